@@ -0,0 +1,240 @@
+package amqpqueue
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type published struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+// fakeSession records acks, nacks and publishes. Closing deliveries
+// simulates a lost connection.
+type fakeSession struct {
+	deliveries chan amqp.Delivery
+
+	mu        sync.Mutex
+	acks      []uint64
+	nacks     map[uint64]bool
+	published []published
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{
+		deliveries: make(chan amqp.Delivery, 10),
+		nacks:      map[uint64]bool{},
+	}
+}
+
+func (s *fakeSession) Consume(string, string) (<-chan amqp.Delivery, error) {
+	return s.deliveries, nil
+}
+
+func (s *fakeSession) Publish(_ context.Context, exchange, key string, msg amqp.Publishing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, published{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+func (s *fakeSession) Close() error { return nil }
+
+func (s *fakeSession) Ack(tag uint64, _ bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acks = append(s.acks, tag)
+	return nil
+}
+
+func (s *fakeSession) Nack(tag uint64, _ bool, requeue bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nacks[tag] = requeue
+	return nil
+}
+
+func (s *fakeSession) Reject(tag uint64, requeue bool) error {
+	return s.Nack(tag, false, requeue)
+}
+
+func (s *fakeSession) deliver(tag uint64, body string, headers amqp.Table) {
+	s.deliveries <- amqp.Delivery{
+		Acknowledger: s,
+		DeliveryTag:  tag,
+		RoutingKey:   "orders.created",
+		Headers:      headers,
+		Body:         []byte(body),
+	}
+}
+
+// newTestQueue returns a queue whose sessions are taken from sessions, in
+// order.
+func newTestQueue(t *testing.T, config AMQPConfigs, sessions ...*fakeSession) goduck.MessagePool {
+	config.URL = "amqp://localhost"
+	config.Queue = "orders"
+	config.ReconnectDelay = time.Millisecond
+
+	var mu sync.Mutex
+	dial := func(AMQPConfigs) (session, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(sessions) == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		s := sessions[0]
+		sessions = sessions[1:]
+		return s, nil
+	}
+
+	q, err := newWithDialer(config, dial)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = q.Close() })
+	return q
+}
+
+func next(t *testing.T, q goduck.MessagePool) goduck.RawMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := q.Next(ctx)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestMessagePool(t *testing.T) {
+	s := newFakeSession()
+	q := newTestQueue(t, AMQPConfigs{}, s)
+	ctx := context.Background()
+
+	s.deliver(1, "a", nil)
+	s.deliver(2, "b", nil)
+
+	a := next(t, q)
+	assert.Equal(t, "a", string(a.Bytes()))
+	require.NoError(t, q.Done(ctx, a))
+
+	b := next(t, q)
+	assert.Equal(t, "b", string(b.Bytes()))
+	require.NoError(t, q.Failed(ctx, b))
+
+	assert.Equal(t, []uint64{1}, s.acks)
+	assert.Equal(t, map[uint64]bool{2: true}, s.nacks)
+
+	assert.ErrorIs(t, q.Done(ctx, nil), ErrInvalidMessage)
+
+	require.NoError(t, q.Close())
+	msg, err := q.Next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessagePool_Reconnect(t *testing.T) {
+	s1, s2 := newFakeSession(), newFakeSession()
+	q := newTestQueue(t, AMQPConfigs{}, s1, s2)
+
+	s1.deliver(1, "a", nil)
+	assert.Equal(t, "a", string(next(t, q).Bytes()))
+
+	// The connection is lost and the consumer reconnects.
+	close(s1.deliveries)
+	s2.deliver(1, "b", nil)
+	b := next(t, q)
+	assert.Equal(t, "b", string(b.Bytes()))
+
+	require.NoError(t, q.Done(context.Background(), b))
+	assert.Empty(t, s1.acks)
+	assert.Equal(t, []uint64{1}, s2.acks)
+}
+
+func TestMessagePool_RequeueNever(t *testing.T) {
+	s := newFakeSession()
+	q := newTestQueue(t, AMQPConfigs{Requeue: RequeueNever}, s)
+
+	s.deliver(1, "a", nil)
+	require.NoError(t, q.Failed(context.Background(), next(t, q)))
+
+	assert.Equal(t, map[uint64]bool{1: false}, s.nacks)
+}
+
+func TestMessagePool_MaxRedeliveries(t *testing.T) {
+	tests := []struct {
+		name              string
+		config            AMQPConfigs
+		headers           amqp.Table
+		expectedPublished []published
+		expectedNacks     map[uint64]bool
+	}{
+		{
+			name:    "Requeue with failures",
+			config:  AMQPConfigs{MaxRedeliveries: 2},
+			headers: amqp.Table{"trace": "x", FailuresHeader: int32(1)},
+			expectedPublished: []published{{
+				key: "orders",
+				msg: amqp.Publishing{Headers: amqp.Table{"trace": "x", FailuresHeader: int64(2)}, Body: []byte("a")},
+			}},
+			expectedNacks: map[uint64]bool{},
+		},
+		{
+			name:    "Dead letter exchange",
+			config:  AMQPConfigs{MaxRedeliveries: 2, DeadLetterExchange: "dlx"},
+			headers: amqp.Table{FailuresHeader: int64(2)},
+			expectedPublished: []published{{
+				exchange: "dlx",
+				key:      "orders.created",
+				msg:      amqp.Publishing{Headers: amqp.Table{FailuresHeader: int64(3)}, Body: []byte("a")},
+			}},
+			expectedNacks: map[uint64]bool{},
+		},
+		{
+			name:    "Dead letter routing key",
+			config:  AMQPConfigs{MaxRedeliveries: 1, DeadLetterExchange: "dlx", DeadLetterRoutingKey: "failed"},
+			headers: amqp.Table{FailuresHeader: int8(1)},
+			expectedPublished: []published{{
+				exchange: "dlx",
+				key:      "failed",
+				msg:      amqp.Publishing{Headers: amqp.Table{FailuresHeader: int64(2)}, Body: []byte("a")},
+			}},
+			expectedNacks: map[uint64]bool{},
+		},
+		{
+			name:          "Dead letter with the queue policy",
+			config:        AMQPConfigs{MaxRedeliveries: 2},
+			headers:       amqp.Table{FailuresHeader: int32(2)},
+			expectedNacks: map[uint64]bool{1: false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newFakeSession()
+			q := newTestQueue(t, test.config, s)
+
+			s.deliver(1, "a", test.headers)
+			require.NoError(t, q.Failed(context.Background(), next(t, q)))
+
+			assert.Equal(t, test.expectedPublished, s.published)
+			assert.Equal(t, test.expectedNacks, s.nacks)
+			if len(test.expectedPublished) > 0 {
+				assert.Equal(t, []uint64{1}, s.acks, "the original is acked after it is published again")
+			}
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(AMQPConfigs{Queue: "orders"})
+	assert.Equal(t, ErrEmptyURL, err)
+
+	_, err = New(AMQPConfigs{URL: "amqp://localhost"})
+	assert.Equal(t, ErrEmptyQueue, err)
+}
@@ -0,0 +1,14 @@
+package amqpqueue
+
+import amqp "github.com/rabbitmq/amqp091-go"
+
+type rawMessage struct {
+	delivery amqp.Delivery
+	// session is the session that received the message. Messages can only
+	// be acked on it.
+	session session
+}
+
+func (r rawMessage) Bytes() []byte {
+	return r.delivery.Body
+}
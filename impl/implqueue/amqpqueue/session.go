@@ -0,0 +1,76 @@
+package amqpqueue
+
+import (
+	"context"
+
+	"github.com/arquivei/foundationkit/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// session is a connection and a channel to the broker.
+type session interface {
+	// Consume starts delivering the messages of the queue. The channel is
+	// closed when the session is lost.
+	Consume(queue, consumerTag string) (<-chan amqp.Delivery, error)
+	// Publish publishes the message and waits for the broker to confirm it.
+	Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error
+	Close() error
+}
+
+type dialFunc func(config AMQPConfigs) (session, error)
+
+type amqpSession struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+// dial connects to the broker and opens a channel in confirm mode with the
+// configured prefetch.
+func dial(config AMQPConfigs) (session, error) {
+	const op = errors.Op("amqpqueue.dial")
+
+	conn, err := amqp.Dial(config.URL)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	channel, err := conn.Channel()
+	if err == nil {
+		err = channel.Qos(config.PrefetchCount, 0, false)
+	}
+	if err == nil {
+		err = channel.Confirm(false)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.E(op, err)
+	}
+
+	return &amqpSession{conn: conn, channel: channel}, nil
+}
+
+func (s *amqpSession) Consume(queue, consumerTag string) (<-chan amqp.Delivery, error) {
+	return s.channel.Consume(queue, consumerTag, false, false, false, false, nil)
+}
+
+func (s *amqpSession) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	const op = errors.Op("amqpqueue.amqpSession.Publish")
+
+	confirmation, err := s.channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if !acked {
+		return errors.E(op, ErrNotConfirmed)
+	}
+	return nil
+}
+
+func (s *amqpSession) Close() error {
+	return s.conn.Close()
+}
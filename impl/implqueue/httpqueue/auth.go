@@ -0,0 +1,106 @@
+package httpqueue
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+	"google.golang.org/api/idtoken"
+)
+
+// Authenticator checks if a request may push messages. Requests are
+// answered with 401 when Authenticate returns an error.
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+// AuthenticatorFunc is a function that implements Authenticator.
+type AuthenticatorFunc func(r *http.Request) error
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// SharedSecret returns an Authenticator that accepts requests with the
+// secret in the "Authorization: Bearer <secret>" header or in the "token"
+// query parameter. The query parameter is useful for pushers that can only
+// be configured with an URL, like Pub/Sub push subscriptions without
+// authentication.
+func SharedSecret(secret string) Authenticator {
+	if secret == "" {
+		panic("shared secret is empty")
+	}
+
+	return AuthenticatorFunc(func(r *http.Request) error {
+		const op = errors.Op("httpqueue.SharedSecret")
+
+		token := bearerToken(r)
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return errors.E(op, ErrUnauthorized)
+		}
+		return nil
+	})
+}
+
+type googleOIDC struct {
+	audience       string
+	serviceAccount string
+	validate       func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+}
+
+// GoogleOIDC returns an Authenticator that accepts requests with an OIDC
+// token signed by Google in the "Authorization: Bearer <token>" header,
+// like the ones sent by Pub/Sub push subscriptions with authentication.
+//
+// The token audience must be audience. If serviceAccount is not empty, the
+// token must belong to that service account email.
+func GoogleOIDC(audience, serviceAccount string) Authenticator {
+	if audience == "" {
+		panic("oidc audience is empty")
+	}
+
+	return &googleOIDC{
+		audience:       audience,
+		serviceAccount: serviceAccount,
+		validate:       idtoken.Validate,
+	}
+}
+
+func (a *googleOIDC) Authenticate(r *http.Request) error {
+	const op = errors.Op("httpqueue.googleOIDC.Authenticate")
+
+	token := bearerToken(r)
+	if token == "" {
+		return errors.E(op, ErrUnauthorized, errors.KV("cause", "missing bearer token"))
+	}
+
+	payload, err := a.validate(r.Context(), token, a.audience)
+	if err != nil {
+		return errors.E(op, ErrUnauthorized, errors.KV("cause", err))
+	}
+
+	if a.serviceAccount != "" {
+		email, _ := payload.Claims["email"].(string)
+		verified, _ := payload.Claims["email_verified"].(bool)
+		if email != a.serviceAccount || !verified {
+			return errors.E(op, ErrUnauthorized, errors.KV("email", email))
+		}
+	}
+	return nil
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+
+	header := r.Header.Get("Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return header[len(prefix):]
+}
@@ -0,0 +1,98 @@
+package httpqueue
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/idtoken"
+)
+
+func TestSharedSecret(t *testing.T) {
+	auth := SharedSecret("s3cret")
+
+	tests := []struct {
+		name        string
+		target      string
+		header      string
+		expectedErr error
+	}{
+		{name: "Success: header", target: "/", header: "Bearer s3cret"},
+		{name: "Success: query", target: "/?token=s3cret"},
+		{name: "Error: wrong secret", target: "/?token=other", expectedErr: ErrUnauthorized},
+		{name: "Error: wrong scheme", target: "/", header: "Basic s3cret", expectedErr: ErrUnauthorized},
+		{name: "Error: missing secret", target: "/", expectedErr: ErrUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, test.target, nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			err := auth.Authenticate(r)
+			if test.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestGoogleOIDC(t *testing.T) {
+	auth := GoogleOIDC("https://example.com/push", "pusher@project.iam.gserviceaccount.com").(*googleOIDC)
+	auth.validate = func(_ context.Context, token, audience string) (*idtoken.Payload, error) {
+		if audience != "https://example.com/push" {
+			return nil, errors.New("wrong audience")
+		}
+		switch token {
+		case "valid":
+			return &idtoken.Payload{Claims: map[string]interface{}{
+				"email":          "pusher@project.iam.gserviceaccount.com",
+				"email_verified": true,
+			}}, nil
+		case "other-account":
+			return &idtoken.Payload{Claims: map[string]interface{}{
+				"email":          "other@project.iam.gserviceaccount.com",
+				"email_verified": true,
+			}}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+
+	tests := []struct {
+		name        string
+		header      string
+		expectedErr error
+	}{
+		{name: "Success", header: "Bearer valid"},
+		{name: "Error: invalid token", header: "Bearer invalid", expectedErr: ErrUnauthorized},
+		{name: "Error: other service account", header: "Bearer other-account", expectedErr: ErrUnauthorized},
+		{name: "Error: missing token", expectedErr: ErrUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			err := auth.Authenticate(r)
+			if test.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestMessagePool_Unauthorized(t *testing.T) {
+	_, url := newTestQueue(t, Config{Authenticator: SharedSecret("s3cret")})
+
+	assert.Equal(t, http.StatusUnauthorized, <-post(context.Background(), url, "a"))
+}
@@ -0,0 +1,53 @@
+package httpqueue
+
+import "sync"
+
+type rawMessage struct {
+	data []byte
+
+	mu sync.Mutex
+	// status is the response status. It is zero until the message is
+	// answered.
+	status int
+	// gone is true when the request ended before the message was answered.
+	gone bool
+	// answered is closed when the message is answered by Done or Failed.
+	answered chan struct{}
+}
+
+func newRawMessage(data []byte) *rawMessage {
+	return &rawMessage{data: data, answered: make(chan struct{})}
+}
+
+func (r *rawMessage) Bytes() []byte {
+	return r.data
+}
+
+// answer sets the response status.
+func (r *rawMessage) answer(status int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gone {
+		return ErrRequestGone
+	}
+	if r.status != 0 {
+		return ErrInvalidMessage
+	}
+	r.status = status
+	close(r.answered)
+	return nil
+}
+
+// abandon returns the response status. If the message wasn't answered, it
+// is answered with status and can't be answered anymore.
+func (r *rawMessage) abandon(status int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == 0 {
+		r.status = status
+		r.gone = true
+	}
+	return r.status
+}
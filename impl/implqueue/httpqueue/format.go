@@ -0,0 +1,85 @@
+package httpqueue
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// Format is the format of the request bodies.
+type Format int
+
+const (
+	// FormatRaw uses the request body as the message. It is the default.
+	FormatRaw Format = iota
+	// FormatPubSub decodes the Pub/Sub push envelope. The message is the
+	// PubSubMessage encoded as JSON, so the processor can read the
+	// attributes.
+	FormatPubSub
+	// FormatPubSubData decodes the Pub/Sub push envelope. The message is
+	// only the Pub/Sub message data.
+	FormatPubSubData
+)
+
+// PubSubMessage is a message received from a Pub/Sub push subscription.
+type PubSubMessage struct {
+	ID          string            `json:"id"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	PublishTime time.Time         `json:"publish_time"`
+	OrderingKey string            `json:"ordering_key,omitempty"`
+	// Subscription is the full name of the push subscription, like
+	// projects/my-project/subscriptions/my-subscription.
+	Subscription string `json:"subscription"`
+	// DeliveryAttempt is only set when the subscription has a dead letter
+	// policy.
+	DeliveryAttempt int `json:"delivery_attempt,omitempty"`
+}
+
+// pushEnvelope is the body of the Pub/Sub push requests.
+type pushEnvelope struct {
+	Message struct {
+		Data        []byte            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+		OrderingKey string            `json:"orderingKey"`
+	} `json:"message"`
+	Subscription    string `json:"subscription"`
+	DeliveryAttempt int    `json:"deliveryAttempt"`
+}
+
+func (f Format) decode(body []byte) ([]byte, error) {
+	const op = errors.Op("httpqueue.Format.decode")
+
+	if f == FormatRaw {
+		return body, nil
+	}
+
+	var envelope pushEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, errors.E(op, ErrInvalidPushMessage, errors.KV("cause", err))
+	}
+	if envelope.Message.MessageID == "" {
+		return nil, errors.E(op, ErrInvalidPushMessage, errors.KV("cause", "missing message id"))
+	}
+
+	if f == FormatPubSubData {
+		return envelope.Message.Data, nil
+	}
+
+	data, err := json.Marshal(PubSubMessage{
+		ID:              envelope.Message.MessageID,
+		Data:            envelope.Message.Data,
+		Attributes:      envelope.Message.Attributes,
+		PublishTime:     envelope.Message.PublishTime,
+		OrderingKey:     envelope.Message.OrderingKey,
+		Subscription:    envelope.Subscription,
+		DeliveryAttempt: envelope.DeliveryAttempt,
+	})
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,265 @@
+package httpqueue
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultMaxInFlight = 100
+	defaultMaxBodySize = 10 << 20
+
+	// doneStatus is the response of Done.
+	doneStatus = http.StatusNoContent
+	// failedStatus is the response of Failed.
+	failedStatus = http.StatusInternalServerError
+	// closedStatus is the response of the requests not answered when the
+	// pool is closed.
+	closedStatus = http.StatusServiceUnavailable
+)
+
+var (
+	// ErrInvalidMessage is returned when Done or Failed receives a message
+	// that wasn't returned by Next, or was already answered.
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrRequestGone is returned by Done and Failed when the request ended
+	// before the message was answered, because the client gave up or the
+	// pool was closed. The pusher is expected to deliver it again.
+	ErrRequestGone = errors.New("request gone before the message was answered")
+	// ErrUnauthorized is returned by the Authenticators when the request
+	// is not allowed.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrInvalidPushMessage is returned when the request body is not a
+	// Pub/Sub push message.
+	ErrInvalidPushMessage = errors.New("invalid pub/sub push message")
+)
+
+// Config contains the configs for receiving messages over HTTP.
+type Config struct {
+	// Addr is the address of the server started by New, like ":8080". If
+	// empty, no server is started, and the MessagePool must be registered
+	// as the handler of an existing server.
+	Addr string
+	// Format is the format of the request bodies. Default: FormatRaw.
+	Format Format
+	// Authenticator checks the requests. Default: no authentication.
+	Authenticator Authenticator
+	// MaxInFlight is how many requests are handled at once. The requests
+	// over the limit are answered with 429, so the pusher backs off.
+	// Default: 100.
+	MaxInFlight int
+	// MaxBodySize is the maximum size of the request bodies, in bytes.
+	// Larger requests are answered with 413. Default: 10MiB.
+	MaxBodySize int64
+}
+
+// MessagePool is a goduck.MessagePool whose messages are pushed by HTTP
+// requests. It is the http.Handler of the requests.
+type MessagePool interface {
+	goduck.MessagePool
+	http.Handler
+	// Addr is the address of the server started by New, or nil if no
+	// server was started.
+	Addr() net.Addr
+}
+
+type httpQueue struct {
+	config Config
+
+	messages chan *rawMessage
+	// inFlight limits the requests handled at once.
+	inFlight chan struct{}
+
+	server   *http.Server
+	listener net.Listener
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a MessagePool that turns each POST request into a message.
+// The request is held open until the message is Done, answered with 204,
+// or Failed, answered with 500, so the pusher delivers it again. This
+// makes it suitable for Pub/Sub push subscriptions and webhooks.
+//
+// Requests are answered right away with 401 when the Authenticator rejects
+// them, 429 when there are MaxInFlight requests being handled, and 400
+// when they can't be decoded. When the pool is closed, the requests still
+// waiting are answered with 503.
+//
+// If Config.Addr is set, New starts a server on it, which is shut down by
+// Close.
+func New(config Config) (MessagePool, error) {
+	const op = errors.Op("httpqueue.New")
+
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = defaultMaxInFlight
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaultMaxBodySize
+	}
+
+	q := &httpQueue{
+		config:   config,
+		messages: make(chan *rawMessage),
+		inFlight: make(chan struct{}, config.MaxInFlight),
+		closed:   make(chan struct{}),
+	}
+
+	if config.Addr != "" {
+		listener, err := net.Listen("tcp", config.Addr)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		q.listener = listener
+		q.server = &http.Server{Handler: q}
+		go func() {
+			if err := q.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Error().Err(err).Str("addr", config.Addr).Msg("http queue server stopped")
+			}
+		}()
+	}
+
+	return q, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(config Config) MessagePool {
+	q, err := New(config)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *httpQueue) Addr() net.Addr {
+	if q.listener == nil {
+		return nil
+	}
+	return q.listener.Addr()
+}
+
+func (q *httpQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeStatus(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if q.config.Authenticator != nil {
+		if err := q.config.Authenticator.Authenticate(r); err != nil {
+			log.Debug().Err(err).Str("remote_addr", r.RemoteAddr).Msg("http queue request unauthorized")
+			writeStatus(w, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	select {
+	case q.inFlight <- struct{}{}:
+		defer func() { <-q.inFlight }()
+	default:
+		writeStatus(w, http.StatusTooManyRequests)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, q.config.MaxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if stderrors.As(err, &maxBytesErr) {
+			writeStatus(w, http.StatusRequestEntityTooLarge)
+		} else {
+			writeStatus(w, http.StatusBadRequest)
+		}
+		return
+	}
+
+	data, err := q.config.Format.decode(body)
+	if err != nil {
+		log.Debug().Err(err).Str("remote_addr", r.RemoteAddr).Msg("http queue request discarded")
+		writeStatus(w, http.StatusBadRequest)
+		return
+	}
+
+	msg := newRawMessage(data)
+	select {
+	case q.messages <- msg:
+	case <-r.Context().Done():
+		return
+	case <-q.closed:
+		writeStatus(w, closedStatus)
+		return
+	}
+
+	select {
+	case <-msg.answered:
+	case <-r.Context().Done():
+	case <-q.closed:
+	}
+	writeStatus(w, msg.abandon(closedStatus))
+}
+
+func writeStatus(w http.ResponseWriter, status int) {
+	if status == doneStatus {
+		w.WriteHeader(status)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (q *httpQueue) Next(ctx context.Context) (goduck.RawMessage, error) {
+	select {
+	case msg := <-q.messages:
+		return msg, nil
+	case <-q.closed:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+// Done answers the request of the message with 204.
+func (q *httpQueue) Done(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("httpqueue.httpQueue.Done")
+	return q.answer(op, msg, doneStatus)
+}
+
+// Failed answers the request of the message with 500, so the pusher
+// delivers it again.
+func (q *httpQueue) Failed(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("httpqueue.httpQueue.Failed")
+	return q.answer(op, msg, failedStatus)
+}
+
+func (q *httpQueue) answer(op errors.Op, msg goduck.RawMessage, status int) error {
+	casted, ok := msg.(*rawMessage)
+	if !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+	if err := casted.answer(status); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// Close stops receiving messages. The requests not answered yet are
+// answered with 503, and the server started by New is shut down.
+func (q *httpQueue) Close() error {
+	const op = errors.Op("httpqueue.httpQueue.Close")
+
+	q.closeOnce.Do(func() { close(q.closed) })
+
+	if q.server != nil {
+		if err := q.server.Shutdown(context.Background()); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package httpqueue
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pushBody = `{
+	"message": {
+		"attributes": {"type": "created"},
+		"data": "eyJpZCI6MX0=",
+		"messageId": "136969346945",
+		"publishTime": "2026-10-02T15:01:23.045Z"
+	},
+	"subscription": "projects/my-project/subscriptions/my-subscription",
+	"deliveryAttempt": 2
+}`
+
+func newTestQueue(t *testing.T, config Config) (MessagePool, string) {
+	q, err := New(config)
+	require.NoError(t, err)
+	server := httptest.NewServer(q)
+	t.Cleanup(func() {
+		_ = q.Close()
+		server.Close()
+	})
+	return q, server.URL
+}
+
+// post sends the request in background and returns the response status.
+func post(ctx context.Context, url, body string) <-chan int {
+	status := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	return status
+}
+
+func next(t *testing.T, q goduck.MessagePool) goduck.RawMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := q.Next(ctx)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestMessagePool(t *testing.T) {
+	q, url := newTestQueue(t, Config{})
+	ctx := context.Background()
+
+	status := post(ctx, url, "a")
+	a := next(t, q)
+	assert.Equal(t, "a", string(a.Bytes()))
+	require.NoError(t, q.Done(ctx, a))
+	assert.Equal(t, http.StatusNoContent, <-status)
+	assert.ErrorIs(t, q.Done(ctx, a), ErrInvalidMessage)
+
+	status = post(ctx, url, "b")
+	b := next(t, q)
+	require.NoError(t, q.Failed(ctx, b))
+	assert.Equal(t, http.StatusInternalServerError, <-status)
+
+	assert.ErrorIs(t, q.Done(ctx, nil), ErrInvalidMessage)
+
+	require.NoError(t, q.Close())
+	msg, err := q.Next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessagePool_PubSub(t *testing.T) {
+	t.Run("Envelope", func(t *testing.T) {
+		q, url := newTestQueue(t, Config{Format: FormatPubSub})
+		status := post(context.Background(), url, pushBody)
+
+		msg := next(t, q)
+		var pubsubMessage PubSubMessage
+		require.NoError(t, json.Unmarshal(msg.Bytes(), &pubsubMessage))
+		assert.Equal(t, PubSubMessage{
+			ID:              "136969346945",
+			Data:            []byte(`{"id":1}`),
+			Attributes:      map[string]string{"type": "created"},
+			PublishTime:     time.Date(2026, 10, 2, 15, 1, 23, 45000000, time.UTC),
+			Subscription:    "projects/my-project/subscriptions/my-subscription",
+			DeliveryAttempt: 2,
+		}, pubsubMessage)
+
+		require.NoError(t, q.Done(context.Background(), msg))
+		assert.Equal(t, http.StatusNoContent, <-status)
+	})
+
+	t.Run("Data", func(t *testing.T) {
+		q, url := newTestQueue(t, Config{Format: FormatPubSubData})
+		post(context.Background(), url, pushBody)
+		assert.Equal(t, `{"id":1}`, string(next(t, q).Bytes()))
+	})
+
+	t.Run("Error: invalid envelope", func(t *testing.T) {
+		_, url := newTestQueue(t, Config{Format: FormatPubSub})
+		assert.Equal(t, http.StatusBadRequest, <-post(context.Background(), url, `{"message": {}}`))
+		assert.Equal(t, http.StatusBadRequest, <-post(context.Background(), url, `not json`))
+	})
+}
+
+func TestMessagePool_Limits(t *testing.T) {
+	q, url := newTestQueue(t, Config{MaxInFlight: 1, MaxBodySize: 3})
+	ctx := context.Background()
+
+	status := post(ctx, url, "a")
+	a := next(t, q)
+
+	// The first request is still in flight.
+	assert.Equal(t, http.StatusTooManyRequests, <-post(ctx, url, "b"))
+
+	require.NoError(t, q.Done(ctx, a))
+	assert.Equal(t, http.StatusNoContent, <-status)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, <-post(ctx, url, "abcd"))
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestMessagePool_RequestGone(t *testing.T) {
+	q, url := newTestQueue(t, Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := post(ctx, url, "a")
+	a := next(t, q)
+	cancel()
+	assert.Equal(t, 0, <-status)
+
+	// Waits for the handler to see the request is gone.
+	assert.Eventually(t, func() bool {
+		raw := a.(*rawMessage)
+		raw.mu.Lock()
+		defer raw.mu.Unlock()
+		return raw.gone
+	}, time.Second, 5*time.Millisecond)
+	assert.ErrorIs(t, q.Done(context.Background(), a), ErrRequestGone)
+}
+
+func TestMessagePool_Server(t *testing.T) {
+	q, err := New(Config{Addr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	url := "http://" + q.Addr().String()
+
+	status := post(context.Background(), url, "a")
+	a := next(t, q)
+
+	// The requests not answered are answered with 503 on Close.
+	require.NoError(t, q.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, <-status)
+	assert.ErrorIs(t, q.Done(context.Background(), a), ErrRequestGone)
+
+	_, err = http.Post(url, "text/plain", strings.NewReader("b"))
+	assert.Error(t, err)
+}
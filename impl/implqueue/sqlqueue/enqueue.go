@@ -0,0 +1,67 @@
+package sqlqueue
+
+import (
+	"context"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// maxJobsPerStatement keeps the insert statements under the Postgres limit
+// of 65535 arguments.
+const maxJobsPerStatement = 1000
+
+// Job is a job to be enqueued.
+type Job struct {
+	// Queue is the queue of the job.
+	Queue string
+	// Payload is returned by the message Bytes.
+	Payload []byte
+	// RunAt is when the job becomes ready to run. Default: now.
+	RunAt time.Time
+}
+
+// Enqueue inserts the jobs into table. If table is empty, DefaultTable is
+// used.
+//
+// Passing a *sql.Tx enqueues the jobs in the same transaction of other
+// changes, so they are only run if the transaction commits. This is the
+// transactional outbox pattern.
+func Enqueue(ctx context.Context, db Execer, table string, jobs ...Job) error {
+	const op = errors.Op("sqlqueue.Enqueue")
+
+	if table == "" {
+		table = DefaultTable
+	}
+	for _, job := range jobs {
+		if job.Queue == "" {
+			return errors.E(op, ErrEmptyQueue, errors.SeverityInput)
+		}
+	}
+
+	q := newQueries(table)
+	for start := 0; start < len(jobs); start += maxJobsPerStatement {
+		end := start + maxJobsPerStatement
+		if end > len(jobs) {
+			end = len(jobs)
+		}
+
+		args := make([]interface{}, 0, 3*(end-start))
+		for _, job := range jobs[start:end] {
+			var runAt interface{}
+			if !job.RunAt.IsZero() {
+				runAt = job.RunAt
+			}
+			payload := job.Payload
+			if payload == nil {
+				payload = []byte{}
+			}
+			args = append(args, job.Queue, payload, runAt)
+		}
+
+		if _, err := db.ExecContext(ctx, q.insertQuery(end-start), args...); err != nil {
+			return errors.E(op, err, errors.SeverityRuntime, errors.KV("table", table))
+		}
+	}
+	return nil
+}
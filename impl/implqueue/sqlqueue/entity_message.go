@@ -0,0 +1,13 @@
+package sqlqueue
+
+type rawMessage struct {
+	id      int64
+	payload []byte
+	// attempts is the lease token. It changes every time the job is
+	// claimed.
+	attempts int
+}
+
+func (r *rawMessage) Bytes() []byte {
+	return r.payload
+}
@@ -0,0 +1,163 @@
+package sqlqueue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// DefaultTable is the jobs table used when Config.Table is empty.
+const DefaultTable = "goduck_jobs"
+
+// Execer runs statements. It is implemented by *sql.DB, *sql.Conn and
+// *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Migrate creates the jobs table, its dead table and their indexes if they
+// don't exist. The dead table has the same name with the "_dead" suffix.
+// The table may be qualified, like schema.table, but the schema must
+// exist.
+func Migrate(ctx context.Context, db Execer, table string) error {
+	const op = errors.Op("sqlqueue.Migrate")
+
+	if table == "" {
+		table = DefaultTable
+	}
+
+	for _, stmt := range newQueries(table).migrations() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return errors.E(op, err, errors.KV("table", table))
+		}
+	}
+	return nil
+}
+
+// queries are the statements of a jobs table. All of them take the
+// time from the database, so the leases don't depend on the clocks of the
+// workers.
+type queries struct {
+	table     string
+	deadTable string
+	indexName string
+
+	claim       string
+	deadExpired string
+	extend      string
+	delete      string
+	retry       string
+	deadLetter  string
+}
+
+func newQueries(table string) queries {
+	name := table[strings.LastIndex(table, ".")+1:]
+	q := queries{
+		table:     quoteIdentifier(table),
+		deadTable: quoteIdentifier(table + "_dead"),
+		indexName: quoteIdentifier(name + "_ready_idx"),
+	}
+
+	// claim leases the next job of the queue that is ready to run. Jobs
+	// leased by other workers are skipped instead of waited for.
+	q.claim = fmt.Sprintf(`UPDATE %[1]s SET attempts = attempts + 1, locked_until = now() + make_interval(secs => $2)
+WHERE id = (
+	SELECT id FROM %[1]s
+	WHERE queue = $1 AND run_at <= now() AND (locked_until IS NULL OR locked_until <= now()) AND attempts < $3
+	ORDER BY run_at, id
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, payload, attempts`, q.table)
+
+	// deadExpired moves the jobs whose last attempt lease expired, because
+	// the worker died, to the dead table.
+	q.deadExpired = fmt.Sprintf(`WITH moved AS (
+	DELETE FROM %[1]s WHERE id IN (
+		SELECT id FROM %[1]s
+		WHERE queue = $1 AND attempts >= $2 AND locked_until <= now()
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, queue, payload, attempts, created_at
+)
+INSERT INTO %[2]s (id, queue, payload, attempts, created_at)
+SELECT id, queue, payload, attempts, created_at FROM moved`, q.table, q.deadTable)
+
+	// The statements below only change the job if the lease is still
+	// held. The attempts are the lease token, because they change every
+	// time the job is claimed.
+	q.extend = fmt.Sprintf(`UPDATE %s SET locked_until = now() + make_interval(secs => $1) WHERE (id, attempts) IN (%%s)`, q.table)
+
+	q.delete = fmt.Sprintf(`DELETE FROM %s WHERE id = $1 AND attempts = $2`, q.table)
+
+	q.retry = fmt.Sprintf(`UPDATE %s SET locked_until = NULL, run_at = now() + make_interval(secs => $3) WHERE id = $1 AND attempts = $2`, q.table)
+
+	q.deadLetter = fmt.Sprintf(`WITH moved AS (
+	DELETE FROM %[1]s WHERE id = $1 AND attempts = $2
+	RETURNING id, queue, payload, attempts, created_at
+)
+INSERT INTO %[2]s (id, queue, payload, attempts, created_at)
+SELECT id, queue, payload, attempts, created_at FROM moved`, q.table, q.deadTable)
+
+	return q
+}
+
+// extendQuery returns the extend statement for n jobs. The arguments are
+// the lease duration, in seconds, followed by the id and attempts of each
+// job.
+func (q queries) extendQuery(n int) string {
+	pairs := make([]string, n)
+	for i := range pairs {
+		pairs[i] = fmt.Sprintf("($%d, $%d)", 2*i+2, 2*i+3)
+	}
+	return fmt.Sprintf(q.extend, strings.Join(pairs, ", "))
+}
+
+// insertQuery returns a statement that enqueues n jobs. The arguments are
+// the queue, payload and run at of each job.
+func (q queries) insertQuery(n int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT INTO %s (queue, payload, run_at) VALUES ", q.table)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "($%d, $%d, COALESCE($%d::timestamptz, now()))", 3*i+1, 3*i+2, 3*i+3)
+	}
+	return sb.String()
+}
+
+func (q queries) migrations() []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	queue TEXT NOT NULL,
+	payload BYTEA NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	locked_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, q.table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (queue, run_at, id)`, q.indexName, q.table),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGINT PRIMARY KEY,
+	queue TEXT NOT NULL,
+	payload BYTEA NOT NULL,
+	attempts INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	dead_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, q.deadTable),
+	}
+}
+
+// quoteIdentifier quotes each part of a qualified identifier.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
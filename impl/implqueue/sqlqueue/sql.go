@@ -0,0 +1,372 @@
+package sqlqueue
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultPollInterval      = time.Second
+	defaultMaxAttempts       = 5
+	defaultRetryBackoff      = 10 * time.Second
+	defaultMaxRetryBackoff   = time.Hour
+	// errorBackoff is how long Next waits after a failed claim. The engines
+	// call Next again right away, so this keeps them from hammering the
+	// database.
+	errorBackoff = time.Second
+	// maxJobsPerExtend limits how many leases are extended by a single
+	// statement.
+	maxJobsPerExtend = 500
+)
+
+var (
+	// ErrNilDB is returned when the db is nil.
+	ErrNilDB = errors.New("bad config: nil db")
+	// ErrEmptyQueue is returned when the queue is missing from the configs
+	// or from a Job.
+	ErrEmptyQueue = errors.New("bad config: empty queue")
+	// ErrInvalidMessage is returned when Done or Failed receives a message
+	// that wasn't returned by Next, or was already marked.
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrLeaseLost is returned by Done and Failed when the lease of the job
+	// expired and the job was claimed again or moved to the dead table.
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
+// Config contains the configs for consuming a jobs table.
+type Config struct {
+	// Table is the jobs table, created by Migrate. Default: DefaultTable.
+	Table string
+	// Queue is the queue of the jobs to run.
+	Queue string
+
+	// VisibilityTimeout is the lease duration of a claimed job. Other
+	// workers can claim the job after it expires. It is extended in the
+	// background while the job is processed. Default: 30s.
+	VisibilityTimeout time.Duration
+	// HeartbeatInterval is how often the leases are extended. Default: a
+	// third of VisibilityTimeout.
+	HeartbeatInterval time.Duration
+	// PollInterval is how long Next waits before looking for jobs again
+	// when there are none ready. Default: 1s.
+	PollInterval time.Duration
+
+	// MaxAttempts is how many times a job is claimed before it is moved to
+	// the dead table. Default: 5.
+	MaxAttempts int
+	// RetryBackoff is how long a job waits to run again after its first
+	// failed attempt. It doubles with every attempt, up to MaxRetryBackoff.
+	// Default: 10s.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff limits RetryBackoff. Default: 1h.
+	MaxRetryBackoff time.Duration
+}
+
+type sqlQueue struct {
+	db      *sql.DB
+	config  Config
+	queries queries
+
+	mu sync.Mutex
+	// inFlight are the jobs returned by Next but not Done or Failed.
+	inFlight map[*rawMessage]struct{}
+
+	ctx      context.Context
+	cancelFn func()
+	wg       sync.WaitGroup
+}
+
+// New creates a goduck.MessagePool that runs the jobs of a Postgres table.
+// The table is created by Migrate, and jobs are added by Enqueue.
+//
+// Next claims one job at a time with SELECT ... FOR UPDATE SKIP LOCKED, so
+// many workers can share the queue without blocking each other. A claimed
+// job is leased for the VisibilityTimeout, and the lease is extended while
+// the job is processed. If the worker dies, the job is claimed again when
+// the lease expires.
+//
+// Done deletes the job. Failed schedules the job to run again after the
+// RetryBackoff, or moves it to the dead table after MaxAttempts.
+//
+// The db must use a Postgres driver, like pgx or lib/pq.
+func New(db *sql.DB, config Config) (goduck.MessagePool, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	if config.Queue == "" {
+		return nil, ErrEmptyQueue
+	}
+	if config.Table == "" {
+		config.Table = DefaultTable
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = config.VisibilityTimeout / 3
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.MaxRetryBackoff <= 0 {
+		config.MaxRetryBackoff = defaultMaxRetryBackoff
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	q := &sqlQueue{
+		db:       db,
+		config:   config,
+		queries:  newQueries(config.Table),
+		inFlight: make(map[*rawMessage]struct{}),
+		ctx:      ctx,
+		cancelFn: cancelFn,
+	}
+
+	q.wg.Add(1)
+	go q.heartbeat()
+
+	return q, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(db *sql.DB, config Config) goduck.MessagePool {
+	q, err := New(db, config)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *sqlQueue) Next(ctx context.Context) (goduck.RawMessage, error) {
+	const op = errors.Op("sqlqueue.sqlQueue.Next")
+
+	// Close interrupts the wait for jobs.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(q.ctx, cancel)
+	defer stop()
+
+	for {
+		if ctx.Err() != nil || q.ctx.Err() != nil {
+			return nil, io.EOF
+		}
+
+		msg, err := q.claim(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, io.EOF
+			}
+			log.Error().Err(err).Str("queue", q.config.Queue).Msg("failed to claim sql job")
+			wait(ctx, errorBackoff)
+			return nil, errors.E(op, err)
+		}
+		if msg != nil {
+			q.mu.Lock()
+			q.inFlight[msg] = struct{}{}
+			q.mu.Unlock()
+			return msg, nil
+		}
+
+		// The queue is idle, so it is a good time to clean it up.
+		if err := q.deadExpired(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("queue", q.config.Queue).Msg("failed to move expired sql jobs to the dead table")
+		}
+		wait(ctx, q.config.PollInterval)
+	}
+}
+
+// claim leases the next job ready to run. It returns nil if there is none.
+func (q *sqlQueue) claim(ctx context.Context) (*rawMessage, error) {
+	const op = errors.Op("sqlqueue.sqlQueue.claim")
+
+	msg := &rawMessage{}
+	err := q.db.QueryRowContext(ctx, q.queries.claim,
+		q.config.Queue,
+		q.config.VisibilityTimeout.Seconds(),
+		q.config.MaxAttempts,
+	).Scan(&msg.id, &msg.payload, &msg.attempts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return msg, nil
+}
+
+// deadExpired moves the jobs that reached MaxAttempts and whose lease
+// expired to the dead table. They can't be claimed again, and Failed is
+// never called for them.
+func (q *sqlQueue) deadExpired(ctx context.Context) error {
+	const op = errors.Op("sqlqueue.sqlQueue.deadExpired")
+
+	if _, err := q.db.ExecContext(ctx, q.queries.deadExpired, q.config.Queue, q.config.MaxAttempts); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// heartbeat extends the leases of the jobs in flight until the queue is
+// closed.
+func (q *sqlQueue) heartbeat() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.ctx.Done():
+			return
+		}
+
+		q.mu.Lock()
+		messages := make([]*rawMessage, 0, len(q.inFlight))
+		for msg := range q.inFlight {
+			messages = append(messages, msg)
+		}
+		q.mu.Unlock()
+
+		if err := q.extend(q.ctx, messages); err != nil && q.ctx.Err() == nil {
+			log.Warn().Err(err).Str("queue", q.config.Queue).Msg("failed to extend sql job leases")
+		}
+	}
+}
+
+// extend extends the leases of the messages.
+func (q *sqlQueue) extend(ctx context.Context, messages []*rawMessage) error {
+	const op = errors.Op("sqlqueue.sqlQueue.extend")
+
+	for start := 0; start < len(messages); start += maxJobsPerExtend {
+		end := start + maxJobsPerExtend
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		args := make([]interface{}, 0, 1+2*(end-start))
+		args = append(args, q.config.VisibilityTimeout.Seconds())
+		for _, msg := range messages[start:end] {
+			args = append(args, msg.id, msg.attempts)
+		}
+
+		if _, err := q.db.ExecContext(ctx, q.queries.extendQuery(end-start), args...); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+// finish removes the message from the jobs in flight. It returns false if
+// the message is not in flight.
+func (q *sqlQueue) finish(msg goduck.RawMessage) (*rawMessage, bool) {
+	casted, ok := msg.(*rawMessage)
+	if !ok {
+		return nil, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.inFlight[casted]; !ok {
+		return nil, false
+	}
+	delete(q.inFlight, casted)
+	return casted, true
+}
+
+// Done deletes the job.
+func (q *sqlQueue) Done(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("sqlqueue.sqlQueue.Done")
+
+	casted, ok := q.finish(msg)
+	if !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+
+	if err := q.exec(ctx, q.queries.delete, casted.id, casted.attempts); err != nil {
+		return errors.E(op, err, errors.KV("job_id", casted.id))
+	}
+	return nil
+}
+
+// Failed schedules the job to run again after the backoff. If the job
+// reached MaxAttempts, it is moved to the dead table instead.
+func (q *sqlQueue) Failed(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("sqlqueue.sqlQueue.Failed")
+
+	casted, ok := q.finish(msg)
+	if !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+
+	var err error
+	if casted.attempts >= q.config.MaxAttempts {
+		err = q.exec(ctx, q.queries.deadLetter, casted.id, casted.attempts)
+	} else {
+		err = q.exec(ctx, q.queries.retry, casted.id, casted.attempts, q.backoff(casted.attempts).Seconds())
+	}
+	if err != nil {
+		return errors.E(op, err, errors.KV("job_id", casted.id))
+	}
+	return nil
+}
+
+// exec runs a statement that changes a single job, if its lease is still
+// held.
+func (q *sqlQueue) exec(ctx context.Context, query string, args ...interface{}) error {
+	result, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *sqlQueue) backoff(attempts int) time.Duration {
+	backoff := q.config.RetryBackoff
+	for i := 1; i < attempts && backoff < q.config.MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.config.MaxRetryBackoff {
+		backoff = q.config.MaxRetryBackoff
+	}
+	return backoff
+}
+
+// Close stops claiming jobs and extending their leases. Jobs in flight can
+// still be Done or Failed. The db is not closed.
+func (q *sqlQueue) Close() error {
+	q.cancelFn()
+	q.wg.Wait()
+	return nil
+}
+
+func wait(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,210 @@
+package sqlqueue
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, mock.ExpectationsWereMet())
+		_ = db.Close()
+	})
+	return db, mock
+}
+
+func newTestQueue(t *testing.T, db *sql.DB, config Config) goduck.MessagePool {
+	config.Queue = "emails"
+	q, err := New(db, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = q.Close() })
+	return q
+}
+
+func expectClaim(mock sqlmock.Sqlmock, id int64, payload string, attempts int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE "goduck_jobs" SET attempts = attempts + 1`)).
+		WithArgs("emails", float64(30), 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload", "attempts"}).AddRow(id, []byte(payload), attempts))
+}
+
+func TestMessagePool(t *testing.T) {
+	db, mock := newTestDB(t)
+	q := newTestQueue(t, db, Config{})
+	ctx := context.Background()
+
+	expectClaim(mock, 1, "a", 1)
+	a, err := q.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(a.Bytes()))
+
+	expectClaim(mock, 2, "b", 2)
+	b, err := q.Next(ctx)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "goduck_jobs" WHERE id = $1 AND attempts = $2`)).
+		WithArgs(int64(1), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, q.Done(ctx, a))
+	assert.ErrorIs(t, q.Done(ctx, a), ErrInvalidMessage)
+
+	// The second attempt waits twice the retry backoff.
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "goduck_jobs" SET locked_until = NULL, run_at = now() + make_interval(secs => $3)`)).
+		WithArgs(int64(2), 2, float64(20)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, q.Failed(ctx, b))
+
+	require.NoError(t, q.Close())
+	msg, err := q.Next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessagePool_DeadLetter(t *testing.T) {
+	db, mock := newTestDB(t)
+	q := newTestQueue(t, db, Config{})
+	ctx := context.Background()
+
+	expectClaim(mock, 1, "a", 5)
+	a, err := q.Next(ctx)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "goduck_jobs_dead"`)).
+		WithArgs(int64(1), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, q.Failed(ctx, a))
+}
+
+func TestMessagePool_LeaseLost(t *testing.T) {
+	db, mock := newTestDB(t)
+	q := newTestQueue(t, db, Config{})
+	ctx := context.Background()
+
+	expectClaim(mock, 1, "a", 1)
+	a, err := q.Next(ctx)
+	require.NoError(t, err)
+
+	// Another worker claimed the job after the lease expired.
+	mock.ExpectExec(`DELETE FROM "goduck_jobs"`).
+		WithArgs(int64(1), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = q.Done(ctx, a)
+	assert.ErrorIs(t, err, ErrLeaseLost)
+	assert.Equal(t, int64(1), getKV(err, "job_id"))
+}
+
+func TestMessagePool_Idle(t *testing.T) {
+	db, mock := newTestDB(t)
+	q := newTestQueue(t, db, Config{PollInterval: 10 * time.Millisecond})
+
+	// When there are no jobs ready, the expired jobs on their last attempt
+	// are moved to the dead table and Next polls again.
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`UPDATE "goduck_jobs"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "payload", "attempts"}))
+		mock.ExpectExec(regexp.QuoteMeta(`WHERE queue = $1 AND attempts >= $2 AND locked_until <= now()`)).
+			WithArgs("emails", 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectClaim(mock, 1, "a", 1)
+
+	msg, err := q.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Bytes()))
+}
+
+func TestMessagePool_Heartbeat(t *testing.T) {
+	db, mock := newTestDB(t)
+	q := newTestQueue(t, db, Config{HeartbeatInterval: 10 * time.Millisecond})
+
+	expectClaim(mock, 1, "a", 1)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "goduck_jobs" SET locked_until = now() + make_interval(secs => $1) WHERE (id, attempts) IN (($2, $3))`)).
+		WithArgs(float64(30), int64(1), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := q.Next(context.Background())
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return mock.ExpectationsWereMet() == nil
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, q.Close())
+}
+
+func TestBackoff(t *testing.T) {
+	q := &sqlQueue{config: Config{RetryBackoff: 10 * time.Second, MaxRetryBackoff: time.Minute}}
+
+	assert.Equal(t, 10*time.Second, q.backoff(1))
+	assert.Equal(t, 20*time.Second, q.backoff(2))
+	assert.Equal(t, 40*time.Second, q.backoff(3))
+	assert.Equal(t, time.Minute, q.backoff(4))
+	assert.Equal(t, time.Minute, q.backoff(100))
+}
+
+func TestEnqueue(t *testing.T) {
+	db, mock := newTestDB(t)
+	runAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "jobs"."outbox" (queue, payload, run_at) VALUES ($1, $2, COALESCE($3::timestamptz, now())), ($4, $5, COALESCE($6::timestamptz, now()))`)).
+		WithArgs("emails", []byte("a"), nil, "sms", []byte{}, runAt).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	require.NoError(t, Enqueue(context.Background(), tx, "jobs.outbox",
+		Job{Queue: "emails", Payload: []byte("a")},
+		Job{Queue: "sms", RunAt: runAt},
+	))
+	require.NoError(t, tx.Commit())
+
+	err = Enqueue(context.Background(), db, "", Job{Payload: []byte("a")})
+	assert.ErrorIs(t, err, ErrEmptyQueue)
+	assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+}
+
+func TestMigrate(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "jobs"."outbox" (`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE INDEX IF NOT EXISTS "outbox_ready_idx" ON "jobs"."outbox" (queue, run_at, id)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "jobs"."outbox_dead" (`)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, Migrate(context.Background(), db, "jobs.outbox"))
+}
+
+func TestNew_Errors(t *testing.T) {
+	db, _ := newTestDB(t)
+
+	_, err := New(nil, Config{Queue: "emails"})
+	assert.Equal(t, ErrNilDB, err)
+
+	_, err = New(db, Config{})
+	assert.Equal(t, ErrEmptyQueue, err)
+}
+
+func getKV(err error, key string) interface{} {
+	for {
+		e, ok := err.(errors.Error)
+		if !ok {
+			return nil
+		}
+		for _, kv := range e.KVs {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+		err = e.Err
+	}
+}
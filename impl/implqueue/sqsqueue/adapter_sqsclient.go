@@ -0,0 +1,111 @@
+package sqsqueue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+type sqsClientGateway struct {
+	client *sqs.Client
+}
+
+// NewSQSGateway returns a SQSClientGateway for the AWS SDK client. To use a
+// SQS compatible service, like ElasticMQ or LocalStack, set the client
+// BaseEndpoint.
+func NewSQSGateway(client *sqs.Client) SQSClientGateway {
+	return &sqsClientGateway{client: client}
+}
+
+func (g *sqsClientGateway) ReceiveMessages(ctx context.Context, queueURL string, max int, wait, visibility time.Duration) ([]Message, error) {
+	const op = errors.Op("sqsqueue.sqsClientGateway.ReceiveMessages")
+
+	output, err := g.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(queueURL),
+		MaxNumberOfMessages: int32(max),
+		WaitTimeSeconds:     int32(wait / time.Second),
+		VisibilityTimeout:   int32(visibility / time.Second),
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+			types.MessageSystemAttributeNameMessageGroupId,
+		},
+	})
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	messages := make([]Message, len(output.Messages))
+	for i, m := range output.Messages {
+		receiveCount, _ := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		messages[i] = Message{
+			ID:            aws.ToString(m.MessageId),
+			ReceiptHandle: aws.ToString(m.ReceiptHandle),
+			Body:          []byte(aws.ToString(m.Body)),
+			GroupID:       m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)],
+			ReceiveCount:  receiveCount,
+		}
+	}
+	return messages, nil
+}
+
+func (g *sqsClientGateway) DeleteMessages(ctx context.Context, queueURL string, receiptHandles []string) ([]error, error) {
+	const op = errors.Op("sqsqueue.sqsClientGateway.DeleteMessages")
+
+	entries := make([]types.DeleteMessageBatchRequestEntry, len(receiptHandles))
+	for i, handle := range receiptHandles {
+		entries[i] = types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: aws.String(handle),
+		}
+	}
+
+	output, err := g.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return batchErrors(len(receiptHandles), output.Failed), nil
+}
+
+func (g *sqsClientGateway) ChangeVisibility(ctx context.Context, queueURL string, receiptHandles []string, visibility time.Duration) ([]error, error) {
+	const op = errors.Op("sqsqueue.sqsClientGateway.ChangeVisibility")
+
+	entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, len(receiptHandles))
+	for i, handle := range receiptHandles {
+		entries[i] = types.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			ReceiptHandle:     aws.String(handle),
+			VisibilityTimeout: int32(visibility / time.Second),
+		}
+	}
+
+	output, err := g.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return batchErrors(len(receiptHandles), output.Failed), nil
+}
+
+// batchErrors returns the error of each entry of a batch request. Entry IDs
+// are their indexes.
+func batchErrors(n int, failed []types.BatchResultErrorEntry) []error {
+	errs := make([]error, n)
+	for _, f := range failed {
+		i, err := strconv.Atoi(aws.ToString(f.Id))
+		if err != nil || i < 0 || i >= n {
+			continue
+		}
+		errs[i] = errors.E(errors.Op("sqsqueue.batchErrors"), aws.ToString(f.Message), errors.KV("code", aws.ToString(f.Code)))
+	}
+	return errs
+}
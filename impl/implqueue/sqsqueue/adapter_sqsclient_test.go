@@ -0,0 +1,88 @@
+package sqsqueue
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSQSServer answers the SQS JSON protocol requests with the responses
+// in responses, keyed by the action name, and records the request bodies.
+func newTestSQSServer(t *testing.T, responses map[string]any) (*sqs.Client, map[string]map[string]any) {
+	requests := map[string]map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("X-Amz-Target")[len("AmazonSQS."):]
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests[action] = body
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		assert.NoError(t, json.NewEncoder(w).Encode(responses[action]))
+	}))
+	t.Cleanup(server.Close)
+
+	client := sqs.New(sqs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return client, requests
+}
+
+func TestSQSGateway(t *testing.T) {
+	md5OfBody := md5.Sum([]byte("a"))
+	client, requests := newTestSQSServer(t, map[string]any{
+		"ReceiveMessage": map[string]any{"Messages": []map[string]any{{
+			"MessageId":     "m1",
+			"ReceiptHandle": "h1",
+			"Body":          "a",
+			"MD5OfBody":     hex.EncodeToString(md5OfBody[:]),
+			"Attributes": map[string]string{
+				"ApproximateReceiveCount": "3",
+				"MessageGroupId":          "g1",
+			},
+		}}},
+		"DeleteMessageBatch": map[string]any{
+			"Successful": []map[string]any{{"Id": "0"}},
+			"Failed":     []map[string]any{{"Id": "1", "Code": "ReceiptHandleIsInvalid", "Message": "invalid", "SenderFault": true}},
+		},
+		"ChangeMessageVisibilityBatch": map[string]any{
+			"Successful": []map[string]any{{"Id": "0"}, {"Id": "1"}},
+		},
+	})
+	gateway := NewSQSGateway(client)
+	ctx := context.Background()
+	queueURL := "https://sqs.local/queue"
+
+	messages, err := gateway.ReceiveMessages(ctx, queueURL, 10, 20*time.Second, 30*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []Message{{ID: "m1", ReceiptHandle: "h1", Body: []byte("a"), GroupID: "g1", ReceiveCount: 3}}, messages)
+	assert.Equal(t, float64(10), requests["ReceiveMessage"]["MaxNumberOfMessages"])
+	assert.Equal(t, float64(20), requests["ReceiveMessage"]["WaitTimeSeconds"])
+	assert.Equal(t, float64(30), requests["ReceiveMessage"]["VisibilityTimeout"])
+
+	errs, err := gateway.DeleteMessages(ctx, queueURL, []string{"h1", "h2"})
+	require.NoError(t, err)
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "sqsqueue.batchErrors: invalid [code=ReceiptHandleIsInvalid]")
+
+	errs, err = gateway.ChangeVisibility(ctx, queueURL, []string{"h1", "h2"}, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, []any{
+		map[string]any{"Id": "0", "ReceiptHandle": "h1", "VisibilityTimeout": float64(60)},
+		map[string]any{"Id": "1", "ReceiptHandle": "h2", "VisibilityTimeout": float64(60)},
+	}, requests["ChangeMessageVisibilityBatch"]["Entries"])
+}
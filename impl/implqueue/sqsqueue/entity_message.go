@@ -0,0 +1,9 @@
+package sqsqueue
+
+type rawMessage struct {
+	msg Message
+}
+
+func (r *rawMessage) Bytes() []byte {
+	return r.msg.Body
+}
@@ -0,0 +1,34 @@
+package sqsqueue
+
+import (
+	"context"
+	"time"
+)
+
+// maxBatchSize is the maximum number of entries of the SQS batch actions.
+const maxBatchSize = 10
+
+// SQSClientGateway represents a gateway to a SQS compatible client.
+type SQSClientGateway interface {
+	// ReceiveMessages receives up to max messages, waiting up to wait for
+	// them. The messages are hidden from other consumers for visibility.
+	ReceiveMessages(ctx context.Context, queueURL string, max int, wait, visibility time.Duration) ([]Message, error)
+	// DeleteMessages deletes up to 10 messages in a single request. It
+	// returns the error of each message, or nil if it was deleted.
+	DeleteMessages(ctx context.Context, queueURL string, receiptHandles []string) ([]error, error)
+	// ChangeVisibility changes the visibility timeout of up to 10 messages
+	// in a single request. It returns the error of each message, or nil if
+	// it was changed.
+	ChangeVisibility(ctx context.Context, queueURL string, receiptHandles []string, visibility time.Duration) ([]error, error)
+}
+
+// Message is a message received from SQS.
+type Message struct {
+	ID            string
+	ReceiptHandle string
+	Body          []byte
+	// GroupID is the message group of FIFO queues.
+	GroupID string
+	// ReceiveCount is how many times the message was received.
+	ReceiveCount int
+}
@@ -0,0 +1,496 @@
+package sqsqueue
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultWaitTime          = 20 * time.Second
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultMaxFailedBackoff  = 15 * time.Minute
+	defaultDeleteInterval    = 50 * time.Millisecond
+	// maxVisibilityTimeout is the maximum visibility timeout allowed by SQS.
+	maxVisibilityTimeout = 12 * time.Hour
+	// receiveErrorDelay is how long to wait after a failed receive.
+	receiveErrorDelay = time.Second
+)
+
+var (
+	// ErrNilGateway is returned when the gateway is nil.
+	ErrNilGateway = errors.New("bad config: nil gateway")
+	// ErrEmptyQueueURL is returned when the QueueURL is missing from the
+	// configs.
+	ErrEmptyQueueURL = errors.New("bad config: empty queue url")
+	// ErrInvalidMessage is returned when Done or Failed receives a message
+	// that wasn't returned by Next, or was already marked.
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// SQSConfigs contains the configs for consuming a SQS queue.
+type SQSConfigs struct {
+	// QueueURL is the URL of the queue.
+	QueueURL string
+	// MaxMessages is how many messages are received at once, up to 10.
+	// Default: 10.
+	MaxMessages int
+	// WaitTime is how long each receive waits for messages, up to 20s.
+	// Default: 20s.
+	WaitTime time.Duration
+	// VisibilityTimeout is how long received messages are hidden from other
+	// consumers. It is extended in the background while the messages are
+	// waiting to be processed or are being processed. Default: 30s.
+	VisibilityTimeout time.Duration
+	// HeartbeatInterval is how often the visibility is extended. Default: a
+	// third of VisibilityTimeout.
+	HeartbeatInterval time.Duration
+
+	// FailedBackoff is the visibility timeout of a failed message after its
+	// first receive. It doubles with every receive, up to MaxFailedBackoff.
+	// Default: zero, so failed messages are visible again right away.
+	FailedBackoff time.Duration
+	// MaxFailedBackoff limits FailedBackoff. Default: 15m.
+	MaxFailedBackoff time.Duration
+
+	// DeleteInterval is how long Done waits for other messages, so they are
+	// deleted in a single request. Default: 50ms.
+	DeleteInterval time.Duration
+}
+
+type deleteRequest struct {
+	receiptHandle string
+	result        chan error
+}
+
+type sqsConsumer struct {
+	gateway SQSClientGateway
+	config  SQSConfigs
+
+	mu sync.Mutex
+	// buffer are the messages received but not returned by Next yet.
+	buffer []*rawMessage
+	// inFlight are the messages returned by Next but not Done or Failed.
+	inFlight map[*rawMessage]struct{}
+	// busyGroups are the FIFO message groups with a message in flight.
+	busyGroups map[string]bool
+	// changed is closed and replaced when a message is received or a group
+	// is released, waking up Next.
+	changed chan struct{}
+
+	deletes  chan deleteRequest
+	ctx      context.Context
+	cancelFn func()
+	wg       sync.WaitGroup
+}
+
+// New creates a goduck.MessagePool that consumes a SQS queue with long
+// polling. Done deletes the messages in batches, and Failed makes the
+// message visible again after the FailedBackoff. The visibility of the
+// received messages is extended until they are Done or Failed.
+//
+// On FIFO queues, only one message of each message group is returned by
+// Next at a time, so they are processed in order even by concurrent
+// workers. If a message fails, the following messages of its group that
+// were already received are made visible again, so SQS delivers the group
+// again in order.
+func New(gateway SQSClientGateway, config SQSConfigs) (goduck.MessagePool, error) {
+	if gateway == nil {
+		return nil, ErrNilGateway
+	}
+	if config.QueueURL == "" {
+		return nil, ErrEmptyQueueURL
+	}
+	if config.MaxMessages <= 0 || config.MaxMessages > maxBatchSize {
+		config.MaxMessages = maxBatchSize
+	}
+	if config.WaitTime <= 0 || config.WaitTime > defaultWaitTime {
+		config.WaitTime = defaultWaitTime
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = config.VisibilityTimeout / 3
+	}
+	if config.MaxFailedBackoff <= 0 {
+		config.MaxFailedBackoff = defaultMaxFailedBackoff
+	}
+	if config.DeleteInterval <= 0 {
+		config.DeleteInterval = defaultDeleteInterval
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	c := &sqsConsumer{
+		gateway:    gateway,
+		config:     config,
+		inFlight:   make(map[*rawMessage]struct{}),
+		busyGroups: make(map[string]bool),
+		changed:    make(chan struct{}),
+		deletes:    make(chan deleteRequest),
+		ctx:        ctx,
+		cancelFn:   cancelFn,
+	}
+
+	c.wg.Add(3)
+	go c.receive()
+	go c.heartbeat()
+	go c.deleteBatches()
+
+	return c, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(gateway SQSClientGateway, config SQSConfigs) goduck.MessagePool {
+	q, err := New(gateway, config)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// notify wakes up everyone waiting on changed. Must be called with the lock
+// held.
+func (c *sqsConsumer) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// receive fills the buffer until the consumer is closed. It only receives
+// more messages when the buffer has room for them, so received messages
+// don't wait too long to be processed.
+func (c *sqsConsumer) receive() {
+	defer c.wg.Done()
+
+	for {
+		c.mu.Lock()
+		if len(c.buffer) >= c.config.MaxMessages {
+			changed := c.changed
+			c.mu.Unlock()
+			select {
+			case <-changed:
+				continue
+			case <-c.ctx.Done():
+				return
+			}
+		}
+		max := c.config.MaxMessages - len(c.buffer)
+		c.mu.Unlock()
+
+		messages, err := c.gateway.ReceiveMessages(c.ctx, c.config.QueueURL, max, c.config.WaitTime, c.config.VisibilityTimeout)
+		if c.ctx.Err() != nil {
+			c.release(messagesToRaw(messages))
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("queue", c.config.QueueURL).Msg("failed to receive sqs messages")
+			select {
+			case <-time.After(receiveErrorDelay):
+			case <-c.ctx.Done():
+				return
+			}
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		c.mu.Lock()
+		c.buffer = append(c.buffer, messagesToRaw(messages)...)
+		c.notify()
+		c.mu.Unlock()
+	}
+}
+
+// heartbeat extends the visibility of the buffered and in flight messages
+// until the consumer is closed.
+func (c *sqsConsumer) heartbeat() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+
+		c.mu.Lock()
+		messages := append([]*rawMessage(nil), c.buffer...)
+		for msg := range c.inFlight {
+			messages = append(messages, msg)
+		}
+		c.mu.Unlock()
+
+		if err := c.changeVisibility(c.ctx, messages, c.config.VisibilityTimeout); err != nil && c.ctx.Err() == nil {
+			log.Warn().Err(err).Str("queue", c.config.QueueURL).Msg("failed to extend sqs messages visibility")
+		}
+	}
+}
+
+// deleteBatches deletes the messages of Done in batches until the consumer
+// is closed.
+func (c *sqsConsumer) deleteBatches() {
+	defer c.wg.Done()
+
+	for {
+		var batch []deleteRequest
+		select {
+		case req := <-c.deletes:
+			batch = append(batch, req)
+		case <-c.ctx.Done():
+			return
+		}
+
+		timer := time.NewTimer(c.config.DeleteInterval)
+	collect:
+		for len(batch) < maxBatchSize {
+			select {
+			case req := <-c.deletes:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-c.ctx.Done():
+				break collect
+			}
+		}
+		timer.Stop()
+
+		c.delete(context.Background(), batch)
+	}
+}
+
+func (c *sqsConsumer) delete(ctx context.Context, batch []deleteRequest) {
+	handles := make([]string, len(batch))
+	for i, req := range batch {
+		handles[i] = req.receiptHandle
+	}
+
+	errs, err := c.gateway.DeleteMessages(ctx, c.config.QueueURL, handles)
+	for i, req := range batch {
+		if err == nil && i < len(errs) {
+			req.result <- errs[i]
+		} else {
+			req.result <- err
+		}
+	}
+}
+
+func (c *sqsConsumer) Next(ctx context.Context) (goduck.RawMessage, error) {
+	for {
+		c.mu.Lock()
+		if msg := c.pop(); msg != nil {
+			c.mu.Unlock()
+			return msg, nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-c.ctx.Done():
+			return nil, io.EOF
+		case <-ctx.Done():
+			return nil, io.EOF
+		}
+	}
+}
+
+// pop returns the first buffered message whose group has no message in
+// flight, and marks it in flight. Must be called with the lock held.
+func (c *sqsConsumer) pop() *rawMessage {
+	for i, msg := range c.buffer {
+		if msg.msg.GroupID != "" && c.busyGroups[msg.msg.GroupID] {
+			continue
+		}
+
+		c.buffer = append(c.buffer[:i], c.buffer[i+1:]...)
+		c.inFlight[msg] = struct{}{}
+		if msg.msg.GroupID != "" {
+			c.busyGroups[msg.msg.GroupID] = true
+		}
+		// The receiver may be waiting for room in the buffer.
+		c.notify()
+		return msg
+	}
+	return nil
+}
+
+// finish removes the message from the in flight messages. It returns false
+// if the message is not in flight.
+func (c *sqsConsumer) finish(msg goduck.RawMessage) (*rawMessage, bool) {
+	casted, ok := msg.(*rawMessage)
+	if !ok {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.inFlight[casted]; !ok {
+		return nil, false
+	}
+	delete(c.inFlight, casted)
+	return casted, true
+}
+
+// releaseGroup allows Next to return the next message of the group.
+func (c *sqsConsumer) releaseGroup(groupID string) {
+	if groupID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.busyGroups, groupID)
+	c.notify()
+}
+
+// Done deletes the message. It waits for the batch with the message to be
+// deleted.
+func (c *sqsConsumer) Done(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("sqsqueue.sqsConsumer.Done")
+
+	casted, ok := c.finish(msg)
+	if !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+	defer c.releaseGroup(casted.msg.GroupID)
+
+	req := deleteRequest{receiptHandle: casted.msg.ReceiptHandle, result: make(chan error, 1)}
+	select {
+	case c.deletes <- req:
+	case <-c.ctx.Done():
+		// The consumer is closed, so the message is deleted right away.
+		c.delete(ctx, []deleteRequest{req})
+	case <-ctx.Done():
+		return errors.E(op, ctx.Err())
+	}
+
+	if err := <-req.result; err != nil {
+		return errors.E(op, err, errors.KV("message_id", casted.msg.ID))
+	}
+	return nil
+}
+
+// Failed makes the message visible again after the backoff. On FIFO queues,
+// the buffered messages of the same group are made visible right away.
+func (c *sqsConsumer) Failed(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("sqsqueue.sqsConsumer.Failed")
+
+	casted, ok := c.finish(msg)
+	if !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+	defer c.releaseGroup(casted.msg.GroupID)
+
+	if casted.msg.GroupID != "" {
+		c.mu.Lock()
+		var group []*rawMessage
+		buffer := c.buffer[:0]
+		for _, m := range c.buffer {
+			if m.msg.GroupID == casted.msg.GroupID {
+				group = append(group, m)
+			} else {
+				buffer = append(buffer, m)
+			}
+		}
+		c.buffer = buffer
+		c.mu.Unlock()
+
+		c.release(group)
+	}
+
+	if err := c.changeVisibility(ctx, []*rawMessage{casted}, c.backoff(casted.msg.ReceiveCount)); err != nil {
+		return errors.E(op, err, errors.KV("message_id", casted.msg.ID))
+	}
+	return nil
+}
+
+func (c *sqsConsumer) backoff(receiveCount int) time.Duration {
+	backoff := c.config.FailedBackoff
+	if backoff <= 0 {
+		return 0
+	}
+	for i := 1; i < receiveCount && backoff < c.config.MaxFailedBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.config.MaxFailedBackoff {
+		backoff = c.config.MaxFailedBackoff
+	}
+	if backoff > maxVisibilityTimeout {
+		backoff = maxVisibilityTimeout
+	}
+	return backoff
+}
+
+// release makes the messages visible again right away.
+func (c *sqsConsumer) release(messages []*rawMessage) {
+	if err := c.changeVisibility(context.Background(), messages, 0); err != nil {
+		log.Warn().Err(err).Str("queue", c.config.QueueURL).Msg("failed to release sqs messages")
+	}
+}
+
+// changeVisibility changes the visibility of the messages in batches.
+func (c *sqsConsumer) changeVisibility(ctx context.Context, messages []*rawMessage, visibility time.Duration) error {
+	const op = errors.Op("sqsqueue.sqsConsumer.changeVisibility")
+
+	var errs []error
+	for start := 0; start < len(messages); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		handles := make([]string, 0, end-start)
+		for _, msg := range messages[start:end] {
+			handles = append(handles, msg.msg.ReceiptHandle)
+		}
+
+		entryErrs, err := c.gateway.ChangeVisibility(ctx, c.config.QueueURL, handles, visibility)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, err := range entryErrs {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.E(op, errs[0], errors.KV("errors", len(errs)))
+	}
+	return nil
+}
+
+// Close stops receiving messages. The buffered messages are made visible
+// again right away. Messages in flight can still be Done or Failed.
+func (c *sqsConsumer) Close() error {
+	c.cancelFn()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	buffer := c.buffer
+	c.buffer = nil
+	c.mu.Unlock()
+
+	c.release(buffer)
+	return nil
+}
+
+func messagesToRaw(messages []Message) []*rawMessage {
+	raw := make([]*rawMessage, len(messages))
+	for i := range messages {
+		raw[i] = &rawMessage{msg: messages[i]}
+	}
+	return raw
+}
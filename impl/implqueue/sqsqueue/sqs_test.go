@@ -0,0 +1,264 @@
+package sqsqueue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryMessage struct {
+	Message
+	visibleAt time.Time
+}
+
+type visibilityChange struct {
+	handle     string
+	visibility time.Duration
+}
+
+// memoryGateway is an in-memory SQSClientGateway. Like FIFO queues, it
+// doesn't return a message while an earlier message of its group is
+// hidden.
+type memoryGateway struct {
+	mu       sync.Mutex
+	messages []*memoryMessage
+	nextID   int
+
+	deleteBatches [][]string
+	changes       []visibilityChange
+}
+
+func (g *memoryGateway) send(groupID string, bodies ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, body := range bodies {
+		g.nextID++
+		g.messages = append(g.messages, &memoryMessage{Message: Message{
+			ID:      fmt.Sprint(g.nextID),
+			Body:    []byte(body),
+			GroupID: groupID,
+		}})
+	}
+}
+
+func (g *memoryGateway) ReceiveMessages(ctx context.Context, _ string, max int, _, visibility time.Duration) ([]Message, error) {
+	g.mu.Lock()
+	now := time.Now()
+	hiddenGroups := map[string]bool{}
+	var messages []Message
+	for _, m := range g.messages {
+		if len(messages) == max {
+			break
+		}
+		if now.Before(m.visibleAt) {
+			hiddenGroups[m.GroupID] = m.GroupID != ""
+			continue
+		}
+		if hiddenGroups[m.GroupID] {
+			continue
+		}
+		m.ReceiveCount++
+		m.ReceiptHandle = fmt.Sprintf("%s-%d", m.ID, m.ReceiveCount)
+		m.visibleAt = now.Add(visibility)
+		messages = append(messages, m.Message)
+	}
+	g.mu.Unlock()
+
+	if len(messages) == 0 {
+		// Long polling.
+		select {
+		case <-time.After(5 * time.Millisecond):
+		case <-ctx.Done():
+		}
+	}
+	return messages, nil
+}
+
+func (g *memoryGateway) DeleteMessages(_ context.Context, _ string, receiptHandles []string) ([]error, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.deleteBatches = append(g.deleteBatches, receiptHandles)
+
+	errs := make([]error, len(receiptHandles))
+	for i, handle := range receiptHandles {
+		errs[i] = fmt.Errorf("receipt handle %s not found", handle)
+		for j, m := range g.messages {
+			if m.ReceiptHandle == handle {
+				g.messages = append(g.messages[:j], g.messages[j+1:]...)
+				errs[i] = nil
+				break
+			}
+		}
+	}
+	return errs, nil
+}
+
+func (g *memoryGateway) ChangeVisibility(_ context.Context, _ string, receiptHandles []string, visibility time.Duration) ([]error, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, handle := range receiptHandles {
+		g.changes = append(g.changes, visibilityChange{handle: handle, visibility: visibility})
+		for _, m := range g.messages {
+			if m.ReceiptHandle == handle {
+				m.visibleAt = time.Now().Add(visibility)
+			}
+		}
+	}
+	return make([]error, len(receiptHandles)), nil
+}
+
+func (g *memoryGateway) remaining() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.messages)
+}
+
+func newTestQueue(t *testing.T, gateway *memoryGateway, config SQSConfigs) goduck.MessagePool {
+	config.QueueURL = "https://sqs.local/queue"
+	q, err := New(gateway, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = q.Close() })
+	return q
+}
+
+func next(t *testing.T, q goduck.MessagePool) goduck.RawMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := q.Next(ctx)
+	require.NoError(t, err)
+	return msg
+}
+
+func assertNoMessages(t *testing.T, q goduck.MessagePool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	msg, err := q.Next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessagePool(t *testing.T) {
+	gateway := &memoryGateway{}
+	gateway.send("", "a", "b")
+	q := newTestQueue(t, gateway, SQSConfigs{})
+	ctx := context.Background()
+
+	a := next(t, q)
+	b := next(t, q)
+	assert.Equal(t, "a", string(a.Bytes()))
+	assert.Equal(t, "b", string(b.Bytes()))
+
+	require.NoError(t, q.Done(ctx, a))
+	require.NoError(t, q.Failed(ctx, b))
+	assert.ErrorIs(t, q.Done(ctx, a), ErrInvalidMessage)
+
+	// The failed message is visible again right away.
+	b = next(t, q)
+	assert.Equal(t, "b", string(b.Bytes()))
+	require.NoError(t, q.Done(ctx, b))
+	assert.Equal(t, 0, gateway.remaining())
+
+	require.NoError(t, q.Close())
+	msg, err := q.Next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessagePool_DeleteBatch(t *testing.T) {
+	gateway := &memoryGateway{}
+	gateway.send("", "a", "b", "c")
+	q := newTestQueue(t, gateway, SQSConfigs{DeleteInterval: 100 * time.Millisecond})
+
+	messages := []goduck.RawMessage{next(t, q), next(t, q), next(t, q)}
+
+	var wg sync.WaitGroup
+	for _, msg := range messages {
+		wg.Add(1)
+		go func(msg goduck.RawMessage) {
+			defer wg.Done()
+			assert.NoError(t, q.Done(context.Background(), msg))
+		}(msg)
+	}
+	wg.Wait()
+
+	require.Len(t, gateway.deleteBatches, 1)
+	assert.ElementsMatch(t, []string{"1-1", "2-1", "3-1"}, gateway.deleteBatches[0])
+}
+
+func TestMessagePool_Heartbeat(t *testing.T) {
+	gateway := &memoryGateway{}
+	gateway.send("", "a")
+	q := newTestQueue(t, gateway, SQSConfigs{
+		VisibilityTimeout: time.Minute,
+		HeartbeatInterval: 10 * time.Millisecond,
+	})
+
+	a := next(t, q)
+	assert.Eventually(t, func() bool {
+		gateway.mu.Lock()
+		defer gateway.mu.Unlock()
+		return len(gateway.changes) >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, q.Done(context.Background(), a))
+
+	gateway.mu.Lock()
+	defer gateway.mu.Unlock()
+	assert.Equal(t, visibilityChange{handle: "1-1", visibility: time.Minute}, gateway.changes[0])
+}
+
+func TestMessagePool_FIFO(t *testing.T) {
+	gateway := &memoryGateway{}
+	gateway.send("g1", "a", "b")
+	gateway.send("g2", "c")
+	q := newTestQueue(t, gateway, SQSConfigs{})
+	ctx := context.Background()
+
+	// Only one message of each group is returned at a time.
+	a := next(t, q)
+	c := next(t, q)
+	assert.Equal(t, "a", string(a.Bytes()))
+	assert.Equal(t, "c", string(c.Bytes()))
+	assertNoMessages(t, q)
+
+	// When a message fails, the group is delivered again in order.
+	require.NoError(t, q.Failed(ctx, a))
+	a = next(t, q)
+	assert.Equal(t, "a", string(a.Bytes()))
+	assertNoMessages(t, q)
+
+	require.NoError(t, q.Done(ctx, a))
+	b := next(t, q)
+	assert.Equal(t, "b", string(b.Bytes()))
+	require.NoError(t, q.Done(ctx, b))
+	require.NoError(t, q.Done(ctx, c))
+	assert.Equal(t, 0, gateway.remaining())
+}
+
+func TestBackoff(t *testing.T) {
+	c := &sqsConsumer{config: SQSConfigs{FailedBackoff: 10 * time.Second, MaxFailedBackoff: time.Minute}}
+
+	assert.Equal(t, 10*time.Second, c.backoff(1))
+	assert.Equal(t, 20*time.Second, c.backoff(2))
+	assert.Equal(t, 40*time.Second, c.backoff(3))
+	assert.Equal(t, time.Minute, c.backoff(4))
+	assert.Equal(t, time.Minute, c.backoff(100))
+
+	c.config.FailedBackoff = 0
+	assert.Equal(t, time.Duration(0), c.backoff(3))
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(nil, SQSConfigs{QueueURL: "https://sqs.local/queue"})
+	assert.Equal(t, ErrNilGateway, err)
+
+	_, err = New(&memoryGateway{}, SQSConfigs{})
+	assert.Equal(t, ErrEmptyQueueURL, err)
+}
@@ -0,0 +1,69 @@
+package filestream
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// position is where a record ends. Offset is counted in decompressed bytes
+// for gzip files.
+type position struct {
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+}
+
+// loadCheckpoint reads the position saved in the checkpoint file. It
+// returns nil if the file doesn't exist.
+func loadCheckpoint(path string) (*position, error) {
+	const op = errors.Op("filestream.loadCheckpoint")
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err, errors.KV("checkpoint", path))
+	}
+
+	var p position
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.E(op, err, errors.KV("checkpoint", path))
+	}
+	return &p, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically, so a crash never
+// leaves it half written.
+func saveCheckpoint(path string, p position) error {
+	const op = errors.Op("filestream.saveCheckpoint")
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.E(op, err, errors.KV("checkpoint", path))
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.E(op, err, errors.KV("checkpoint", path))
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.E(op, err, errors.KV("checkpoint", path))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.E(op, err, errors.KV("checkpoint", path))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.E(op, err, errors.KV("checkpoint", path))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package filestream
+
+import (
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+const (
+	defaultMaxRecordSize = 16 << 20
+	defaultPollInterval  = time.Second
+)
+
+// Stdin is the path that reads the records from the standard input.
+const Stdin = "-"
+
+var (
+	// ErrNoPaths is returned when the Paths are missing from the Config
+	// struct.
+	ErrNoPaths = errors.New("bad config: no paths")
+	// ErrNoFiles is returned when no file matches the Paths.
+	ErrNoFiles = errors.New("no files match the paths")
+	// ErrStdinCheckpoint is returned when a Checkpoint is set and the
+	// records are read from the standard input, which can't be resumed.
+	ErrStdinCheckpoint = errors.New("bad config: checkpoint is not supported for stdin")
+	// ErrRecordTooLarge is returned when a record is larger than the
+	// MaxRecordSize.
+	ErrRecordTooLarge = errors.New("record too large")
+	// ErrTruncatedRecord is returned when a length-prefixed file ends in the
+	// middle of a record.
+	ErrTruncatedRecord = errors.New("truncated record")
+)
+
+// Format is how the records are delimited in the files.
+type Format int
+
+const (
+	// FormatLines reads one record per line. Empty lines are skipped, and
+	// the line endings, "\n" or "\r\n", are not part of the record. It is
+	// the default.
+	FormatLines Format = iota
+	// FormatLengthPrefixed reads records prefixed by their length, as a
+	// 4 byte big endian unsigned integer.
+	FormatLengthPrefixed
+)
+
+// Config contains the configuration necessary to build the file
+// goduck.Stream.
+type Config struct {
+	// Paths are the files to read, in order. They can be glob patterns,
+	// whose matches are read in lexical order, or Stdin. Gzip files are
+	// detected and decompressed.
+	Paths []string
+	// Format is how the records are delimited. Default: FormatLines.
+	Format Format
+	// MaxRecordSize is the size of the largest record, in bytes.
+	// Default: 16MiB.
+	MaxRecordSize int
+
+	// Checkpoint is the file where Done saves the position of the last
+	// record returned by Next. If it exists, the stream resumes from that
+	// position. If the file of the position is not in the Paths anymore,
+	// the stream starts from the beginning. Default: no checkpoint.
+	Checkpoint string
+
+	// Follow keeps reading the last file as it grows, like tail -f, instead
+	// of returning io.EOF at its end. Gzip files and Stdin are not
+	// followed. Default: disabled.
+	Follow bool
+	// PollInterval is how often the followed file is checked for new
+	// records. Default: 1s.
+	PollInterval time.Duration
+}
+
+func (c *Config) validate() error {
+	if len(c.Paths) == 0 {
+		return ErrNoPaths
+	}
+	for _, p := range c.Paths {
+		if p == Stdin && c.Checkpoint != "" {
+			return ErrStdinCheckpoint
+		}
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.MaxRecordSize <= 0 {
+		c.MaxRecordSize = defaultMaxRecordSize
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+}
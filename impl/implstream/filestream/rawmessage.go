@@ -0,0 +1,7 @@
+package filestream
+
+type rawMessage []byte
+
+func (r rawMessage) Bytes() []byte {
+	return r
+}
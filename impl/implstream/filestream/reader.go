@@ -0,0 +1,184 @@
+package filestream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const lengthPrefixSize = 4
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// open opens the file at the given offset. Gzip files are decompressed and
+// the offset skips decompressed bytes.
+func open(path string, offset int64) (closer io.Closer, r *bufio.Reader, gzipped bool, err error) {
+	if path == Stdin {
+		r = bufio.NewReader(os.Stdin)
+		if magic, _ := r.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			return gz, bufio.NewReader(gz), true, nil
+		}
+		return io.NopCloser(os.Stdin), r, false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	magic := make([]byte, len(gzipMagic))
+	if n, _ := f.ReadAt(magic, 0); n == len(magic) && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, false, err
+		}
+		if _, err := io.CopyN(io.Discard, gz, offset); err != nil && err != io.EOF {
+			_ = f.Close()
+			return nil, nil, false, err
+		}
+		return f, bufio.NewReader(gz), true, nil
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, false, err
+	}
+	return f, bufio.NewReader(f), false, nil
+}
+
+// recordReader reads the records of a file. It keeps the bytes of an
+// incomplete record at the end of the file, so it can be completed when a
+// followed file grows.
+type recordReader struct {
+	r       *bufio.Reader
+	format  Format
+	maxSize int
+	// offset is where the last record returned ends.
+	offset int64
+	// pending are the bytes read of the next record.
+	pending []byte
+	// skipping discards the rest of a line that is too large.
+	skipping bool
+}
+
+// next returns the next record, or io.EOF at the end of the file.
+func (rr *recordReader) next() ([]byte, error) {
+	if rr.format == FormatLengthPrefixed {
+		return rr.nextLengthPrefixed()
+	}
+	return rr.nextLine()
+}
+
+func (rr *recordReader) nextLine() ([]byte, error) {
+	for {
+		chunk, err := rr.r.ReadSlice('\n')
+		if rr.skipping {
+			rr.offset += int64(len(chunk))
+			switch err {
+			case nil:
+				rr.skipping = false
+				continue
+			case bufio.ErrBufferFull:
+				continue
+			default:
+				return nil, err
+			}
+		}
+		rr.pending = append(rr.pending, chunk...)
+
+		switch err {
+		case nil:
+			record := trimLineEnding(rr.pending)
+			rr.offset += int64(len(rr.pending))
+			rr.pending = nil
+			if len(record) == 0 {
+				continue
+			}
+			if len(record) > rr.maxSize {
+				return nil, ErrRecordTooLarge
+			}
+			return record, nil
+		case bufio.ErrBufferFull:
+			if len(rr.pending) > rr.maxSize+len("\r\n") {
+				// The rest of the line is skipped by the next call.
+				rr.offset += int64(len(rr.pending))
+				rr.pending = nil
+				rr.skipping = true
+				return nil, ErrRecordTooLarge
+			}
+		default:
+			return nil, err
+		}
+	}
+}
+
+func (rr *recordReader) nextLengthPrefixed() ([]byte, error) {
+	for {
+		size := lengthPrefixSize
+		if len(rr.pending) >= lengthPrefixSize {
+			recordSize := binary.BigEndian.Uint32(rr.pending)
+			if uint64(recordSize) > uint64(rr.maxSize) {
+				return nil, ErrRecordTooLarge
+			}
+			size += int(recordSize)
+			if len(rr.pending) == size {
+				record := rr.pending[lengthPrefixSize:]
+				rr.offset += int64(size)
+				rr.pending = nil
+				return record, nil
+			}
+		}
+
+		buf := make([]byte, size-len(rr.pending))
+		n, err := io.ReadFull(rr.r, buf)
+		rr.pending = append(rr.pending, buf[:n]...)
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// last returns the incomplete record at the end of a file that is not
+// followed. Only the last line may have no line ending.
+func (rr *recordReader) last() ([]byte, error) {
+	if len(rr.pending) == 0 {
+		return nil, nil
+	}
+	if rr.format == FormatLengthPrefixed {
+		return nil, ErrTruncatedRecord
+	}
+
+	record := trimLineEnding(rr.pending)
+	rr.offset += int64(len(rr.pending))
+	rr.pending = nil
+	if len(record) > rr.maxSize {
+		return nil, ErrRecordTooLarge
+	}
+	if len(record) == 0 {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// canResync reports if the records after the error can still be read. Lines
+// that are too large are skipped, but a length-prefixed file can't be
+// trusted after a framing error.
+func (rr *recordReader) canResync(err error) bool {
+	return rr.format != FormatLengthPrefixed && err == ErrRecordTooLarge
+}
+
+func trimLineEnding(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
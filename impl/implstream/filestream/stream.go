@@ -0,0 +1,271 @@
+package filestream
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/rs/zerolog/log"
+)
+
+// item is a record, or an error, read by the background reader.
+type item struct {
+	record   []byte
+	position position
+	err      error
+}
+
+type goduckStream struct {
+	config Config
+	files  []string
+	items  chan item
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// last is the position of the last record returned by Next and not
+	// saved by Done yet.
+	last *position
+}
+
+// New creates a goduck.Stream that reads the records of files, or of the
+// standard input. The files are read in background, one record ahead of
+// Next.
+//
+// Next returns io.EOF once all the files are read, so run-once jobs finish,
+// unless the last file is followed. A file that can't be read, or has an
+// invalid record, makes Next return an error once and the stream moves to
+// the next file.
+//
+// Done saves the position of the last record returned by Next to the
+// Checkpoint file, if set.
+func New(config Config) (goduck.Stream, error) {
+	const op = errors.Op("filestream.New")
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+
+	files, err := expand(config.Paths)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if len(files) == 0 {
+		return nil, ErrNoFiles
+	}
+
+	start := 0
+	var offset int64
+	if config.Checkpoint != "" {
+		p, err := loadCheckpoint(config.Checkpoint)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		if p != nil {
+			start = indexOf(files, p.File)
+			if start < 0 {
+				log.Warn().Str("file", p.File).Msg("checkpoint file not found in the paths, starting from the beginning")
+				start = 0
+			} else {
+				offset = p.Offset
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &goduckStream{
+		config: config,
+		files:  files,
+		items:  make(chan item),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go s.read(start, offset)
+
+	return s, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(config Config) goduck.Stream {
+	s, err := New(config)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// expand returns the files matched by the paths, in order and without
+// duplicates.
+func expand(paths []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		matches := []string{p}
+		if p != Stdin {
+			var err error
+			matches, err = filepath.Glob(p)
+			if err != nil {
+				return nil, errors.E(err, errors.KV("path", p))
+			}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+func indexOf(files []string, file string) int {
+	for i, f := range files {
+		if f == file {
+			return i
+		}
+	}
+	return -1
+}
+
+// read sends the records of the files, starting at the given file and
+// offset, until they end or the stream is closed.
+func (s *goduckStream) read(start int, offset int64) {
+	defer close(s.items)
+
+	for i := start; i < len(s.files); i++ {
+		follow := s.config.Follow && i == len(s.files)-1
+		if !s.readFile(s.files[i], offset, follow) {
+			return
+		}
+		offset = 0
+	}
+}
+
+// readFile sends the records of a file. After an error, the reading
+// continues at the next line if possible, otherwise the rest of the file is
+// skipped. It returns false if the stream is closed.
+func (s *goduckStream) readFile(file string, offset int64, follow bool) bool {
+	const op = errors.Op("filestream.goduckStream.readFile")
+
+	closer, r, gzipped, err := open(file, offset)
+	if err != nil {
+		return s.send(item{err: errors.E(op, err, errors.KV("file", file))})
+	}
+	defer closer.Close()
+
+	follow = follow && !gzipped && file != Stdin
+	rr := &recordReader{
+		r:       r,
+		format:  s.config.Format,
+		maxSize: s.config.MaxRecordSize,
+		offset:  offset,
+	}
+
+	for {
+		record, err := rr.next()
+		if err == io.EOF && follow {
+			if !wait(s.ctx, s.config.PollInterval) {
+				return false
+			}
+			continue
+		}
+		if err == io.EOF {
+			record, err = rr.last()
+			if record == nil && err == nil {
+				return true
+			}
+		}
+		if err != nil {
+			if !s.send(item{err: errors.E(op, err, errors.KV("file", file), errors.KV("offset", rr.offset))}) {
+				return false
+			}
+			if rr.canResync(err) {
+				continue
+			}
+			return true
+		}
+		if !s.send(item{record: record, position: position{File: file, Offset: rr.offset}}) {
+			return false
+		}
+	}
+}
+
+func (s *goduckStream) send(it item) bool {
+	select {
+	case s.items <- it:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+func (s *goduckStream) Next(ctx context.Context) (goduck.RawMessage, error) {
+	if s.ctx.Err() != nil {
+		return nil, io.EOF
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, io.EOF
+	case <-s.ctx.Done():
+		return nil, io.EOF
+	case it, ok := <-s.items:
+		if !ok {
+			return nil, io.EOF
+		}
+		if it.err != nil {
+			return nil, it.err
+		}
+
+		s.mu.Lock()
+		s.last = &it.position
+		s.mu.Unlock()
+		return rawMessage(it.record), nil
+	}
+}
+
+// Done saves the position of the last record returned by Next to the
+// checkpoint file.
+func (s *goduckStream) Done(ctx context.Context) error {
+	const op = errors.Op("filestream.goduckStream.Done")
+
+	if s.config.Checkpoint == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		return nil
+	}
+
+	if err := saveCheckpoint(s.config.Checkpoint, *s.last); err != nil {
+		return errors.E(op, err)
+	}
+	s.last = nil
+	return nil
+}
+
+// Close stops reading the files. The standard input is not closed.
+func (s *goduckStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+// wait waits for d and returns false if ctx is done first.
+func wait(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
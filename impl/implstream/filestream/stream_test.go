@@ -0,0 +1,249 @@
+package filestream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func lengthPrefixed(records ...string) []byte {
+	var buf bytes.Buffer
+	for _, r := range records {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(r)))
+		buf.WriteString(r)
+	}
+	return buf.Bytes()
+}
+
+func newTestStream(t *testing.T, config Config) goduck.Stream {
+	s, err := New(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func next(t *testing.T, s goduck.Stream) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := s.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(msg.Bytes()), nil
+}
+
+func readAll(t *testing.T, s goduck.Stream) []string {
+	var records []string
+	for {
+		record, err := next(t, s)
+		if err == io.EOF {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "1.txt"), []byte("a\r\n\nb\n"))
+	writeFile(t, filepath.Join(dir, "2.txt"), []byte("c\nd"))
+	writeFile(t, filepath.Join(dir, "3.txt.gz"), gzipped(t, []byte("e\nf\n")))
+
+	s := newTestStream(t, Config{Paths: []string{filepath.Join(dir, "*")}})
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, readAll(t, s))
+	require.NoError(t, s.Done(context.Background()))
+
+	require.NoError(t, s.Close())
+	msg, err := s.Next(context.Background())
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStream_LengthPrefixed(t *testing.T) {
+	dir := t.TempDir()
+	data := lengthPrefixed("a\nb", "", "c")
+	writeFile(t, filepath.Join(dir, "1.bin"), data)
+	writeFile(t, filepath.Join(dir, "2.bin"), data[:len(data)-1])
+	writeFile(t, filepath.Join(dir, "3.bin"), lengthPrefixed("d"))
+
+	s := newTestStream(t, Config{Paths: []string{filepath.Join(dir, "*.bin")}, Format: FormatLengthPrefixed})
+	assert.Equal(t, []string{"a\nb", "", "c", "a\nb", ""}, []string{
+		mustNext(t, s), mustNext(t, s), mustNext(t, s), mustNext(t, s), mustNext(t, s),
+	})
+
+	// The truncated file is skipped after the error.
+	_, err := next(t, s)
+	assert.ErrorIs(t, err, ErrTruncatedRecord)
+	assert.Equal(t, []string{"d"}, readAll(t, s))
+}
+
+func mustNext(t *testing.T, s goduck.Stream) string {
+	record, err := next(t, s)
+	require.NoError(t, err)
+	return record
+}
+
+func TestStream_RecordTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	// The second large line doesn't fit in the read buffer.
+	writeFile(t, filepath.Join(dir, "1.txt"), []byte("abc\nabcdef\nab\n"+strings.Repeat("x", 10000)+"\nc\n"))
+	writeFile(t, filepath.Join(dir, "2.txt"), []byte("d\n"))
+
+	// The reading continues at the next line.
+	s := newTestStream(t, Config{Paths: []string{filepath.Join(dir, "*")}, MaxRecordSize: 3})
+	assert.Equal(t, "abc", mustNext(t, s))
+	_, err := next(t, s)
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+	assert.Equal(t, "ab", mustNext(t, s))
+	_, err = next(t, s)
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+	assert.Equal(t, []string{"c", "d"}, readAll(t, s))
+}
+
+func TestStream_LengthPrefixedRecordTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "1.bin"), lengthPrefixed("a", "abcdef", "b"))
+	writeFile(t, filepath.Join(dir, "2.bin"), lengthPrefixed("c"))
+
+	// The framing can't be trusted, so the rest of the file is skipped.
+	s := newTestStream(t, Config{Paths: []string{filepath.Join(dir, "*")}, Format: FormatLengthPrefixed, MaxRecordSize: 3})
+	assert.Equal(t, "a", mustNext(t, s))
+	_, err := next(t, s)
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+	assert.Equal(t, []string{"c"}, readAll(t, s))
+}
+
+func TestStream_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "1.txt"), []byte("a\nb\n"))
+	writeFile(t, filepath.Join(dir, "2.txt.gz"), gzipped(t, []byte("c\nd\ne\n")))
+	config := Config{
+		Paths:      []string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "*.gz")},
+		Checkpoint: filepath.Join(dir, "checkpoint"),
+	}
+
+	s := newTestStream(t, config)
+	assert.Equal(t, "a", mustNext(t, s))
+	require.NoError(t, s.Done(context.Background()))
+	assert.Equal(t, "b", mustNext(t, s))
+	require.NoError(t, s.Close())
+
+	// The records not done are read again.
+	s = newTestStream(t, config)
+	assert.Equal(t, "b", mustNext(t, s))
+	assert.Equal(t, "c", mustNext(t, s))
+	require.NoError(t, s.Done(context.Background()))
+	require.NoError(t, s.Close())
+
+	data, err := os.ReadFile(config.Checkpoint)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"file": "`+filepath.Join(dir, "2.txt.gz")+`", "offset": 2}`, string(data))
+
+	s = newTestStream(t, config)
+	assert.Equal(t, []string{"d", "e"}, readAll(t, s))
+	require.NoError(t, s.Done(context.Background()))
+	require.NoError(t, s.Close())
+
+	s = newTestStream(t, config)
+	assert.Empty(t, readAll(t, s))
+}
+
+func TestStream_Follow(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "1.txt")
+	writeFile(t, path, []byte("a\nb"))
+
+	s := newTestStream(t, Config{Paths: []string{path}, Follow: true, PollInterval: 10 * time.Millisecond})
+	assert.Equal(t, "a", mustNext(t, s))
+
+	// The incomplete line is only returned when it ends.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	msg, err := s.Next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("c\nd\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, "bc", mustNext(t, s))
+	assert.Equal(t, "d", mustNext(t, s))
+}
+
+func TestStream_Stdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+
+	go func() {
+		_, _ = w.Write(gzipped(t, []byte("a\nb\n")))
+		_ = w.Close()
+	}()
+
+	s := newTestStream(t, Config{Paths: []string{Stdin}})
+	assert.Equal(t, []string{"a", "b"}, readAll(t, s))
+}
+
+func TestNew_Errors(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "checkpoint")
+	writeFile(t, checkpoint, []byte("not json"))
+	writeFile(t, filepath.Join(dir, "1.txt"), []byte("a\n"))
+
+	tests := []struct {
+		name        string
+		config      Config
+		expectedErr error
+	}{
+		{name: "No paths", config: Config{}, expectedErr: ErrNoPaths},
+		{name: "No files", config: Config{Paths: []string{filepath.Join(dir, "*.bin")}}, expectedErr: ErrNoFiles},
+		{name: "Stdin checkpoint", config: Config{Paths: []string{Stdin}, Checkpoint: checkpoint}, expectedErr: ErrStdinCheckpoint},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.config)
+			assert.Nil(t, s)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+
+	t.Run("Invalid checkpoint", func(t *testing.T) {
+		s, err := New(Config{Paths: []string{filepath.Join(dir, "1.txt")}, Checkpoint: checkpoint})
+		assert.Nil(t, s)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,112 @@
+package kafkafranz
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/aws"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const defaultMaxPollRecords = 100
+
+var (
+	// ErrEmptyBroker is returned when the Brokers are missing from the
+	// Config struct.
+	ErrEmptyBroker = errors.New("bad config: empty broker")
+	// ErrEmptyTopic is returned when the Topics are missing from the Config
+	// struct, or one of them is empty.
+	ErrEmptyTopic = errors.New("bad config: empty topic")
+	// ErrEmptyGroupID is returned when the GroupID is missing from the
+	// Config struct.
+	ErrEmptyGroupID = errors.New("bad config: empty group id")
+)
+
+// Config contains the configuration necessary to build the franz-go
+// goduck.Stream.
+type Config struct {
+	Brokers []string
+	GroupID string
+	Topics  []string
+
+	// TLS enables TLS with the given config. Default: disabled.
+	TLS *tls.Config
+	// SASL is the SASL mechanism, like the ones returned by SASLPlain or
+	// SASLScramSHA512. GSSAPI is supported with the mechanism of the
+	// github.com/twmb/franz-go/pkg/sasl/kerberos module. Default: no SASL.
+	SASL sasl.Mechanism
+
+	// StartOffset is where the group starts consuming partitions without
+	// committed offsets. Default: the earliest offset.
+	StartOffset *kgo.Offset
+	// MaxPollRecords is how many records are fetched at once. Default: 100.
+	MaxPollRecords int
+	// DisableCommit indicates that offsets should never be commited, even
+	// after calling Done().
+	DisableCommit bool
+
+	// OnAssigned is called with the partitions assigned to the stream by a
+	// rebalance, before they are consumed.
+	OnAssigned func(ctx context.Context, assigned map[string][]int32)
+	// OnRevoked is called with the partitions revoked from the stream by a
+	// rebalance, or lost because the stream left the group. The records of
+	// these partitions not returned by Next yet are discarded.
+	OnRevoked func(ctx context.Context, revoked map[string][]int32)
+
+	// Opts are extra franz-go options. They are applied after the options
+	// built from this config, so they override them.
+	Opts []kgo.Opt
+}
+
+// SASLPlain returns the PLAIN SASL mechanism.
+func SASLPlain(username, password string) sasl.Mechanism {
+	return plain.Auth{User: username, Pass: password}.AsMechanism()
+}
+
+// SASLScramSHA256 returns the SCRAM-SHA-256 SASL mechanism.
+func SASLScramSHA256(username, password string) sasl.Mechanism {
+	return scram.Auth{User: username, Pass: password}.AsSha256Mechanism()
+}
+
+// SASLScramSHA512 returns the SCRAM-SHA-512 SASL mechanism.
+func SASLScramSHA512(username, password string) sasl.Mechanism {
+	return scram.Auth{User: username, Pass: password}.AsSha512Mechanism()
+}
+
+// SASLOAuthBearer returns the OAUTHBEARER SASL mechanism. The token is
+// requested on every connection, so it can be refreshed.
+func SASLOAuthBearer(token func(ctx context.Context) (string, error)) sasl.Mechanism {
+	return oauth.Oauth(func(ctx context.Context) (oauth.Auth, error) {
+		t, err := token(ctx)
+		return oauth.Auth{Token: t}, err
+	})
+}
+
+// SASLAWSMSKIAM returns the AWS_MSK_IAM SASL mechanism of Amazon MSK. The
+// credentials are requested on every connection, so they can be rotated.
+func SASLAWSMSKIAM(credentials func(ctx context.Context) (aws.Auth, error)) sasl.Mechanism {
+	return aws.ManagedStreamingIAM(credentials)
+}
+
+func (c Config) validate() error {
+	if len(c.Brokers) == 0 {
+		return ErrEmptyBroker
+	}
+	if len(c.Topics) == 0 {
+		return ErrEmptyTopic
+	}
+	for _, topic := range c.Topics {
+		if topic == "" {
+			return ErrEmptyTopic
+		}
+	}
+	if c.GroupID == "" {
+		return ErrEmptyGroupID
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package kafkafranz
+
+type rawMessage []byte
+
+func (r rawMessage) Bytes() []byte {
+	return r
+}
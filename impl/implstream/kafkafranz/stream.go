@@ -0,0 +1,252 @@
+package kafkafranz
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/rs/zerolog/log"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// errorBackoff is how long Next waits after a failed poll. The engines call
+// Next again right away, so this keeps them from hammering the brokers.
+const errorBackoff = time.Second
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type goduckStream struct {
+	client *kgo.Client
+	config Config
+	closed atomic.Bool
+
+	mu sync.Mutex
+	// buffer are the records polled but not returned by Next yet.
+	buffer []*kgo.Record
+	// uncommitted is the last record returned by Next since the last Done,
+	// by partition.
+	uncommitted map[topicPartition]*kgo.Record
+}
+
+// New creates a franz-go goduck.Stream that consumes the topics as part of
+// a consumer group. It doesn't need cgo.
+//
+// Done commits, for each partition, the offset of the last record returned
+// by Next. Records buffered but not returned yet are not committed.
+//
+// Rebalances are blocked while there are records returned by Next and not
+// committed by Done, so Done never commits offsets of partitions owned by
+// another consumer. This means the records returned by Next must be Done
+// within the group rebalance timeout, 60s by default, once a rebalance
+// starts, or the stream is kicked out of the group.
+func New(config Config) (goduck.Stream, error) {
+	const op = errors.Op("kafkafranz.New")
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.MaxPollRecords <= 0 {
+		config.MaxPollRecords = defaultMaxPollRecords
+	}
+
+	s := &goduckStream{
+		config:      config,
+		uncommitted: make(map[topicPartition]*kgo.Record),
+	}
+
+	startOffset := kgo.NewOffset().AtStart()
+	if config.StartOffset != nil {
+		startOffset = *config.StartOffset
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(config.Brokers...),
+		kgo.ConsumerGroup(config.GroupID),
+		kgo.ConsumeTopics(config.Topics...),
+		kgo.ConsumeResetOffset(startOffset),
+		kgo.DisableAutoCommit(),
+		kgo.BlockRebalanceOnPoll(),
+		kgo.OnPartitionsAssigned(s.onAssigned),
+		kgo.OnPartitionsRevoked(s.onRevoked),
+		kgo.OnPartitionsLost(s.onRevoked),
+	}
+	if config.TLS != nil {
+		opts = append(opts, kgo.DialTLSConfig(config.TLS))
+	}
+	if config.SASL != nil {
+		opts = append(opts, kgo.SASL(config.SASL))
+	}
+	opts = append(opts, config.Opts...)
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	s.client = client
+
+	return s, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(config Config) goduck.Stream {
+	s, err := New(config)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *goduckStream) Next(ctx context.Context) (goduck.RawMessage, error) {
+	const op = errors.Op("kafkafranz.goduckStream.Next")
+
+	s.mu.Lock()
+	for len(s.buffer) == 0 {
+		canRebalance := len(s.uncommitted) == 0
+		s.mu.Unlock()
+
+		if canRebalance {
+			// Nothing to commit, so it is safe to rebalance. The rebalance
+			// callbacks take the lock.
+			s.client.AllowRebalance()
+		}
+
+		fetches := s.client.PollRecords(ctx, s.config.MaxPollRecords)
+		if s.closed.Load() {
+			// Close waits for the rebalance of leaving the group, which
+			// waits for this poll to allow it. The records are consumed
+			// again by the group.
+			s.client.AllowRebalance()
+			return nil, io.EOF
+		}
+
+		var errs []error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if err == context.Canceled || err == context.DeadlineExceeded || err == kgo.ErrClientClosed {
+				return
+			}
+			log.Error().Err(err).Str("topic", topic).Int32("partition", partition).Msg("failed to fetch kafka records")
+			errs = append(errs, err)
+		})
+
+		// The records are kept even if ctx is done, they were already
+		// consumed from the partitions.
+		s.mu.Lock()
+		s.buffer = append(s.buffer, fetches.Records()...)
+		if len(s.buffer) > 0 {
+			break
+		}
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			s.mu.Unlock()
+			return nil, io.EOF
+		}
+		if len(errs) > 0 {
+			s.mu.Unlock()
+			wait(ctx, errorBackoff)
+			return nil, errors.E(op, errs[0], errors.KV("errors", len(errs)))
+		}
+	}
+	defer s.mu.Unlock()
+
+	record := s.buffer[0]
+	s.buffer[0] = nil
+	s.buffer = s.buffer[1:]
+
+	if !s.config.DisableCommit {
+		s.uncommitted[topicPartition{record.Topic, record.Partition}] = record
+	}
+	return rawMessage(record.Value), nil
+}
+
+// Done commits the offsets of the records returned by Next.
+func (s *goduckStream) Done(ctx context.Context) error {
+	const op = errors.Op("kafkafranz.goduckStream.Done")
+
+	s.mu.Lock()
+	if len(s.uncommitted) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+
+	records := make([]*kgo.Record, 0, len(s.uncommitted))
+	for _, record := range s.uncommitted {
+		records = append(records, record)
+	}
+
+	if err := s.client.CommitRecords(ctx, records...); err != nil {
+		s.mu.Unlock()
+		return errors.E(op, err)
+	}
+	s.uncommitted = make(map[topicPartition]*kgo.Record)
+	s.mu.Unlock()
+
+	s.client.AllowRebalance()
+	return nil
+}
+
+func (s *goduckStream) onAssigned(ctx context.Context, _ *kgo.Client, assigned map[string][]int32) {
+	if s.config.OnAssigned != nil {
+		s.config.OnAssigned(ctx, assigned)
+	}
+}
+
+// onRevoked discards the records of the revoked partitions. They are
+// consumed by their new owner from the last commit.
+func (s *goduckStream) onRevoked(ctx context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	isRevoked := func(topic string, partition int32) bool {
+		for _, p := range revoked[topic] {
+			if p == partition {
+				return true
+			}
+		}
+		return false
+	}
+
+	s.mu.Lock()
+	buffer := s.buffer[:0]
+	for _, record := range s.buffer {
+		if !isRevoked(record.Topic, record.Partition) {
+			buffer = append(buffer, record)
+		}
+	}
+	for i := len(buffer); i < len(s.buffer); i++ {
+		s.buffer[i] = nil
+	}
+	s.buffer = buffer
+
+	// Only partitions lost without a rebalance can have uncommitted
+	// records, when the stream is kicked out of the group.
+	for tp := range s.uncommitted {
+		if isRevoked(tp.topic, tp.partition) {
+			delete(s.uncommitted, tp)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.config.OnRevoked != nil {
+		s.config.OnRevoked(ctx, revoked)
+	}
+}
+
+// Close leaves the group. Records returned by Next and not committed by
+// Done are consumed again by the group.
+func (s *goduckStream) Close() error {
+	s.closed.Store(true)
+	s.client.CloseAllowingRebalance()
+	return nil
+}
+
+func wait(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
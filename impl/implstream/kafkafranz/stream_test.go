@@ -0,0 +1,207 @@
+package kafkafranz
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newTestCluster(t *testing.T) []string {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "orders", "payments"))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()
+}
+
+func produce(t *testing.T, brokers []string, topic string, values ...string) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, v := range values {
+		err := client.ProduceSync(context.Background(), &kgo.Record{Topic: topic, Value: []byte(v)}).FirstErr()
+		require.NoError(t, err)
+	}
+}
+
+func testConfig(brokers []string) Config {
+	return Config{
+		Brokers: brokers,
+		GroupID: "group",
+		Topics:  []string{"orders", "payments"},
+		Opts:    []kgo.Opt{kgo.FetchMaxWait(100 * time.Millisecond)},
+	}
+}
+
+func newTestStream(t *testing.T, config Config) goduck.Stream {
+	s, err := New(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func nextValues(t *testing.T, s goduck.Stream, n int) []string {
+	var values []string
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		msg, err := s.Next(ctx)
+		cancel()
+		require.NoError(t, err)
+		values = append(values, string(msg.Bytes()))
+	}
+	return values
+}
+
+func TestStream(t *testing.T) {
+	brokers := newTestCluster(t)
+	produce(t, brokers, "orders", "a", "b")
+	produce(t, brokers, "payments", "c")
+
+	s := newTestStream(t, testConfig(brokers))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, nextValues(t, s, 3))
+	require.NoError(t, s.Done(context.Background()))
+	require.NoError(t, s.Done(context.Background()))
+	require.NoError(t, s.Close())
+
+	msg, err := s.Next(context.Background())
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+
+	// The group continues from the committed offsets.
+	produce(t, brokers, "orders", "d")
+	s = newTestStream(t, testConfig(brokers))
+	assert.Equal(t, []string{"d"}, nextValues(t, s, 1))
+}
+
+func TestStream_UncommittedRecords(t *testing.T) {
+	brokers := newTestCluster(t)
+	produce(t, brokers, "orders", "a", "b")
+
+	s := newTestStream(t, testConfig(brokers))
+	assert.ElementsMatch(t, []string{"a", "b"}, nextValues(t, s, 2))
+	require.NoError(t, s.Close())
+
+	// The records not committed are consumed again.
+	s = newTestStream(t, testConfig(brokers))
+	assert.ElementsMatch(t, []string{"a", "b"}, nextValues(t, s, 2))
+}
+
+// partitions records the partitions assigned to a stream.
+type partitions struct {
+	mu       sync.Mutex
+	assigned map[string][]int32
+}
+
+func (p *partitions) onAssigned(_ context.Context, assigned map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for topic, ps := range assigned {
+		p.assigned[topic] = append(p.assigned[topic], ps...)
+	}
+}
+
+func (p *partitions) onRevoked(_ context.Context, revoked map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for topic, ps := range revoked {
+		kept := p.assigned[topic][:0]
+		for _, a := range p.assigned[topic] {
+			if !containsPartition(ps, a) {
+				kept = append(kept, a)
+			}
+		}
+		p.assigned[topic] = kept
+	}
+}
+
+func (p *partitions) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, ps := range p.assigned {
+		n += len(ps)
+	}
+	return n
+}
+
+func containsPartition(ps []int32, p int32) bool {
+	for _, x := range ps {
+		if x == p {
+			return true
+		}
+	}
+	return false
+}
+
+// poll calls Next until ctx is done, so the stream takes part in
+// rebalances.
+func poll(ctx context.Context, s goduck.Stream) {
+	for ctx.Err() == nil {
+		_, _ = s.Next(ctx)
+	}
+}
+
+func TestStream_Rebalance(t *testing.T) {
+	brokers := newTestCluster(t)
+
+	p1 := &partitions{assigned: map[string][]int32{}}
+	config := testConfig(brokers)
+	config.OnAssigned = p1.onAssigned
+	config.OnRevoked = p1.onRevoked
+	s1 := newTestStream(t, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go poll(ctx, s1)
+	assert.Eventually(t, func() bool { return p1.count() == 4 }, 10*time.Second, 10*time.Millisecond)
+
+	// The partitions are split between the streams when another one joins.
+	p2 := &partitions{assigned: map[string][]int32{}}
+	config.OnAssigned = p2.onAssigned
+	config.OnRevoked = p2.onRevoked
+	s2 := newTestStream(t, config)
+	go poll(ctx, s2)
+
+	assert.Eventually(t, func() bool {
+		return p1.count() == 2 && p2.count() == 2
+	}, 20*time.Second, 10*time.Millisecond)
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expectedErr error
+	}{
+		{name: "No brokers", config: Config{GroupID: "group", Topics: []string{"orders"}}, expectedErr: ErrEmptyBroker},
+		{name: "No topics", config: Config{Brokers: []string{"localhost:9092"}, GroupID: "group"}, expectedErr: ErrEmptyTopic},
+		{name: "Empty topic", config: Config{Brokers: []string{"localhost:9092"}, GroupID: "group", Topics: []string{""}}, expectedErr: ErrEmptyTopic},
+		{name: "No group", config: Config{Brokers: []string{"localhost:9092"}, Topics: []string{"orders"}}, expectedErr: ErrEmptyGroupID},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.config)
+			assert.Nil(t, s)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestSASL(t *testing.T) {
+	token := func(context.Context) (string, error) { return "token", nil }
+
+	assert.Equal(t, "PLAIN", SASLPlain("user", "pass").Name())
+	assert.Equal(t, "SCRAM-SHA-256", SASLScramSHA256("user", "pass").Name())
+	assert.Equal(t, "SCRAM-SHA-512", SASLScramSHA512("user", "pass").Name())
+	assert.Equal(t, "OAUTHBEARER", SASLOAuthBearer(token).Name())
+	assert.Equal(t, "AWS_MSK_IAM", SASLAWSMSKIAM(nil).Name())
+}
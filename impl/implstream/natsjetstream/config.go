@@ -0,0 +1,138 @@
+package natsjetstream
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	defaultAckWait   = 30 * time.Second
+	defaultBatchSize = 100
+)
+
+var (
+	// ErrNilJetStream is returned when the jetstream context is nil.
+	ErrNilJetStream = errors.New("bad config: nil jetstream")
+	// ErrEmptyStream is returned when the Stream is missing from the Config
+	// struct.
+	ErrEmptyStream = errors.New("bad config: empty stream")
+	// ErrEmptyConsumer is returned when the Consumer is missing from the
+	// Config struct.
+	ErrEmptyConsumer = errors.New("bad config: empty consumer")
+	// ErrInvalidMessage is returned when Done or Failed receives a message
+	// that wasn't returned by this package.
+	ErrInvalidMessage = errors.New("invalid message type")
+)
+
+// Config contains the configuration necessary to consume a JetStream stream
+// with a durable pull consumer.
+type Config struct {
+	// Stream is the name of the JetStream stream. It must exist.
+	Stream string
+	// Consumer is the name of the durable consumer. It is created, or
+	// updated to match this config, when the Stream or MessagePool is
+	// created. A consumer can't be shared by a Stream and a MessagePool,
+	// because they use different ack policies.
+	Consumer string
+	// FilterSubjects restricts the consumer to these subjects. Optional.
+	FilterSubjects []string
+	// DeliverPolicy is where a new consumer starts. Default: all messages.
+	DeliverPolicy jetstream.DeliverPolicy
+
+	// AckWait is how long the server waits for an ack before delivering a
+	// message again. Messages waiting in the client buffer count towards
+	// it. Default: 30s.
+	AckWait time.Duration
+	// MaxDeliver is how many times a message is delivered before the server
+	// gives up on it. Default: unlimited.
+	MaxDeliver int
+	// BatchSize is how many messages are pulled at once. Default: 100.
+	BatchSize int
+
+	// NakDelay is how long the server waits before delivering a failed
+	// message again. Only used by the MessagePool. Default: the message
+	// is delivered again right away.
+	NakDelay time.Duration
+	// InProgressInterval is how often the MessagePool tells the server that
+	// a message returned by Next is still being processed, so it isn't
+	// delivered again while it is processed for longer than AckWait.
+	// Default: a third of AckWait.
+	InProgressInterval time.Duration
+}
+
+func (c *Config) validate() error {
+	if c.Stream == "" {
+		return ErrEmptyStream
+	}
+	if c.Consumer == "" {
+		return ErrEmptyConsumer
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.AckWait <= 0 {
+		c.AckWait = defaultAckWait
+	}
+	if c.MaxDeliver <= 0 {
+		c.MaxDeliver = -1
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.InProgressInterval <= 0 {
+		c.InProgressInterval = c.AckWait / 3
+	}
+}
+
+// messages creates or updates the durable consumer and starts pulling its
+// messages.
+func messages(js jetstream.JetStream, config *Config, ackPolicy jetstream.AckPolicy) (jetstream.MessagesContext, error) {
+	const op = errors.Op("natsjetstream.messages")
+
+	if js == nil {
+		return nil, ErrNilJetStream
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+
+	consumer, err := js.CreateOrUpdateConsumer(context.Background(), config.Stream, jetstream.ConsumerConfig{
+		Durable:        config.Consumer,
+		DeliverPolicy:  config.DeliverPolicy,
+		AckPolicy:      ackPolicy,
+		AckWait:        config.AckWait,
+		MaxDeliver:     config.MaxDeliver,
+		FilterSubjects: config.FilterSubjects,
+	})
+	if err != nil {
+		return nil, errors.E(op, err, errors.KV("stream", config.Stream), errors.KV("consumer", config.Consumer))
+	}
+
+	iter, err := consumer.Messages(jetstream.PullMaxMessages(config.BatchSize))
+	if err != nil {
+		return nil, errors.E(op, err, errors.KV("stream", config.Stream), errors.KV("consumer", config.Consumer))
+	}
+	return iter, nil
+}
+
+// next returns the next message of the iterator. It returns io.EOF if the
+// iterator is stopped or ctx is done.
+func next(ctx context.Context, iter jetstream.MessagesContext) (jetstream.Msg, error) {
+	const op = errors.Op("natsjetstream.next")
+
+	msg, err := iter.Next(jetstream.NextContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil || stderrors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			return nil, io.EOF
+		}
+		return nil, errors.E(op, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,162 @@
+package natsjetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+)
+
+type messagePool struct {
+	iter               jetstream.MessagesContext
+	nakDelay           time.Duration
+	inProgressInterval time.Duration
+
+	// ctx is canceled by Close to stop the heartbeats.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	closed     bool
+	heartbeats sync.WaitGroup
+}
+
+// NewMessagePool creates a goduck.MessagePool that pulls messages from a
+// JetStream durable consumer with the AckExplicit policy. Done acknowledges
+// a single message and Failed delivers it again after Config.NakDelay.
+//
+// While a message returned by Next isn't Done or Failed, the server is told
+// it is in progress every Config.InProgressInterval, so long processing
+// doesn't exceed AckWait.
+func NewMessagePool(js jetstream.JetStream, config Config) (goduck.MessagePool, error) {
+	iter, err := messages(js, &config, jetstream.AckExplicitPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &messagePool{
+		iter:               iter,
+		nakDelay:           config.NakDelay,
+		inProgressInterval: config.InProgressInterval,
+		ctx:                ctx,
+		cancel:             cancel,
+	}, nil
+}
+
+// MustNewMessagePool calls NewMessagePool but panics in case of error.
+func MustNewMessagePool(js jetstream.JetStream, config Config) goduck.MessagePool {
+	p, err := NewMessagePool(js, config)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *messagePool) Next(ctx context.Context) (goduck.RawMessage, error) {
+	msg, err := next(ctx, p.iter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawMessage{
+		msg:  msg,
+		stop: p.heartbeat(ctx, msg),
+	}, nil
+}
+
+// heartbeat sends InProgress for the message until the returned function is
+// called or the pool is closed. The function may be called more than once.
+func (p *messagePool) heartbeat(ctx context.Context, msg jetstream.Msg) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		close(stopped)
+		return func() {}
+	}
+	p.heartbeats.Add(1)
+	p.mu.Unlock()
+
+	logger := log.Ctx(ctx)
+	go func() {
+		defer p.heartbeats.Done()
+		defer close(stopped)
+		ticker := time.NewTicker(p.inProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					logger.Warn().Err(err).Msg("failed to send jetstream in progress heartbeat")
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+func (p *messagePool) Done(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("natsjetstream.messagePool.Done")
+
+	casted, ok := msg.(*rawMessage)
+	if !ok || casted.stop == nil {
+		return errors.E(op, ErrInvalidMessage)
+	}
+	casted.stop()
+
+	if err := casted.msg.DoubleAck(ctx); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+func (p *messagePool) Failed(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("natsjetstream.messagePool.Failed")
+
+	casted, ok := msg.(*rawMessage)
+	if !ok || casted.stop == nil {
+		return errors.E(op, ErrInvalidMessage)
+	}
+	casted.stop()
+
+	var err error
+	if p.nakDelay > 0 {
+		err = casted.msg.NakWithDelay(p.nakDelay)
+	} else {
+		err = casted.msg.Nak()
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// Close stops pulling messages and the heartbeats. Messages returned by
+// Next and not acknowledged are delivered again after AckWait.
+func (p *messagePool) Close() error {
+	p.iter.Stop()
+
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.cancel()
+	p.heartbeats.Wait()
+	return nil
+}
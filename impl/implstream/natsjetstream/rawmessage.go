@@ -0,0 +1,13 @@
+package natsjetstream
+
+import "github.com/nats-io/nats.go/jetstream"
+
+type rawMessage struct {
+	msg jetstream.Msg
+	// stop stops the InProgress heartbeats of the message.
+	stop func()
+}
+
+func (m *rawMessage) Bytes() []byte {
+	return m.msg.Data()
+}
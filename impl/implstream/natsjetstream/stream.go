@@ -0,0 +1,80 @@
+package natsjetstream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type goduckStream struct {
+	iter jetstream.MessagesContext
+
+	// last is the last message returned by Next since the last Done.
+	last     jetstream.Msg
+	lastLock sync.Mutex
+}
+
+// New creates a goduck.Stream that pulls messages from a JetStream durable
+// consumer with the AckAll policy. Done acknowledges the last message
+// returned by Next, and with it all messages before it.
+//
+// Because an ack covers every message before it, the consumer must have a
+// single Stream. All messages returned since the last Done must be
+// processed within AckWait, otherwise they are delivered again.
+func New(js jetstream.JetStream, config Config) (goduck.Stream, error) {
+	iter, err := messages(js, &config, jetstream.AckAllPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &goduckStream{iter: iter}, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(js jetstream.JetStream, config Config) goduck.Stream {
+	s, err := New(js, config)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *goduckStream) Next(ctx context.Context) (goduck.RawMessage, error) {
+	msg, err := next(ctx, s.iter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lastLock.Lock()
+	defer s.lastLock.Unlock()
+	s.last = msg
+
+	return &rawMessage{msg: msg}, nil
+}
+
+func (s *goduckStream) Done(ctx context.Context) error {
+	const op = errors.Op("natsjetstream.goduckStream.Done")
+
+	s.lastLock.Lock()
+	defer s.lastLock.Unlock()
+
+	if s.last == nil {
+		return nil
+	}
+
+	if err := s.last.DoubleAck(ctx); err != nil {
+		return errors.E(op, err)
+	}
+	s.last = nil
+	return nil
+}
+
+// Close stops pulling messages. Messages returned by Next and not
+// acknowledged are delivered again after AckWait.
+func (s *goduckStream) Close() error {
+	s.iter.Stop()
+	return nil
+}
@@ -0,0 +1,186 @@
+package natsjetstream
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestJetStream runs an embedded nats-server with a stream named EVENTS.
+func newTestJetStream(t *testing.T) jetstream.JetStream {
+	s, err := server.NewServer(&server.Options{
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	require.True(t, s.ReadyForConnections(5*time.Second))
+
+	nc, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "EVENTS",
+		Subjects: []string{"events.>"},
+	})
+	require.NoError(t, err)
+	return js
+}
+
+func publish(t *testing.T, js jetstream.JetStream, data ...string) {
+	for _, d := range data {
+		_, err := js.Publish(context.Background(), "events.test", []byte(d))
+		require.NoError(t, err)
+	}
+}
+
+func nextData(t *testing.T, next func(context.Context) (goduck.RawMessage, error), n int) []string {
+	var data []string
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		msg, err := next(ctx)
+		cancel()
+		require.NoError(t, err)
+		data = append(data, string(msg.Bytes()))
+	}
+	return data
+}
+
+func ackPending(t *testing.T, js jetstream.JetStream, consumer string) int {
+	c, err := js.Consumer(context.Background(), "EVENTS", consumer)
+	require.NoError(t, err)
+	info, err := c.Info(context.Background())
+	require.NoError(t, err)
+	return info.NumAckPending
+}
+
+// assertNoMessages checks that Next has nothing to return for a while.
+func assertNoMessages(t *testing.T, next func(context.Context) (goduck.RawMessage, error), d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	msg, err := next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStream(t *testing.T) {
+	js := newTestJetStream(t)
+	publish(t, js, "a", "b", "c")
+
+	stream := MustNew(js, Config{Stream: "EVENTS", Consumer: "stream"})
+	assert.Equal(t, []string{"a", "b", "c"}, nextData(t, stream.Next, 3))
+	assert.Equal(t, 3, ackPending(t, js, "stream"))
+
+	// Acking the last message acks all of them.
+	require.NoError(t, stream.Done(context.Background()))
+	assert.Equal(t, 0, ackPending(t, js, "stream"))
+	require.NoError(t, stream.Done(context.Background()))
+
+	require.NoError(t, stream.Close())
+	msg, err := stream.Next(context.Background())
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessagePool(t *testing.T) {
+	js := newTestJetStream(t)
+	publish(t, js, "a")
+
+	pool := MustNewMessagePool(js, Config{
+		Stream:             "EVENTS",
+		Consumer:           "pool",
+		AckWait:            300 * time.Millisecond,
+		InProgressInterval: 50 * time.Millisecond,
+		NakDelay:           100 * time.Millisecond,
+	})
+	defer pool.Close()
+
+	ctx := context.Background()
+	msg, err := pool.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Bytes()))
+
+	// The heartbeats keep the message from being delivered again while it
+	// is processed for longer than AckWait.
+	assertNoMessages(t, pool.Next, time.Second)
+
+	// A failed message is delivered again after the nak delay.
+	require.NoError(t, pool.Failed(ctx, msg))
+	msg, err = pool.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(msg.Bytes()))
+
+	require.NoError(t, pool.Done(ctx, msg))
+	assert.Equal(t, 0, ackPending(t, js, "pool"))
+
+	assert.ErrorIs(t, pool.Done(ctx, nil), ErrInvalidMessage)
+	assert.ErrorIs(t, pool.Failed(ctx, nil), ErrInvalidMessage)
+}
+
+func TestMessagePool_Close(t *testing.T) {
+	js := newTestJetStream(t)
+	publish(t, js, "a")
+
+	config := Config{
+		Stream:             "EVENTS",
+		Consumer:           "pool",
+		AckWait:            300 * time.Millisecond,
+		InProgressInterval: 50 * time.Millisecond,
+	}
+	pool := MustNewMessagePool(js, config)
+	_, err := pool.Next(context.Background())
+	require.NoError(t, err)
+
+	// Close stops the heartbeats, so the message is delivered again after
+	// AckWait.
+	require.NoError(t, pool.Close())
+	pool = MustNewMessagePool(js, config)
+	defer pool.Close()
+	assert.Equal(t, []string{"a"}, nextData(t, pool.Next, 1))
+}
+
+func TestNew_Errors(t *testing.T) {
+	js := newTestJetStream(t)
+
+	tests := []struct {
+		name        string
+		js          jetstream.JetStream
+		config      Config
+		expectedErr error
+	}{
+		{name: "Nil jetstream", config: Config{Stream: "EVENTS", Consumer: "c"}, expectedErr: ErrNilJetStream},
+		{name: "No stream", js: js, config: Config{Consumer: "c"}, expectedErr: ErrEmptyStream},
+		{name: "No consumer", js: js, config: Config{Stream: "EVENTS"}, expectedErr: ErrEmptyConsumer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.js, test.config)
+			assert.Nil(t, s)
+			assert.Equal(t, test.expectedErr, err)
+
+			p, err := NewMessagePool(test.js, test.config)
+			assert.Nil(t, p)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+
+	t.Run("Unknown stream", func(t *testing.T) {
+		_, err := New(js, Config{Stream: "UNKNOWN", Consumer: "c"})
+		assert.ErrorIs(t, err, jetstream.ErrStreamNotFound)
+	})
+}
@@ -0,0 +1,107 @@
+package redisstream
+
+import (
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+const (
+	defaultStartID       = "0"
+	defaultBatchSize     = 100
+	defaultBlock         = time.Second
+	defaultClaimMinIdle  = 5 * time.Minute
+	defaultClaimInterval = 30 * time.Second
+)
+
+var (
+	// ErrNilClient is returned when the redis client is nil.
+	ErrNilClient = errors.New("bad config: nil redis client")
+	// ErrEmptyStream is returned when the Streams are missing from the
+	// Config struct, or one of them is empty.
+	ErrEmptyStream = errors.New("bad config: empty stream")
+	// ErrEmptyGroup is returned when the Group is missing from the Config
+	// struct.
+	ErrEmptyGroup = errors.New("bad config: empty group")
+	// ErrInvalidMessage is returned when Done or Failed receives a message
+	// that wasn't returned by this package.
+	ErrInvalidMessage = errors.New("invalid message type")
+)
+
+// Config contains the configuration necessary to consume redis streams with
+// a consumer group.
+type Config struct {
+	// Streams are the keys of the streams to be consumed.
+	Streams []string
+	// Group is the consumer group. It is created if it doesn't exist, along
+	// with the streams.
+	Group string
+	// Consumer is the name of this consumer in the group. It must be unique
+	// and should be stable across restarts, so the entries that were
+	// pending when the process stopped are delivered again to it. Default:
+	// the hostname followed by a random suffix.
+	Consumer string
+
+	// Field is the entry field with the message bytes. If empty, all fields
+	// of the entry are encoded as a JSON object. Entries without the field
+	// have empty messages.
+	Field string
+
+	// StartID is the ID the group starts after when it is created. Use "$"
+	// to consume only new entries. Default: "0", the whole stream.
+	StartID string
+	// BatchSize is how many entries are read at once. Default: 100.
+	BatchSize int64
+	// Block is how long each read waits for new entries. It also bounds
+	// how long Next takes to return after Close. Default: 1s.
+	Block time.Duration
+
+	// ClaimMinIdle is how long an entry must be pending, without being
+	// acknowledged, before it is claimed from its consumer with XAUTOCLAIM.
+	// It should be larger than the time to process a batch, otherwise
+	// entries being processed may be delivered to other consumers. Default:
+	// 5m.
+	ClaimMinIdle time.Duration
+	// ClaimInterval is how often the streams are scanned for idle pending
+	// entries. Default: 30s.
+	ClaimInterval time.Duration
+	// DisableClaim disables XAUTOCLAIM. Entries pending in other consumers
+	// are only delivered again when those consumers restart.
+	DisableClaim bool
+}
+
+func (c *Config) validate() error {
+	if len(c.Streams) == 0 {
+		return ErrEmptyStream
+	}
+	for _, stream := range c.Streams {
+		if stream == "" {
+			return ErrEmptyStream
+		}
+	}
+	if c.Group == "" {
+		return ErrEmptyGroup
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Consumer == "" {
+		c.Consumer = defaultConsumerName()
+	}
+	if c.StartID == "" {
+		c.StartID = defaultStartID
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.Block <= 0 {
+		c.Block = defaultBlock
+	}
+	if c.ClaimMinIdle <= 0 {
+		c.ClaimMinIdle = defaultClaimMinIdle
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = defaultClaimInterval
+	}
+}
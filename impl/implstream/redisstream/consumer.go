@@ -0,0 +1,330 @@
+package redisstream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// errorBackoff is how long Next waits after a failed read. The engines call
+// Next again right away, so this keeps them from hammering redis.
+const errorBackoff = time.Second
+
+// consumer reads the entries of a consumer group. It is shared by the
+// Stream and the MessagePool.
+type consumer struct {
+	client redis.Cmdable
+	config Config
+
+	// mu serializes reads.
+	mu     sync.Mutex
+	buffer []*rawMessage
+	// history is the position of the pending entries of this consumer
+	// already read, by stream. They are read before anything else, so the
+	// entries delivered before a restart are delivered again. A stream is
+	// removed after all its pending entries are read.
+	history map[string]string
+	// claimCursor is the position of the XAUTOCLAIM scan, by stream.
+	claimCursor map[string]string
+	// nextClaim is when the next XAUTOCLAIM scan starts, by stream.
+	nextClaim map[string]time.Time
+
+	closed  context.Context
+	closeFn context.CancelFunc
+}
+
+func newConsumer(client redis.Cmdable, config Config) (*consumer, error) {
+	if client == nil {
+		return nil, ErrNilClient
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+	config.Streams = append([]string(nil), config.Streams...)
+
+	c := &consumer{
+		client:      client,
+		config:      config,
+		history:     make(map[string]string, len(config.Streams)),
+		claimCursor: make(map[string]string, len(config.Streams)),
+		nextClaim:   make(map[string]time.Time, len(config.Streams)),
+	}
+	for _, stream := range config.Streams {
+		c.history[stream] = "0"
+		c.claimCursor[stream] = "0-0"
+	}
+
+	if err := c.createGroups(context.Background()); err != nil {
+		return nil, err
+	}
+
+	c.closed, c.closeFn = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// createGroups creates the consumer group in all streams, if needed.
+func (c *consumer) createGroups(ctx context.Context) error {
+	const op = errors.Op("redisstream.consumer.createGroups")
+
+	for _, stream := range c.config.Streams {
+		err := c.client.XGroupCreateMkStream(ctx, stream, c.config.Group, c.config.StartID).Err()
+		if err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
+			return errors.E(op, err, errors.KV("stream", stream), errors.KV("group", c.config.Group))
+		}
+	}
+	return nil
+}
+
+// next returns the next entry, reading more if needed. It returns io.EOF if
+// the consumer is closed or ctx is done.
+func (c *consumer) next(ctx context.Context) (*rawMessage, error) {
+	const op = errors.Op("redisstream.consumer.next")
+
+	// Close interrupts a blocked read.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.closed, cancel)
+	defer stop()
+
+	msg, err := c.read(ctx)
+	if err != nil && err != io.EOF {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to read redis stream entries")
+		// The lock is already released, so the wait doesn't block the
+		// other calls.
+		wait(ctx, errorBackoff)
+		return nil, errors.E(op, err)
+	}
+	return msg, err
+}
+
+// read returns the next entry in the buffer, fetching more if it is empty.
+// It returns io.EOF if ctx is done.
+func (c *consumer) read(ctx context.Context) (*rawMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.buffer) == 0 {
+		if ctx.Err() != nil {
+			return nil, io.EOF
+		}
+
+		if err := c.fetch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+	}
+
+	msg := c.buffer[0]
+	c.buffer[0] = nil
+	c.buffer = c.buffer[1:]
+	return msg, nil
+}
+
+// fetch fills the buffer with the pending entries of this consumer, idle
+// pending entries claimed from other consumers or new entries, in this
+// order.
+func (c *consumer) fetch(ctx context.Context) error {
+	if err := c.readHistory(ctx); err != nil || len(c.buffer) > 0 {
+		return err
+	}
+	if err := c.claim(ctx); err != nil || len(c.buffer) > 0 {
+		return err
+	}
+	return c.readNew(ctx)
+}
+
+func (c *consumer) readHistory(ctx context.Context) error {
+	const op = errors.Op("redisstream.consumer.readHistory")
+
+	for _, stream := range c.config.Streams {
+		id, ok := c.history[stream]
+		if !ok {
+			continue
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.config.Group,
+			Consumer: c.config.Consumer,
+			Streams:  []string{stream, id},
+			Count:    c.config.BatchSize,
+			Block:    -1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return errors.E(op, err, errors.KV("stream", stream))
+		}
+
+		var messages []redis.XMessage
+		for _, s := range streams {
+			messages = append(messages, s.Messages...)
+		}
+		if len(messages) == 0 {
+			delete(c.history, stream)
+			continue
+		}
+
+		c.history[stream] = messages[len(messages)-1].ID
+		if err := c.add(ctx, stream, messages); err != nil {
+			return errors.E(op, err)
+		}
+		return nil
+	}
+	return nil
+}
+
+func (c *consumer) claim(ctx context.Context) error {
+	const op = errors.Op("redisstream.consumer.claim")
+
+	if c.config.DisableClaim {
+		return nil
+	}
+
+	now := time.Now()
+	for _, stream := range c.config.Streams {
+		if now.Before(c.nextClaim[stream]) {
+			continue
+		}
+
+		messages, cursor, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    c.config.Group,
+			MinIdle:  c.config.ClaimMinIdle,
+			Start:    c.claimCursor[stream],
+			Count:    c.config.BatchSize,
+			Consumer: c.config.Consumer,
+		}).Result()
+		if err != nil {
+			return errors.E(op, err, errors.KV("stream", stream))
+		}
+
+		// The scan continues in the next fetch until it reaches the end of
+		// the pending entries.
+		c.claimCursor[stream] = cursor
+		if cursor == "0-0" {
+			c.nextClaim[stream] = now.Add(c.config.ClaimInterval)
+		}
+
+		if err := c.add(ctx, stream, messages); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+func (c *consumer) readNew(ctx context.Context) error {
+	const op = errors.Op("redisstream.consumer.readNew")
+
+	streams := make([]string, 0, 2*len(c.config.Streams))
+	streams = append(streams, c.config.Streams...)
+	for range c.config.Streams {
+		streams = append(streams, ">")
+	}
+
+	result, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.config.Group,
+		Consumer: c.config.Consumer,
+		Streams:  streams,
+		Count:    c.config.BatchSize,
+		Block:    c.config.Block,
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	for _, s := range result {
+		if err := c.add(ctx, s.Stream, s.Messages); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+// add appends the entries to the buffer. Entries deleted from the stream
+// while pending have no values, so they are acknowledged and skipped.
+func (c *consumer) add(ctx context.Context, stream string, messages []redis.XMessage) error {
+	const op = errors.Op("redisstream.consumer.add")
+
+	var deleted []string
+	for _, m := range messages {
+		if m.Values == nil {
+			deleted = append(deleted, m.ID)
+			continue
+		}
+
+		data, err := c.data(m.Values)
+		if err != nil {
+			return errors.E(op, err, errors.KV("stream", stream), errors.KV("id", m.ID))
+		}
+		c.buffer = append(c.buffer, &rawMessage{stream: stream, id: m.ID, data: data})
+	}
+
+	if len(deleted) > 0 {
+		if err := c.ack(ctx, stream, deleted...); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+func (c *consumer) data(values map[string]interface{}) ([]byte, error) {
+	if c.config.Field == "" {
+		return json.Marshal(values)
+	}
+
+	switch v := values[c.config.Field].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
+
+func (c *consumer) ack(ctx context.Context, stream string, ids ...string) error {
+	const op = errors.Op("redisstream.consumer.ack")
+
+	if err := c.client.XAck(ctx, stream, c.config.Group, ids...).Err(); err != nil {
+		return errors.E(op, err, errors.KV("stream", stream))
+	}
+	return nil
+}
+
+func (c *consumer) close() error {
+	c.closeFn()
+	return nil
+}
+
+func wait(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func defaultConsumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "goduck"
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hostname + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,75 @@
+package redisstream
+
+import (
+	"context"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/redis/go-redis/v9"
+)
+
+type messagePool struct {
+	consumer *consumer
+}
+
+// NewMessagePool creates a goduck.MessagePool that consumes redis streams
+// with a consumer group. Done acknowledges a single entry with XACK.
+//
+// Failed leaves the entry pending, so it is claimed again with XAUTOCLAIM
+// after Config.ClaimMinIdle, by this or another consumer. If DisableClaim is
+// set, failed entries are only returned again when the consumer restarts.
+// The client is not closed by Close.
+func NewMessagePool(client redis.Cmdable, config Config) (goduck.MessagePool, error) {
+	c, err := newConsumer(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messagePool{consumer: c}, nil
+}
+
+// MustNewMessagePool calls NewMessagePool but panics in case of error.
+func MustNewMessagePool(client redis.Cmdable, config Config) goduck.MessagePool {
+	p, err := NewMessagePool(client, config)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *messagePool) Next(ctx context.Context) (goduck.RawMessage, error) {
+	msg, err := p.consumer.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (p *messagePool) Done(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("redisstream.messagePool.Done")
+
+	casted, ok := msg.(*rawMessage)
+	if !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+
+	if err := p.consumer.ack(ctx, casted.stream, casted.id); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+func (p *messagePool) Failed(ctx context.Context, msg goduck.RawMessage) error {
+	const op = errors.Op("redisstream.messagePool.Failed")
+
+	if _, ok := msg.(*rawMessage); !ok {
+		return errors.E(op, ErrInvalidMessage)
+	}
+
+	// The entry stays pending until it is claimed again.
+	return nil
+}
+
+func (p *messagePool) Close() error {
+	return p.consumer.close()
+}
@@ -0,0 +1,11 @@
+package redisstream
+
+type rawMessage struct {
+	stream string
+	id     string
+	data   []byte
+}
+
+func (m *rawMessage) Bytes() []byte {
+	return m.data
+}
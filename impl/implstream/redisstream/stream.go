@@ -0,0 +1,79 @@
+package redisstream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck"
+	"github.com/redis/go-redis/v9"
+)
+
+type goduckStream struct {
+	consumer *consumer
+
+	// delivered are the IDs returned by Next since the last Done, by
+	// stream.
+	delivered     map[string][]string
+	deliveredLock sync.Mutex
+}
+
+// New creates a goduck.Stream that consumes redis streams with a consumer
+// group. Entries are returned in the order they are read and Done
+// acknowledges all entries returned so far with XACK.
+//
+// Entries left pending by this consumer, like after a crash, are returned
+// first. Entries left pending by dead consumers are claimed with XAUTOCLAIM,
+// so they may be returned out of order. The client is not closed by Close.
+func New(client redis.Cmdable, config Config) (goduck.Stream, error) {
+	c, err := newConsumer(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &goduckStream{
+		consumer:  c,
+		delivered: make(map[string][]string),
+	}, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(client redis.Cmdable, config Config) goduck.Stream {
+	s, err := New(client, config)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *goduckStream) Next(ctx context.Context) (goduck.RawMessage, error) {
+	msg, err := s.consumer.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deliveredLock.Lock()
+	defer s.deliveredLock.Unlock()
+	s.delivered[msg.stream] = append(s.delivered[msg.stream], msg.id)
+
+	return msg, nil
+}
+
+func (s *goduckStream) Done(ctx context.Context) error {
+	const op = errors.Op("redisstream.goduckStream.Done")
+
+	s.deliveredLock.Lock()
+	defer s.deliveredLock.Unlock()
+
+	for stream, ids := range s.delivered {
+		if err := s.consumer.ack(ctx, stream, ids...); err != nil {
+			return errors.E(op, err)
+		}
+		delete(s.delivered, stream)
+	}
+	return nil
+}
+
+func (s *goduckStream) Close() error {
+	return s.consumer.close()
+}
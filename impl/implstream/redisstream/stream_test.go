@@ -0,0 +1,199 @@
+package redisstream
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/arquivei/goduck"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+func testConfig(consumer string) Config {
+	return Config{
+		Streams:  []string{"events"},
+		Group:    "group",
+		Consumer: consumer,
+		Field:    "data",
+		Block:    10 * time.Millisecond,
+	}
+}
+
+func addEntries(t *testing.T, client *redis.Client, data ...string) {
+	for _, d := range data {
+		err := client.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: "events",
+			Values: map[string]interface{}{"data": d},
+		}).Err()
+		require.NoError(t, err)
+	}
+}
+
+func nextData(t *testing.T, next func(context.Context) (goduck.RawMessage, error), n int) []string {
+	var data []string
+	for i := 0; i < n; i++ {
+		msg, err := next(context.Background())
+		require.NoError(t, err)
+		data = append(data, string(msg.Bytes()))
+	}
+	return data
+}
+
+func pending(t *testing.T, client *redis.Client) int64 {
+	p, err := client.XPending(context.Background(), "events", "group").Result()
+	require.NoError(t, err)
+	return p.Count
+}
+
+// assertNoMessages checks that Next has nothing to return.
+func assertNoMessages(t *testing.T, next func(context.Context) (goduck.RawMessage, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	msg, err := next(ctx)
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStream(t *testing.T) {
+	_, client := newTestClient(t)
+	addEntries(t, client, "a", "b", "c")
+
+	stream := MustNew(client, testConfig("c1"))
+	assert.Equal(t, []string{"a", "b", "c"}, nextData(t, stream.Next, 3))
+	assert.Equal(t, int64(3), pending(t, client))
+
+	require.NoError(t, stream.Done(context.Background()))
+	assert.Equal(t, int64(0), pending(t, client))
+
+	addEntries(t, client, "d")
+	assert.Equal(t, []string{"d"}, nextData(t, stream.Next, 1))
+	assertNoMessages(t, stream.Next)
+
+	require.NoError(t, stream.Close())
+	msg, err := stream.Next(context.Background())
+	assert.Nil(t, msg)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStream_RedeliversPendingEntries(t *testing.T) {
+	_, client := newTestClient(t)
+	addEntries(t, client, "a", "b", "c")
+
+	stream := MustNew(client, testConfig("c1"))
+	assert.Equal(t, []string{"a", "b"}, nextData(t, stream.Next, 2))
+	require.NoError(t, stream.Close())
+
+	// The same consumer gets its pending entries before the new ones.
+	stream = MustNew(client, testConfig("c1"))
+	assert.Equal(t, []string{"a", "b", "c"}, nextData(t, stream.Next, 3))
+	require.NoError(t, stream.Done(context.Background()))
+	assertNoMessages(t, stream.Next)
+	assert.Equal(t, int64(0), pending(t, client))
+}
+
+func TestStream_JSONEntries(t *testing.T) {
+	_, client := newTestClient(t)
+	err := client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: "events",
+		Values: map[string]interface{}{"id": "1", "type": "login"},
+	}).Err()
+	require.NoError(t, err)
+
+	config := testConfig("c1")
+	config.Field = ""
+	stream := MustNew(client, config)
+
+	assert.Equal(t, []string{`{"id":"1","type":"login"}`}, nextData(t, stream.Next, 1))
+}
+
+func TestMessagePool(t *testing.T) {
+	mr, client := newTestClient(t)
+	now := time.Now()
+	mr.SetTime(now)
+	addEntries(t, client, "a", "b", "c")
+
+	config := testConfig("c1")
+	config.BatchSize = 2
+	pool := MustNewMessagePool(client, config)
+
+	ctx := context.Background()
+	a, err := pool.Next(ctx)
+	require.NoError(t, err)
+	b, err := pool.Next(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, pool.Done(ctx, b))
+	require.NoError(t, pool.Failed(ctx, a))
+	assert.Equal(t, int64(1), pending(t, client))
+
+	// The failed entry is claimed by another consumer once it is idle,
+	// before it reads new entries.
+	mr.SetTime(now.Add(defaultClaimMinIdle + time.Second))
+	other := MustNewMessagePool(client, testConfig("c2"))
+	assert.Equal(t, []string{"a", "c"}, nextData(t, other.Next, 2))
+
+	assert.ErrorIs(t, pool.Done(ctx, nil), ErrInvalidMessage)
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, client := newTestClient(t)
+
+	tests := []struct {
+		name        string
+		client      redis.Cmdable
+		config      Config
+		expectedErr error
+	}{
+		{name: "Nil client", config: testConfig("c1"), expectedErr: ErrNilClient},
+		{name: "No streams", client: client, config: Config{Group: "group"}, expectedErr: ErrEmptyStream},
+		{name: "Empty stream", client: client, config: Config{Streams: []string{""}, Group: "group"}, expectedErr: ErrEmptyStream},
+		{name: "No group", client: client, config: Config{Streams: []string{"events"}}, expectedErr: ErrEmptyGroup},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.client, test.config)
+			assert.Nil(t, s)
+			assert.Equal(t, test.expectedErr, err)
+
+			p, err := NewMessagePool(test.client, test.config)
+			assert.Nil(t, p)
+			assert.Equal(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestMessagePool_ErrorBackoffReleasesLock(t *testing.T) {
+	mr, client := newTestClient(t)
+	pool := MustNewMessagePool(client, testConfig("c1"))
+	defer pool.Close()
+
+	mr.SetError("ERR unavailable")
+	failed := make(chan error, 1)
+	go func() {
+		_, err := pool.Next(context.Background())
+		failed <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// The failed Next is waiting for the backoff, which doesn't block the
+	// other calls.
+	mr.SetError("")
+	addEntries(t, client, "a")
+	start := time.Now()
+	assert.Equal(t, []string{"a"}, nextData(t, pool.Next, 1))
+	assert.Less(t, time.Since(start), errorBackoff/2)
+
+	assert.Error(t, <-failed)
+}
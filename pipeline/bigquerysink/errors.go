@@ -18,4 +18,17 @@ var (
 
 	// ErrEmptyData is returned when the Message.Data is nil.
 	ErrEmptyData = errors.New("data is missing from the message")
+
+	// ErrSchemaRequired is returned by the Storage Write API sink when
+	// Message.Schema is empty and it can't be inferred from Message.Data.
+	ErrSchemaRequired = errors.New("schema is required for data that is not a struct")
+
+	// ErrInvalidRow is returned by the Storage Write API sink when
+	// Message.Data doesn't match the table schema.
+	ErrInvalidRow = errors.New("data doesn't match the table schema")
+
+	// ErrNonAdditiveSchemaChange is returned when a column of Message.Data
+	// has a different type or mode than the same column in the table, or in
+	// other messages of the same table. Only new columns can be added.
+	ErrNonAdditiveSchemaChange = errors.New("non-additive schema change: column type or mode changed")
 )
@@ -32,3 +32,33 @@ func WithIgnoreValidationErrors() Option {
 		bs.shouldIgnoreValidationErrors = true
 	}
 }
+
+// WithSchemaManagement makes the bigquery sink create missing tables and add
+// new columns to existing tables before writing. The schema is
+// Message.Schema or, if empty, the one inferred from Message.Data, which must
+// then be a struct. Tables are created with the given options.
+//
+// Only additive changes are made and new columns are always nullable. If a
+// column changes its type or mode, Store fails with
+// ErrNonAdditiveSchemaChange. If a write still fails because of missing
+// columns, the table schema is read again, changed and the write is retried
+// once.
+func WithSchemaManagement(tableOptions TableOptions) Option {
+	return func(bs *bigquerySink) {
+		bs.schemaManager = newSchemaManager(tableOptions)
+	}
+}
+
+// WithRejectsTable makes the bigquery sink write the rows that BigQuery
+// refuses to the given table, instead of failing the whole Store. The valid
+// rows of the batch are still stored. The rejects table must have the
+// RejectsSchema, or it is created if schema management is enabled.
+//
+// If the rejects can't be written, Store fails and the batch can be retried.
+// With the legacy streaming inserts, the rows that were already stored are
+// deduplicated by their Message.InsertID.
+func WithRejectsTable(projectID, datasetID, tableID string) Option {
+	return func(bs *bigquerySink) {
+		bs.rejectsTable = bs.client.DatasetInProject(projectID, datasetID).Table(tableID)
+	}
+}
@@ -0,0 +1,98 @@
+package bigquerysink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Reject is a row of the rejects table. See WithRejectsTable.
+type Reject struct {
+	// Table is the fully qualified name of the table the row was sent to.
+	Table string `bigquery:"table"`
+	// InsertID is the insert ID of the rejected row.
+	InsertID string `bigquery:"insert_id"`
+	// Payload is Message.Data encoded as JSON.
+	Payload string `bigquery:"payload"`
+	// Reason is the error returned for the row.
+	Reason string `bigquery:"reason"`
+	// RejectedAt is when the row was rejected.
+	RejectedAt time.Time `bigquery:"rejected_at"`
+}
+
+// RejectsSchema is the schema of the rejects table.
+var RejectsSchema = mustInferSchema(Reject{})
+
+// rejectFunc writes the rows of a bigquery.PutMultiError to the rejects
+// table. RowIndex is the index of the message in the job.
+type rejectFunc func(ctx context.Context, rowErrs bigquery.PutMultiError) error
+
+func (s *bigquerySink) reject(ctx context.Context, job *putJob, rowErrs bigquery.PutMultiError) error {
+	const op errors.Op = "bigquerysink.bigquerySink.reject"
+
+	now := time.Now()
+	rows := make([]*bigquery.StructSaver, 0, len(rowErrs))
+	for _, rowErr := range rowErrs {
+		if rowErr.RowIndex < 0 || rowErr.RowIndex >= len(job.messages) {
+			return errors.E(op, "row index out of range", errors.SeverityRuntime, errors.KV("index", rowErr.RowIndex))
+		}
+		message := job.messages[rowErr.RowIndex]
+		// The inserter reports the ID of the ValueSaver, if it has one.
+		insertID := rowErr.InsertID
+		if insertID == "" {
+			insertID = job.insertID(rowErr.RowIndex)
+		}
+
+		rows = append(rows, &bigquery.StructSaver{
+			Schema:   RejectsSchema,
+			InsertID: insertID,
+			Struct: Reject{
+				Table:      job.table.FullyQualifiedName(),
+				InsertID:   insertID,
+				Payload:    payloadJSON(message.Data),
+				Reason:     rowErr.Errors.Error(),
+				RejectedAt: now,
+			},
+		})
+	}
+
+	if s.schemaManager != nil {
+		if _, err := s.schemaManager.ensure(ctx, s.rejectsTable, RejectsSchema); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	if err := s.rejectsTable.Inserter().Put(ctx, rows); err != nil {
+		return errors.E(op, err, errors.SeverityRuntime, errors.KV("rejects_table", s.rejectsTable.FullyQualifiedName()))
+	}
+
+	logger := log.Ctx(ctx).Level(s.logLevel)
+	logger.Warn().
+		Str("bigquery_table", job.table.FullyQualifiedName()).
+		Int("rejected_rows", len(rows)).
+		Msg("[goduck][pipeline][bigquerySink] Rows were written to the rejects table.")
+
+	return nil
+}
+
+// payloadJSON encodes the data as JSON or, if it can't, as text.
+func payloadJSON(data interface{}) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprintf("%+v", data)
+	}
+	return string(b)
+}
+
+func mustInferSchema(st interface{}) bigquery.Schema {
+	schema, err := bigquery.InferSchema(st)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
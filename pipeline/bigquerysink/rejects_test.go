@@ -0,0 +1,155 @@
+package bigquerysink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+type insertAllRequest struct {
+	SkipInvalidRows bool `json:"skipInvalidRows"`
+	Rows            []struct {
+		InsertID string                 `json:"insertId"`
+		JSON     map[string]interface{} `json:"json"`
+	} `json:"rows"`
+}
+
+// fakeInsertAll records the insertAll requests of each table and fails the
+// rows of the "events" table whose Key is "bad".
+type fakeInsertAll struct {
+	mu       sync.Mutex
+	requests map[string][]insertAllRequest
+}
+
+func (f *fakeInsertAll) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasSuffix(r.URL.Path, "/insertAll") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	table := parts[len(parts)-2]
+
+	var request insertAllRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		panic(err)
+	}
+	f.requests[table] = append(f.requests[table], request)
+
+	var insertErrors []string
+	if table == "events" {
+		for i, row := range request.Rows {
+			if row.JSON["Key"] == "bad" {
+				insertErrors = append(insertErrors, fmt.Sprintf(
+					`{"index":%d,"errors":[{"reason":"invalid","message":"bad key"}]}`, i))
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"kind":"bigquery#tableDataInsertAllResponse","insertErrors":[%s]}`,
+		strings.Join(insertErrors, ","))
+}
+
+func TestStore_Rejects(t *testing.T) {
+	type event struct {
+		Key   string
+		Value int64
+	}
+
+	fake := &fakeInsertAll{requests: map[string][]insertAllRequest{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client, err := bigquery.NewClient(context.Background(), "project",
+		option.WithEndpoint(server.URL),
+		option.WithoutAuthentication(),
+	)
+	require.NoError(t, err)
+
+	sink := MustNew(client, WithRejectsTable("project", "dataset", "rejects"))
+
+	newMessage := func(data interface{}) Message {
+		return Message{ProjectID: "project", DatasetID: "dataset", TableID: "events", Data: data}
+	}
+	messages := []Message{
+		newMessage(event{Key: "good", Value: 1}),
+		newMessage(map[string]string{"Key": "not a struct"}),
+		newMessage(event{Key: "bad", Value: 2}),
+		newMessage(event{Key: "good", Value: 3}),
+	}
+	messages[3].InsertID = "custom"
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.Store(context.Background(), messages[0], messages[1], messages[2], messages[3]))
+	}
+
+	events := fake.requests["events"]
+	require.Len(t, events, 2)
+	assert.True(t, events[0].SkipInvalidRows)
+	require.Len(t, events[0].Rows, 3)
+	assert.Equal(t, "custom", events[0].Rows[2].InsertID)
+	// Retries send the same insert IDs, so BigQuery deduplicates them.
+	assert.Equal(t, events[0].Rows, events[1].Rows)
+	assert.NotEmpty(t, events[0].Rows[0].InsertID)
+
+	rejects := fake.requests["rejects"]
+	require.Len(t, rejects, 2)
+	require.Len(t, rejects[0].Rows, 2)
+
+	notStruct := rejects[0].Rows[0]
+	assert.Equal(t, "project:dataset.events", notStruct.JSON["table"])
+	assert.Equal(t, `{"Key":"not a struct"}`, notStruct.JSON["payload"])
+	assert.Contains(t, notStruct.JSON["reason"], "bigquery:")
+	assert.NotEmpty(t, notStruct.JSON["rejected_at"])
+
+	bad := rejects[0].Rows[1]
+	assert.Equal(t, `{"Key":"bad","Value":2}`, bad.JSON["payload"])
+	assert.Contains(t, bad.JSON["reason"], `Message: "bad key"`)
+	assert.Equal(t, events[0].Rows[1].InsertID, bad.InsertID)
+	assert.Equal(t, events[1].Rows[1].InsertID, rejects[1].Rows[1].InsertID)
+}
+
+func TestStore_InsertIDs(t *testing.T) {
+	type event struct {
+		Key string
+	}
+
+	fake := &fakeInsertAll{requests: map[string][]insertAllRequest{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client, err := bigquery.NewClient(context.Background(), "project",
+		option.WithEndpoint(server.URL),
+		option.WithoutAuthentication(),
+	)
+	require.NoError(t, err)
+
+	sink := MustNew(client)
+	message := Message{ProjectID: "project", DatasetID: "dataset", TableID: "counters", Data: &event{Key: "a"}}
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.Store(context.Background(), message, message))
+	}
+
+	// Equal rows of a batch get different insert IDs, so BigQuery doesn't
+	// drop them, but a retried batch gets the same IDs.
+	requests := fake.requests["counters"]
+	require.Len(t, requests, 2)
+	require.Len(t, requests[0].Rows, 2)
+	assert.NotEmpty(t, requests[0].Rows[0].InsertID)
+	assert.NotEqual(t, requests[0].Rows[0].InsertID, requests[0].Rows[1].InsertID)
+	assert.Equal(t, requests[0].Rows, requests[1].Rows)
+}
@@ -0,0 +1,213 @@
+package bigquerysink
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/arquivei/foundationkit/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TableOptions configures the tables created by the sink when schema
+// management is enabled. See WithSchemaManagement.
+type TableOptions struct {
+	// TimePartitioning is the time partitioning of the created tables.
+	// Optional.
+	TimePartitioning *bigquery.TimePartitioning
+	// Clustering is the clustering of the created tables. Optional.
+	Clustering *bigquery.Clustering
+}
+
+// schemaManager creates missing tables and adds new columns to existing
+// tables.
+type schemaManager struct {
+	tableOptions TableOptions
+
+	mu sync.Mutex
+	// schemas caches the known schema of each table.
+	schemas map[string]bigquery.Schema
+}
+
+func newSchemaManager(tableOptions TableOptions) *schemaManager {
+	return &schemaManager{
+		tableOptions: tableOptions,
+		schemas:      make(map[string]bigquery.Schema),
+	}
+}
+
+// ensure makes sure the table exists and has all columns of schema. It
+// returns true if the table was created or changed.
+func (m *schemaManager) ensure(ctx context.Context, table *bigquery.Table, schema bigquery.Schema) (bool, error) {
+	const op = errors.Op("bigquerysink.schemaManager.ensure")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := table.FullyQualifiedName()
+	if known, ok := m.schemas[name]; ok {
+		_, changed, err := mergeSchema(known, schema)
+		if err != nil {
+			return false, errors.E(op, err, errors.KV("table", name))
+		}
+		if !changed {
+			return false, nil
+		}
+	}
+
+	metadata, err := table.Metadata(ctx)
+	if isNotFound(err) {
+		metadata, err = m.create(ctx, table, schema)
+		if err == nil {
+			m.schemas[name] = metadata.Schema
+			return true, nil
+		}
+	}
+	if err != nil {
+		return false, errors.E(op, err, errors.SeverityRuntime, errors.KV("table", name))
+	}
+
+	merged, changed, err := mergeSchema(metadata.Schema, schema)
+	if err != nil {
+		return false, errors.E(op, err, errors.KV("table", name))
+	}
+
+	if changed {
+		metadata, err = table.Update(ctx, bigquery.TableMetadataToUpdate{Schema: merged}, metadata.ETag)
+		if err != nil {
+			return false, errors.E(op, err, errors.SeverityRuntime, errors.KV("table", name))
+		}
+	}
+
+	m.schemas[name] = metadata.Schema
+	return changed, nil
+}
+
+// invalidate removes the cached schema of the table, so it is read again.
+func (m *schemaManager) invalidate(table *bigquery.Table) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.schemas, table.FullyQualifiedName())
+}
+
+func (m *schemaManager) create(ctx context.Context, table *bigquery.Table, schema bigquery.Schema) (*bigquery.TableMetadata, error) {
+	err := table.Create(ctx, &bigquery.TableMetadata{
+		Schema:           schema,
+		TimePartitioning: m.tableOptions.TimePartitioning,
+		Clustering:       m.tableOptions.Clustering,
+	})
+	// Another writer may have created the table in the meantime.
+	if err != nil && !isAlreadyExists(err) {
+		return nil, err
+	}
+	return table.Metadata(ctx)
+}
+
+// mergeSchema adds the columns of schema that are missing in current. New
+// columns are always nullable, because BigQuery can't add required columns.
+// It returns ErrNonAdditiveSchemaChange if a column changes its type or mode.
+func mergeSchema(current, schema bigquery.Schema) (bigquery.Schema, bool, error) {
+	const op = errors.Op("bigquerysink.mergeSchema")
+
+	merged := make(bigquery.Schema, len(current))
+	copy(merged, current)
+	changed := false
+
+	for _, field := range schema {
+		i := fieldIndex(merged, field.Name)
+		if i < 0 {
+			added := *field
+			if !added.Repeated {
+				added.Required = false
+			}
+			merged = append(merged, &added)
+			changed = true
+			continue
+		}
+
+		existing := merged[i]
+		if existing.Type != field.Type || existing.Repeated != field.Repeated {
+			return nil, false, errors.E(op, ErrNonAdditiveSchemaChange, errors.SeverityInput,
+				errors.KV("field", field.Name),
+				errors.KV("table_type", fieldTypeName(existing)),
+				errors.KV("data_type", fieldTypeName(field)),
+			)
+		}
+
+		if existing.Type == bigquery.RecordFieldType {
+			nested, nestedChanged, err := mergeSchema(existing.Schema, field.Schema)
+			if err != nil {
+				return nil, false, errors.E(op, err, errors.KV("record", field.Name))
+			}
+			if nestedChanged {
+				updated := *existing
+				updated.Schema = nested
+				merged[i] = &updated
+				changed = true
+			}
+		}
+	}
+
+	return merged, changed, nil
+}
+
+// fieldIndex finds the field by name. BigQuery column names are case
+// insensitive.
+func fieldIndex(schema bigquery.Schema, name string) int {
+	for i, field := range schema {
+		if strings.EqualFold(field.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func fieldTypeName(field *bigquery.FieldSchema) string {
+	if field.Repeated {
+		return "REPEATED " + string(field.Type)
+	}
+	return string(field.Type)
+}
+
+// isSchemaMismatch checks if the write failed because the data has columns
+// that are not in the table. The error may be wrapped.
+func isSchemaMismatch(err error) bool {
+	var multiErr bigquery.PutMultiError
+	if stderrors.As(err, &multiErr) {
+		for _, rowErr := range multiErr {
+			for _, e := range rowErr.Errors {
+				if strings.Contains(e.Error(), "no such field") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if stderrors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Error(), "no such field")
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if stderrors.As(err, &grpcErr) {
+		s := grpcErr.GRPCStatus()
+		return s.Code() == codes.InvalidArgument && strings.Contains(strings.ToLower(s.Message()), "schema")
+	}
+	return false
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return stderrors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func isAlreadyExists(err error) bool {
+	var apiErr *googleapi.Error
+	return stderrors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
@@ -0,0 +1,361 @@
+package bigquerysink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMergeSchema(t *testing.T) {
+	current := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "item", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "sku", Type: bigquery.StringFieldType},
+		}},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	}
+
+	tests := []struct {
+		name            string
+		schema          bigquery.Schema
+		expectedSchema  bigquery.Schema
+		expectedChanged bool
+		expectedErr     error
+	}{
+		{
+			name: "Unchanged, case insensitive",
+			schema: bigquery.Schema{
+				{Name: "ID", Type: bigquery.StringFieldType, Required: true},
+				{Name: "Tags", Type: bigquery.StringFieldType, Repeated: true},
+			},
+			expectedSchema:  current,
+			expectedChanged: false,
+		},
+		{
+			name: "New columns are nullable",
+			schema: bigquery.Schema{
+				{Name: "count", Type: bigquery.IntegerFieldType, Required: true},
+				{Name: "item", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+					{Name: "quantity", Type: bigquery.IntegerFieldType, Required: true},
+				}},
+			},
+			expectedSchema: bigquery.Schema{
+				{Name: "id", Type: bigquery.StringFieldType, Required: true},
+				{Name: "item", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+					{Name: "sku", Type: bigquery.StringFieldType},
+					{Name: "quantity", Type: bigquery.IntegerFieldType},
+				}},
+				{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+				{Name: "count", Type: bigquery.IntegerFieldType},
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "Type change",
+			schema: bigquery.Schema{
+				{Name: "id", Type: bigquery.IntegerFieldType},
+			},
+			expectedErr: ErrNonAdditiveSchemaChange,
+		},
+		{
+			name: "Nested type change",
+			schema: bigquery.Schema{
+				{Name: "item", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+					{Name: "sku", Type: bigquery.BytesFieldType},
+				}},
+			},
+			expectedErr: ErrNonAdditiveSchemaChange,
+		},
+		{
+			name: "Mode change",
+			schema: bigquery.Schema{
+				{Name: "tags", Type: bigquery.StringFieldType},
+			},
+			expectedErr: ErrNonAdditiveSchemaChange,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, changed, err := mergeSchema(current, test.schema)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedChanged, changed)
+			assert.Equal(t, test.expectedSchema, merged)
+		})
+	}
+
+	// current must not be modified.
+	assert.Len(t, current, 3)
+	assert.Len(t, current[1].Schema, 1)
+}
+
+func TestPutJobSchema(t *testing.T) {
+	type v1 struct {
+		ID string
+	}
+	type v2 struct {
+		ID    string
+		Count int64
+	}
+
+	job := &putJob{messages: []Message{
+		{Data: v1{ID: "a"}},
+		{Data: v2{ID: "b", Count: 1}},
+	}}
+
+	schema, err := job.schema()
+	require.NoError(t, err)
+	assert.Equal(t, bigquery.Schema{
+		{Name: "ID", Type: bigquery.StringFieldType},
+		{Name: "Count", Type: bigquery.IntegerFieldType},
+	}, schema)
+}
+
+// fakeBigQuery serves the tables API and insertAll for the tables it
+// knows. Rows with columns that are not in the table schema fail with
+// "no such field".
+type fakeBigQuery struct {
+	mu      sync.Mutex
+	schemas map[string]bigquery.Schema
+	// calls are the method and path of each request.
+	calls []string
+	// staleInserts makes the next inserts fail as if the table didn't have
+	// the columns added by the last change yet.
+	staleInserts int
+	added        map[string]bool
+	// inserts are the insertAll requests.
+	inserts []insertAllRequest
+}
+
+func newFakeBigQuery(t *testing.T) (*fakeBigQuery, *bigquery.Client) {
+	fake := &fakeBigQuery{schemas: map[string]bigquery.Schema{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := bigquery.NewClient(context.Background(), "project",
+		option.WithEndpoint(server.URL),
+		option.WithoutAuthentication(),
+	)
+	require.NoError(t, err)
+	return fake, client
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	// projects/{project}/datasets/{dataset}/tables[/{table}[/insertAll]]
+	for len(parts) > 0 && parts[0] != "projects" {
+		parts = parts[1:]
+	}
+	f.calls = append(f.calls, r.Method+" "+strings.Join(parts[4:], "/"))
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 5:
+		var table struct {
+			TableReference struct {
+				TableID string `json:"tableId"`
+			} `json:"tableReference"`
+			Schema struct {
+				Fields json.RawMessage `json:"fields"`
+			} `json:"schema"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+			panic(err)
+		}
+		schema, err := bigquery.SchemaFromJSON(table.Schema.Fields)
+		if err != nil {
+			panic(err)
+		}
+		f.schemas[table.TableReference.TableID] = schema
+		f.writeTable(w, table.TableReference.TableID)
+
+	case r.Method == http.MethodGet && len(parts) == 6:
+		if _, ok := f.schemas[parts[5]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"message":"Not found: Table"}}`)
+			return
+		}
+		f.writeTable(w, parts[5])
+
+	case r.Method == http.MethodPatch && len(parts) == 6:
+		var table struct {
+			Schema struct {
+				Fields json.RawMessage `json:"fields"`
+			} `json:"schema"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+			panic(err)
+		}
+		schema, err := bigquery.SchemaFromJSON(table.Schema.Fields)
+		if err != nil {
+			panic(err)
+		}
+		f.added = map[string]bool{}
+		for _, field := range schema {
+			if fieldIndex(f.schemas[parts[5]], field.Name) < 0 {
+				f.added[field.Name] = true
+			}
+		}
+		f.schemas[parts[5]] = schema
+		f.writeTable(w, parts[5])
+
+	case r.Method == http.MethodPost && len(parts) == 7 && parts[6] == "insertAll":
+		var request insertAllRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			panic(err)
+		}
+		f.inserts = append(f.inserts, request)
+		stale := f.staleInserts > 0
+		if stale {
+			f.staleInserts--
+		}
+
+		var insertErrors []string
+		for i, row := range request.Rows {
+			for column := range row.JSON {
+				if (stale && f.added[column]) || fieldIndex(f.schemas[parts[5]], column) < 0 {
+					insertErrors = append(insertErrors, fmt.Sprintf(
+						`{"index":%d,"errors":[{"reason":"invalid","message":"no such field: %s."}]}`, i, column))
+					break
+				}
+			}
+		}
+		fmt.Fprintf(w, `{"insertErrors":[%s]}`, strings.Join(insertErrors, ","))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeBigQuery) writeTable(w http.ResponseWriter, table string) {
+	fields, err := f.schemas[table].ToJSONFields()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(w, `{"tableReference":{"projectId":"project","datasetId":"dataset","tableId":%q},"schema":{"fields":%s},"etag":"etag"}`,
+		table, fields)
+}
+
+func (f *fakeBigQuery) takeCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func TestStore_SchemaManagement(t *testing.T) {
+	type v1 struct {
+		ID string
+	}
+	type v2 struct {
+		ID    string
+		Count int64
+	}
+
+	fake, client := newFakeBigQuery(t)
+	sink := MustNew(client, WithSchemaManagement(TableOptions{}))
+	message := func(data interface{}) Message {
+		return Message{ProjectID: "project", DatasetID: "dataset", TableID: "events", Data: data}
+	}
+	ctx := context.Background()
+
+	// The missing table is created.
+	require.NoError(t, sink.Store(ctx, message(v1{ID: "a"})))
+	assert.Equal(t, []string{"GET tables/events", "POST tables", "GET tables/events", "POST tables/events/insertAll"}, fake.takeCalls())
+
+	// The known schema is cached.
+	require.NoError(t, sink.Store(ctx, message(v1{ID: "b"})))
+	assert.Equal(t, []string{"POST tables/events/insertAll"}, fake.takeCalls())
+
+	// New columns are added.
+	require.NoError(t, sink.Store(ctx, message(v2{ID: "c", Count: 1})))
+	assert.Equal(t, []string{"GET tables/events", "PATCH tables/events", "POST tables/events/insertAll"}, fake.takeCalls())
+	require.Len(t, fake.schemas["events"], 2)
+	assert.Equal(t, &bigquery.FieldSchema{Name: "Count", Type: bigquery.IntegerFieldType}, fake.schemas["events"][1])
+
+	// A write that fails because of missing columns reads the table again
+	// and is retried once.
+	fake.staleInserts = 1
+	require.NoError(t, sink.Store(ctx, message(v2{ID: "d", Count: 2})))
+	assert.Equal(t, []string{"POST tables/events/insertAll", "GET tables/events", "POST tables/events/insertAll"}, fake.takeCalls())
+
+	// The table changed by someone else is only read again when the cache
+	// is invalidated.
+	fake.schemas["events"] = bigquery.Schema{{Name: "ID", Type: bigquery.StringFieldType}}
+	err := sink.Store(ctx, message(v2{ID: "e", Count: 3}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"POST tables/events/insertAll", "GET tables/events", "PATCH tables/events", "POST tables/events/insertAll"}, fake.takeCalls())
+
+	// Non additive changes are refused.
+	err = sink.Store(ctx, message(struct{ ID int64 }{ID: 1}))
+	assert.ErrorIs(t, err, ErrNonAdditiveSchemaChange)
+	assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+}
+
+func TestIsSchemaMismatch(t *testing.T) {
+	rowErr := bigquery.PutMultiError{{Errors: bigquery.MultiError{fmt.Errorf("no such field: Count.")}}}
+	apiErr := &googleapi.Error{Code: http.StatusBadRequest, Message: "no such field: Count."}
+	grpcErr := status.Error(codes.InvalidArgument, "Input schema has more fields than BigQuery schema")
+
+	for _, err := range []error{rowErr, apiErr, grpcErr} {
+		assert.True(t, isSchemaMismatch(err), err)
+		assert.True(t, isSchemaMismatch(errors.E(errors.Op("op"), err, errors.SeverityRuntime)), err)
+	}
+	assert.False(t, isSchemaMismatch(status.Error(codes.Unavailable, "unavailable")))
+	assert.False(t, isSchemaMismatch(&googleapi.Error{Code: http.StatusNotFound}))
+}
+
+func TestStore_SchemaRetryWithRejects(t *testing.T) {
+	type v1 struct {
+		ID string
+	}
+	type v2 struct {
+		ID    string
+		Count int64
+	}
+
+	fake, client := newFakeBigQuery(t)
+	sink := MustNew(client, WithSchemaManagement(TableOptions{}), WithRejectsTable("project", "dataset", "rejects"))
+	message := func(data interface{}) Message {
+		return Message{ProjectID: "project", DatasetID: "dataset", TableID: "events", Data: data}
+	}
+	ctx := context.Background()
+
+	require.NoError(t, sink.Store(ctx, message(v1{ID: "a"})))
+	require.NoError(t, sink.Store(ctx, message(v2{ID: "b", Count: 1})))
+	fake.takeCalls()
+
+	// The valid row is written by the first insert, so only the row that
+	// failed because of the stale schema is retried.
+	fake.staleInserts = 1
+	fake.inserts = nil
+	require.NoError(t, sink.Store(ctx, message(v1{ID: "c"}), message(v2{ID: "d", Count: 2})))
+	assert.Equal(t, []string{"POST tables/events/insertAll", "GET tables/events", "POST tables/events/insertAll"}, fake.takeCalls())
+	require.Len(t, fake.inserts, 2)
+	require.Len(t, fake.inserts[1].Rows, 1)
+	assert.Equal(t, "d", fake.inserts[1].Rows[0].JSON["ID"])
+	assert.Equal(t, fake.inserts[0].Rows[1].InsertID, fake.inserts[1].Rows[0].InsertID)
+}
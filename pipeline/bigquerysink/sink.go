@@ -2,6 +2,11 @@ package bigquerysink
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/arquivei/foundationkit/errors"
@@ -16,6 +21,13 @@ type bigquerySink struct {
 	logLevel                     zerolog.Level
 	shouldIgnoreUnkownMessages   bool
 	shouldIgnoreValidationErrors bool
+
+	// storageWriter is set when the Storage Write API is used.
+	storageWriter *storageWriter
+	// schemaManager is set when schema management is enabled.
+	schemaManager *schemaManager
+	// rejectsTable receives the rows that BigQuery refused.
+	rejectsTable *bigquery.Table
 }
 
 // Message is the pipeline message being stored.
@@ -31,6 +43,19 @@ type Message struct {
 	// This means that types as `map` or  `*string` will fail.
 	// Read the bigquery documentation for more details: https://pkg.go.dev/cloud.google.com/go/bigquery.
 	Data interface{}
+
+	// Schema is the table schema. It is optional and only used by the
+	// Storage Write API sink and by schema management, which infer it from
+	// Data if empty. It is required by them if Data is not a struct.
+	Schema bigquery.Schema
+
+	// InsertID is used by BigQuery to deduplicate rows sent more than once
+	// in a short period of time. It is optional. If empty, the ID returned
+	// by Data, if it is a bigquery.ValueSaver, is used. Otherwise one is
+	// derived from the table, the message position in the batch and Data,
+	// so the same batch gets the same IDs when it is retried. Set it if
+	// equal batches that are not retries can be stored within a minute.
+	InsertID string
 }
 
 // MustNew returns a new Sink that saves data to bigquiery.
@@ -82,21 +107,18 @@ func (s *bigquerySink) Store(ctx context.Context, sinkmessages ...pipeline.SinkM
 		tname := t.FullyQualifiedName()
 		job := putJobs[tname]
 		if job == nil {
-			job = &putJob{
-				table: t,
-				rows:  make([]interface{}, 0, len(sinkmessages)),
-			}
+			job = newPutJob(t, len(sinkmessages))
 			putJobs[tname] = job
 		}
 
-		job.rows = append(job.rows, message.Data)
+		job.add(message)
 		logger.Trace().
 			Str("bigquery_table", tname).
 			Msg("[goduck][pipeline][bigquerySink] Message processed.")
 	}
 
 	for _, job := range putJobs {
-		err := job.Execute(ctx)
+		err := s.writeJob(ctx, job)
 		if err != nil {
 			return errors.E(op, err, errors.KV("table", job.table.FullyQualifiedName()))
 		}
@@ -107,6 +129,69 @@ func (s *bigquerySink) Store(ctx context.Context, sinkmessages ...pipeline.SinkM
 	return nil
 }
 
+// writeJob writes the job rows, managing the table schema if enabled.
+func (s *bigquerySink) writeJob(ctx context.Context, job *putJob) error {
+	const op errors.Op = "bigquerysink.bigquerySink.writeJob"
+
+	var schema bigquery.Schema
+	schemaChanged := false
+	if s.storageWriter != nil || s.schemaManager != nil {
+		var err error
+		schema, err = job.schema()
+		if err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	if s.schemaManager != nil {
+		var err error
+		schemaChanged, err = s.schemaManager.ensure(ctx, job.table, schema)
+		if err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	// reject uses the job being written, which is replaced by the failed
+	// rows when they are retried.
+	var reject rejectFunc
+	if s.rejectsTable != nil {
+		reject = func(ctx context.Context, rowErrs bigquery.PutMultiError) error {
+			return s.reject(ctx, job, rowErrs)
+		}
+	}
+
+	err := s.write(ctx, job, schema, schemaChanged, reject)
+	if err != nil && s.schemaManager != nil && isSchemaMismatch(err) {
+		// The cached schema was stale, so the table is read and changed again
+		// before retrying once.
+		s.schemaManager.invalidate(job.table)
+		if _, err := s.schemaManager.ensure(ctx, job.table, schema); err != nil {
+			return errors.E(op, err)
+		}
+
+		// The valid rows of an insert that skips invalid rows were already
+		// written, so only the failed rows are retried.
+		var rowErrs bigquery.PutMultiError
+		if reject != nil && stderrors.As(err, &rowErrs) {
+			job = job.subset(rowErrs)
+		}
+		err = s.write(ctx, job, schema, true, reject)
+	}
+
+	var rowErrs bigquery.PutMultiError
+	if reject != nil && stderrors.As(err, &rowErrs) {
+		return reject(ctx, rowErrs)
+	}
+	return err
+}
+
+func (s *bigquerySink) write(ctx context.Context, job *putJob, schema bigquery.Schema, schemaChanged bool, reject rejectFunc) error {
+	if s.storageWriter != nil {
+		return s.storageWriter.write(ctx, job, schema, schemaChanged, reject)
+	}
+	return job.Execute(ctx, reject != nil)
+}
+
 func (s *bigquerySink) getTable(m Message) *bigquery.Table {
 	return s.client.DatasetInProject(m.ProjectID, m.DatasetID).Table(m.TableID)
 }
@@ -134,12 +219,179 @@ func checkMessage(m Message) error {
 
 // putJob aggregates rows to be inserted together
 type putJob struct {
-	table *bigquery.Table
-	rows  []interface{}
+	table    *bigquery.Table
+	messages []Message
+	// insertIDs are the insert IDs of the messages, fixed when they are
+	// added, so they don't change if the messages are retried in a subset.
+	insertIDs []string
+}
+
+func newPutJob(table *bigquery.Table, size int) *putJob {
+	return &putJob{
+		table:     table,
+		messages:  make([]Message, 0, size),
+		insertIDs: make([]string, 0, size),
+	}
+}
+
+// add appends the message to the job, deriving its insert ID from the
+// table, its position and its data if it doesn't have one.
+func (j *putJob) add(message Message) {
+	insertID := message.InsertID
+	if insertID == "" {
+		payload, _ := json.Marshal(message.Data)
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\n%d\n", j.table.FullyQualifiedName(), len(j.messages))
+		h.Write(payload)
+		insertID = hex.EncodeToString(h.Sum(nil)[:16])
+	}
+
+	j.messages = append(j.messages, message)
+	j.insertIDs = append(j.insertIDs, insertID)
+}
+
+// subset returns a job with the messages of the row errors, in the same
+// order. The RowIndex of the errors is the message index in the new job.
+func (j *putJob) subset(rowErrs bigquery.PutMultiError) *putJob {
+	subset := &putJob{table: j.table}
+	for _, rowErr := range rowErrs {
+		subset.messages = append(subset.messages, j.messages[rowErr.RowIndex])
+		subset.insertIDs = append(subset.insertIDs, j.insertIDs[rowErr.RowIndex])
+	}
+	return subset
+}
+
+// Execute inserts all the rows of the putJob into the table. If
+// skipInvalidRows is true, the valid rows are inserted and the others are
+// returned in a bigquery.PutMultiError, whose RowIndex is the message index.
+func (j *putJob) Execute(ctx context.Context, skipInvalidRows bool) error {
+	if !skipInvalidRows {
+		rows := make([]bigquery.ValueSaver, 0, len(j.messages))
+		for i := range j.messages {
+			saver, err := j.saver(i)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, saver)
+		}
+		return j.table.Inserter().Put(ctx, rows)
+	}
+
+	var rowErrs bigquery.PutMultiError
+	rows := make([]bigquery.ValueSaver, 0, len(j.messages))
+	indexes := make([]int, 0, len(j.messages))
+	for i := range j.messages {
+		row, err := j.save(i)
+		if err != nil {
+			rowErrs = append(rowErrs, bigquery.RowInsertionError{
+				InsertID: j.insertID(i),
+				RowIndex: i,
+				Errors:   bigquery.MultiError{err},
+			})
+			continue
+		}
+		rows = append(rows, row)
+		indexes = append(indexes, i)
+	}
+
+	if len(rows) > 0 {
+		inserter := j.table.Inserter()
+		inserter.SkipInvalidRows = true
+		err := inserter.Put(ctx, rows)
+
+		var putErrs bigquery.PutMultiError
+		if !stderrors.As(err, &putErrs) {
+			if err != nil {
+				return err
+			}
+		}
+		for _, putErr := range putErrs {
+			putErr.RowIndex = indexes[putErr.RowIndex]
+			rowErrs = append(rowErrs, putErr)
+		}
+	}
+
+	if len(rowErrs) > 0 {
+		return rowErrs
+	}
+	return nil
+}
+
+// saver returns the message data as a bigquery.ValueSaver with its insert ID.
+func (j *putJob) saver(i int) (bigquery.ValueSaver, error) {
+	message := j.messages[i]
+	insertID := j.insertID(i)
+
+	if saver, ok := message.Data.(bigquery.ValueSaver); ok {
+		return insertIDSaver{saver: saver, insertID: insertID, replace: message.InsertID != ""}, nil
+	}
+
+	schema, err := bigquery.InferSchema(message.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &bigquery.StructSaver{Schema: schema, Struct: message.Data, InsertID: insertID}, nil
 }
 
-// Execute inserts all the rows of the putJob into
-// the table.
-func (j *putJob) Execute(ctx context.Context) error {
-	return j.table.Inserter().Put(ctx, j.rows)
+// save converts the message data into a row, so encoding errors are known
+// before sending it.
+func (j *putJob) save(i int) (savedRow, error) {
+	saver, err := j.saver(i)
+	if err != nil {
+		return savedRow{}, err
+	}
+	row, insertID, err := saver.Save()
+	if err != nil {
+		return savedRow{}, err
+	}
+	return savedRow{row: row, insertID: insertID}, nil
+}
+
+// insertID returns Message.InsertID or the ID derived from the message.
+func (j *putJob) insertID(i int) string {
+	return j.insertIDs[i]
+}
+
+// insertIDSaver sets the insert ID of a ValueSaver that doesn't have one.
+// If replace is set, the ID of the ValueSaver is replaced.
+type insertIDSaver struct {
+	saver    bigquery.ValueSaver
+	insertID string
+	replace  bool
+}
+
+func (s insertIDSaver) Save() (map[string]bigquery.Value, string, error) {
+	row, insertID, err := s.saver.Save()
+	if insertID == "" || s.replace {
+		insertID = s.insertID
+	}
+	return row, insertID, err
+}
+
+// savedRow is a row that was already converted.
+type savedRow struct {
+	row      map[string]bigquery.Value
+	insertID string
+}
+
+func (r savedRow) Save() (map[string]bigquery.Value, string, error) {
+	return r.row, r.insertID, nil
+}
+
+// schema returns the union of the schemas of all messages.
+func (j *putJob) schema() (bigquery.Schema, error) {
+	const op errors.Op = "bigquerysink.putJob.schema"
+
+	var schema bigquery.Schema
+	for _, message := range j.messages {
+		messageSchema, err := resolveSchema(message)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		schema, _, err = mergeSchema(schema, messageSchema)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+	}
+	return schema, nil
 }
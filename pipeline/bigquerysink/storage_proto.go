@@ -0,0 +1,346 @@
+package bigquerysink
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"cloud.google.com/go/civil"
+	"github.com/arquivei/foundationkit/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var epochDate = civil.Date{Year: 1970, Month: time.January, Day: 1}
+
+// rowEncoder encodes rows of a table schema as protocol buffers, which is
+// the format used by the Storage Write API.
+type rowEncoder struct {
+	schema     bigquery.Schema
+	descriptor protoreflect.MessageDescriptor
+	// descriptorProto is the self contained descriptor sent to BigQuery.
+	descriptorProto *descriptorpb.DescriptorProto
+}
+
+func newRowEncoder(schema bigquery.Schema) (*rowEncoder, error) {
+	const op = errors.Op("bigquerysink.newRowEncoder")
+
+	tableSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	// Civil times and numerics are sent in their canonical string format,
+	// which is what the bigquery package produces for them.
+	var options []adapt.ProtoConversionOption
+	for _, fieldType := range []storagepb.TableFieldSchema_Type{
+		storagepb.TableFieldSchema_DATETIME,
+		storagepb.TableFieldSchema_TIME,
+		storagepb.TableFieldSchema_NUMERIC,
+		storagepb.TableFieldSchema_BIGNUMERIC,
+	} {
+		options = append(options, adapt.WithProtoMapping(adapt.ProtoMapping{
+			FieldType: fieldType,
+			Type:      descriptorpb.FieldDescriptorProto_TYPE_STRING,
+		}))
+	}
+
+	descriptor, err := adapt.StorageSchemaToProtoDescriptorWithOptions(tableSchema, "root", options...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, errors.E(op, "schema is not a message descriptor")
+	}
+
+	descriptorProto, err := adapt.NormalizeDescriptor(messageDescriptor)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return &rowEncoder{
+		schema:          schema,
+		descriptor:      messageDescriptor,
+		descriptorProto: descriptorProto,
+	}, nil
+}
+
+// encode converts the message data into a serialized protocol buffer.
+func (e *rowEncoder) encode(data interface{}) ([]byte, error) {
+	const op = errors.Op("bigquerysink.rowEncoder.encode")
+
+	row, err := dataToRow(data, e.schema)
+	if err != nil {
+		return nil, errors.E(op, ErrInvalidRow, errors.SeverityInput, errors.KV("cause", err))
+	}
+
+	message := dynamicpb.NewMessage(e.descriptor)
+	if err := fillMessage(message, e.schema, row); err != nil {
+		return nil, errors.E(op, ErrInvalidRow, errors.SeverityInput, errors.KV("cause", err))
+	}
+
+	b, err := proto.Marshal(message)
+	if err != nil {
+		return nil, errors.E(op, ErrInvalidRow, errors.SeverityInput, errors.KV("cause", err))
+	}
+	return b, nil
+}
+
+// dataToRow converts Message.Data into a row with the schema columns.
+func dataToRow(data interface{}, schema bigquery.Schema) (map[string]bigquery.Value, error) {
+	if row, ok := toRow(data); ok {
+		return row, nil
+	}
+
+	if saver, ok := data.(bigquery.ValueSaver); ok {
+		row, _, err := saver.Save()
+		return row, err
+	}
+
+	row, _, err := (&bigquery.StructSaver{Schema: schema, Struct: data}).Save()
+	return row, err
+}
+
+func toRow(v interface{}) (map[string]bigquery.Value, bool) {
+	switch row := v.(type) {
+	case map[string]bigquery.Value:
+		return row, true
+	case map[string]interface{}:
+		converted := make(map[string]bigquery.Value, len(row))
+		for k, v := range row {
+			converted[k] = v
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// fillMessage sets the message fields from the row. Fields are matched by
+// their position in the schema, because the descriptor may change column
+// names that are not valid protocol buffer names.
+func fillMessage(message protoreflect.Message, schema bigquery.Schema, row map[string]bigquery.Value) error {
+	known := 0
+	for i, field := range schema {
+		value, ok := row[field.Name]
+		if !ok {
+			continue
+		}
+		known++
+		if value == nil {
+			continue
+		}
+
+		fd := message.Descriptor().Fields().ByNumber(protoreflect.FieldNumber(i + 1))
+		if fd == nil {
+			return fmt.Errorf("field %s not found in descriptor", field.Name)
+		}
+
+		if field.Repeated {
+			values := reflect.ValueOf(value)
+			if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+				return fmt.Errorf("repeated field %s must be a slice", field.Name)
+			}
+			list := message.Mutable(fd).List()
+			for j := 0; j < values.Len(); j++ {
+				element, err := fieldValue(list.NewElement, field, values.Index(j).Interface())
+				if err != nil {
+					return err
+				}
+				if element.IsValid() {
+					list.Append(element)
+				}
+			}
+			continue
+		}
+
+		v, err := fieldValue(func() protoreflect.Value { return message.NewField(fd) }, field, value)
+		if err != nil {
+			return err
+		}
+		if v.IsValid() {
+			message.Set(fd, v)
+		}
+	}
+
+	if known != len(row) {
+		for name := range row {
+			if !schemaHasField(schema, name) {
+				return fmt.Errorf("field %s is not in the table schema", name)
+			}
+		}
+	}
+	return nil
+}
+
+func schemaHasField(schema bigquery.Schema, name string) bool {
+	for _, field := range schema {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldValue converts a single value of the field. It returns an invalid
+// value for nulls. newMessage is used for records.
+func fieldValue(newMessage func() protoreflect.Value, field *bigquery.FieldSchema, value interface{}) (protoreflect.Value, error) {
+	value, ok := unwrapNull(value)
+	if !ok {
+		return protoreflect.Value{}, nil
+	}
+
+	mismatch := func() (protoreflect.Value, error) {
+		return protoreflect.Value{}, fmt.Errorf("field %s of type %s can't hold %T", field.Name, field.Type, value)
+	}
+
+	switch field.Type {
+	case bigquery.RecordFieldType:
+		row, ok := toRow(value)
+		if !ok {
+			var err error
+			if row, err = dataToRow(value, field.Schema); err != nil {
+				return protoreflect.Value{}, err
+			}
+		}
+		v := newMessage()
+		if err := fillMessage(v.Message(), field.Schema, row); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return v, nil
+
+	case bigquery.StringFieldType, bigquery.GeographyFieldType:
+		if s, ok := value.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+		return mismatch()
+
+	case bigquery.JSONFieldType:
+		switch v := value.(type) {
+		case string:
+			return protoreflect.ValueOfString(v), nil
+		case []byte:
+			return protoreflect.ValueOfString(string(v)), nil
+		case json.RawMessage:
+			return protoreflect.ValueOfString(string(v)), nil
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		return protoreflect.ValueOfString(string(b)), nil
+
+	case bigquery.BytesFieldType:
+		if b, ok := value.([]byte); ok {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+		return mismatch()
+
+	case bigquery.BooleanFieldType:
+		if b, ok := value.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+		return mismatch()
+
+	case bigquery.IntegerFieldType:
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return protoreflect.ValueOfInt64(v.Int()), nil
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return protoreflect.ValueOfInt64(int64(v.Uint())), nil
+		}
+		return mismatch()
+
+	case bigquery.FloatFieldType:
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return protoreflect.ValueOfFloat64(v.Float()), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return protoreflect.ValueOfFloat64(float64(v.Int())), nil
+		}
+		return mismatch()
+
+	case bigquery.TimestampFieldType:
+		if t, ok := value.(time.Time); ok {
+			return protoreflect.ValueOfInt64(t.UnixMicro()), nil
+		}
+		return mismatch()
+
+	case bigquery.DateFieldType:
+		if d, ok := value.(civil.Date); ok {
+			return protoreflect.ValueOfInt32(int32(d.DaysSince(epochDate))), nil
+		}
+		return mismatch()
+
+	case bigquery.TimeFieldType:
+		switch v := value.(type) {
+		case string:
+			return protoreflect.ValueOfString(v), nil
+		case civil.Time:
+			return protoreflect.ValueOfString(bigquery.CivilTimeString(v)), nil
+		}
+		return mismatch()
+
+	case bigquery.DateTimeFieldType:
+		switch v := value.(type) {
+		case string:
+			return protoreflect.ValueOfString(v), nil
+		case civil.DateTime:
+			return protoreflect.ValueOfString(bigquery.CivilDateTimeString(v)), nil
+		}
+		return mismatch()
+
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		switch v := value.(type) {
+		case string:
+			return protoreflect.ValueOfString(v), nil
+		case *big.Rat:
+			if field.Type == bigquery.NumericFieldType {
+				return protoreflect.ValueOfString(bigquery.NumericString(v)), nil
+			}
+			return protoreflect.ValueOfString(bigquery.BigNumericString(v)), nil
+		}
+		return mismatch()
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("field %s has unsupported type %s", field.Name, field.Type)
+}
+
+// unwrapNull returns the value inside the bigquery null types and false if
+// it is null.
+func unwrapNull(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case bigquery.NullString:
+		return v.StringVal, v.Valid
+	case bigquery.NullInt64:
+		return v.Int64, v.Valid
+	case bigquery.NullFloat64:
+		return v.Float64, v.Valid
+	case bigquery.NullBool:
+		return v.Bool, v.Valid
+	case bigquery.NullTimestamp:
+		return v.Timestamp, v.Valid
+	case bigquery.NullDate:
+		return v.Date, v.Valid
+	case bigquery.NullTime:
+		return v.Time, v.Valid
+	case bigquery.NullDateTime:
+		return v.DateTime, v.Valid
+	case bigquery.NullGeography:
+		return v.GeographyVal, v.Valid
+	case bigquery.NullJSON:
+		return v.JSONVal, v.Valid
+	}
+	return value, true
+}
@@ -0,0 +1,106 @@
+package bigquerysink
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type testItem struct {
+	SKU      string
+	Quantity int64
+}
+
+type testRow struct {
+	ID        string
+	CreatedAt time.Time
+	Day       civil.Date
+	At        civil.DateTime
+	Price     float64
+	Note      bigquery.NullString
+	Tags      []string
+	Items     []testItem
+	Main      testItem
+}
+
+func TestRowEncoder_Struct(t *testing.T) {
+	data := testRow{
+		ID:        "a",
+		CreatedAt: time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Day:       civil.Date{Year: 1970, Month: time.January, Day: 11},
+		At:        civil.DateTime{Date: civil.Date{Year: 2026, Month: time.October, Day: 17}, Time: civil.Time{Hour: 8}},
+		Price:     1.5,
+		Tags:      []string{"x", "y"},
+		Items:     []testItem{{SKU: "s1", Quantity: 2}},
+		Main:      testItem{SKU: "s2", Quantity: 1},
+	}
+
+	schema, err := resolveSchema(Message{Data: data})
+	require.NoError(t, err)
+	encoder, err := newRowEncoder(schema)
+	require.NoError(t, err)
+
+	b, err := encoder.encode(data)
+	require.NoError(t, err)
+
+	message := dynamicpb.NewMessage(encoder.descriptor)
+	require.NoError(t, proto.Unmarshal(b, message))
+
+	j, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"ID": "a",
+		"CreatedAt": "1792238400000000",
+		"Day": 10,
+		"At": "2026-10-17 08:00:00",
+		"Price": 1.5,
+		"Tags": ["x", "y"],
+		"Items": [{"SKU": "s1", "Quantity": "2"}],
+		"Main": {"SKU": "s2", "Quantity": "1"}
+	}`, string(j))
+}
+
+func TestRowEncoder_ProvidedSchema(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "payload", Type: bigquery.JSONFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+	}
+	encoder, err := newRowEncoder(schema)
+	require.NoError(t, err)
+
+	b, err := encoder.encode(map[string]interface{}{
+		"id":      "a",
+		"payload": map[string]int{"x": 1},
+		"count":   nil,
+	})
+	require.NoError(t, err)
+
+	message := dynamicpb.NewMessage(encoder.descriptor)
+	require.NoError(t, proto.Unmarshal(b, message))
+	j, err := protojson.Marshal(message)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id": "a", "payload": "{\"x\":1}"}`, string(j))
+
+	for _, data := range []interface{}{
+		map[string]interface{}{"id": "a", "unknown": 1},
+		map[string]interface{}{"id": 1},
+	} {
+		_, err := encoder.encode(data)
+		assert.ErrorIs(t, err, ErrInvalidRow)
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+	}
+}
+
+func TestResolveSchema_RequiresStruct(t *testing.T) {
+	_, err := resolveSchema(Message{Data: map[string]interface{}{"id": "a"}})
+	assert.ErrorIs(t, err, ErrSchemaRequired)
+}
@@ -0,0 +1,379 @@
+package bigquerysink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	stderrors "errors"
+	"reflect"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MustNewStorageWrite returns a new Sink that saves data to bigquery using
+// the Storage Write API instead of the legacy streaming inserts.
+//
+// Each table gets a committed stream and every append uses an explicit
+// offset. Appends to a table are serialized. If an append fails without
+// knowing whether the rows were written, the batch stays pending at its
+// offset: when the same batch is retried, like with pipeline.SinkWithRetry,
+// it is appended at that offset again and BigQuery rejects it if it was
+// already written, instead of duplicating it. If another batch comes first,
+// the stream is finalized to learn whether the pending batch was written,
+// and a new stream is opened. Batches are identified by their encoded rows,
+// so a batch equal to a pending one that was written is taken as its retry.
+// This only holds while the sink is alive, so a batch redelivered after a
+// restart is written again.
+//
+// Rows are converted to protocol buffers using Message.Schema or, if it is
+// empty, the schema inferred from Message.Data, which must be a struct.
+// A new stream is opened when the schema of the rows changes.
+//
+// The returned function closes all streams. The clients are not closed.
+func MustNewStorageWrite(client *bigquery.Client, writeClient *managedwriter.Client, options ...Option) (pipeline.Sink, func() error) {
+	if writeClient == nil {
+		panic("bigquery storage write client is nil")
+	}
+
+	s := MustNew(client, options...).(*bigquerySink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.storageWriter = &storageWriter{
+		newStream: func(ctx context.Context, table *bigquery.Table, descriptor *descriptorpb.DescriptorProto) (appendStream, error) {
+			stream, err := writeClient.NewManagedStream(ctx,
+				managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(
+					table.ProjectID,
+					table.DatasetID,
+					table.TableID,
+				)),
+				managedwriter.WithType(managedwriter.CommittedStream),
+				managedwriter.WithSchemaDescriptor(descriptor),
+			)
+			if err != nil {
+				return nil, err
+			}
+			return managedAppendStream{stream}, nil
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		tables: make(map[string]*tableStream),
+	}
+
+	return s, s.storageWriter.close
+}
+
+// appendStream is a committed stream of a table.
+type appendStream interface {
+	// append writes the rows at the offset and waits for the response.
+	append(ctx context.Context, rows [][]byte, offset int64) (*storagepb.AppendRowsResponse, error)
+	// finalize stops the stream and returns how many rows it has.
+	finalize(ctx context.Context) (int64, error)
+	close() error
+}
+
+// managedAppendStream is an appendStream of the managedwriter package.
+type managedAppendStream struct {
+	stream *managedwriter.ManagedStream
+}
+
+func (s managedAppendStream) append(ctx context.Context, rows [][]byte, offset int64) (*storagepb.AppendRowsResponse, error) {
+	result, err := s.stream.AppendRows(ctx, rows, managedwriter.WithOffset(offset))
+	if err != nil {
+		return nil, err
+	}
+	return result.FullResponse(ctx)
+}
+
+func (s managedAppendStream) finalize(ctx context.Context) (int64, error) {
+	return s.stream.Finalize(ctx)
+}
+
+func (s managedAppendStream) close() error {
+	return s.stream.Close()
+}
+
+// storageWriter keeps a committed stream for each table.
+type storageWriter struct {
+	newStream func(ctx context.Context, table *bigquery.Table, descriptor *descriptorpb.DescriptorProto) (appendStream, error)
+
+	// ctx is used by the streams for their whole lifetime.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	tables map[string]*tableStream
+}
+
+// maxWrittenBatches limits how many pending batches found written when
+// their stream was finalized are remembered until they are retried.
+const maxWrittenBatches = 100
+
+// tableStream is the committed stream of a table and the offset of its next
+// append. Appends to the same table are serialized so offsets are sequential.
+type tableStream struct {
+	mu      sync.Mutex
+	stream  appendStream
+	encoder *rowEncoder
+	offset  int64
+	// pending is the batch whose append at offset failed without knowing
+	// whether it was written.
+	pending *pendingBatch
+	// written are the pending batches found written when their stream was
+	// finalized, so their retries are not written again.
+	written map[string]bool
+}
+
+type pendingBatch struct {
+	id   string
+	rows int64
+}
+
+func (w *storageWriter) getTableStream(name string) *tableStream {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ts := w.tables[name]
+	if ts == nil {
+		ts = &tableStream{written: make(map[string]bool)}
+		w.tables[name] = ts
+	}
+	return ts
+}
+
+// write appends the job rows to the table stream. If the schema changed, a
+// new stream is opened so it sees the new columns.
+//
+// If reject is not nil, the rows that can't be encoded or that BigQuery
+// refuses are rejected and the others are appended. Rejects are written
+// before the append, so a retried batch is not duplicated.
+func (w *storageWriter) write(ctx context.Context, job *putJob, schema bigquery.Schema, schemaChanged bool, reject rejectFunc) error {
+	const op = errors.Op("bigquerysink.storageWriter.write")
+
+	ts := w.getTableStream(job.table.FullyQualifiedName())
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.stream != nil && (schemaChanged || !reflect.DeepEqual(ts.encoder.schema, schema)) {
+		w.reset(ctx, ts)
+	}
+
+	if ts.stream == nil {
+		if err := w.open(ts, job.table, schema); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	var rowErrs bigquery.PutMultiError
+	rows := make([][]byte, 0, len(job.messages))
+	indexes := make([]int, 0, len(job.messages))
+	for i, message := range job.messages {
+		row, err := ts.encoder.encode(message.Data)
+		if err != nil {
+			if reject == nil {
+				return errors.E(op, err)
+			}
+			rowErrs = append(rowErrs, bigquery.RowInsertionError{
+				RowIndex: i,
+				Errors:   bigquery.MultiError{errors.GetRootError(err)},
+			})
+			continue
+		}
+		rows = append(rows, row)
+		indexes = append(indexes, i)
+	}
+
+	for {
+		if len(rowErrs) > 0 {
+			if err := reject(ctx, rowErrs); err != nil {
+				return errors.E(op, err)
+			}
+			rowErrs = nil
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		id := batchID(rows)
+		if ts.written[id] {
+			delete(ts.written, id)
+			return nil
+		}
+		if ts.pending != nil && ts.pending.id != id {
+			// Only the pending batch can be appended at its offset, so
+			// another batch isn't taken as written when BigQuery says the
+			// offset already exists.
+			w.reset(ctx, ts)
+			if err := w.open(ts, job.table, schema); err != nil {
+				return errors.E(op, err)
+			}
+		}
+
+		response, err := ts.stream.append(ctx, rows, ts.offset)
+
+		if reject != nil && len(response.GetRowErrors()) > 0 {
+			// None of the rows of an append with row errors are written, so
+			// the bad rows are rejected and the others are appended again.
+			rowErrs, rows, indexes = splitRowErrors(response.GetRowErrors(), rows, indexes)
+			if len(rowErrs) > 0 {
+				ts.pending = nil
+				continue
+			}
+		}
+
+		switch status.Code(err) {
+		case codes.OK:
+			ts.pending = nil
+			ts.offset += int64(len(rows))
+			return nil
+		case codes.AlreadyExists:
+			if ts.pending != nil {
+				// The pending batch, this one, was written by the previous
+				// attempt whose response was lost.
+				ts.pending = nil
+				ts.offset += int64(len(rows))
+				return nil
+			}
+			// The stream has rows this writer doesn't know about.
+			w.reset(ctx, ts)
+		case codes.InvalidArgument:
+			ts.pending = nil
+			return errors.E(op, err, errors.SeverityInput)
+		case codes.OutOfRange, codes.NotFound, codes.FailedPrecondition:
+			// The stream offset is not what we expect or the stream is no longer
+			// usable. A new stream is opened on the next write.
+			w.reset(ctx, ts)
+		default:
+			ts.pending = &pendingBatch{id: id, rows: int64(len(rows))}
+		}
+		return errors.E(op, err, errors.SeverityRuntime)
+	}
+}
+
+// batchID identifies a batch by its encoded rows.
+func batchID(rows [][]byte) string {
+	h := sha256.New()
+	for _, row := range rows {
+		_ = binary.Write(h, binary.BigEndian, uint32(len(row)))
+		h.Write(row)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reset closes the table stream, so a new one is opened. If a batch is
+// pending, the stream is finalized first to learn whether it was written.
+// Must be called with the table lock held.
+func (w *storageWriter) reset(ctx context.Context, ts *tableStream) {
+	if ts.pending != nil {
+		rowCount, err := ts.stream.finalize(ctx)
+		switch {
+		case err != nil:
+			log.Ctx(ctx).Warn().Err(err).
+				Msg("[goduck][pipeline][bigquerySink] Failed to finalize the stream, a pending batch may be written again.")
+		case rowCount >= ts.offset+ts.pending.rows:
+			if len(ts.written) >= maxWrittenBatches {
+				ts.written = make(map[string]bool)
+			}
+			ts.written[ts.pending.id] = true
+		}
+		ts.pending = nil
+	}
+
+	_ = ts.stream.close()
+	ts.stream = nil
+}
+
+// splitRowErrors removes the rows with errors from rows. It returns the
+// errors, with the message index of each row, and the remaining rows.
+func splitRowErrors(rowErrors []*storagepb.RowError, rows [][]byte, indexes []int) (bigquery.PutMultiError, [][]byte, []int) {
+	failed := make(map[int]string, len(rowErrors))
+	for _, rowError := range rowErrors {
+		failed[int(rowError.GetIndex())] = rowError.GetMessage()
+	}
+
+	var rowErrs bigquery.PutMultiError
+	remainingRows := make([][]byte, 0, len(rows))
+	remainingIndexes := make([]int, 0, len(indexes))
+	for i := range rows {
+		if reason, ok := failed[i]; ok {
+			rowErrs = append(rowErrs, bigquery.RowInsertionError{
+				RowIndex: indexes[i],
+				Errors:   bigquery.MultiError{stderrors.New(reason)},
+			})
+			continue
+		}
+		remainingRows = append(remainingRows, rows[i])
+		remainingIndexes = append(remainingIndexes, indexes[i])
+	}
+	return rowErrs, remainingRows, remainingIndexes
+}
+
+// open creates the committed stream of the table. Must be called with the
+// table lock held.
+func (w *storageWriter) open(ts *tableStream, table *bigquery.Table, schema bigquery.Schema) error {
+	const op = errors.Op("bigquerysink.storageWriter.open")
+
+	encoder, err := newRowEncoder(schema)
+	if err != nil {
+		return errors.E(op, err, errors.SeverityInput)
+	}
+
+	stream, err := w.newStream(w.ctx, table, encoder.descriptorProto)
+	if err != nil {
+		return errors.E(op, err, errors.SeverityRuntime)
+	}
+
+	ts.stream = stream
+	ts.encoder = encoder
+	ts.offset = 0
+	return nil
+}
+
+func (w *storageWriter) close() error {
+	const op = errors.Op("bigquerysink.storageWriter.close")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var sliceErrs []error
+	for _, ts := range w.tables {
+		ts.mu.Lock()
+		if ts.stream != nil {
+			if err := ts.stream.close(); err != nil {
+				sliceErrs = append(sliceErrs, err)
+			}
+			ts.stream = nil
+		}
+		ts.mu.Unlock()
+	}
+	w.cancel()
+
+	if len(sliceErrs) > 0 {
+		return errors.E(op, "failed to close streams", errors.KV("errors", sliceErrs))
+	}
+	return nil
+}
+
+// resolveSchema returns the message schema or infers it from the data.
+func resolveSchema(m Message) (bigquery.Schema, error) {
+	const op = errors.Op("bigquerysink.resolveSchema")
+
+	if len(m.Schema) > 0 {
+		return m.Schema, nil
+	}
+
+	schema, err := bigquery.InferSchema(m.Data)
+	if err != nil {
+		return nil, errors.E(op, ErrSchemaRequired, errors.SeverityInput, errors.KV("cause", err))
+	}
+	return schema, nil
+}
@@ -0,0 +1,221 @@
+package bigquerysink
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// fakeAppend is how the fakeStream answers an append.
+type fakeAppend int
+
+const (
+	// appendOK writes the rows if the offset is the end of the stream.
+	appendOK fakeAppend = iota
+	// appendLost writes the rows but the response is lost.
+	appendLost
+	// appendUnavailable doesn't write the rows.
+	appendUnavailable
+	// appendNotFound fails because the stream is gone.
+	appendNotFound
+)
+
+type fakeStream struct {
+	rows      [][]byte
+	finalized bool
+	closed    bool
+	// answers are used by the next appends, then they are appendOK.
+	answers []fakeAppend
+}
+
+func (s *fakeStream) append(_ context.Context, rows [][]byte, offset int64) (*storagepb.AppendRowsResponse, error) {
+	answer := appendOK
+	if len(s.answers) > 0 {
+		answer, s.answers = s.answers[0], s.answers[1:]
+	}
+
+	switch answer {
+	case appendUnavailable:
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	case appendNotFound:
+		return nil, status.Error(codes.NotFound, "stream not found")
+	}
+
+	switch {
+	case offset < int64(len(s.rows)):
+		return nil, status.Error(codes.AlreadyExists, "offset already exists")
+	case offset > int64(len(s.rows)):
+		return nil, status.Error(codes.OutOfRange, "offset out of range")
+	}
+	s.rows = append(s.rows, rows...)
+
+	if answer == appendLost {
+		return nil, status.Error(codes.Unavailable, "connection lost")
+	}
+	return &storagepb.AppendRowsResponse{}, nil
+}
+
+func (s *fakeStream) finalize(context.Context) (int64, error) {
+	s.finalized = true
+	return int64(len(s.rows)), nil
+}
+
+func (s *fakeStream) close() error {
+	s.closed = true
+	return nil
+}
+
+type fakeStreams struct {
+	streams []*fakeStream
+	// answers are given to the next stream opened.
+	answers []fakeAppend
+}
+
+func (f *fakeStreams) newStream(context.Context, *bigquery.Table, *descriptorpb.DescriptorProto) (appendStream, error) {
+	s := &fakeStream{answers: f.answers}
+	f.answers = nil
+	f.streams = append(f.streams, s)
+	return s, nil
+}
+
+func (f *fakeStreams) last() *fakeStream {
+	return f.streams[len(f.streams)-1]
+}
+
+// rowCount returns how many rows were written to all streams.
+func (f *fakeStreams) rowCount() int {
+	n := 0
+	for _, s := range f.streams {
+		n += len(s.rows)
+	}
+	return n
+}
+
+type storageTestRow struct {
+	ID string
+}
+
+type storageTestRowV2 struct {
+	ID    string
+	Count int64
+}
+
+func newTestStorageWriter() (*storageWriter, *fakeStreams) {
+	streams := &fakeStreams{}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &storageWriter{
+		newStream: streams.newStream,
+		ctx:       ctx,
+		cancel:    cancel,
+		tables:    make(map[string]*tableStream),
+	}, streams
+}
+
+func writeBatch(t *testing.T, w *storageWriter, data ...interface{}) error {
+	job := newPutJob(&bigquery.Table{ProjectID: "project", DatasetID: "dataset", TableID: "events"}, len(data))
+	for _, d := range data {
+		job.add(Message{ProjectID: "project", DatasetID: "dataset", TableID: "events", Data: d})
+	}
+	schema, err := job.schema()
+	require.NoError(t, err)
+	return w.write(context.Background(), job, schema, false, nil)
+}
+
+func TestStorageWriter_AlreadyExists(t *testing.T) {
+	w, streams := newTestStorageWriter()
+	streams.answers = []fakeAppend{appendLost}
+	a := []interface{}{storageTestRow{ID: "a1"}, storageTestRow{ID: "a2"}}
+
+	err := writeBatch(t, w, a...)
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+
+	// The retry is rejected by BigQuery at the same offset.
+	require.NoError(t, writeBatch(t, w, a...))
+	require.NoError(t, writeBatch(t, w, storageTestRow{ID: "b"}))
+
+	require.Len(t, streams.streams, 1)
+	assert.Len(t, streams.last().rows, 3)
+}
+
+func TestStorageWriter_OtherBatchAfterFailure(t *testing.T) {
+	t.Run("Pending batch was written", func(t *testing.T) {
+		w, streams := newTestStorageWriter()
+		streams.answers = []fakeAppend{appendLost}
+		a := []interface{}{storageTestRow{ID: "a1"}, storageTestRow{ID: "a2"}}
+
+		assert.Error(t, writeBatch(t, w, a...))
+
+		// Another batch can't use the offset of the pending batch, so the
+		// stream is finalized and the batch goes to a new stream.
+		require.NoError(t, writeBatch(t, w, storageTestRow{ID: "b"}))
+		require.Len(t, streams.streams, 2)
+		assert.True(t, streams.streams[0].finalized)
+		assert.True(t, streams.streams[0].closed)
+		assert.Len(t, streams.streams[1].rows, 1)
+
+		// The pending batch was written, so its retry is not written again.
+		require.NoError(t, writeBatch(t, w, a...))
+		assert.Equal(t, 3, streams.rowCount())
+	})
+
+	t.Run("Pending batch was not written", func(t *testing.T) {
+		w, streams := newTestStorageWriter()
+		streams.answers = []fakeAppend{appendUnavailable}
+		a := []interface{}{storageTestRow{ID: "a1"}, storageTestRow{ID: "a2"}}
+
+		assert.Error(t, writeBatch(t, w, a...))
+		require.NoError(t, writeBatch(t, w, storageTestRow{ID: "b"}))
+		require.NoError(t, writeBatch(t, w, a...))
+
+		require.Len(t, streams.streams, 2)
+		assert.Empty(t, streams.streams[0].rows)
+		assert.Len(t, streams.streams[1].rows, 3)
+	})
+}
+
+func TestStorageWriter_Reconnect(t *testing.T) {
+	w, streams := newTestStorageWriter()
+	streams.answers = []fakeAppend{appendOK, appendNotFound}
+
+	require.NoError(t, writeBatch(t, w, storageTestRow{ID: "a"}))
+	err := writeBatch(t, w, storageTestRow{ID: "b"})
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+	assert.True(t, streams.last().closed)
+
+	// A new stream is opened, starting at offset 0.
+	require.NoError(t, writeBatch(t, w, storageTestRow{ID: "b"}))
+	require.Len(t, streams.streams, 2)
+	assert.Len(t, streams.last().rows, 1)
+}
+
+func TestStorageWriter_SchemaChange(t *testing.T) {
+	w, streams := newTestStorageWriter()
+	streams.answers = []fakeAppend{appendLost}
+	a := storageTestRow{ID: "a"}
+
+	assert.Error(t, writeBatch(t, w, a))
+
+	// The stream is finalized before it is replaced, so the pending batch
+	// written by the old stream is not written again.
+	require.NoError(t, writeBatch(t, w, storageTestRowV2{ID: "b", Count: 1}))
+	require.Len(t, streams.streams, 2)
+	assert.True(t, streams.streams[0].finalized)
+
+	require.NoError(t, writeBatch(t, w, a))
+	assert.Equal(t, 2, streams.rowCount())
+
+	// Without a pending batch the stream is only replaced.
+	require.NoError(t, writeBatch(t, w, a))
+	require.Len(t, streams.streams, 3)
+	assert.False(t, streams.streams[1].finalized)
+	assert.True(t, streams.streams[1].closed)
+	assert.Len(t, streams.last().rows, 1)
+}
@@ -0,0 +1,101 @@
+package elasticsink
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// elasticsearch8Adapter implements bulkClient with the official
+// go-elasticsearch v8 typed client.
+type elasticsearch8Adapter struct {
+	client *elasticsearch.TypedClient
+}
+
+func (a elasticsearch8Adapter) Bulk(ctx context.Context, body []byte) (*bulkResponse, error) {
+	res, err := a.client.Bulk().Raw(bytes.NewReader(body)).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &bulkResponse{
+		Errors: res.Errors,
+		Items:  make([]map[string]*bulkResponseItem, 0, len(res.Items)),
+	}
+	for _, item := range res.Items {
+		converted := make(map[string]*bulkResponseItem, len(item))
+		for action, result := range item {
+			r := &bulkResponseItem{
+				Index:  result.Index_,
+				Status: result.Status,
+			}
+			if result.Id_ != nil {
+				r.ID = *result.Id_
+			}
+			if result.Error != nil {
+				r.Error = &bulkItemError{Type: result.Error.Type}
+				if result.Error.Reason != nil {
+					r.Error.Reason = *result.Error.Reason
+				}
+			}
+			converted[action.String()] = r
+		}
+		response.Items = append(response.Items, converted)
+	}
+	return response, nil
+}
+
+func (a elasticsearch8Adapter) IndexExists(ctx context.Context, index string) (bool, error) {
+	return a.client.Indices.Exists(index).Do(ctx)
+}
+
+func (a elasticsearch8Adapter) CreateIndex(ctx context.Context, index string) error {
+	_, err := a.client.Indices.Create(index).Do(ctx)
+	if e, ok := err.(*types.ElasticsearchError); ok && e.ErrorCause.Type == errorTypeResourceAlreadyExistsException {
+		return nil
+	}
+	return err
+}
+
+func (a elasticsearch8Adapter) IndexTemplateExists(ctx context.Context, name string) (bool, error) {
+	return a.client.Indices.ExistsIndexTemplate(name).Do(ctx)
+}
+
+func (a elasticsearch8Adapter) GetAlias(ctx context.Context, alias string) (map[string]bool, error) {
+	// The not found response of get alias can't be decoded by the typed
+	// client, so the existence is checked first.
+	exists, err := a.client.Indices.ExistsAlias(alias).Do(ctx)
+	if err != nil || !exists {
+		return map[string]bool{}, err
+	}
+
+	res, err := a.client.Indices.GetAlias().Name(alias).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	indices := make(map[string]bool)
+	for index, result := range res {
+		if definition, ok := result.Aliases[alias]; ok {
+			indices[index] = definition.IsWriteIndex != nil && *definition.IsWriteIndex
+		}
+	}
+	return indices, nil
+}
+
+func (a elasticsearch8Adapter) AddToAlias(ctx context.Context, actions ...aliasAction) error {
+	indicesActions := make([]types.IndicesAction, 0, len(actions))
+	for _, action := range actions {
+		indicesActions = append(indicesActions, types.IndicesAction{
+			Add: &types.AddAction{
+				Index:        &action.Index,
+				Alias:        &action.Alias,
+				IsWriteIndex: &action.IsWriteIndex,
+			},
+		})
+	}
+	_, err := a.client.Indices.UpdateAliases().Actions(indicesActions...).Do(ctx)
+	return err
+}
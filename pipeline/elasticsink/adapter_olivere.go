@@ -0,0 +1,84 @@
+package elasticsink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// olivereAdapter implements bulkClient with the olivere/elastic v7 client.
+type olivereAdapter struct {
+	client *elastic.Client
+}
+
+func (a olivereAdapter) Bulk(ctx context.Context, body []byte) (*bulkResponse, error) {
+	res, err := a.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:      http.MethodPost,
+		Path:        "/_bulk",
+		Body:        string(body),
+		ContentType: "application/x-ndjson",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &bulkResponse{}
+	if err := json.Unmarshal(res.Body, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (a olivereAdapter) IndexExists(ctx context.Context, index string) (bool, error) {
+	return a.client.IndexExists(index).Do(ctx)
+}
+
+func (a olivereAdapter) CreateIndex(ctx context.Context, index string) error {
+	_, err := a.client.CreateIndex(index).Do(ctx)
+	if e, ok := err.(*elastic.Error); ok && e.Details != nil && e.Details.Type == errorTypeResourceAlreadyExistsException {
+		return nil
+	}
+	return err
+}
+
+func (a olivereAdapter) IndexTemplateExists(ctx context.Context, name string) (bool, error) {
+	_, err := a.client.IndexGetIndexTemplate(name).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (a olivereAdapter) GetAlias(ctx context.Context, alias string) (map[string]bool, error) {
+	result, err := a.client.Aliases().Alias(alias).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	indices := make(map[string]bool)
+	for index, r := range result.Indices {
+		for _, a := range r.Aliases {
+			if a.AliasName == alias {
+				indices[index] = a.IsWriteIndex
+			}
+		}
+	}
+	return indices, nil
+}
+
+func (a olivereAdapter) AddToAlias(ctx context.Context, actions ...aliasAction) error {
+	service := a.client.Alias()
+	for _, action := range actions {
+		service.Action(elastic.NewAliasAddAction(action.Alias).Index(action.Index).IsWriteIndex(action.IsWriteIndex))
+	}
+	_, err := service.Do(ctx)
+	return err
+}
@@ -0,0 +1,171 @@
+package elasticsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/opensearch-project/opensearch-go/v2"
+	"github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+// opensearchAdapter implements bulkClient with the opensearch-go client.
+type opensearchAdapter struct {
+	client *opensearch.Client
+}
+
+// opensearchError is returned when opensearch answers with an error status.
+type opensearchError struct {
+	Status  int
+	Details struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+}
+
+func (e *opensearchError) Error() string {
+	return fmt.Sprintf("opensearch: status %d: %s: %s", e.Status, e.Details.Type, e.Details.Reason)
+}
+
+// decodeOpensearchResponse closes the response body and decodes it into v.
+// Error statuses are returned as *opensearchError.
+func decodeOpensearchResponse(res *opensearchapi.Response, v interface{}) error {
+	defer res.Body.Close()
+
+	if res.IsError() {
+		e := &opensearchError{Status: res.StatusCode}
+		body, _ := io.ReadAll(res.Body)
+		// The error may be an object or, in some endpoints, a plain string.
+		var details struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(body, &details) == nil && json.Unmarshal(details.Error, &e.Details) != nil {
+			_ = json.Unmarshal(details.Error, &e.Details.Reason)
+		}
+		return e
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (a opensearchAdapter) Bulk(ctx context.Context, body []byte) (*bulkResponse, error) {
+	res, err := opensearchapi.BulkRequest{Body: bytes.NewReader(body)}.Do(ctx, a.client)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &bulkResponse{}
+	if err := decodeOpensearchResponse(res, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (a opensearchAdapter) IndexExists(ctx context.Context, index string) (bool, error) {
+	res, err := opensearchapi.IndicesExistsRequest{Index: []string{index}}.Do(ctx, a.client)
+	return opensearchExists(res, err)
+}
+
+func (a opensearchAdapter) CreateIndex(ctx context.Context, index string) error {
+	res, err := opensearchapi.IndicesCreateRequest{Index: index}.Do(ctx, a.client)
+	if err != nil {
+		return err
+	}
+
+	err = decodeOpensearchResponse(res, nil)
+	if e, ok := err.(*opensearchError); ok && e.Details.Type == errorTypeResourceAlreadyExistsException {
+		return nil
+	}
+	return err
+}
+
+func (a opensearchAdapter) IndexTemplateExists(ctx context.Context, name string) (bool, error) {
+	res, err := opensearchapi.IndicesExistsIndexTemplateRequest{Name: name}.Do(ctx, a.client)
+	return opensearchExists(res, err)
+}
+
+func (a opensearchAdapter) GetAlias(ctx context.Context, alias string) (map[string]bool, error) {
+	res, err := opensearchapi.IndicesGetAliasRequest{Name: []string{alias}}.Do(ctx, a.client)
+	if err != nil {
+		return nil, err
+	}
+
+	response := aliasesResponse{}
+	err = decodeOpensearchResponse(res, &response)
+	if e, ok := err.(*opensearchError); ok && e.Status == http.StatusNotFound {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return response.indices(alias), nil
+}
+
+func (a opensearchAdapter) AddToAlias(ctx context.Context, actions ...aliasAction) error {
+	body, err := aliasesRequest(actions)
+	if err != nil {
+		return err
+	}
+
+	res, err := opensearchapi.IndicesUpdateAliasesRequest{Body: bytes.NewReader(body)}.Do(ctx, a.client)
+	if err != nil {
+		return err
+	}
+	return decodeOpensearchResponse(res, nil)
+}
+
+func opensearchExists(res *opensearchapi.Response, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return false, nil
+	}
+	if err := decodeOpensearchResponse(res, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// aliasesRequest is the body of the _aliases endpoint.
+func aliasesRequest(actions []aliasAction) ([]byte, error) {
+	type add struct {
+		Index        string `json:"index"`
+		Alias        string `json:"alias"`
+		IsWriteIndex bool   `json:"is_write_index"`
+	}
+	body := struct {
+		Actions []map[string]add `json:"actions"`
+	}{}
+	for _, action := range actions {
+		body.Actions = append(body.Actions, map[string]add{
+			"add": {Index: action.Index, Alias: action.Alias, IsWriteIndex: action.IsWriteIndex},
+		})
+	}
+	return json.Marshal(body)
+}
+
+// aliasesResponse is the response of the _alias endpoint.
+type aliasesResponse map[string]struct {
+	Aliases map[string]struct {
+		IsWriteIndex bool `json:"is_write_index"`
+	} `json:"aliases"`
+}
+
+func (r aliasesResponse) indices(alias string) map[string]bool {
+	indices := make(map[string]bool)
+	for index, result := range r {
+		if a, ok := result.Aliases[alias]; ok {
+			indices[index] = a.IsWriteIndex
+		}
+	}
+	return indices
+}
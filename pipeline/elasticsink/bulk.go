@@ -0,0 +1,158 @@
+package elasticsink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+const (
+	defaultMaxBulkBytes       = 5 << 20
+	defaultMaxBulkActions     = 1000
+	defaultMaxConcurrentBulks = 4
+)
+
+// bulkItem is a single bulk action encoded as NDJSON.
+type bulkItem struct {
+	body []byte
+	// key identifies the document, so actions on the same document are
+	// never sent concurrently.
+	key string
+}
+
+// bulkChunk is a group of actions sent in a single bulk request.
+type bulkChunk struct {
+	items []bulkItem
+	size  int64
+	// dependsOn are the previous chunks with actions on the same documents
+	// as this one. They must finish before this chunk is sent.
+	dependsOn []int
+}
+
+// chunkResult is the outcome of sending a bulkChunk.
+type chunkResult struct {
+	err      error
+	itemErrs []string
+}
+
+// splitBulk splits the items in chunks that respect maxBytes and maxActions.
+// Items are kept in order. An item bigger than maxBytes is sent alone.
+func splitBulk(items []bulkItem, maxBytes int64, maxActions int) []bulkChunk {
+	var chunks []bulkChunk
+	lastChunkByKey := make(map[string]int)
+
+	for _, item := range items {
+		n := len(chunks) - 1
+		if n < 0 ||
+			(maxActions > 0 && len(chunks[n].items) >= maxActions) ||
+			(maxBytes > 0 && len(chunks[n].items) > 0 && chunks[n].size+int64(len(item.body)) > maxBytes) {
+			chunks = append(chunks, bulkChunk{})
+			n++
+		}
+
+		chunk := &chunks[n]
+		if last, ok := lastChunkByKey[item.key]; ok && last != n {
+			chunk.dependsOn = append(chunk.dependsOn, last)
+		}
+		lastChunkByKey[item.key] = n
+
+		chunk.items = append(chunk.items, item)
+		chunk.size += int64(len(item.body))
+	}
+
+	return chunks
+}
+
+// sendBulk sends all chunks with at most maxConcurrency requests in flight
+// and returns the result of each chunk.
+func (e *elasticSink) sendBulk(ctx context.Context, chunks []bulkChunk) []chunkResult {
+	results := make([]chunkResult, len(chunks))
+	done := make([]chan struct{}, len(chunks))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	semaphore := make(chan struct{}, e.bulkOptions.MaxConcurrency)
+
+	for i, chunk := range chunks {
+		go func() {
+			defer close(done[i])
+
+			// Chunks only depend on previous chunks, so this never deadlocks.
+			for _, dep := range chunk.dependsOn {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+					results[i].err = ctx.Err()
+					return
+				}
+			}
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				results[i].err = ctx.Err()
+				return
+			}
+			defer func() { <-semaphore }()
+
+			results[i] = e.sendChunk(ctx, chunk)
+		}()
+	}
+
+	for _, d := range done {
+		<-d
+	}
+	return results
+}
+
+func (e *elasticSink) sendChunk(ctx context.Context, chunk bulkChunk) chunkResult {
+	body := make([]byte, 0, chunk.size)
+	for _, item := range chunk.items {
+		body = append(body, item.body...)
+	}
+
+	response, err := e.client.Bulk(ctx, body)
+	if err != nil {
+		return chunkResult{err: err}
+	}
+
+	if !response.Errors {
+		return chunkResult{}
+	}
+
+	// One or more errors happened, but because we could
+	// be ignoring some of them we must check the errors.
+	return chunkResult{itemErrs: e.extractErrorsFromBulkItems(response)}
+}
+
+// mergeChunkResults merges the results of all chunks into a single error.
+func mergeChunkResults(results []chunkResult) error {
+	var requestErrs []error
+	var itemErrs []string
+
+	for i, result := range results {
+		if result.err != nil {
+			requestErrs = append(requestErrs, result.err)
+			if len(results) > 1 {
+				itemErrs = append(itemErrs, fmt.Sprintf("bulk request %d: %v", i, result.err))
+			}
+		}
+		itemErrs = append(itemErrs, result.itemErrs...)
+	}
+
+	if len(requestErrs) > 0 {
+		// The failed requests are retried as a whole, so the first error is
+		// enough as the root error. The others are kept for debugging.
+		if len(itemErrs) > 0 {
+			return errors.E(requestErrs[0], errors.SeverityRuntime, errors.KV("errors", itemErrs))
+		}
+		return errors.E(requestErrs[0], errors.SeverityRuntime)
+	}
+
+	if len(itemErrs) > 0 {
+		return errors.E("some items failed to be stored", errors.SeverityRuntime, errors.KV("errors", itemErrs))
+	}
+	return nil
+}
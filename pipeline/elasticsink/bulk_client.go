@@ -0,0 +1,52 @@
+package elasticsink
+
+import (
+	"context"
+)
+
+// bulkClient is the subset of the elasticsearch API used by the sink. Each
+// supported client library has an adapter implementing it, so all of them
+// share the same message semantics and error handling.
+type bulkClient interface {
+	// Bulk sends the NDJSON body to the _bulk endpoint. It only returns an
+	// error if the request as a whole failed.
+	Bulk(ctx context.Context, body []byte) (*bulkResponse, error)
+	// IndexExists checks if the index exists.
+	IndexExists(ctx context.Context, index string) (bool, error)
+	// CreateIndex creates the index. It doesn't fail if the index already
+	// exists.
+	CreateIndex(ctx context.Context, index string) error
+	// IndexTemplateExists checks if the composable index template exists.
+	IndexTemplateExists(ctx context.Context, name string) (bool, error)
+	// GetAlias returns the indices of the alias and if each of them is the
+	// write index. It returns an empty map if the alias doesn't exist.
+	GetAlias(ctx context.Context, alias string) (map[string]bool, error)
+	// AddToAlias atomically adds all indices to their aliases.
+	AddToAlias(ctx context.Context, actions ...aliasAction) error
+}
+
+// aliasAction adds Index to Alias.
+type aliasAction struct {
+	Index        string
+	Alias        string
+	IsWriteIndex bool
+}
+
+// bulkResponse is the response of the _bulk endpoint.
+type bulkResponse struct {
+	Errors bool                           `json:"errors"`
+	Items  []map[string]*bulkResponseItem `json:"items"`
+}
+
+// bulkResponseItem is the result of a single bulk action.
+type bulkResponseItem struct {
+	Index  string         `json:"_index"`
+	ID     string         `json:"_id"`
+	Status int            `json:"status"`
+	Error  *bulkItemError `json:"error,omitempty"`
+}
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
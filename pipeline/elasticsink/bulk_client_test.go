@@ -0,0 +1,258 @@
+package elasticsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arquivei/goduck/pipeline"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/olivere/elastic/v7"
+	"github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBackends = map[string]func(t *testing.T, url string, options ...Option) pipeline.Sink{
+	"olivere": func(t *testing.T, url string, options ...Option) pipeline.Sink {
+		client, err := elastic.NewSimpleClient(elastic.SetURL(url))
+		require.NoError(t, err)
+		return MustNew(client, options...)
+	},
+	"elasticsearch8": func(t *testing.T, url string, options ...Option) pipeline.Sink {
+		client, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{url}})
+		require.NoError(t, err)
+		return MustNewElasticsearch8(client, options...)
+	},
+	"opensearch": func(t *testing.T, url string, options ...Option) pipeline.Sink {
+		client, err := opensearch.NewClient(opensearch.Config{Addresses: []string{url}})
+		require.NoError(t, err)
+		return MustNewOpenSearch(client, options...)
+	},
+}
+
+func TestBackends(t *testing.T) {
+	for name, newSink := range testBackends {
+		t.Run(name, func(t *testing.T) {
+			cluster := newFakeCluster()
+			cluster.templates["logs"] = true
+			cluster.indices["logs-2026.10.16"] = true
+			cluster.aliases["logs"] = map[string]bool{"logs-2026.10.16": true}
+			cluster.bulkResponse = `{"took":1,"errors":true,"items":[` +
+				`{"index":{"_index":"logs-2026.10.17","_id":"ID1","status":409,"error":{"type":"version_conflict_engine_exception","reason":"version conflict"}}},` +
+				`{"delete":{"_index":"other","_id":"ID2","status":404,"error":{"type":"index_not_found_exception","reason":"no such index [other]"}}},` +
+				`{"update":{"_index":"logs-2026.10.17","_id":"ID3","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`
+
+			httpServer := httptest.NewServer(cluster)
+			defer httpServer.Close()
+
+			sink := newSink(t, httpServer.URL,
+				WithIgnoreVersionConflicts(),
+				WithIgnoreIndexNotFoundOnDelete(),
+				WithIndexNameTemplate("logs", IndexNameTemplate{
+					Template:          `{{.Index}}-{{.Time.Format "2006.01.02"}}`,
+					TimestampField:    "timestamp",
+					CreateIndex:       true,
+					IndexTemplateName: "logs",
+					Alias:             "logs",
+				}),
+			)
+
+			err := sink.Store(context.Background(),
+				IndexMessage{
+					ID:       "ID1",
+					Index:    "logs",
+					Version:  5,
+					Document: map[string]interface{}{"timestamp": "2026-10-17T10:00:00Z"},
+				},
+				DeleteMessage{ID: "ID2", Index: "other"},
+				UpdateMessage{
+					ID:       "ID3",
+					Index:    "logs",
+					Document: map[string]interface{}{"timestamp": "2026-10-17T11:00:00Z"},
+				},
+			)
+
+			assert.EqualError(t, errors.GetRootError(err), "some items failed to be stored")
+			assert.Equal(t, []string{"update logs-2026.10.17/ID3:mapper_parsing_exception: failed to parse"}, getKV(err, "errors"))
+
+			assert.Equal(t, []string{`{"index":{"_index":"logs-2026.10.17","_id":"ID1","version":5,"version_type":"external"}}
+{"timestamp":"2026-10-17T10:00:00Z"}
+{"delete":{"_index":"other","_id":"ID2"}}
+{"update":{"_index":"logs-2026.10.17","_id":"ID3"}}
+{"doc":{"timestamp":"2026-10-17T11:00:00Z"}}
+`}, cluster.bulkBodies)
+
+			assert.True(t, cluster.indices["logs-2026.10.17"])
+			assert.Equal(t, map[string]bool{"logs-2026.10.16": false, "logs-2026.10.17": true}, cluster.aliases["logs"])
+		})
+	}
+}
+
+func TestBackends_EncodedDocuments(t *testing.T) {
+	document := `{"a":1}`
+	raw := json.RawMessage(`{"b":2}`)
+
+	for name, newSink := range testBackends {
+		t.Run(name, func(t *testing.T) {
+			cluster := newFakeCluster()
+			cluster.bulkResponse = `{"took":1,"errors":false,"items":[]}`
+			httpServer := httptest.NewServer(cluster)
+			defer httpServer.Close()
+
+			sink := newSink(t, httpServer.URL)
+			err := sink.Store(context.Background(),
+				IndexMessage{ID: "ID1", Index: "docs", Document: document},
+				IndexMessage{ID: "ID2", Index: "docs", Document: &document},
+				IndexMessage{ID: "ID3", Index: "docs", Document: raw},
+				IndexMessage{ID: "ID4", Index: "docs", Document: &raw},
+			)
+			require.NoError(t, err)
+
+			// The documents are sent as they are, like olivere's bulk requests do.
+			assert.Equal(t, []string{`{"index":{"_index":"docs","_id":"ID1"}}
+{"a":1}
+{"index":{"_index":"docs","_id":"ID2"}}
+{"a":1}
+{"index":{"_index":"docs","_id":"ID3"}}
+{"b":2}
+{"index":{"_index":"docs","_id":"ID4"}}
+{"b":2}
+`}, cluster.bulkBodies)
+
+			var nilDocument *string
+			err = sink.Store(context.Background(), IndexMessage{ID: "ID5", Index: "docs", Document: nilDocument})
+			assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+		})
+	}
+}
+
+// fakeCluster implements the subset of the elasticsearch API used by the
+// bulkClient adapters.
+type fakeCluster struct {
+	mu           sync.Mutex
+	indices      map[string]bool
+	templates    map[string]bool
+	aliases      map[string]map[string]bool
+	bulkResponse string
+	bulkBodies   []string
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		indices:   map[string]bool{},
+		templates: map[string]bool{},
+		aliases:   map[string]map[string]bool{},
+	}
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		panic(err)
+	}
+
+	notFound := func(errorType string) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":{"type":%q,"reason":"not found"},"status":404}`, errorType)
+	}
+
+	switch {
+	case r.URL.Path == "/_bulk":
+		c.bulkBodies = append(c.bulkBodies, string(body))
+		fmt.Fprint(w, c.bulkResponse)
+
+	case r.URL.Path == "/_aliases":
+		var request struct {
+			Actions []map[string]struct {
+				Index        string `json:"index"`
+				Alias        string `json:"alias"`
+				IsWriteIndex bool   `json:"is_write_index"`
+			} `json:"actions"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			panic(err)
+		}
+		for _, action := range request.Actions {
+			add := action["add"]
+			if c.aliases[add.Alias] == nil {
+				c.aliases[add.Alias] = map[string]bool{}
+			}
+			c.aliases[add.Alias][add.Index] = add.IsWriteIndex
+		}
+		fmt.Fprint(w, `{"acknowledged":true}`)
+
+	case strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		name := strings.TrimPrefix(r.URL.Path, "/_index_template/")
+		if !c.templates[name] {
+			notFound("resource_not_found_exception")
+			return
+		}
+		fmt.Fprintf(w, `{"index_templates":[{"name":%q,"index_template":{"index_patterns":["%s-*"]}}]}`, name, name)
+
+	case strings.HasPrefix(r.URL.Path, "/_alias/"):
+		alias := strings.TrimPrefix(r.URL.Path, "/_alias/")
+		indices, ok := c.aliases[alias]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":"alias [%s] missing","status":404}`, alias)
+			return
+		}
+		response := map[string]interface{}{}
+		for index, isWriteIndex := range indices {
+			response[index] = map[string]interface{}{
+				"aliases": map[string]interface{}{alias: map[string]bool{"is_write_index": isWriteIndex}},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+
+	default:
+		index := strings.TrimPrefix(r.URL.Path, "/")
+		switch r.Method {
+		case http.MethodHead:
+			if !c.indices[index] {
+				notFound("index_not_found_exception")
+			}
+		case http.MethodPut:
+			if c.indices[index] {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"type":"resource_already_exists_exception","reason":"already exists"},"status":400}`)
+				return
+			}
+			c.indices[index] = true
+			fmt.Fprintf(w, `{"acknowledged":true,"shards_acknowledged":true,"index":%q}`, index)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// getKV returns the value of the key in the first error of the chain with it.
+func getKV(err error, key string) interface{} {
+	for {
+		e, ok := err.(errors.Error)
+		if !ok {
+			return nil
+		}
+		for _, kv := range e.KVs {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+		err = e.Err
+	}
+}
@@ -0,0 +1,303 @@
+package elasticsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// IndexNameTemplate resolves the index name of time-series documents.
+// It is registered for a base index name with WithIndexNameTemplate.
+type IndexNameTemplate struct {
+	// Template is a text/template that resolves the index name. It receives
+	// the message .Index and the document .Time, in UTC. For example:
+	//
+	//	{{.Index}}-{{.Time.Format "2006.01.02"}}
+	Template string
+	// TimestampField is the top level document field with the document time.
+	// It can be a time.Time, a RFC 3339 string or epoch milliseconds. If
+	// empty or missing in the document, the message Time is used and, if it
+	// is also zero, the time Store was called. Deletes and updates target
+	// existing documents, so they require a time instead.
+	TimestampField string
+
+	// CreateIndex creates the resolved index on its first write, if it
+	// doesn't exist yet. Settings and mappings come from the index templates
+	// registered in the cluster.
+	CreateIndex bool
+	// IndexTemplateName is the index template expected to match the created
+	// indices. If set, the sink checks it is registered before creating an
+	// index, so indices are never created without their mappings.
+	IndexTemplateName string
+	// Alias adds the created indices to this alias. The index with the
+	// greatest name becomes the alias write index, so the template should
+	// sort by time, like the example above.
+	Alias string
+}
+
+type indexNameTemplateData struct {
+	Index string
+	Time  time.Time
+}
+
+// indexNameResolver resolves the index names for a single base index.
+type indexNameResolver struct {
+	config   IndexNameTemplate
+	template *template.Template
+}
+
+func newIndexNameResolver(config IndexNameTemplate) (*indexNameResolver, error) {
+	tmpl, err := template.New("index").Option("missingkey=error").Parse(config.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &indexNameResolver{
+		config:   config,
+		template: tmpl,
+	}, nil
+}
+
+// resolve returns the index name for the document time. If the time can't
+// be found and now is zero, it returns an input error.
+func (r *indexNameResolver) resolve(index string, document interface{}, messageTime, now time.Time) (string, error) {
+	const op = errors.Op("elasticsink.indexNameResolver.resolve")
+
+	t := messageTime
+	if r.config.TimestampField != "" && document != nil {
+		documentTime, ok, err := documentTimestamp(document, r.config.TimestampField)
+		if err != nil {
+			return "", errors.E(op, err, errors.SeverityInput, errors.KV("field", r.config.TimestampField))
+		}
+		if ok {
+			t = documentTime
+		}
+	}
+	if t.IsZero() {
+		if now.IsZero() {
+			return "", errors.E(op, "message time is required to resolve the index", errors.SeverityInput, errors.KV("index", index))
+		}
+		t = now
+	}
+
+	var buf bytes.Buffer
+	err := r.template.Execute(&buf, indexNameTemplateData{
+		Index: index,
+		Time:  t.UTC(),
+	})
+	if err != nil {
+		return "", errors.E(op, err, errors.SeverityInput)
+	}
+	return buf.String(), nil
+}
+
+// documentTimestamp reads the timestamp from the top level field of the
+// document. It returns false if the field is missing.
+func documentTimestamp(document interface{}, field string) (time.Time, bool, error) {
+	fields, ok := document.(map[string]interface{})
+	if !ok {
+		// Other documents are converted to JSON, which is what elasticsearch
+		// would receive, so the field name matches the mapping.
+		data, err := json.Marshal(document)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		raw := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return time.Time{}, false, err
+		}
+		value, ok := raw[field]
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return time.Time{}, false, err
+		}
+		fields = map[string]interface{}{field: v}
+	}
+
+	value, ok := fields[field]
+	if !ok || value == nil {
+		return time.Time{}, false, nil
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, true, nil
+	case *time.Time:
+		return *v, true, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return t, true, nil
+	case float64:
+		return time.UnixMilli(int64(v)), true, nil
+	case int64:
+		return time.UnixMilli(v), true, nil
+	case int:
+		return time.UnixMilli(int64(v)), true, nil
+	case json.Number:
+		ms, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return time.UnixMilli(ms), true, nil
+	}
+
+	return time.Time{}, false, errors.New("unsupported timestamp type")
+}
+
+// indexCreator creates the resolved indices on their first write.
+type indexCreator struct {
+	client bulkClient
+
+	// creations deduplicates concurrent checks of the same index.
+	creations singleflight.Group
+
+	mu        sync.Mutex
+	known     map[string]bool
+	templates map[string]bool
+	// aliases serializes the write index updates of each alias.
+	aliases map[string]*sync.Mutex
+}
+
+func newIndexCreator(client bulkClient) *indexCreator {
+	return &indexCreator{
+		client:    client,
+		known:     make(map[string]bool),
+		templates: make(map[string]bool),
+		aliases:   make(map[string]*sync.Mutex),
+	}
+}
+
+// ensure creates the index if it doesn't exist, as configured by config.
+// Indices are only checked once for the lifetime of the sink. The lock is not
+// held during the checks, so writes to known indices are not blocked by
+// them.
+func (c *indexCreator) ensure(ctx context.Context, index string, config IndexNameTemplate) error {
+	const op = errors.Op("elasticsink.indexCreator.ensure")
+
+	c.mu.Lock()
+	known := c.known[index]
+	c.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	_, err, _ := c.creations.Do(index, func() (interface{}, error) {
+		exists, err := c.client.IndexExists(ctx, index)
+		if err != nil {
+			return nil, errors.E(op, err, errors.SeverityRuntime, errors.KV("index", index))
+		}
+
+		if !exists {
+			if err := c.checkTemplate(ctx, config.IndexTemplateName); err != nil {
+				return nil, errors.E(op, err, errors.KV("index", index))
+			}
+
+			if err := c.client.CreateIndex(ctx, index); err != nil {
+				return nil, errors.E(op, err, errors.SeverityRuntime, errors.KV("index", index))
+			}
+		}
+
+		if config.Alias != "" {
+			if err := c.updateWriteIndex(ctx, index, config.Alias); err != nil {
+				return nil, errors.E(op, err, errors.KV("index", index), errors.KV("alias", config.Alias))
+			}
+		}
+
+		c.mu.Lock()
+		c.known[index] = true
+		c.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+func (c *indexCreator) checkTemplate(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	known := c.templates[name]
+	c.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	exists, err := c.client.IndexTemplateExists(ctx, name)
+	if err != nil {
+		return errors.E(err, errors.SeverityRuntime)
+	}
+	if !exists {
+		return errors.E("index template not found", errors.SeverityFatal, errors.KV("template", name))
+	}
+
+	c.mu.Lock()
+	c.templates[name] = true
+	c.mu.Unlock()
+	return nil
+}
+
+// aliasLock returns the lock of the alias.
+func (c *indexCreator) aliasLock(alias string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lock, ok := c.aliases[alias]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.aliases[alias] = lock
+	}
+	return lock
+}
+
+// updateWriteIndex adds the index to the alias, making it the write index if
+// its name is greater than the current write index.
+func (c *indexCreator) updateWriteIndex(ctx context.Context, index, alias string) error {
+	// Serializing the updates of an alias keeps its write index consistent.
+	lock := c.aliasLock(alias)
+	lock.Lock()
+	defer lock.Unlock()
+
+	indices, err := c.client.GetAlias(ctx, alias)
+	if err != nil {
+		return errors.E(err, errors.SeverityRuntime)
+	}
+
+	var writeIndex string
+	for name, isWriteIndex := range indices {
+		if isWriteIndex {
+			writeIndex = name
+		}
+	}
+
+	var actions []aliasAction
+	if writeIndex >= index {
+		if _, ok := indices[index]; ok {
+			return nil
+		}
+		actions = append(actions, aliasAction{Index: index, Alias: alias})
+	} else {
+		// Both actions are applied atomically, so the alias always has a
+		// single write index.
+		actions = append(actions, aliasAction{Index: index, Alias: alias, IsWriteIndex: true})
+		if writeIndex != "" {
+			actions = append(actions, aliasAction{Index: writeIndex, Alias: alias})
+		}
+	}
+
+	if err := c.client.AddToAlias(ctx, actions...); err != nil {
+		return errors.E(err, errors.SeverityRuntime)
+	}
+	return nil
+}
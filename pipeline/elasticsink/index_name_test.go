@@ -0,0 +1,277 @@
+package elasticsink
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexNameResolver(t *testing.T) {
+	resolver, err := newIndexNameResolver(IndexNameTemplate{
+		Template:       `{{.Index}}-{{.Time.Format "2006.01.02"}}`,
+		TimestampField: "timestamp",
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	messageTime := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	type doc struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+
+	tests := []struct {
+		name          string
+		document      interface{}
+		messageTime   time.Time
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "RFC 3339 field",
+			document: map[string]interface{}{"timestamp": "2026-10-17T23:00:00-03:00"},
+			expected: "logs-2026.10.18",
+		},
+		{
+			name:     "Epoch milliseconds field",
+			document: map[string]interface{}{"timestamp": 1792238400000},
+			expected: "logs-2026.10.17",
+		},
+		{
+			name:     "Struct field",
+			document: doc{Timestamp: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+			expected: "logs-2026.10.16",
+		},
+		{
+			name:        "Missing field uses message time",
+			document:    map[string]interface{}{"a": 1},
+			messageTime: messageTime,
+			expected:    "logs-2026.10.18",
+		},
+		{
+			name:     "Missing field and message time uses now",
+			document: map[string]interface{}{"a": 1},
+			expected: "logs-2026.10.19",
+		},
+		{
+			name:          "Invalid field",
+			document:      map[string]interface{}{"timestamp": "yesterday"},
+			expectedError: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index, err := resolver.resolve("logs", test.document, test.messageTime, now)
+			if test.expectedError {
+				assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, index)
+		})
+	}
+
+	t.Run("Missing time without now", func(t *testing.T) {
+		_, err := resolver.resolve("logs", map[string]interface{}{"a": 1}, time.Time{}, time.Time{})
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+
+		index, err := resolver.resolve("logs", nil, messageTime, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, "logs-2026.10.18", index)
+	})
+}
+
+func TestStore_IndexNameTemplate(t *testing.T) {
+	server := new(mockServer)
+	server.On("ServeHTTP", "/logs-2026.10.17", "").Once().Return(``, 404)
+	server.On("ServeHTTP", "/_index_template/logs", "").Once().Return(
+		`{"index_templates":[{"name":"logs","index_template":{"index_patterns":["logs-*"]}}]}`,
+		200,
+	)
+	server.On("ServeHTTP", "/logs-2026.10.17", "").Once().Return(
+		`{"acknowledged":true,"shards_acknowledged":true,"index":"logs-2026.10.17"}`,
+		200,
+	)
+	server.On("ServeHTTP", "/_alias/logs", "").Once().Return(
+		`{"logs-2026.10.16":{"aliases":{"logs":{"is_write_index":true}}}}`,
+		200,
+	)
+	server.On(
+		"ServeHTTP",
+		"/_aliases",
+		`{"actions":[{"add":{"alias":"logs","index":"logs-2026.10.17","is_write_index":true}},{"add":{"alias":"logs","index":"logs-2026.10.16","is_write_index":false}}]}`,
+	).Once().Return(`{"acknowledged":true}`, 200)
+	server.On(
+		"ServeHTTP",
+		"/_bulk",
+		`{"index":{"_id":"ID1","_index":"logs-2026.10.17"}}
+{"timestamp":"2026-10-17T10:00:00Z"}
+{"index":{"_id":"ID2","_index":"logs-2026.10.17"}}
+{"a":1}`,
+	).Twice().Return(
+		`{"took":1,"errors":false,"items":[{"index":{"_index":"logs-2026.10.17","_id":"ID1","status":201}},{"index":{"_index":"logs-2026.10.17","_id":"ID2","status":201}}]}`,
+		200,
+	)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, err := elastic.NewSimpleClient(
+		elastic.SetURL(httpServer.URL),
+		elastic.SetHttpClient(httpServer.Client()),
+	)
+	require.NoError(t, err)
+	sink := MustNew(client, WithIndexNameTemplate("logs", IndexNameTemplate{
+		Template:          `{{.Index}}-{{.Time.Format "2006.01.02"}}`,
+		TimestampField:    "timestamp",
+		CreateIndex:       true,
+		IndexTemplateName: "logs",
+		Alias:             "logs",
+	}))
+
+	messages := []pipeline.SinkMessage{
+		IndexMessage{
+			ID:       "ID1",
+			Index:    "logs",
+			Document: map[string]interface{}{"timestamp": "2026-10-17T10:00:00Z"},
+		},
+		IndexMessage{
+			ID:       "ID2",
+			Index:    "logs",
+			Document: map[string]interface{}{"a": 1},
+			Time:     time.Date(2026, 10, 17, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	// The index is only created on the first write.
+	for range 2 {
+		assert.NoError(t, sink.Store(context.Background(), messages...))
+	}
+	server.AssertExpectations(t)
+}
+
+func TestStore_IndexNameTemplateRequiresTime(t *testing.T) {
+	client, err := elastic.NewSimpleClient()
+	require.NoError(t, err)
+	sink := MustNew(client, WithIndexNameTemplate("logs", IndexNameTemplate{
+		Template:       `{{.Index}}-{{.Time.Format "2006.01.02"}}`,
+		TimestampField: "timestamp",
+	}))
+
+	// Deletes and updates without a time would target the current index
+	// instead of the index of the document.
+	for _, message := range []pipeline.SinkMessage{
+		DeleteMessage{ID: "ID1", Index: "logs"},
+		UpdateMessage{ID: "ID1", Index: "logs", Document: map[string]interface{}{"a": 1}},
+		ScriptedUpdateMessage{ID: "ID1", Index: "logs", Script: "ctx._source.a++"},
+	} {
+		err := sink.Store(context.Background(), message)
+		assert.Error(t, err)
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+	}
+}
+
+func TestMustNew_InvalidIndexNameTemplate(t *testing.T) {
+	client, err := elastic.NewSimpleClient()
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		MustNew(client, WithIndexNameTemplate("logs", IndexNameTemplate{Template: "{{"}))
+	})
+}
+
+func TestIndexCreator_DoesNotBlockOtherIndices(t *testing.T) {
+	client := &blockingIndexClient{
+		blocked: "logs-2024.01.01",
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	creator := newIndexCreator(client)
+	config := IndexNameTemplate{Alias: "logs"}
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() { errs <- creator.ensure(context.Background(), "logs-2024.01.01", config) }()
+	}
+	<-client.entered
+
+	// Other indices are created while the check of the blocked one hangs.
+	done := make(chan error)
+	go func() { done <- creator.ensure(context.Background(), "logs-2024.01.02", config) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("ensure was blocked by another index")
+	}
+
+	close(client.release)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	// Concurrent checks of the same index are deduplicated.
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.Equal(t, map[string]int{"logs-2024.01.01": 1, "logs-2024.01.02": 1}, client.existsCalls)
+	assert.Equal(t, map[string]bool{"logs-2024.01.01": false, "logs-2024.01.02": true}, client.alias)
+}
+
+// blockingIndexClient is a bulkClient whose IndexExists hangs for the
+// blocked index until release is closed.
+type blockingIndexClient struct {
+	bulkClient
+
+	blocked string
+	entered chan struct{}
+	release chan struct{}
+
+	mu          sync.Mutex
+	existsCalls map[string]int
+	alias       map[string]bool
+}
+
+func (c *blockingIndexClient) IndexExists(_ context.Context, index string) (bool, error) {
+	c.mu.Lock()
+	if c.existsCalls == nil {
+		c.existsCalls = make(map[string]int)
+	}
+	c.existsCalls[index]++
+	c.mu.Unlock()
+
+	if index == c.blocked {
+		close(c.entered)
+		<-c.release
+	}
+	return true, nil
+}
+
+func (c *blockingIndexClient) GetAlias(_ context.Context, _ string) (map[string]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	indices := make(map[string]bool, len(c.alias))
+	for index, isWriteIndex := range c.alias {
+		indices[index] = isWriteIndex
+	}
+	return indices, nil
+}
+
+func (c *blockingIndexClient) AddToAlias(_ context.Context, actions ...aliasAction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.alias == nil {
+		c.alias = make(map[string]bool)
+	}
+	for _, action := range actions {
+		c.alias[action.Index] = action.IsWriteIndex
+	}
+	return nil
+}
@@ -7,3 +7,51 @@ func WithIgnoreIndexNotFoundOnDelete() Option {
 		es.deleteOptions.IgnoreIndexNotFoundError = true
 	}
 }
+
+// WithIgnoreVersionConflicts makes the sink ignore version conflict errors
+// for all actions. This is useful with external versioning, where a conflict
+// means that a newer version of the document is already stored.
+func WithIgnoreVersionConflicts() Option {
+	return func(es *elasticSink) {
+		es.ignoreVersionConflicts = true
+	}
+}
+
+// WithMaxBulkBytes limits the estimated size of each bulk request. Store
+// calls bigger than this are split in many bulk requests. Zero disables the
+// limit. Defaults to 5MiB, which is well below the elasticsearch default
+// http.max_content_length.
+func WithMaxBulkBytes(maxBytes int64) Option {
+	return func(es *elasticSink) {
+		es.bulkOptions.MaxBytes = maxBytes
+	}
+}
+
+// WithMaxBulkActions limits how many actions are sent in each bulk request.
+// Zero disables the limit. Defaults to 1000.
+func WithMaxBulkActions(maxActions int) Option {
+	return func(es *elasticSink) {
+		es.bulkOptions.MaxActions = maxActions
+	}
+}
+
+// WithMaxConcurrentBulks limits how many bulk requests of a single Store call
+// are sent at the same time. Defaults to 4.
+func WithMaxConcurrentBulks(maxConcurrency int) Option {
+	return func(es *elasticSink) {
+		es.bulkOptions.MaxConcurrency = maxConcurrency
+	}
+}
+
+// WithIndexNameTemplate resolves the index of messages with the given Index
+// using the template. This is used to write time-series documents, like
+// logs-2026.10.17, without computing the index name in every endpoint.
+// MustNew panics if the template is invalid.
+func WithIndexNameTemplate(index string, template IndexNameTemplate) Option {
+	return func(es *elasticSink) {
+		if es.indexNameTemplates == nil {
+			es.indexNameTemplates = make(map[string]IndexNameTemplate)
+		}
+		es.indexNameTemplates[index] = template
+	}
+}
@@ -1,17 +1,31 @@
 package elasticsink
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/arquivei/goduck/pipeline"
 
 	"github.com/arquivei/foundationkit/errors"
+	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/olivere/elastic/v7"
+	"github.com/opensearch-project/opensearch-go/v2"
 )
 
 const (
-	actionDelete                    = "delete"
-	errorTypeIndexNotFoundException = "index_not_found_exception"
+	actionDelete                            = "delete"
+	errorTypeIndexNotFoundException         = "index_not_found_exception"
+	errorTypeVersionConflictEngineException = "version_conflict_engine_exception"
+	errorTypeResourceAlreadyExistsException = "resource_already_exists_exception"
+
+	// VersionTypeExternal only accepts the write if the given version is
+	// greater than the stored version.
+	VersionTypeExternal = "external"
+	// VersionTypeExternalGTE only accepts the write if the given version is
+	// greater than or equal to the stored version.
+	VersionTypeExternalGTE = "external_gte"
 )
 
 // SinkMessage is the input for the Elastic Sink
@@ -23,23 +37,114 @@ type IndexMessage struct {
 	ID       string
 	Index    string
 	Document interface{}
+
+	// Routing is the optional shard routing value.
+	Routing string
+	// Version is the optional external version of the document. If set, the
+	// document is only saved if the version is newer than the stored one, so
+	// out-of-order redeliveries can't overwrite newer documents.
+	Version int64
+	// VersionType is used with Version. Defaults to VersionTypeExternal.
+	VersionType string
+
+	// Time is used to resolve the index name when Index has an
+	// IndexNameTemplate. Optional.
+	Time time.Time
 }
 
 // DeleteMessage deletes the document from the elasticsearch
 type DeleteMessage struct {
 	ID    string
 	Index string
+
+	// Routing is the optional shard routing value.
+	Routing string
+	// Version is the optional external version of the document. If set, the
+	// document is only deleted if the version is newer than the stored one.
+	Version int64
+	// VersionType is used with Version. Defaults to VersionTypeExternal.
+	VersionType string
+
+	// Time is used to resolve the index name when Index has an
+	// IndexNameTemplate. It is required in that case, so the delete targets
+	// the index of the document.
+	Time time.Time
+}
+
+// UpdateMessage merges the partial Document into the stored document.
+type UpdateMessage struct {
+	ID       string
+	Index    string
+	Document interface{}
+
+	// DocAsUpsert creates the document with Document if it doesn't exist.
+	DocAsUpsert bool
+	// Routing is the optional shard routing value.
+	Routing string
+	// RetryOnConflict is how many times elasticsearch retries the update
+	// if the document changes while being updated.
+	RetryOnConflict int
+
+	// Time is used to resolve the index name when Index has an
+	// IndexNameTemplate. It is required in that case, unless the template
+	// TimestampField is in the document, so the document index is targeted.
+	Time time.Time
+}
+
+// ScriptedUpdateMessage updates the stored document by running a script.
+type ScriptedUpdateMessage struct {
+	ID    string
+	Index string
+
+	// Script is the script source.
+	Script string
+	// Lang is the script language. Defaults to painless.
+	Lang string
+	// Params are the script parameters.
+	Params map[string]interface{}
+
+	// Upsert is the document created if it doesn't exist. Optional.
+	Upsert interface{}
+	// ScriptedUpsert runs the script even if the document doesn't exist.
+	ScriptedUpsert bool
+	// Routing is the optional shard routing value.
+	Routing string
+	// RetryOnConflict is how many times elasticsearch retries the update
+	// if the document changes while being updated.
+	RetryOnConflict int
+
+	// Time is used to resolve the index name when Index has an
+	// IndexNameTemplate. It is required in that case, unless the template
+	// TimestampField is in the document, so the document index is targeted.
+	Time time.Time
 }
 
 type elasticSink struct {
-	client *elastic.Client
+	client bulkClient
 
 	deleteOptions struct {
 		IgnoreIndexNotFoundError bool
 	}
+
+	ignoreVersionConflicts bool
+
+	bulkOptions struct {
+		MaxBytes       int64
+		MaxActions     int
+		MaxConcurrency int
+	}
+
+	indexNameTemplates map[string]IndexNameTemplate
+	indexNameResolvers map[string]*indexNameResolver
+	indexCreator       *indexCreator
 }
 
-// MustNew creates a new sink that saves documents to elastic
+// MustNew creates a new sink that saves documents to elastic using the
+// olivere/elastic v7 client.
+//
+// Each Store call is split in bulk requests limited by WithMaxBulkBytes and
+// WithMaxBulkActions, which are sent concurrently up to
+// WithMaxConcurrentBulks. Actions on the same document keep their order.
 func MustNew(
 	client *elastic.Client,
 	options ...Option,
@@ -47,14 +152,58 @@ func MustNew(
 	if client == nil {
 		panic("elasticsearch client is nil")
 	}
+	return mustNew(olivereAdapter{client: client}, options...)
+}
+
+// MustNewElasticsearch8 is like MustNew, but uses the official
+// go-elasticsearch v8 typed client.
+func MustNewElasticsearch8(
+	client *elasticsearch.TypedClient,
+	options ...Option,
+) pipeline.Sink {
+	if client == nil {
+		panic("elasticsearch client is nil")
+	}
+	return mustNew(elasticsearch8Adapter{client: client}, options...)
+}
+
+// MustNewOpenSearch is like MustNew, but uses the opensearch-go client.
+func MustNewOpenSearch(
+	client *opensearch.Client,
+	options ...Option,
+) pipeline.Sink {
+	if client == nil {
+		panic("opensearch client is nil")
+	}
+	return mustNew(opensearchAdapter{client: client}, options...)
+}
 
+func mustNew(client bulkClient, options ...Option) pipeline.Sink {
 	es := &elasticSink{
 		client: client,
 	}
+	es.bulkOptions.MaxBytes = defaultMaxBulkBytes
+	es.bulkOptions.MaxActions = defaultMaxBulkActions
+	es.bulkOptions.MaxConcurrency = defaultMaxConcurrentBulks
 
 	for _, opt := range options {
 		opt(es)
 	}
+
+	if es.bulkOptions.MaxConcurrency < 1 {
+		panic("max concurrent bulks must be at least 1")
+	}
+
+	es.indexNameResolvers = make(map[string]*indexNameResolver, len(es.indexNameTemplates))
+	for index, config := range es.indexNameTemplates {
+		resolver, err := newIndexNameResolver(config)
+		if err != nil {
+			panic(errors.E(errors.Op("elasticsink.MustNew"), err, errors.KV("index", index)))
+		}
+		es.indexNameResolvers[index] = resolver
+	}
+	es.indexCreator = newIndexCreator(client)
+
 	return es
 }
 
@@ -65,53 +214,111 @@ func (e *elasticSink) Store(ctx context.Context, input ...pipeline.SinkMessage)
 		return nil
 	}
 
-	bulkRequest := e.client.Bulk()
+	now := time.Now()
+	items := make([]bulkItem, 0, len(input))
+	indicesToCreate := make(map[string]IndexNameTemplate)
 	for _, message := range input {
+		var body []byte
+		var key string
+		var err error
+
 		switch sinkMessage := message.(type) {
 		case IndexMessage:
-			item, err := newIndexBulkItem(sinkMessage)
+			sinkMessage.Index, err = e.resolveIndex(sinkMessage.Index, sinkMessage.Document, sinkMessage.Time, now, indicesToCreate)
 			if err != nil {
 				return errors.E(op, err)
 			}
-			bulkRequest.Add(item)
+			key = sinkMessage.Index + "/" + sinkMessage.ID
+			body, err = newIndexBulkItem(sinkMessage)
 		case DeleteMessage:
-			item, err := newDeleteBulkItem(sinkMessage)
+			// Deletes never create indices and must target the index of the
+			// document, so they don't fall back to the current time.
+			sinkMessage.Index, err = e.resolveIndex(sinkMessage.Index, nil, sinkMessage.Time, time.Time{}, nil)
+			if err != nil {
+				return errors.E(op, err)
+			}
+			key = sinkMessage.Index + "/" + sinkMessage.ID
+			body, err = newDeleteBulkItem(sinkMessage)
+		case UpdateMessage:
+			sinkMessage.Index, err = e.resolveIndex(sinkMessage.Index, sinkMessage.Document, sinkMessage.Time, time.Time{}, indicesToCreate)
 			if err != nil {
 				return errors.E(op, err)
 			}
-			bulkRequest.Add(item)
+			key = sinkMessage.Index + "/" + sinkMessage.ID
+			body, err = newUpdateBulkItem(sinkMessage)
+		case ScriptedUpdateMessage:
+			sinkMessage.Index, err = e.resolveIndex(sinkMessage.Index, sinkMessage.Upsert, sinkMessage.Time, time.Time{}, indicesToCreate)
+			if err != nil {
+				return errors.E(op, err)
+			}
+			key = sinkMessage.Index + "/" + sinkMessage.ID
+			body, err = newScriptedUpdateBulkItem(sinkMessage)
 		default:
-			return errors.E(op, "message should have type elasticsink.SinkMessage", errors.SeverityInput)
+			return errors.E(op, "message should have type elasticsink.IndexMessage, DeleteMessage, UpdateMessage or ScriptedUpdateMessage", errors.SeverityInput)
+		}
+		if err != nil {
+			return errors.E(op, err)
 		}
+
+		items = append(items, bulkItem{body: body, key: key})
 	}
 
-	response, err := bulkRequest.Do(ctx)
-	if err != nil {
-		return errors.E(op, err, errors.SeverityRuntime)
-	}
-
-	if response.Errors {
-		// One or more errors happened, but because we could
-		// be ignoring some of them we must check the errors.
-		// Let's extract the errors that are not ignored and
-		// return a new error with only those errors. If no
-		// error is returned here, than just return success.
-		errs := e.extractErrorsFromBulkItems(response)
-		if len(errs) > 0 {
-			return errors.E(op, "some items failed to be stored", errors.SeverityRuntime, errors.KV("errors", errs))
+	for index, config := range indicesToCreate {
+		if err := e.indexCreator.ensure(ctx, index, config); err != nil {
+			return errors.E(op, err)
 		}
 	}
+
+	chunks := splitBulk(items, e.bulkOptions.MaxBytes, e.bulkOptions.MaxActions)
+	results := e.sendBulk(ctx, chunks)
+
+	if err := mergeChunkResults(results); err != nil {
+		return errors.E(op, err)
+	}
 	return nil
 }
 
-func (e *elasticSink) shouldIgnoreError(action string, result *elastic.BulkResponseItem) bool {
+// resolveIndex resolves the index name if it has an IndexNameTemplate. If
+// the document has no time, now is used, or an error is returned when now
+// is zero. If indicesToCreate is not nil, the resolved index is added to it
+// when its template creates indices.
+func (e *elasticSink) resolveIndex(
+	index string,
+	document interface{},
+	messageTime, now time.Time,
+	indicesToCreate map[string]IndexNameTemplate,
+) (string, error) {
+	resolver, ok := e.indexNameResolvers[index]
+	if !ok {
+		return index, nil
+	}
+
+	resolved, err := resolver.resolve(index, document, messageTime, now)
+	if err != nil {
+		return "", err
+	}
+
+	if indicesToCreate != nil && resolver.config.CreateIndex {
+		indicesToCreate[resolved] = resolver.config
+	}
+	return resolved, nil
+}
+
+func (e *elasticSink) shouldIgnoreError(action string, result *bulkResponseItem) bool {
+	if result.Error == nil {
+		return false
+	}
+
+	if e.ignoreVersionConflicts && result.Error.Type == errorTypeVersionConflictEngineException {
+		return true
+	}
+
 	return action == actionDelete &&
 		e.deleteOptions.IgnoreIndexNotFoundError &&
-		result.Error != nil &&
 		result.Error.Type == errorTypeIndexNotFoundException
 }
 
-func (e *elasticSink) extractErrorsFromBulkItems(response *elastic.BulkResponse) []string {
+func (e *elasticSink) extractErrorsFromBulkItems(response *bulkResponse) []string {
 	errs := []string{}
 	for _, item := range response.Items {
 		for action, result := range item {
@@ -126,17 +333,85 @@ func (e *elasticSink) extractErrorsFromBulkItems(response *elastic.BulkResponse)
 			if result.Error != nil {
 				reason = result.Error.Type + ": " + result.Error.Reason
 			}
-			errs = append(errs, action+" "+result.Index+"/"+result.Id+":"+reason)
+			errs = append(errs, action+" "+result.Index+"/"+result.ID+":"+reason)
 		}
 	}
 	return errs
 }
 
-func bulkItemSucceeded(result *elastic.BulkResponseItem) bool {
+func bulkItemSucceeded(result *bulkResponseItem) bool {
 	return result.Status >= 200 && result.Status <= 299
 }
 
-func newIndexBulkItem(sinkMessage IndexMessage) (elastic.BulkableRequest, error) {
+// bulkActionMetadata is the first line of every bulk action.
+type bulkActionMetadata struct {
+	Index           string `json:"_index"`
+	ID              string `json:"_id"`
+	Routing         string `json:"routing,omitempty"`
+	Version         int64  `json:"version,omitempty"`
+	VersionType     string `json:"version_type,omitempty"`
+	RetryOnConflict int    `json:"retry_on_conflict,omitempty"`
+}
+
+type updateSource struct {
+	Doc         interface{} `json:"doc"`
+	DocAsUpsert bool        `json:"doc_as_upsert,omitempty"`
+}
+
+type scriptedUpdateSource struct {
+	Script struct {
+		Source string                 `json:"source"`
+		Lang   string                 `json:"lang,omitempty"`
+		Params map[string]interface{} `json:"params,omitempty"`
+	} `json:"script"`
+	Upsert         interface{} `json:"upsert,omitempty"`
+	ScriptedUpsert bool        `json:"scripted_upsert,omitempty"`
+}
+
+// encodeBulkAction encodes the action in the NDJSON format of the bulk API.
+// The source line is omitted if source is nil.
+func encodeBulkAction(action string, metadata bulkActionMetadata, source interface{}) ([]byte, error) {
+	const op errors.Op = "encodeBulkAction"
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]bulkActionMetadata{action: metadata}); err != nil {
+		return nil, errors.E(op, err, errors.SeverityInput)
+	}
+
+	if source == nil {
+		return buf.Bytes(), nil
+	}
+
+	// Strings and raw messages, or pointers to them, are already encoded
+	// documents.
+	switch s := source.(type) {
+	case string:
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	case *string:
+		if s == nil {
+			return nil, errors.E(op, "nil document", errors.SeverityInput)
+		}
+		buf.WriteString(*s)
+		buf.WriteByte('\n')
+	case json.RawMessage:
+		buf.Write(s)
+		buf.WriteByte('\n')
+	case *json.RawMessage:
+		if s == nil {
+			return nil, errors.E(op, "nil document", errors.SeverityInput)
+		}
+		buf.Write(*s)
+		buf.WriteByte('\n')
+	default:
+		if err := json.NewEncoder(&buf).Encode(source); err != nil {
+			return nil, errors.E(op, err, errors.SeverityInput)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func newIndexBulkItem(sinkMessage IndexMessage) ([]byte, error) {
 	const op errors.Op = "newIndexBulkItem"
 
 	if sinkMessage.ID == "" {
@@ -149,14 +424,20 @@ func newIndexBulkItem(sinkMessage IndexMessage) (elastic.BulkableRequest, error)
 		return nil, errors.E(op, "mandatory Document", errors.SeverityInput)
 	}
 
-	return elastic.
-		NewBulkIndexRequest().
-		Index(sinkMessage.Index).
-		Id(sinkMessage.ID).
-		Doc(sinkMessage.Document), nil
+	metadata := bulkActionMetadata{
+		Index:   sinkMessage.Index,
+		ID:      sinkMessage.ID,
+		Routing: sinkMessage.Routing,
+	}
+	if sinkMessage.Version != 0 {
+		metadata.Version = sinkMessage.Version
+		metadata.VersionType = versionTypeOrDefault(sinkMessage.VersionType)
+	}
+
+	return encodeBulkAction("index", metadata, sinkMessage.Document)
 }
 
-func newDeleteBulkItem(sinkMessage DeleteMessage) (elastic.BulkableRequest, error) {
+func newDeleteBulkItem(sinkMessage DeleteMessage) ([]byte, error) {
 	const op errors.Op = "newDeleteBulkItem"
 
 	if sinkMessage.ID == "" {
@@ -166,7 +447,79 @@ func newDeleteBulkItem(sinkMessage DeleteMessage) (elastic.BulkableRequest, erro
 		return nil, errors.E(op, "mandatory Index", errors.SeverityInput)
 	}
 
-	return elastic.NewBulkDeleteRequest().
-		Index(sinkMessage.Index).
-		Id(sinkMessage.ID), nil
+	metadata := bulkActionMetadata{
+		Index:   sinkMessage.Index,
+		ID:      sinkMessage.ID,
+		Routing: sinkMessage.Routing,
+	}
+	if sinkMessage.Version != 0 {
+		metadata.Version = sinkMessage.Version
+		metadata.VersionType = versionTypeOrDefault(sinkMessage.VersionType)
+	}
+
+	return encodeBulkAction(actionDelete, metadata, nil)
+}
+
+func newUpdateBulkItem(sinkMessage UpdateMessage) ([]byte, error) {
+	const op errors.Op = "newUpdateBulkItem"
+
+	if sinkMessage.ID == "" {
+		return nil, errors.E(op, "mandatory ID", errors.SeverityInput)
+	}
+	if sinkMessage.Index == "" {
+		return nil, errors.E(op, "mandatory Index", errors.SeverityInput)
+	}
+	if sinkMessage.Document == nil {
+		return nil, errors.E(op, "mandatory Document", errors.SeverityInput)
+	}
+
+	metadata := bulkActionMetadata{
+		Index:           sinkMessage.Index,
+		ID:              sinkMessage.ID,
+		Routing:         sinkMessage.Routing,
+		RetryOnConflict: sinkMessage.RetryOnConflict,
+	}
+
+	return encodeBulkAction("update", metadata, updateSource{
+		Doc:         sinkMessage.Document,
+		DocAsUpsert: sinkMessage.DocAsUpsert,
+	})
+}
+
+func newScriptedUpdateBulkItem(sinkMessage ScriptedUpdateMessage) ([]byte, error) {
+	const op errors.Op = "newScriptedUpdateBulkItem"
+
+	if sinkMessage.ID == "" {
+		return nil, errors.E(op, "mandatory ID", errors.SeverityInput)
+	}
+	if sinkMessage.Index == "" {
+		return nil, errors.E(op, "mandatory Index", errors.SeverityInput)
+	}
+	if sinkMessage.Script == "" {
+		return nil, errors.E(op, "mandatory Script", errors.SeverityInput)
+	}
+
+	metadata := bulkActionMetadata{
+		Index:           sinkMessage.Index,
+		ID:              sinkMessage.ID,
+		Routing:         sinkMessage.Routing,
+		RetryOnConflict: sinkMessage.RetryOnConflict,
+	}
+
+	source := scriptedUpdateSource{
+		Upsert:         sinkMessage.Upsert,
+		ScriptedUpsert: sinkMessage.ScriptedUpsert,
+	}
+	source.Script.Source = sinkMessage.Script
+	source.Script.Lang = sinkMessage.Lang
+	source.Script.Params = sinkMessage.Params
+
+	return encodeBulkAction("update", metadata, source)
+}
+
+func versionTypeOrDefault(versionType string) string {
+	if versionType == "" {
+		return VersionTypeExternal
+	}
+	return versionType
 }
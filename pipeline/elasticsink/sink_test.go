@@ -21,6 +21,7 @@ func TestAddBulk(t *testing.T) {
 	tests := []struct {
 		name          string
 		httpHandler   *mockServer
+		options       []Option
 		input         []pipeline.SinkMessage
 		expectedError string
 	}{
@@ -105,6 +106,120 @@ func TestAddBulk(t *testing.T) {
 			},
 			expectedError: "",
 		},
+		{
+			name: "Success - Update and scripted update",
+			httpHandler: func() *mockServer {
+				server := new(mockServer)
+				server.On(
+					"ServeHTTP",
+					"/_bulk",
+					`{"update":{"_id":"ID1","_index":"index1","retry_on_conflict":3,"routing":"r1"}}
+{"doc":{"a":2},"doc_as_upsert":true}
+{"update":{"_id":"ID2","_index":"index1"}}
+{"script":{"lang":"painless","params":{"n":1},"source":"ctx._source.count += params.n"},"scripted_upsert":true,"upsert":{"count":0}}`,
+				).Once().Return(
+					`{"took":3,"errors":false,"items":[{"update":{"_index":"index1","_id":"ID1","_version":1,"result":"created","status":201}},{"update":{"_index":"index1","_id":"ID2","_version":2,"result":"updated","status":200}}]}`,
+					200,
+				)
+
+				return server
+			}(),
+			input: []pipeline.SinkMessage{
+				UpdateMessage{
+					ID:              "ID1",
+					Index:           "index1",
+					Routing:         "r1",
+					Document:        map[string]interface{}{"a": 2},
+					DocAsUpsert:     true,
+					RetryOnConflict: 3,
+				},
+				ScriptedUpdateMessage{
+					ID:             "ID2",
+					Index:          "index1",
+					Script:         "ctx._source.count += params.n",
+					Lang:           "painless",
+					Params:         map[string]interface{}{"n": 1},
+					Upsert:         map[string]interface{}{"count": 0},
+					ScriptedUpsert: true,
+				},
+			},
+			expectedError: "",
+		},
+		{
+			name: "Success - External version conflict ignored",
+			httpHandler: func() *mockServer {
+				server := new(mockServer)
+				server.On(
+					"ServeHTTP",
+					"/_bulk",
+					`{"index":{"_id":"ID1","_index":"index1","routing":"r1","version":5,"version_type":"external"}}
+{"a":2}
+{"delete":{"_id":"ID2","_index":"index1","version":7,"version_type":"external_gte"}}`,
+				).Once().Return(
+					`{"took":1,"errors":true,"items":[{"index":{"_index":"index1","_id":"ID1","status":409,"error":{"type":"version_conflict_engine_exception","reason":"[ID1]: version conflict, current version [6] is higher or equal to the one provided [5]"}}},{"delete":{"_index":"index1","_id":"ID2","_version":7,"result":"deleted","status":200}}]}`,
+					200,
+				)
+
+				return server
+			}(),
+			options: []Option{WithIgnoreVersionConflicts()},
+			input: []pipeline.SinkMessage{
+				IndexMessage{
+					ID:       "ID1",
+					Index:    "index1",
+					Routing:  "r1",
+					Version:  5,
+					Document: map[string]interface{}{"a": 2},
+				},
+				DeleteMessage{
+					ID:          "ID2",
+					Index:       "index1",
+					Version:     7,
+					VersionType: VersionTypeExternalGTE,
+				},
+			},
+			expectedError: "",
+		},
+		{
+			name: "Error - External version conflict",
+			httpHandler: func() *mockServer {
+				server := new(mockServer)
+				server.On(
+					"ServeHTTP",
+					"/_bulk",
+					`{"index":{"_id":"ID1","_index":"index1","version":5,"version_type":"external"}}
+{"a":2}`,
+				).Once().Return(
+					`{"took":1,"errors":true,"items":[{"index":{"_index":"index1","_id":"ID1","status":409,"error":{"type":"version_conflict_engine_exception","reason":"[ID1]: version conflict, current version [6] is higher or equal to the one provided [5]"}}}]}`,
+					200,
+				)
+
+				return server
+			}(),
+			input: []pipeline.SinkMessage{
+				IndexMessage{
+					ID:       "ID1",
+					Index:    "index1",
+					Version:  5,
+					Document: map[string]interface{}{"a": 2},
+				},
+			},
+			expectedError: "some items failed to be stored",
+		},
+		{
+			name: "Error - Scripted update without script",
+			httpHandler: func() *mockServer {
+				server := new(mockServer)
+				return server
+			}(),
+			input: []pipeline.SinkMessage{
+				ScriptedUpdateMessage{
+					ID:    "ID1",
+					Index: "index1",
+				},
+			},
+			expectedError: "mandatory Script",
+		},
 
 		{
 			name: "Error - No ID",
@@ -177,7 +292,7 @@ func TestAddBulk(t *testing.T) {
 				elastic.SetHttpClient(httpServer.Client()),
 			)
 			assert.NoError(t, err)
-			sink := MustNew(client)
+			sink := MustNew(client, test.options...)
 
 			err = sink.Store(context.Background(), test.input...)
 
@@ -226,3 +341,73 @@ func (s *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 }
+
+func TestStore_SplitsBulk(t *testing.T) {
+	server := new(mockServer)
+	server.On(
+		"ServeHTTP",
+		"/_bulk",
+		`{"index":{"_id":"ID1","_index":"index1"}}
+{"a":1}
+{"index":{"_id":"ID2","_index":"index1"}}
+{"a":2}`,
+	).Once().Return(
+		`{"took":1,"errors":false,"items":[{"index":{"_index":"index1","_id":"ID1","status":201}},{"index":{"_index":"index1","_id":"ID2","status":201}}]}`,
+		200,
+	)
+	server.On(
+		"ServeHTTP",
+		"/_bulk",
+		`{"index":{"_id":"ID3","_index":"index1"}}
+{"a":3}`,
+	).Once().Return(
+		`{"took":1,"errors":true,"items":[{"index":{"_index":"index1","_id":"ID3","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`,
+		200,
+	)
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, err := elastic.NewSimpleClient(
+		elastic.SetURL(httpServer.URL),
+		elastic.SetHttpClient(httpServer.Client()),
+	)
+	assert.NoError(t, err)
+	sink := MustNew(client, WithMaxBulkActions(2), WithMaxConcurrentBulks(2))
+
+	err = sink.Store(context.Background(),
+		IndexMessage{ID: "ID1", Index: "index1", Document: map[string]interface{}{"a": 1}},
+		IndexMessage{ID: "ID2", Index: "index1", Document: map[string]interface{}{"a": 2}},
+		IndexMessage{ID: "ID3", Index: "index1", Document: map[string]interface{}{"a": 3}},
+	)
+
+	assert.EqualError(t, errors.GetRootError(err), "some items failed to be stored")
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+	server.AssertExpectations(t)
+}
+
+func TestSplitBulk(t *testing.T) {
+	item := func(key string, size int64) bulkItem {
+		return bulkItem{key: key, body: make([]byte, size)}
+	}
+
+	chunks := splitBulk([]bulkItem{
+		item("i/1", 40),
+		item("i/2", 40),
+		item("i/3", 150),
+		item("i/1", 10),
+		item("i/4", 10),
+		item("i/5", 10),
+	}, 100, 2)
+
+	keys := make([][]string, len(chunks))
+	deps := make([][]int, len(chunks))
+	for i, chunk := range chunks {
+		for _, item := range chunk.items {
+			keys[i] = append(keys[i], item.key)
+		}
+		deps[i] = chunk.dependsOn
+	}
+
+	assert.Equal(t, [][]string{{"i/1", "i/2"}, {"i/3"}, {"i/1", "i/4"}, {"i/5"}}, keys)
+	assert.Equal(t, [][]int{nil, nil, {0}, nil}, deps)
+}
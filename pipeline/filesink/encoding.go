@@ -0,0 +1,75 @@
+package filesink
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+)
+
+// Encoding defines how records are encoded in the files.
+type Encoding interface {
+	// Extension is the file extension, including the dot.
+	Extension() string
+	// Header is written at the beginning of every file. It may be nil.
+	Header() ([]byte, error)
+	// Encode returns the encoded record.
+	Encode(record interface{}) ([]byte, error)
+}
+
+// EncodingJSONL encodes each record as a JSON document in its own line.
+func EncodingJSONL() Encoding {
+	return jsonlEncoding{}
+}
+
+// EncodingCSV encodes each record as a CSV line. Records must be of type
+// []string. If header is not empty, it is written as the first line of
+// every file.
+func EncodingCSV(header []string) Encoding {
+	return csvEncoding{header: header}
+}
+
+type jsonlEncoding struct{}
+
+func (jsonlEncoding) Extension() string { return ".jsonl" }
+
+func (jsonlEncoding) Header() ([]byte, error) { return nil, nil }
+
+func (jsonlEncoding) Encode(record interface{}) ([]byte, error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+type csvEncoding struct {
+	header []string
+}
+
+func (csvEncoding) Extension() string { return ".csv" }
+
+func (e csvEncoding) Header() ([]byte, error) {
+	if len(e.header) == 0 {
+		return nil, nil
+	}
+	return encodeCSVLine(e.header)
+}
+
+func (csvEncoding) Encode(record interface{}) ([]byte, error) {
+	line, ok := record.([]string)
+	if !ok {
+		return nil, fmt.Errorf("csv records must be []string, got %T", record)
+	}
+	return encodeCSVLine(line)
+}
+
+func encodeCSVLine(line []string) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write(line); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
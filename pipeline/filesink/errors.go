@@ -0,0 +1,27 @@
+package filesink
+
+import "errors"
+
+var (
+	// ErrUnknownMessageType is returned when the sink message received is
+	// not of the type Record.
+	ErrUnknownMessageType = errors.New("unknown message type: expected filesink.Record")
+
+	// ErrEmptyData is returned when the Record.Data is nil.
+	ErrEmptyData = errors.New("data is missing from the record")
+
+	// ErrInvalidRecord is returned when a record can't be encoded.
+	ErrInvalidRecord = errors.New("record can't be encoded")
+
+	// ErrWriteFailed is returned when the records could not be written to
+	// the file or the file could not be rotated.
+	ErrWriteFailed = errors.New("failed to write records")
+
+	// ErrRecoveryFailed is returned when the temporary files left by a
+	// previous sink could not be recovered.
+	ErrRecoveryFailed = errors.New("failed to recover temporary files")
+
+	// ErrSinkClosed is returned when Store is called after the sink is
+	// closed.
+	ErrSinkClosed = errors.New("sink is closed")
+)
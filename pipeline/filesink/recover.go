@@ -0,0 +1,116 @@
+package filesink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+)
+
+// offsetSuffix is appended to the temporary file name to name the file that
+// holds the offset after its last flushed record.
+const offsetSuffix = ".offset"
+
+// recoverFiles finalizes the temporary files left in the directory by a
+// sink that didn't rotate them, usually because the process crashed.
+func recoverFiles(config Config) error {
+	const op = errors.Op("filesink.recoverFiles")
+
+	entries, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return errors.E(op, ErrRecoveryFailed, errors.KV("cause", err), errors.KV("dir", config.Dir))
+	}
+
+	prefix := "." + config.FilePrefix + "-"
+	recovered := false
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+
+		tmpPath := filepath.Join(config.Dir, name)
+		if err := recoverFile(tmpPath); err != nil {
+			return errors.E(op, ErrRecoveryFailed, errors.KV("cause", err), errors.KV("file", tmpPath))
+		}
+		recovered = true
+	}
+
+	// Offset files without a temporary file were left by a crash after the
+	// rename of a rotation.
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".tmp"+offsetSuffix) {
+			continue
+		}
+
+		offsetPath := filepath.Join(config.Dir, name)
+		if _, err := os.Stat(strings.TrimSuffix(offsetPath, offsetSuffix)); !os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Remove(offsetPath); err != nil && !os.IsNotExist(err) {
+			return errors.E(op, ErrRecoveryFailed, errors.KV("cause", err), errors.KV("file", offsetPath))
+		}
+		recovered = true
+	}
+
+	if recovered {
+		if err := syncDir(config.Dir); err != nil {
+			return errors.E(op, ErrRecoveryFailed, errors.KV("cause", err), errors.KV("dir", config.Dir))
+		}
+	}
+	return nil
+}
+
+// recoverFile truncates the temporary file to the offset saved by its last
+// flush and renames it to its final name. If there is no saved offset, no
+// records were flushed and the file is removed.
+func recoverFile(tmpPath string) error {
+	offsetPath := tmpPath + offsetSuffix
+	b, err := os.ReadFile(offsetPath)
+	if os.IsNotExist(err) {
+		return os.Remove(tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+	if len(b) != 8 {
+		return fmt.Errorf("invalid offset file %s", offsetPath)
+	}
+	offset := int64(binary.BigEndian.Uint64(b))
+
+	file, err := os.OpenFile(tmpPath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// The offset is saved after the file is synced, so it is never past the
+	// end of the file.
+	if offset < 0 || offset > info.Size() {
+		return fmt.Errorf("offset %d is past the end of the file", offset)
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(tmpPath), "."), ".tmp")
+	if err := os.Rename(tmpPath, filepath.Join(filepath.Dir(tmpPath), name)); err != nil {
+		return err
+	}
+	return os.Remove(offsetPath)
+}
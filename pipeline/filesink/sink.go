@@ -0,0 +1,481 @@
+package filesink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+)
+
+// Record is the input for the file sink.
+type Record struct {
+	// Data is the record being stored. It is encoded with the sink Encoding.
+	Data interface{}
+}
+
+// Config configures the file sink.
+type Config struct {
+	// Dir is where the files are written. It is created if it doesn't exist.
+	Dir string
+	// FilePrefix is the prefix of the generated file names.
+	// Defaults to "part".
+	FilePrefix string
+	// Encoding is how records are written. See EncodingJSONL and EncodingCSV.
+	Encoding Encoding
+	// Gzip compresses the files. The ".gz" extension is added to them.
+	Gzip bool
+
+	// MaxBytes rotates the file after this many bytes were written, before
+	// compression. Zero disables it.
+	MaxBytes int64
+	// MaxRecords rotates the file after this many records. Zero disables it.
+	MaxRecords int
+	// MaxAge rotates the file after it has been open for this long. Zero
+	// disables it, so files are only rotated by size, count or when the sink
+	// is closed.
+	MaxAge time.Duration
+}
+
+type fileSink struct {
+	config Config
+
+	mu      sync.Mutex
+	current *openFile
+	closed  bool
+	// rotateErr is the error of a rotation by age, returned by the next
+	// Store or by close.
+	rotateErr error
+}
+
+// openFile is the file receiving records. It is written with a hidden
+// temporary name and renamed when rotated.
+type openFile struct {
+	name     string
+	tmpPath  string
+	file     *os.File
+	buf      *bufio.Writer
+	compress bool
+	// gz is the gzip member of the current Store, if compressing.
+	gz    *gzip.Writer
+	timer *time.Timer
+
+	bytes   int64
+	records int
+
+	// offsetFile persists syncedOffset once the file has records, so
+	// recovery knows where the last acknowledged record ends.
+	offsetFile *os.File
+
+	// synced* are the state after the last flush, restored if a write fails.
+	syncedOffset  int64
+	syncedBytes   int64
+	syncedRecords int
+}
+
+// MustNew creates a new pipeline sink that writes records to rotating files
+// in a local directory. It panics if the config is invalid or the directory
+// can't be created.
+//
+// Records are written to a hidden temporary file, like ".part-....jsonl.tmp",
+// which is renamed to its final name when rotated. Renames are atomic, so
+// readers never see partial files. Every Store flushes and fsyncs the file
+// before returning, so acknowledged records survive a crash. With Gzip, each
+// Store writes a gzip member, so the file is a valid multi-member gzip after
+// every Store.
+//
+// The offset after the last flushed record is saved next to the temporary
+// file, in ".part-....jsonl.tmp.offset". The temporary files left in Dir by a
+// crash are recovered when the sink is created: they are truncated to that
+// offset and renamed to their final names. Files without flushed records are
+// removed.
+// Because of that, running sinks must not share Dir and FilePrefix.
+//
+// Store calls are serialized. The returned function rotates the open file
+// and must be called before the process exits.
+func MustNew(config Config) (pipeline.Sink, func() error) {
+	if config.Dir == "" {
+		panic("missing dir")
+	}
+
+	if config.Encoding == nil {
+		panic("missing encoding")
+	}
+
+	if config.MaxBytes < 0 || config.MaxRecords < 0 || config.MaxAge < 0 {
+		panic("invalid rotation limits")
+	}
+
+	if config.FilePrefix == "" {
+		config.FilePrefix = "part"
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		panic(err)
+	}
+
+	if err := recoverFiles(config); err != nil {
+		panic(err)
+	}
+
+	s := &fileSink{config: config}
+	return s, s.close
+}
+
+// Store encodes all records and then appends them to the files. If any
+// record can't be encoded, nothing is written.
+func (s *fileSink) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
+	const op = errors.Op("filesink.fileSink.Store")
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	encoded, err := s.encode(messages)
+	if err != nil {
+		return errors.E(op, err, errors.SeverityInput)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.E(op, ErrSinkClosed, errors.SeverityRuntime)
+	}
+
+	if s.rotateErr != nil {
+		err := s.rotateErr
+		s.rotateErr = nil
+		return errors.E(op, err)
+	}
+
+	for _, record := range encoded {
+		if err := s.write(record); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	if s.current != nil {
+		if err := s.flush(); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) encode(messages []pipeline.SinkMessage) ([][]byte, error) {
+	const op = errors.Op("filesink.fileSink.encode")
+
+	encoded := make([][]byte, len(messages))
+	for i, message := range messages {
+		record, ok := message.(Record)
+		if !ok {
+			return nil, errors.E(op, ErrUnknownMessageType)
+		}
+		if record.Data == nil {
+			return nil, errors.E(op, ErrEmptyData)
+		}
+
+		b, err := s.config.Encoding.Encode(record.Data)
+		if err != nil {
+			return nil, errors.E(op, ErrInvalidRecord, errors.KV("cause", err))
+		}
+		encoded[i] = b
+	}
+	return encoded, nil
+}
+
+// write appends a record to the current file, opening a new file if needed
+// and rotating it if it reached its limits. Must be called with the lock
+// held.
+func (s *fileSink) write(record []byte) error {
+	const op = errors.Op("filesink.fileSink.write")
+
+	if s.current == nil {
+		if err := s.open(); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	if err := s.current.write(record); err != nil {
+		tmpPath := s.current.tmpPath
+		s.rollback()
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", tmpPath))
+	}
+	s.current.records++
+
+	if s.shouldRotate() {
+		return s.rotate()
+	}
+	return nil
+}
+
+func (s *fileSink) shouldRotate() bool {
+	if s.config.MaxRecords > 0 && s.current.records >= s.config.MaxRecords {
+		return true
+	}
+	return s.config.MaxBytes > 0 && s.current.bytes >= s.config.MaxBytes
+}
+
+// open creates a new temporary file and writes the encoding header. Must be
+// called with the lock held.
+func (s *fileSink) open() error {
+	const op = errors.Op("filesink.fileSink.open")
+
+	name := s.config.FilePrefix + "-" + time.Now().UTC().Format("20060102T150405Z") + "-" + randomSuffix() + s.config.Encoding.Extension()
+	if s.config.Gzip {
+		name += ".gz"
+	}
+	tmpPath := filepath.Join(s.config.Dir, "."+name+".tmp")
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", tmpPath))
+	}
+
+	f := &openFile{
+		name:     name,
+		tmpPath:  tmpPath,
+		file:     file,
+		buf:      bufio.NewWriter(file),
+		compress: s.config.Gzip,
+	}
+
+	// The header is flushed on its own, so a rollback never removes it.
+	header, err := s.config.Encoding.Header()
+	if err == nil && len(header) > 0 {
+		err = f.write(header)
+		if err == nil {
+			f.syncedOffset, err = f.flush()
+			f.syncedBytes = f.bytes
+		}
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", tmpPath))
+	}
+
+	if s.config.MaxAge > 0 {
+		f.timer = time.AfterFunc(s.config.MaxAge, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.current != f {
+				return
+			}
+			if err := s.rotate(); err != nil && s.rotateErr == nil {
+				s.rotateErr = err
+			}
+		})
+	}
+
+	s.current = f
+	return nil
+}
+
+// flush closes the gzip member, if any, and syncs the file. Must be called
+// with the lock held.
+func (s *fileSink) flush() error {
+	const op = errors.Op("filesink.fileSink.flush")
+
+	f := s.current
+	offset, err := f.flush()
+	if err != nil {
+		s.rollback()
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", f.tmpPath))
+	}
+
+	if f.records > 0 {
+		if err := f.saveOffset(offset); err != nil {
+			s.rollback()
+			return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", f.offsetPath()))
+		}
+	}
+
+	f.syncedOffset = offset
+	f.syncedBytes = f.bytes
+	f.syncedRecords = f.records
+	return nil
+}
+
+// rollback discards what was written to the current file after the last
+// flush. If it can't, the file is abandoned with its temporary name. Must be
+// called with the lock held.
+func (s *fileSink) rollback() {
+	f := s.current
+	f.gz = nil
+	f.buf.Reset(f.file)
+
+	err := f.file.Truncate(f.syncedOffset)
+	if err == nil {
+		_, err = f.file.Seek(f.syncedOffset, io.SeekStart)
+	}
+	if err != nil {
+		s.abandon()
+		return
+	}
+
+	f.bytes = f.syncedBytes
+	f.records = f.syncedRecords
+}
+
+// abandon closes the current file without renaming it. Must be called with
+// the lock held.
+func (s *fileSink) abandon() {
+	if s.current.timer != nil {
+		s.current.timer.Stop()
+	}
+	_ = s.current.file.Close()
+	if s.current.offsetFile != nil {
+		_ = s.current.offsetFile.Close()
+	}
+	s.current = nil
+}
+
+// rotate flushes and closes the current file and renames it to its final
+// name. Must be called with the lock held.
+func (s *fileSink) rotate() error {
+	const op = errors.Op("filesink.fileSink.rotate")
+
+	// A file without records, like the one left by a failed first write,
+	// is discarded instead of producing an empty or header-only file.
+	if s.current.records == 0 {
+		f := s.current
+		s.abandon()
+		if err := os.Remove(f.tmpPath); err != nil {
+			return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", f.tmpPath))
+		}
+		if err := os.Remove(f.offsetPath()); err != nil && !os.IsNotExist(err) {
+			return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", f.offsetPath()))
+		}
+		return nil
+	}
+
+	if err := s.flush(); err != nil {
+		return errors.E(op, err)
+	}
+
+	f := s.current
+	s.abandon()
+
+	finalPath := filepath.Join(s.config.Dir, f.name)
+	if err := os.Rename(f.tmpPath, finalPath); err != nil {
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", f.tmpPath))
+	}
+	// An offset file left by a crash here is removed by the recovery.
+	if err := os.Remove(f.offsetPath()); err != nil {
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", f.offsetPath()))
+	}
+
+	// The directory is synced so the rename survives a crash.
+	if err := syncDir(s.config.Dir); err != nil {
+		return errors.E(op, ErrWriteFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("file", finalPath))
+	}
+	return nil
+}
+
+func (s *fileSink) close() error {
+	const op = errors.Op("filesink.fileSink.close")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	err := s.rotateErr
+	s.rotateErr = nil
+	if s.current != nil {
+		if rotateErr := s.rotate(); rotateErr != nil {
+			err = rotateErr
+		}
+	}
+
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+func (f *openFile) write(b []byte) error {
+	var w io.Writer = f.buf
+	if f.compress {
+		if f.gz == nil {
+			f.gz = gzip.NewWriter(f.buf)
+		}
+		w = f.gz
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	f.bytes += int64(len(b))
+	return nil
+}
+
+// flush writes the buffered data, syncs the file and returns its size.
+func (f *openFile) flush() (int64, error) {
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			return 0, err
+		}
+		f.gz = nil
+	}
+	if err := f.buf.Flush(); err != nil {
+		return 0, err
+	}
+	if err := f.file.Sync(); err != nil {
+		return 0, err
+	}
+	return f.file.Seek(0, io.SeekCurrent)
+}
+
+func (f *openFile) offsetPath() string {
+	return f.tmpPath + offsetSuffix
+}
+
+// saveOffset writes the offset to the offset file and syncs it. The
+// directory is synced when the offset file is created, so both files
+// survive a crash.
+func (f *openFile) saveOffset(offset int64) error {
+	if f.offsetFile == nil {
+		file, err := os.OpenFile(f.offsetPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if err := syncDir(filepath.Dir(f.tmpPath)); err != nil {
+			_ = file.Close()
+			return err
+		}
+		f.offsetFile = file
+	}
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(offset))
+	if _, err := f.offsetFile.WriteAt(b[:], 0); err != nil {
+		return err
+	}
+	return f.offsetFile.Sync()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,292 @@
+package filesink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFiles returns the content of the final files and the names of the
+// temporary files in dir.
+func readFiles(t *testing.T, dir string) ([]string, []string) {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names, tmpNames []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			tmpNames = append(tmpNames, entry.Name())
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	var contents []string
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		require.NoError(t, err)
+
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			gz, err := gzip.NewReader(f)
+			require.NoError(t, err)
+			r = gz
+		}
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		contents = append(contents, string(b))
+	}
+	return contents, tmpNames
+}
+
+func records(data ...interface{}) []pipeline.SinkMessage {
+	messages := make([]pipeline.SinkMessage, len(data))
+	for i, d := range data {
+		messages[i] = Record{Data: d}
+	}
+	return messages
+}
+
+func TestStore_RotateByRecords(t *testing.T) {
+	dir := t.TempDir()
+	sink, closeFn := MustNew(Config{
+		Dir:        dir,
+		FilePrefix: "events",
+		Encoding:   EncodingJSONL(),
+		MaxRecords: 2,
+	})
+	ctx := context.Background()
+
+	require.NoError(t, sink.Store(ctx, records(map[string]int{"n": 1})...))
+
+	// The open file is only visible with its temporary name, next to the
+	// offset of its last flushed record.
+	contents, tmpNames := readFiles(t, dir)
+	assert.Empty(t, contents)
+	require.Len(t, tmpNames, 2)
+	assert.True(t, strings.HasPrefix(tmpNames[0], ".events-"))
+	assert.True(t, strings.HasSuffix(tmpNames[0], ".jsonl.tmp"))
+	assert.Equal(t, tmpNames[0]+".offset", tmpNames[1])
+
+	require.NoError(t, sink.Store(ctx, records(map[string]int{"n": 2}, map[string]int{"n": 3}, map[string]int{"n": 4}, map[string]int{"n": 5})...))
+	require.NoError(t, closeFn())
+
+	contents, tmpNames = readFiles(t, dir)
+	assert.Empty(t, tmpNames)
+	assert.ElementsMatch(t, []string{
+		"{\"n\":1}\n{\"n\":2}\n",
+		"{\"n\":3}\n{\"n\":4}\n",
+		"{\"n\":5}\n",
+	}, contents)
+
+	err := sink.Store(ctx, records(map[string]int{"n": 6})...)
+	assert.ErrorIs(t, err, ErrSinkClosed)
+}
+
+func TestStore_GzipCSV(t *testing.T) {
+	dir := t.TempDir()
+	sink, closeFn := MustNew(Config{
+		Dir:      dir,
+		Encoding: EncodingCSV([]string{"id", "name"}),
+		Gzip:     true,
+		MaxBytes: 20,
+	})
+	ctx := context.Background()
+
+	// Each Store is a gzip member of the same file.
+	require.NoError(t, sink.Store(ctx, records([]string{"1", "a"})...))
+	require.NoError(t, sink.Store(ctx, records([]string{"2", "b,c"})...))
+	require.NoError(t, sink.Store(ctx, records([]string{"3", "d"})...))
+	require.NoError(t, closeFn())
+
+	contents, tmpNames := readFiles(t, dir)
+	assert.Empty(t, tmpNames)
+	assert.ElementsMatch(t, []string{
+		"id,name\n1,a\n2,\"b,c\"\n",
+		"id,name\n3,d\n",
+	}, contents)
+}
+
+func TestStore_RotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	sink, closeFn := MustNew(Config{
+		Dir:      dir,
+		Encoding: EncodingJSONL(),
+		MaxAge:   10 * time.Millisecond,
+	})
+	defer func() { _ = closeFn() }()
+
+	require.NoError(t, sink.Store(context.Background(), records("a")...))
+
+	assert.Eventually(t, func() bool {
+		contents, tmpNames := readFiles(t, dir)
+		return len(tmpNames) == 0 && len(contents) == 1 && contents[0] == "\"a\"\n"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStore_InvalidRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		messages    []pipeline.SinkMessage
+		expectedErr error
+	}{
+		{
+			name:        "Unknown type",
+			messages:    []pipeline.SinkMessage{Record{Data: []string{"1"}}, "record"},
+			expectedErr: ErrUnknownMessageType,
+		},
+		{
+			name:        "Empty data",
+			messages:    []pipeline.SinkMessage{Record{Data: []string{"1"}}, Record{}},
+			expectedErr: ErrEmptyData,
+		},
+		{
+			name:        "Wrong type",
+			messages:    []pipeline.SinkMessage{Record{Data: []string{"1"}}, Record{Data: 1}},
+			expectedErr: ErrInvalidRecord,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sink, closeFn := MustNew(Config{Dir: dir, Encoding: EncodingCSV(nil)})
+
+			err := sink.Store(context.Background(), test.messages...)
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+
+			require.NoError(t, closeFn())
+			contents, tmpNames := readFiles(t, dir)
+			assert.Empty(t, contents)
+			assert.Empty(t, tmpNames)
+		})
+	}
+}
+
+func TestMustNew_RecoversTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	var gz bytes.Buffer
+	for _, member := range []string{"id\n", "1\n", "2\n"} {
+		w := gzip.NewWriter(&gz)
+		_, err := w.Write([]byte(member))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+	complete := gz.Len()
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write([]byte("3\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	offset := func(n int) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(n))
+		return b
+	}
+
+	files := map[string][]byte{
+		// The last record was being written when the process crashed.
+		".part-1.csv.tmp":        []byte("id\n1\n2\n3"),
+		".part-1.csv.tmp.offset": offset(7),
+		// The last record has a quoted newline.
+		".part-2.csv.tmp":        []byte("id\n1\n\"a\nb\"\n\"c\nd"),
+		".part-2.csv.tmp.offset": offset(11),
+		// Only the header was written.
+		".part-3.csv.tmp": []byte("id\n"),
+		// The last gzip member is incomplete.
+		".part-4.csv.gz.tmp":        gz.Bytes()[:complete+5],
+		".part-4.csv.gz.tmp.offset": offset(complete),
+		// The file was renamed, but its offset file wasn't removed.
+		".part-5.csv.tmp.offset": offset(7),
+		// Files of other prefixes are not touched.
+		".other-1.csv.tmp": []byte("id\n4\n"),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+
+	_, closeFn := MustNew(Config{Dir: dir, Encoding: EncodingCSV([]string{"id"})})
+	require.NoError(t, closeFn())
+
+	contents, tmpNames := readFiles(t, dir)
+	assert.Equal(t, []string{"id\n1\n2\n", "id\n1\n\"a\nb\"\n", "id\n1\n2\n"}, contents)
+	assert.Equal(t, []string{".other-1.csv.tmp"}, tmpNames)
+	assert.FileExists(t, filepath.Join(dir, "part-1.csv"))
+	assert.FileExists(t, filepath.Join(dir, "part-2.csv"))
+	assert.FileExists(t, filepath.Join(dir, "part-4.csv.gz"))
+}
+
+func TestMustNew_InvalidOffsetFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".part-1.csv.tmp"), []byte("id\n1\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".part-1.csv.tmp.offset"), []byte{1, 2}, 0o644))
+
+	assert.Panics(t, func() {
+		MustNew(Config{Dir: dir, Encoding: EncodingCSV([]string{"id"})})
+	})
+}
+
+func TestStore_SavesOffset(t *testing.T) {
+	dir := t.TempDir()
+	sink, closeFn := MustNew(Config{Dir: dir, Encoding: EncodingCSV([]string{"id"})})
+
+	require.NoError(t, sink.Store(context.Background(), records([]string{"a\nb"})...))
+
+	// Simulates a crash with a partial record after the flushed ones.
+	s := sink.(*fileSink)
+	s.mu.Lock()
+	f := s.current
+	_, err := f.file.Write([]byte("\"c\nd"))
+	require.NoError(t, err)
+	s.abandon()
+	s.mu.Unlock()
+
+	_, tmpNames := readFiles(t, dir)
+	assert.Len(t, tmpNames, 2)
+
+	_, recoverCloseFn := MustNew(Config{Dir: dir, Encoding: EncodingCSV([]string{"id"})})
+	require.NoError(t, recoverCloseFn())
+	require.NoError(t, closeFn())
+
+	contents, tmpNames := readFiles(t, dir)
+	assert.Equal(t, []string{"id\n\"a\nb\"\n"}, contents)
+	assert.Empty(t, tmpNames)
+}
+
+func TestRotate_SkipsFilesWithoutRecords(t *testing.T) {
+	dir := t.TempDir()
+	sink, closeFn := MustNew(Config{
+		Dir:      dir,
+		Encoding: EncodingCSV([]string{"id"}),
+		MaxAge:   10 * time.Millisecond,
+	})
+	defer func() { _ = closeFn() }()
+
+	// A file is left without records when its first write fails.
+	s := sink.(*fileSink)
+	s.mu.Lock()
+	require.NoError(t, s.open())
+	s.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		contents, tmpNames := readFiles(t, dir)
+		return len(tmpNames) == 0 && len(contents) == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -2,9 +2,17 @@ package gcssink
 
 import (
 	"context"
+	"crypto/md5" //nolint:gosec // MD5 is what GCS uses to verify uploads
+	stderrors "errors"
+	"hash/crc32"
+	"io"
+	"net/http"
 
 	"cloud.google.com/go/storage"
 	"github.com/arquivei/foundationkit/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // gcsClientGateway implements GcsClientGateway interface and is responsible for
@@ -13,7 +21,8 @@ type gcsClientGateway struct {
 	storageClient *storage.Client
 }
 
-// NewGcsClientGateway creates a new GcsClientGateway
+// NewGcsClientGateway creates a new GcsClientGateway. It also implements
+// ConditionalGcsClientGateway.
 func NewGcsGateway(client *storage.Client) GcsClientGateway {
 	return &gcsClientGateway{
 		storageClient: client,
@@ -28,9 +37,30 @@ func (g gcsClientGateway) GetWriter(
 	chunkSize int,
 	retrierOption ...storage.RetryOption,
 ) *storage.Writer {
-	bucketHandler := g.storageClient.Bucket(bucket)
-	obj := bucketHandler.Object(object)
+	obj := g.storageClient.Bucket(bucket).Object(object)
+	return newWriter(ctx, obj, contentType, chunkSize, retrierOption...)
+}
 
+// GetConditionalWriter returns a GCS Writer like GetWriter, but the object is
+// only written if it matches the given conditions.
+func (g gcsClientGateway) GetConditionalWriter(
+	ctx context.Context,
+	bucket, object, contentType string,
+	chunkSize int,
+	conds storage.Conditions,
+	retrierOption ...storage.RetryOption,
+) *storage.Writer {
+	obj := g.storageClient.Bucket(bucket).Object(object).If(conds)
+	return newWriter(ctx, obj, contentType, chunkSize, retrierOption...)
+}
+
+func newWriter(
+	ctx context.Context,
+	obj *storage.ObjectHandle,
+	contentType string,
+	chunkSize int,
+	retrierOption ...storage.RetryOption,
+) *storage.Writer {
 	if len(retrierOption) > 0 {
 		obj = obj.Retryer(retrierOption...)
 	}
@@ -46,20 +76,69 @@ func (g gcsClientGateway) GetWriter(
 func (g gcsClientGateway) Write(writer *storage.Writer, message SinkMessage) error {
 	const op = errors.Op("gcssink.gcsClientGateway.Write")
 
-	writer.Metadata = message.Metadata
+	setWriterAttrs(writer, message)
 
 	if _, err := writer.Write(message.Data); err != nil {
-		return errors.E(op, err, CodeFailedToWriteAtBucket, errors.KV("bucket", message.Bucket), errors.KV("path", message.StoragePath))
+		return errors.E(op, err, writeErrorCode(err, CodeFailedToWriteAtBucket), errors.KV("bucket", message.Bucket), errors.KV("path", message.StoragePath))
 	}
 
 	if err := writer.Close(); err != nil {
-		return errors.E(op, err, CodeFailedToCloseBucket, errors.KV("bucket", message.Bucket), errors.KV("path", message.StoragePath))
+		return errors.E(op, err, writeErrorCode(err, CodeFailedToCloseBucket), errors.KV("bucket", message.Bucket), errors.KV("path", message.StoragePath))
 	}
 
 	return nil
 }
 
+// GetObjectAttrs returns the attributes of an existing object.
+func (g gcsClientGateway) GetObjectAttrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error) {
+	return g.storageClient.Bucket(bucket).Object(object).Attrs(ctx)
+}
+
+// setWriterAttrs sets the object attributes and checksums from the message.
+// It must be called before the first write.
+func setWriterAttrs(writer *storage.Writer, message SinkMessage) {
+	writer.Metadata = message.Metadata
+	writer.ContentEncoding = message.ContentEncoding
+
+	switch message.Checksum {
+	case ChecksumCRC32C:
+		writer.CRC32C = crc32.Checksum(message.Data, crc32cTable)
+		writer.SendCRC32C = true
+	case ChecksumMD5:
+		sum := md5.Sum(message.Data) //nolint:gosec // MD5 is what GCS uses to verify uploads
+		writer.MD5 = sum[:]
+	}
+}
+
+// writeErrorCode returns CodePreconditionFailed if the error was caused by
+// the writer conditions, both on the JSON and on the gRPC APIs.
+func writeErrorCode(err error, fallback errors.Code) errors.Code {
+	var apiErr *googleapi.Error
+	if stderrors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return CodePreconditionFailed
+	}
+	if status.Code(err) == codes.FailedPrecondition {
+		return CodePreconditionFailed
+	}
+	return fallback
+}
+
 // Close closes the GCS client
 func (g gcsClientGateway) Close() error {
 	return g.storageClient.Close()
 }
+
+// NewGcsObjectGateway creates a new ObjectGateway, used by the aggregating sink.
+func NewGcsObjectGateway(client *storage.Client) ObjectGateway {
+	return &gcsClientGateway{
+		storageClient: client,
+	}
+}
+
+// NewObjectWriter returns a GCS Writer to the given object. The object is
+// created when the writer is closed.
+func (g gcsClientGateway) NewObjectWriter(ctx context.Context, bucket, object, contentType string) io.WriteCloser {
+	writer := g.storageClient.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = contentType
+	return writer
+}
@@ -0,0 +1,441 @@
+package gcssink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"path"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+)
+
+// ObjectGateway represents a gateway that opens streaming writers to GCS
+// objects. It is used by the aggregating sink, which writes many records to
+// the same object.
+type ObjectGateway interface {
+	// NewObjectWriter returns a writer to the given object. The object is
+	// only created when the writer is successfully closed. Canceling ctx
+	// before that aborts the upload.
+	NewObjectWriter(ctx context.Context, bucket, object, contentType string) io.WriteCloser
+	// Close closes the GCS client
+	Close() error
+}
+
+// AggregatedRecord is the input for the aggregating GCS sink.
+type AggregatedRecord struct {
+	// Data is the record being stored. It is encoded with the sink Encoding.
+	Data interface{}
+	// Time is used to resolve the path template. If zero, the time Store was
+	// called is used.
+	Time time.Time
+	// Fields are extra values available to the path template.
+	Fields map[string]string
+}
+
+// AggregatingConfig configures the aggregating GCS sink.
+type AggregatingConfig struct {
+	// Bucket is where the objects are written.
+	Bucket string
+	// PathTemplate is a text/template resolved for each record. Records with
+	// the same resolved path are appended to the same object. The template
+	// receives the record .Time, in UTC, and .Fields. For example:
+	//
+	//	events/dt={{.Time.Format "2006-01-02"}}/hour={{.Time.Format "15"}}
+	PathTemplate string
+	// ObjectPrefix is the prefix of the generated object names.
+	// Defaults to "part".
+	ObjectPrefix string
+	// Encoding is how records are written. See EncodingJSONL, EncodingCSV
+	// and EncodingParquet.
+	Encoding Encoding
+
+	// MaxBytes rolls the object after this many encoded bytes, including the
+	// records buffered by a SizedEncoder. Zero disables it.
+	MaxBytes int64
+	// MaxRecords rolls the object after this many records. Zero disables it.
+	MaxRecords int
+	// MaxAge rolls the object after it has been open for this long. It is
+	// mandatory because Store only returns after the objects containing its
+	// records are finalized.
+	MaxAge time.Duration
+}
+
+type pathTemplateData struct {
+	Time   time.Time
+	Fields map[string]string
+}
+
+// aggregatingWriter is a pipeline.Sink that appends records to open GCS
+// objects and rolls them by size, count or age.
+type aggregatingWriter struct {
+	gateway      ObjectGateway
+	config       AggregatingConfig
+	pathTemplate *template.Template
+
+	mu      sync.Mutex
+	objects map[string]*aggregatedObject
+	closed  bool
+
+	// finalizing tracks the objects being finalized in background so close
+	// can wait for them.
+	finalizing sync.WaitGroup
+}
+
+// aggregatedObject is a GCS object still receiving records.
+type aggregatedObject struct {
+	// path is the resolved path template of its records.
+	path    string
+	name    string
+	cancel  context.CancelFunc
+	writer  io.WriteCloser
+	counter *countingWriter
+	encoder RecordEncoder
+	records int
+	timer   *time.Timer
+
+	// err is set before done is closed.
+	err  error
+	done chan struct{}
+}
+
+// MustNewAggregating creates a new pipeline sink that aggregates many records
+// into rolled GCS objects, grouped by config.PathTemplate. It panics if the
+// gateway or the config are invalid.
+//
+// Store only returns after all objects containing its records are finalized,
+// so offsets are only acknowledged after the records are durable. Because of
+// that, objects only hold more than one batch when Store is called
+// concurrently, like with jobpoolengine or with many input streams. The
+// returned function finalizes all open objects and closes the gateway.
+func MustNewAggregating(gateway ObjectGateway, config AggregatingConfig) (pipeline.Sink, func() error) {
+	if gateway == nil {
+		panic("gateway is nil")
+	}
+
+	if config.Bucket == "" {
+		panic("missing bucket")
+	}
+
+	if config.Encoding == nil {
+		panic("missing encoding")
+	}
+
+	if config.MaxAge <= 0 {
+		panic("invalid max age")
+	}
+
+	if config.ObjectPrefix == "" {
+		config.ObjectPrefix = "part"
+	}
+
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(config.PathTemplate)
+	if err != nil {
+		panic(err)
+	}
+
+	w := &aggregatingWriter{
+		gateway:      gateway,
+		config:       config,
+		pathTemplate: tmpl,
+		objects:      make(map[string]*aggregatedObject),
+	}
+
+	return w, w.close
+}
+
+// Store implements the pipeline.Sink interface. It appends the records to the
+// open objects and waits until all of them are finalized.
+func (w *aggregatingWriter) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
+	const op = errors.Op("gcssink.aggregatingWriter.Store")
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	records, paths, err := w.resolve(messages)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	if err := w.validate(records, paths); err != nil {
+		return errors.E(op, err)
+	}
+
+	touched, err := w.append(records, paths)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	var sliceErrs []error
+	for _, obj := range touched {
+		select {
+		case <-obj.done:
+			if obj.err != nil {
+				sliceErrs = append(sliceErrs, obj.err)
+			}
+		case <-ctx.Done():
+			return errors.E(op, ctx.Err(), errors.SeverityRuntime)
+		}
+	}
+
+	if len(sliceErrs) > 0 {
+		return errors.E(op, ErrFailedToStoreMessages, errors.SeverityRuntime, errors.KV("errors", sliceErrs))
+	}
+
+	return nil
+}
+
+// resolve validates the messages and resolves the path of each record.
+func (w *aggregatingWriter) resolve(messages []pipeline.SinkMessage) ([]AggregatedRecord, []string, error) {
+	now := time.Now()
+	records := make([]AggregatedRecord, len(messages))
+	paths := make([]string, len(messages))
+
+	for i, message := range messages {
+		record, ok := message.(AggregatedRecord)
+		if !ok {
+			return nil, nil, errors.E(ErrInvalidSinkMessage, CodeWrongTypeSinkMessage, errors.SeverityInput)
+		}
+
+		if record.Data == nil {
+			return nil, nil, errors.E(ErrInvalidSinkMessage, CodeEmptyDataSinkMessage, errors.SeverityInput)
+		}
+
+		if record.Time.IsZero() {
+			record.Time = now
+		}
+
+		var buf bytes.Buffer
+		err := w.pathTemplate.Execute(&buf, pathTemplateData{
+			Time:   record.Time.UTC(),
+			Fields: record.Fields,
+		})
+		if err != nil {
+			return nil, nil, errors.E(ErrInvalidSinkMessage, CodeInvalidPath, errors.SeverityInput, errors.KV("cause", err))
+		}
+
+		records[i] = record
+		paths[i] = buf.String()
+	}
+
+	return records, paths, nil
+}
+
+// validate encodes the records with scratch encoders, so a record that
+// can't be encoded is rejected before any record of the batch is appended to
+// the shared objects.
+func (w *aggregatingWriter) validate(records []AggregatedRecord, paths []string) error {
+	encoders := make(map[string]RecordEncoder)
+	for i, record := range records {
+		encoder := encoders[paths[i]]
+		if encoder == nil {
+			encoder = w.config.Encoding.NewEncoder(io.Discard)
+			encoders[paths[i]] = encoder
+		}
+		if err := encoder.Encode(record.Data); err != nil {
+			return errors.E(ErrInvalidSinkMessage, CodeWrongTypeRecord, errors.SeverityInput, errors.KV("cause", err))
+		}
+	}
+	return nil
+}
+
+// append encodes the records into their objects and returns all objects that
+// received records. Objects that reached their limits are finalized after
+// all records are appended.
+//
+// If a record can't be appended, like when it doesn't match the records
+// other batches appended to the object, the records already appended can't
+// be removed. So all objects that received records from the batch are
+// aborted, and the batches sharing them fail and are retried.
+func (w *aggregatingWriter) append(records []AggregatedRecord, paths []string) ([]*aggregatedObject, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, errors.E(ErrSinkClosed, errors.SeverityRuntime)
+	}
+
+	var touched, rolled []*aggregatedObject
+	seen := make(map[*aggregatedObject]bool)
+
+	for i, record := range records {
+		obj := w.objects[paths[i]]
+		if obj == nil {
+			obj = w.open(paths[i])
+		}
+		if !seen[obj] {
+			seen[obj] = true
+			touched = append(touched, obj)
+		}
+
+		if err := obj.encoder.Encode(record.Data); err != nil {
+			err = errors.E(err, CodeFailedToWriteAtBucket, errors.SeverityRuntime, errors.KV("object", obj.name))
+			for _, obj := range touched {
+				w.detach(obj)
+				obj.abort(err)
+			}
+			return nil, err
+		}
+		obj.records++
+
+		if w.shouldRoll(obj) {
+			w.detach(obj)
+			rolled = append(rolled, obj)
+		}
+	}
+
+	for _, obj := range rolled {
+		w.finalizing.Add(1)
+		go func() {
+			defer w.finalizing.Done()
+			obj.finalize()
+		}()
+	}
+
+	return touched, nil
+}
+
+func (w *aggregatingWriter) shouldRoll(obj *aggregatedObject) bool {
+	if w.config.MaxRecords > 0 && obj.records >= w.config.MaxRecords {
+		return true
+	}
+	return w.config.MaxBytes > 0 && obj.size() >= w.config.MaxBytes
+}
+
+// open creates a new object for the path. Must be called with the lock held.
+func (w *aggregatingWriter) open(objectPath string) *aggregatedObject {
+	now := time.Now()
+	name := path.Join(objectPath, w.config.ObjectPrefix+"-"+now.UTC().Format("20060102T150405Z")+"-"+randomSuffix()+w.config.Encoding.Extension())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := w.gateway.NewObjectWriter(ctx, w.config.Bucket, name, w.config.Encoding.ContentType())
+	counter := &countingWriter{w: writer}
+
+	obj := &aggregatedObject{
+		path:    objectPath,
+		name:    name,
+		cancel:  cancel,
+		writer:  writer,
+		counter: counter,
+		encoder: w.config.Encoding.NewEncoder(counter),
+		done:    make(chan struct{}),
+	}
+	obj.timer = time.AfterFunc(w.config.MaxAge, func() {
+		w.mu.Lock()
+		current := w.objects[objectPath]
+		if current != obj {
+			w.mu.Unlock()
+			return
+		}
+		delete(w.objects, objectPath)
+		w.finalizing.Add(1)
+		w.mu.Unlock()
+
+		defer w.finalizing.Done()
+		obj.finalize()
+	})
+
+	w.objects[objectPath] = obj
+	return obj
+}
+
+// detach removes the object from the open objects so it receives no more
+// records. Must be called with the lock held.
+func (w *aggregatingWriter) detach(obj *aggregatedObject) {
+	obj.timer.Stop()
+	if w.objects[obj.path] == obj {
+		delete(w.objects, obj.path)
+	}
+}
+
+func (w *aggregatingWriter) close() error {
+	const op = errors.Op("gcssink.aggregatingWriter.close")
+
+	w.mu.Lock()
+	w.closed = true
+	objects := w.objects
+	w.objects = make(map[string]*aggregatedObject)
+	w.mu.Unlock()
+
+	var sliceErrs []error
+	for _, obj := range objects {
+		obj.timer.Stop()
+		obj.finalize()
+		if obj.err != nil {
+			sliceErrs = append(sliceErrs, obj.err)
+		}
+	}
+	w.finalizing.Wait()
+
+	if err := w.gateway.Close(); err != nil {
+		sliceErrs = append(sliceErrs, err)
+	}
+
+	if len(sliceErrs) > 0 {
+		return errors.E(op, ErrFailedToStoreMessages, errors.KV("errors", sliceErrs))
+	}
+	return nil
+}
+
+// finalize writes the encoder trailer and closes the object writer, which
+// makes the object visible in GCS.
+func (o *aggregatedObject) finalize() {
+	defer close(o.done)
+	defer o.cancel()
+
+	// Objects only get empty if their records were rejected, so there is no
+	// reason to create them.
+	if o.records == 0 {
+		o.cancel()
+		_ = o.writer.Close()
+		return
+	}
+
+	if err := o.encoder.Close(); err != nil {
+		o.err = errors.E(err, CodeFailedToFinalizeObject, errors.SeverityRuntime, errors.KV("object", o.name))
+		return
+	}
+	if err := o.writer.Close(); err != nil {
+		o.err = errors.E(err, CodeFailedToFinalizeObject, errors.SeverityRuntime, errors.KV("object", o.name))
+	}
+}
+
+// size returns the encoded size of the object, including the records
+// buffered by the encoder.
+func (o *aggregatedObject) size() int64 {
+	if sized, ok := o.encoder.(SizedEncoder); ok {
+		return sized.Size()
+	}
+	return o.counter.n
+}
+
+// abort cancels the upload so the object is never created.
+func (o *aggregatedObject) abort(err error) {
+	o.cancel()
+	_ = o.writer.Close()
+	o.err = err
+	close(o.done)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
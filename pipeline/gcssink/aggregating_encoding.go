@@ -0,0 +1,180 @@
+package gcssink
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Encoding defines how records are encoded inside an aggregated object.
+type Encoding interface {
+	// ContentType is the content type of the objects.
+	ContentType() string
+	// Extension is the file extension of the objects, including the dot.
+	Extension() string
+	// NewEncoder returns a new RecordEncoder writing to w.
+	NewEncoder(w io.Writer) RecordEncoder
+}
+
+// RecordEncoder encodes records into a single object.
+type RecordEncoder interface {
+	// Encode appends the record to the object.
+	Encode(record interface{}) error
+	// Close writes any buffered data and trailer. It does not close the
+	// underlying writer.
+	Close() error
+}
+
+// SizedEncoder is a RecordEncoder that buffers records before writing them.
+// It is used by encoders like parquet's, so MaxBytes also counts the
+// buffered records.
+type SizedEncoder interface {
+	RecordEncoder
+	// Size returns the estimated size of the object with the records
+	// encoded so far, written or buffered.
+	Size() int64
+}
+
+// EncodingJSONL encodes each record as a JSON document in its own line.
+func EncodingJSONL() Encoding {
+	return jsonlEncoding{}
+}
+
+// EncodingCSV encodes each record as a CSV line. Records must be of type
+// []string. If header is not empty, it is written as the first line of
+// every object.
+func EncodingCSV(header []string) Encoding {
+	return csvEncoding{header: header}
+}
+
+// EncodingParquet encodes records as a parquet file. Records must be structs
+// or pointers to structs and the schema is derived from the first record of
+// each object, so all records with the same path must have the same type.
+// Records are buffered in memory and written as a row group every
+// parquetRowGroupSize bytes.
+func EncodingParquet() Encoding {
+	return parquetEncoding{}
+}
+
+type jsonlEncoding struct{}
+
+func (jsonlEncoding) ContentType() string { return "application/x-ndjson" }
+func (jsonlEncoding) Extension() string   { return ".jsonl" }
+
+func (jsonlEncoding) NewEncoder(w io.Writer) RecordEncoder {
+	return jsonlEncoder{json.NewEncoder(w)}
+}
+
+type jsonlEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e jsonlEncoder) Encode(record interface{}) error {
+	return e.encoder.Encode(record)
+}
+
+func (jsonlEncoder) Close() error {
+	return nil
+}
+
+type csvEncoding struct {
+	header []string
+}
+
+func (csvEncoding) ContentType() string { return "text/csv" }
+func (csvEncoding) Extension() string   { return ".csv" }
+
+func (e csvEncoding) NewEncoder(w io.Writer) RecordEncoder {
+	return &csvEncoder{
+		writer: csv.NewWriter(w),
+		header: e.header,
+	}
+}
+
+type csvEncoder struct {
+	writer        *csv.Writer
+	header        []string
+	headerWritten bool
+}
+
+func (e *csvEncoder) Encode(record interface{}) error {
+	const op = errors.Op("gcssink.csvEncoder.Encode")
+
+	line, ok := record.([]string)
+	if !ok {
+		return errors.E(op, ErrInvalidSinkMessage, CodeWrongTypeRecord, errors.SeverityInput)
+	}
+
+	if !e.headerWritten && len(e.header) > 0 {
+		if err := e.writer.Write(e.header); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	e.headerWritten = true
+
+	if err := e.writer.Write(line); err != nil {
+		return errors.E(op, err)
+	}
+	// Flushing on every record keeps the size estimation accurate.
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type parquetEncoding struct{}
+
+func (parquetEncoding) ContentType() string { return "application/vnd.apache.parquet" }
+func (parquetEncoding) Extension() string   { return ".parquet" }
+
+// parquetRowGroupSize is the estimated size of the buffered records that
+// makes the parquet encoder write a row group, so the memory used by an
+// object is bounded.
+const parquetRowGroupSize = 32 << 20
+
+func (parquetEncoding) NewEncoder(w io.Writer) RecordEncoder {
+	return &parquetEncoder{writer: parquet.NewWriter(w)}
+}
+
+type parquetEncoder struct {
+	writer *parquet.Writer
+	// flushed is the size when the last row group was written.
+	flushed int64
+}
+
+func (e *parquetEncoder) Encode(record interface{}) (err error) {
+	const op = errors.Op("gcssink.parquetEncoder.Encode")
+
+	// The parquet writer panics if the record doesn't match the schema.
+	panicErr := errors.DontPanic(func() {
+		err = e.writer.Write(record)
+	})
+	if panicErr != nil {
+		return errors.E(op, ErrInvalidSinkMessage, CodeWrongTypeRecord, errors.SeverityInput, errors.KV("panic", panicErr))
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	if e.writer.Size()-e.flushed >= parquetRowGroupSize {
+		if err := e.writer.Flush(); err != nil {
+			return errors.E(op, err)
+		}
+		e.flushed = e.writer.Size()
+	}
+	return nil
+}
+
+func (e *parquetEncoder) Size() int64 {
+	return e.writer.Size()
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.writer.Close()
+}
@@ -0,0 +1,372 @@
+package gcssink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fkerrors "github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeObjectGateway keeps the finalized objects in memory.
+type fakeObjectGateway struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	closeErr error
+}
+
+func newFakeObjectGateway() *fakeObjectGateway {
+	return &fakeObjectGateway{objects: map[string][]byte{}}
+}
+
+func (g *fakeObjectGateway) NewObjectWriter(ctx context.Context, bucket, object, contentType string) io.WriteCloser {
+	return &fakeObjectWriter{ctx: ctx, gateway: g, name: bucket + "/" + object}
+}
+
+func (g *fakeObjectGateway) Close() error {
+	return nil
+}
+
+func (g *fakeObjectGateway) get() map[string][]byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	objects := make(map[string][]byte, len(g.objects))
+	for k, v := range g.objects {
+		objects[k] = v
+	}
+	return objects
+}
+
+type fakeObjectWriter struct {
+	ctx     context.Context
+	gateway *fakeObjectGateway
+	name    string
+	buf     bytes.Buffer
+}
+
+func (w *fakeObjectWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *fakeObjectWriter) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if w.gateway.closeErr != nil {
+		return w.gateway.closeErr
+	}
+	w.gateway.mu.Lock()
+	defer w.gateway.mu.Unlock()
+	w.gateway.objects[w.name] = w.buf.Bytes()
+	return nil
+}
+
+func TestMustNewAggregating(t *testing.T) {
+	valid := AggregatingConfig{
+		Bucket:   "bucket",
+		Encoding: EncodingJSONL(),
+		MaxAge:   time.Second,
+	}
+
+	assert.Panics(t, func() { MustNewAggregating(nil, valid) })
+
+	for _, mutate := range []func(c *AggregatingConfig){
+		func(c *AggregatingConfig) { c.Bucket = "" },
+		func(c *AggregatingConfig) { c.Encoding = nil },
+		func(c *AggregatingConfig) { c.MaxAge = 0 },
+		func(c *AggregatingConfig) { c.PathTemplate = "{{" },
+	} {
+		config := valid
+		mutate(&config)
+		assert.Panics(t, func() { MustNewAggregating(newFakeObjectGateway(), config) })
+	}
+
+	assert.NotPanics(t, func() {
+		_, closeFn := MustNewAggregating(newFakeObjectGateway(), valid)
+		assert.NoError(t, closeFn())
+	})
+}
+
+func TestAggregatingStore_RollByCount(t *testing.T) {
+	gateway := newFakeObjectGateway()
+	sink, closeFn := MustNewAggregating(gateway, AggregatingConfig{
+		Bucket:       "bucket",
+		PathTemplate: `events/dt={{.Time.Format "2006-01-02"}}/hour={{.Time.Format "15"}}`,
+		Encoding:     EncodingJSONL(),
+		MaxRecords:   2,
+		MaxAge:       time.Minute,
+	})
+	defer closeFn()
+
+	at := time.Date(2026, 10, 17, 12, 30, 0, 0, time.UTC)
+
+	// Two concurrent stores share the same object, which is rolled when the
+	// second record arrives.
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sink.Store(context.Background(), AggregatedRecord{
+				Data: map[string]string{"id": id},
+				Time: at,
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	objects := gateway.get()
+	require.Len(t, objects, 1)
+	for name, data := range objects {
+		assert.True(t, strings.HasPrefix(name, "bucket/events/dt=2026-10-17/hour=12/part-"), name)
+		assert.True(t, strings.HasSuffix(name, ".jsonl"), name)
+		assert.Equal(t, 2, strings.Count(string(data), "\n"))
+	}
+}
+
+func TestAggregatingStore_RollByAgeAndPath(t *testing.T) {
+	gateway := newFakeObjectGateway()
+	sink, closeFn := MustNewAggregating(gateway, AggregatingConfig{
+		Bucket:       "bucket",
+		PathTemplate: `{{.Fields.type}}`,
+		Encoding:     EncodingCSV([]string{"id"}),
+		MaxAge:       20 * time.Millisecond,
+	})
+	defer closeFn()
+
+	err := sink.Store(context.Background(),
+		AggregatedRecord{Data: []string{"1"}, Fields: map[string]string{"type": "a"}},
+		AggregatedRecord{Data: []string{"2"}, Fields: map[string]string{"type": "b"}},
+		AggregatedRecord{Data: []string{"3"}, Fields: map[string]string{"type": "a"}},
+	)
+	assert.NoError(t, err)
+
+	objects := gateway.get()
+	require.Len(t, objects, 2)
+	for name, data := range objects {
+		if strings.HasPrefix(name, "bucket/a/") {
+			assert.Equal(t, "id\n1\n3\n", string(data))
+		} else {
+			assert.Equal(t, "id\n2\n", string(data))
+		}
+	}
+}
+
+type parquetRow struct {
+	ID    string `parquet:"id"`
+	Value int64  `parquet:"value"`
+}
+
+func TestAggregatingStore_Parquet(t *testing.T) {
+	gateway := newFakeObjectGateway()
+	sink, closeFn := MustNewAggregating(gateway, AggregatingConfig{
+		Bucket:     "bucket",
+		Encoding:   EncodingParquet(),
+		MaxRecords: 2,
+		MaxAge:     time.Minute,
+	})
+	defer closeFn()
+
+	err := sink.Store(context.Background(),
+		AggregatedRecord{Data: parquetRow{ID: "a", Value: 1}},
+		AggregatedRecord{Data: parquetRow{ID: "b", Value: 2}},
+	)
+	assert.NoError(t, err)
+
+	objects := gateway.get()
+	require.Len(t, objects, 1)
+	for name, data := range objects {
+		assert.True(t, strings.HasSuffix(name, ".parquet"), name)
+		rows, err := parquet.Read[parquetRow](bytes.NewReader(data), int64(len(data)))
+		assert.NoError(t, err)
+		assert.Equal(t, []parquetRow{{"a", 1}, {"b", 2}}, rows)
+	}
+}
+
+func TestAggregatingStore_RollByBytes(t *testing.T) {
+	tests := []struct {
+		name            string
+		encoding        Encoding
+		maxBytes        int64
+		records         []interface{}
+		expectedObjects int
+	}{
+		{
+			name:     "JSONL",
+			encoding: EncodingJSONL(),
+			// Each record has 11 bytes, so objects get two records.
+			maxBytes:        15,
+			records:         []interface{}{map[string]string{"id": "a"}, map[string]string{"id": "b"}, map[string]string{"id": "c"}, map[string]string{"id": "d"}},
+			expectedObjects: 2,
+		},
+		{
+			name:     "CSV",
+			encoding: EncodingCSV(nil),
+			// Each record has 2 bytes, so objects get two records.
+			maxBytes:        3,
+			records:         []interface{}{[]string{"a"}, []string{"b"}, []string{"c"}, []string{"d"}},
+			expectedObjects: 2,
+		},
+		{
+			name:     "Parquet",
+			encoding: EncodingParquet(),
+			// The buffered records count, so each record fills an object.
+			maxBytes:        1,
+			records:         []interface{}{parquetRow{ID: "a"}, parquetRow{ID: "b"}, parquetRow{ID: "c"}, parquetRow{ID: "d"}},
+			expectedObjects: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gateway := newFakeObjectGateway()
+			sink, closeFn := MustNewAggregating(gateway, AggregatingConfig{
+				Bucket:   "bucket",
+				Encoding: test.encoding,
+				MaxBytes: test.maxBytes,
+				MaxAge:   10 * time.Second,
+			})
+			defer closeFn()
+
+			var messages []pipeline.SinkMessage
+			for _, record := range test.records {
+				messages = append(messages, AggregatedRecord{Data: record})
+			}
+
+			start := time.Now()
+			require.NoError(t, sink.Store(context.Background(), messages...))
+			assert.Less(t, time.Since(start), 5*time.Second, "objects were rolled by age")
+			assert.Len(t, gateway.get(), test.expectedObjects)
+		})
+	}
+}
+
+func TestAggregatingStore_Errors(t *testing.T) {
+	config := AggregatingConfig{
+		Bucket:       "bucket",
+		PathTemplate: `{{.Fields.type}}`,
+		Encoding:     EncodingCSV(nil),
+		MaxAge:       10 * time.Millisecond,
+	}
+
+	t.Run("invalid messages", func(t *testing.T) {
+		gateway := newFakeObjectGateway()
+		sink, closeFn := MustNewAggregating(gateway, config)
+		defer closeFn()
+
+		for _, msg := range []pipeline.SinkMessage{
+			"bad msg type",
+			AggregatedRecord{},
+			AggregatedRecord{Data: []string{"1"}},
+			AggregatedRecord{Data: "not a csv line", Fields: map[string]string{"type": "a"}},
+		} {
+			err := sink.Store(context.Background(), msg)
+			assert.ErrorIs(t, err, ErrInvalidSinkMessage)
+			assert.Equal(t, fkerrors.SeverityInput, fkerrors.GetSeverity(err))
+		}
+
+		// The rejected record must not create an empty object.
+		time.Sleep(5 * config.MaxAge)
+		assert.Empty(t, gateway.get())
+	})
+
+	t.Run("invalid record after valid records", func(t *testing.T) {
+		gateway := newFakeObjectGateway()
+		sink, closeFn := MustNewAggregating(gateway, config)
+		defer closeFn()
+
+		err := sink.Store(context.Background(),
+			AggregatedRecord{Data: []string{"1"}, Fields: map[string]string{"type": "a"}},
+			AggregatedRecord{Data: "not a csv line", Fields: map[string]string{"type": "a"}},
+		)
+		assert.ErrorIs(t, err, ErrInvalidSinkMessage)
+		assert.Equal(t, fkerrors.SeverityInput, fkerrors.GetSeverity(err))
+
+		// The batch goes to the DLQ, so none of its records are written.
+		time.Sleep(5 * config.MaxAge)
+		assert.Empty(t, gateway.get())
+	})
+
+	t.Run("record doesn't match the object", func(t *testing.T) {
+		gateway := newFakeObjectGateway()
+		sink, closeFn := MustNewAggregating(gateway, AggregatingConfig{
+			Bucket:   "bucket",
+			Encoding: EncodingParquet(),
+			MaxAge:   200 * time.Millisecond,
+		})
+		defer closeFn()
+
+		first := make(chan error, 1)
+		go func() {
+			first <- sink.Store(context.Background(), AggregatedRecord{Data: parquetRow{ID: "a"}})
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		// The second batch has a valid record, but it can't be appended to
+		// the object of the first batch. Both are retried.
+		type otherRow struct {
+			Name string `parquet:"name"`
+		}
+		err := sink.Store(context.Background(),
+			AggregatedRecord{Data: otherRow{Name: "b"}},
+		)
+		assert.Equal(t, fkerrors.SeverityRuntime, fkerrors.GetSeverity(err))
+		assert.Equal(t, fkerrors.SeverityRuntime, fkerrors.GetSeverity(<-first))
+		assert.Empty(t, gateway.get())
+	})
+
+	t.Run("finalize failure", func(t *testing.T) {
+		gateway := newFakeObjectGateway()
+		gateway.closeErr = errors.New("upload failed")
+		sink, closeFn := MustNewAggregating(gateway, config)
+		defer closeFn()
+
+		err := sink.Store(context.Background(), AggregatedRecord{
+			Data:   []string{"1"},
+			Fields: map[string]string{"type": "a"},
+		})
+		assert.ErrorIs(t, err, ErrFailedToStoreMessages)
+		assert.Equal(t, fkerrors.SeverityRuntime, fkerrors.GetSeverity(err))
+		assert.Equal(t, CodeFailedToFinalizeObject, fkerrors.GetCode(err.(fkerrors.Error).KVs[0].Value.([]error)[0]))
+	})
+
+	t.Run("closed sink", func(t *testing.T) {
+		sink, closeFn := MustNewAggregating(newFakeObjectGateway(), config)
+		assert.NoError(t, closeFn())
+
+		err := sink.Store(context.Background(), AggregatedRecord{
+			Data:   []string{"1"},
+			Fields: map[string]string{"type": "a"},
+		})
+		assert.ErrorIs(t, err, ErrSinkClosed)
+	})
+}
+
+func TestAggregatingClose_FinalizesOpenObjects(t *testing.T) {
+	gateway := newFakeObjectGateway()
+	sink, closeFn := MustNewAggregating(gateway, AggregatingConfig{
+		Bucket:   "bucket",
+		Encoding: EncodingJSONL(),
+		MaxAge:   time.Hour,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The store gives up waiting, but the record stays in the open object.
+	err := sink.Store(ctx, AggregatedRecord{Data: 1})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, closeFn())
+	assert.Len(t, gateway.get(), 1)
+}
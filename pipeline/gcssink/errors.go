@@ -13,6 +13,20 @@ var (
 	CodeFailedToCloseBucket = errors.Code("FAILED_TO_CLOSE_BUCKET")
 	// CodePanic is returned when a panic occurs
 	CodePanic = errors.Code("PANIC_TO_WRITE_AT_BUCKET")
+	// CodePreconditionFailed is returned when the object doesn't match the write policy conditions
+	CodePreconditionFailed = errors.Code("PRECONDITION_FAILED")
+	// CodeInvalidWritePolicy is returned when the sink message has an unknown write policy
+	CodeInvalidWritePolicy = errors.Code("INVALID_WRITE_POLICY")
+	// CodeInvalidGeneration is returned when the generation is missing for WritePolicyMatchGeneration
+	CodeInvalidGeneration = errors.Code("INVALID_GENERATION")
+	// CodeFailedToGetObjectAttrs is returned when a error occurs while reading the object attributes
+	CodeFailedToGetObjectAttrs = errors.Code("FAILED_TO_GET_OBJECT_ATTRS")
+	// CodeWrongTypeRecord is returned when a record can't be encoded by the aggregating sink encoding
+	CodeWrongTypeRecord = errors.Code("WRONG_TYPE_RECORD")
+	// CodeInvalidPath is returned when the path template can't be resolved for a record
+	CodeInvalidPath = errors.Code("INVALID_PATH")
+	// CodeFailedToFinalizeObject is returned when an aggregated object fails to be written or closed
+	CodeFailedToFinalizeObject = errors.Code("FAILED_TO_FINALIZE_OBJECT")
 
 	// ErrFailedToCloseSink is returned when any error occurs while gcsClientGateway is writing
 	ErrFailedToStoreMessages = errors.New("failed to store messages")
@@ -20,4 +34,9 @@ var (
 	ErrInvalidSinkMessage = errors.New("invalid sink message")
 	//ErrPanic is returned when a panic occurs
 	ErrPanic = errors.New("panic occurred while storing to gcs")
+	// ErrConditionalWriteNotSupported is returned when the write policy needs a
+	// gateway that doesn't implement ConditionalGcsClientGateway
+	ErrConditionalWriteNotSupported = errors.New("gateway doesn't support conditional writes")
+	// ErrSinkClosed is returned when Store is called after the aggregating sink is closed
+	ErrSinkClosed = errors.New("sink is closed")
 )
@@ -59,6 +59,113 @@ func (_c *MockGcsClientGateway_Close_Call) Return(_a0 error) *MockGcsClientGatew
 	return _c
 }
 
+// GetConditionalWriter provides a mock function with given fields: ctx, bucket, object, contentType, chunkSize, conds, retrierOption
+func (_m *MockGcsClientGateway) GetConditionalWriter(ctx context.Context, bucket string, object string, contentType string, chunkSize int, conds storage.Conditions, retrierOption ...storage.RetryOption) *storage.Writer {
+	_va := make([]interface{}, len(retrierOption))
+	for _i := range retrierOption {
+		_va[_i] = retrierOption[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, bucket, object, contentType, chunkSize, conds)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *storage.Writer
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, int, storage.Conditions, ...storage.RetryOption) *storage.Writer); ok {
+		r0 = rf(ctx, bucket, object, contentType, chunkSize, conds, retrierOption...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*storage.Writer)
+		}
+	}
+
+	return r0
+}
+
+// MockGcsClientGateway_GetConditionalWriter_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetConditionalWriter'
+type MockGcsClientGateway_GetConditionalWriter_Call struct {
+	*mock.Call
+}
+
+// GetConditionalWriter is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bucket string
+//   - object string
+//   - contentType string
+//   - chunkSize int
+//   - conds storage.Conditions
+//   - retrierOption ...storage.RetryOption
+func (_e *MockGcsClientGateway_Expecter) GetConditionalWriter(ctx interface{}, bucket interface{}, object interface{}, contentType interface{}, chunkSize interface{}, conds interface{}, retrierOption ...interface{}) *MockGcsClientGateway_GetConditionalWriter_Call {
+	return &MockGcsClientGateway_GetConditionalWriter_Call{Call: _e.mock.On("GetConditionalWriter",
+		append([]interface{}{ctx, bucket, object, contentType, chunkSize, conds}, retrierOption...)...)}
+}
+
+func (_c *MockGcsClientGateway_GetConditionalWriter_Call) Run(run func(ctx context.Context, bucket string, object string, contentType string, chunkSize int, conds storage.Conditions, retrierOption ...storage.RetryOption)) *MockGcsClientGateway_GetConditionalWriter_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		variadicArgs := make([]storage.RetryOption, len(args)-6)
+		for i, a := range args[6:] {
+			if a != nil {
+				variadicArgs[i] = a.(storage.RetryOption)
+			}
+		}
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(string), args[4].(int), args[5].(storage.Conditions), variadicArgs...)
+	})
+	return _c
+}
+
+func (_c *MockGcsClientGateway_GetConditionalWriter_Call) Return(_a0 *storage.Writer) *MockGcsClientGateway_GetConditionalWriter_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+// GetObjectAttrs provides a mock function with given fields: ctx, bucket, object
+func (_m *MockGcsClientGateway) GetObjectAttrs(ctx context.Context, bucket string, object string) (*storage.ObjectAttrs, error) {
+	ret := _m.Called(ctx, bucket, object)
+
+	var r0 *storage.ObjectAttrs
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *storage.ObjectAttrs); ok {
+		r0 = rf(ctx, bucket, object)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*storage.ObjectAttrs)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, bucket, object)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockGcsClientGateway_GetObjectAttrs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetObjectAttrs'
+type MockGcsClientGateway_GetObjectAttrs_Call struct {
+	*mock.Call
+}
+
+// GetObjectAttrs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - bucket string
+//   - object string
+func (_e *MockGcsClientGateway_Expecter) GetObjectAttrs(ctx interface{}, bucket interface{}, object interface{}) *MockGcsClientGateway_GetObjectAttrs_Call {
+	return &MockGcsClientGateway_GetObjectAttrs_Call{Call: _e.mock.On("GetObjectAttrs", ctx, bucket, object)}
+}
+
+func (_c *MockGcsClientGateway_GetObjectAttrs_Call) Run(run func(ctx context.Context, bucket string, object string)) *MockGcsClientGateway_GetObjectAttrs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string))
+	})
+	return _c
+}
+
+func (_c *MockGcsClientGateway_GetObjectAttrs_Call) Return(_a0 *storage.ObjectAttrs, _a1 error) *MockGcsClientGateway_GetObjectAttrs_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // GetWriter provides a mock function with given fields: ctx, bucket, object, contentType, chunkSize, retrierOption
 func (_m *MockGcsClientGateway) GetWriter(ctx context.Context, bucket string, object string, contentType string, chunkSize int, retrierOption ...storage.RetryOption) *storage.Writer {
 	_va := make([]interface{}, len(retrierOption))
@@ -1,7 +1,10 @@
 package gcssink
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5" //nolint:gosec // MD5 is what GCS uses to verify uploads
+	"hash/crc32"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -17,11 +20,27 @@ type GcsClientGateway interface {
 	// If retrierOption is not empty, the writer will be configured with the given retry options.
 	GetWriter(ctx context.Context, bucket, object, contentType string, chunkSize int, retrierOption ...storage.RetryOption) *storage.Writer
 	// Write writes the given message to the given writer.
+	// If the write fails because of the writer conditions, the returned error
+	// must have the CodePreconditionFailed code.
 	Write(writer *storage.Writer, message SinkMessage) error
 	// Close closes the GCS client
 	Close() error
 }
 
+// ConditionalGcsClientGateway is implemented by the gateways that support
+// the write policies other than WritePolicyOverwrite. The gateway returned
+// by NewGcsGateway implements it.
+type ConditionalGcsClientGateway interface {
+	GcsClientGateway
+	// GetConditionalWriter is like GetWriter, but the write only succeeds if the
+	// object matches the given conditions.
+	GetConditionalWriter(ctx context.Context, bucket, object, contentType string, chunkSize int, conds storage.Conditions, retrierOption ...storage.RetryOption) *storage.Writer
+	// GetObjectAttrs returns the attributes of an existing object.
+	GetObjectAttrs(ctx context.Context, bucket, object string) (*storage.ObjectAttrs, error)
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 // gcsParallelWriter is a pipeline.Sink that writes messages to GCS in parallel.
 type gcsParallelWriter struct {
 	clientGateway GcsClientGateway
@@ -36,12 +55,50 @@ type gcsParallelWriter struct {
 	retrierOption []storage.RetryOption
 }
 
+// WritePolicy defines what happens when the object being written already exists.
+type WritePolicy int
+
+const (
+	// WritePolicyOverwrite always replaces the existing object. This is the default.
+	WritePolicyOverwrite WritePolicy = iota
+	// WritePolicyCreateOnly only writes the object if it doesn't exist yet.
+	WritePolicyCreateOnly
+	// WritePolicyMatchGeneration only writes the object if its current
+	// generation is SinkMessage.Generation.
+	WritePolicyMatchGeneration
+)
+
+// Checksum is the checksum sent along with the data so GCS rejects corrupted uploads.
+type Checksum int
+
+const (
+	// ChecksumNone doesn't send any checksum. This is the default.
+	ChecksumNone Checksum = iota
+	// ChecksumCRC32C sends the CRC32C of the data.
+	ChecksumCRC32C
+	// ChecksumMD5 sends the MD5 of the data.
+	ChecksumMD5
+)
+
 // SinkMessage is the input for the GCS Sink
 type SinkMessage struct {
 	Data        []byte
 	StoragePath string
 	Bucket      string
 	Metadata    map[string]string
+
+	// ContentEncoding is the object content encoding, like "gzip". Optional.
+	ContentEncoding string
+	// WritePolicy defines what happens if the object already exists.
+	// Policies other than WritePolicyOverwrite require a gateway that
+	// implements ConditionalGcsClientGateway. If the write is rejected because of the policy but the existing object
+	// has the same content, the write is considered successful. This makes
+	// redeliveries idempotent.
+	WritePolicy WritePolicy
+	// Generation is the expected object generation for WritePolicyMatchGeneration.
+	Generation int64
+	// Checksum is the checksum verified by GCS on upload.
+	Checksum Checksum
 }
 
 // MustNew creates a new pipeline sink that write messages to GCS. It panics if
@@ -101,8 +158,7 @@ func (w *gcsParallelWriter) Store(ctx context.Context, messages ...pipeline.Sink
 				return nil
 			}
 
-			writer := w.clientGateway.GetWriter(ctx, sinkMsg.Bucket, sinkMsg.StoragePath, w.contentType, w.chunkSize, w.retrierOption...)
-			errChan <- w.clientGateway.Write(writer, sinkMsg)
+			errChan <- w.write(ctx, sinkMsg)
 
 			return nil
 		})
@@ -120,12 +176,94 @@ func (w *gcsParallelWriter) Store(ctx context.Context, messages ...pipeline.Sink
 	close(errChan)
 
 	if len(sliceErrs) > 0 {
-		return errors.E(op, ErrFailedToStoreMessages, errors.KV("errors", sliceErrs))
+		return errors.E(op, ErrFailedToStoreMessages, severityOf(sliceErrs), errors.KV("errors", sliceErrs))
 	}
 
 	return nil
 }
 
+// write writes a single message, honoring its write policy.
+func (w *gcsParallelWriter) write(ctx context.Context, sinkMsg SinkMessage) error {
+	var conds storage.Conditions
+	switch sinkMsg.WritePolicy {
+	case WritePolicyOverwrite:
+		writer := w.clientGateway.GetWriter(ctx, sinkMsg.Bucket, sinkMsg.StoragePath, w.contentType, w.chunkSize, w.retrierOption...)
+		return w.clientGateway.Write(writer, sinkMsg)
+	case WritePolicyCreateOnly:
+		conds = storage.Conditions{DoesNotExist: true}
+	case WritePolicyMatchGeneration:
+		if sinkMsg.Generation <= 0 {
+			return errors.E(ErrInvalidSinkMessage, CodeInvalidGeneration, errors.SeverityInput)
+		}
+		conds = storage.Conditions{GenerationMatch: sinkMsg.Generation}
+	default:
+		return errors.E(ErrInvalidSinkMessage, CodeInvalidWritePolicy, errors.SeverityInput)
+	}
+
+	gateway, ok := w.clientGateway.(ConditionalGcsClientGateway)
+	if !ok {
+		return errors.E(ErrConditionalWriteNotSupported, CodeInvalidWritePolicy, errors.SeverityFatal)
+	}
+
+	writer := gateway.GetConditionalWriter(ctx, sinkMsg.Bucket, sinkMsg.StoragePath, w.contentType, w.chunkSize, conds, w.retrierOption...)
+	err := gateway.Write(writer, sinkMsg)
+	if errors.GetCode(err) != CodePreconditionFailed {
+		return err
+	}
+
+	return checkExistingObject(ctx, gateway, sinkMsg, err)
+}
+
+// checkExistingObject is called when a write was rejected by its
+// preconditions. If the existing object has the same content, the message
+// was already written, probably by a previous delivery, so it is not an error.
+func checkExistingObject(ctx context.Context, gateway ConditionalGcsClientGateway, sinkMsg SinkMessage, writeErr error) error {
+	attrs, err := gateway.GetObjectAttrs(ctx, sinkMsg.Bucket, sinkMsg.StoragePath)
+	if err != nil {
+		return errors.E(err, CodeFailedToGetObjectAttrs, errors.SeverityRuntime, errors.KV("bucket", sinkMsg.Bucket), errors.KV("path", sinkMsg.StoragePath))
+	}
+
+	if sameContent(attrs, sinkMsg.Data) {
+		return nil
+	}
+
+	// Retrying won't change the outcome.
+	return errors.E(writeErr, errors.SeverityInput)
+}
+
+// sameContent compares the object checksums with the data. The MD5 is only
+// compared when available, because composite objects don't have one.
+func sameContent(attrs *storage.ObjectAttrs, data []byte) bool {
+	if attrs == nil || attrs.Size != int64(len(data)) {
+		return false
+	}
+	if attrs.CRC32C != crc32.Checksum(data, crc32cTable) {
+		return false
+	}
+	if len(attrs.MD5) > 0 {
+		sum := md5.Sum(data)
+		return bytes.Equal(attrs.MD5, sum[:])
+	}
+	return true
+}
+
+// severityOf returns fatal if any error is fatal, so the engine stops, and
+// input if all errors are input errors, so the messages can go to a DLQ.
+// Otherwise the batch should be retried.
+func severityOf(errs []error) errors.Severity {
+	severity := errors.SeverityInput
+	for _, err := range errs {
+		switch errors.GetSeverity(err) {
+		case errors.SeverityFatal:
+			return errors.SeverityFatal
+		case errors.SeverityInput:
+		default:
+			severity = errors.SeverityRuntime
+		}
+	}
+	return severity
+}
+
 func panicToError(errChan *chan error) {
 	if r := recover(); r != nil {
 		*errChan <- errors.E(ErrPanic, CodePanic, errors.KV("panic", r))
@@ -2,6 +2,9 @@ package gcssink
 
 import (
 	"context"
+	"crypto/md5" //nolint:gosec
+	"hash/crc32"
+	"net/http"
 	"testing"
 	"time"
 
@@ -11,6 +14,9 @@ import (
 	"github.com/googleapis/gax-go/v2"
 	"github.com/stretchr/testify/assert"
 	mock "github.com/stretchr/testify/mock"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMustNewParallel(t *testing.T) {
@@ -391,3 +397,173 @@ func TestMakeGcsRetrierOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestStoreWritePolicies(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("test")
+	md5Sum := md5.Sum(data) //nolint:gosec
+	preconditionErr := errors.E(errors.Op("gcssink.gcsClientGateway.Write"), errors.New("412"), CodePreconditionFailed)
+
+	tests := []struct {
+		name         string
+		message      SinkMessage
+		setupMock    func(m *MockGcsClientGateway)
+		wantSeverity errors.Severity
+		wantCode     errors.Code
+		wantErr      bool
+	}{
+		{
+			name:    "[SUCCESS] - create only uses does not exist condition",
+			message: SinkMessage{Data: data, Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyCreateOnly},
+			setupMock: func(m *MockGcsClientGateway) {
+				m.EXPECT().GetConditionalWriter(mock.Anything, "bucket", "path", mock.Anything, mock.Anything, storage.Conditions{DoesNotExist: true}).Return(nil).Once()
+				m.EXPECT().Write(mock.Anything, mock.Anything).Return(nil).Once()
+			},
+		},
+		{
+			name:    "[SUCCESS] - match generation uses generation condition",
+			message: SinkMessage{Data: data, Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyMatchGeneration, Generation: 42},
+			setupMock: func(m *MockGcsClientGateway) {
+				m.EXPECT().GetConditionalWriter(mock.Anything, "bucket", "path", mock.Anything, mock.Anything, storage.Conditions{GenerationMatch: 42}).Return(nil).Once()
+				m.EXPECT().Write(mock.Anything, mock.Anything).Return(nil).Once()
+			},
+		},
+		{
+			name:    "[SUCCESS] - precondition failure with same content is idempotent",
+			message: SinkMessage{Data: data, Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyCreateOnly},
+			setupMock: func(m *MockGcsClientGateway) {
+				m.EXPECT().GetConditionalWriter(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+				m.EXPECT().Write(mock.Anything, mock.Anything).Return(preconditionErr).Once()
+				m.EXPECT().GetObjectAttrs(mock.Anything, "bucket", "path").Return(&storage.ObjectAttrs{
+					Size:   int64(len(data)),
+					CRC32C: crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)),
+					MD5:    md5Sum[:],
+				}, nil).Once()
+			},
+		},
+		{
+			name:    "[ERROR] - precondition failure with different content",
+			message: SinkMessage{Data: data, Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyCreateOnly},
+			setupMock: func(m *MockGcsClientGateway) {
+				m.EXPECT().GetConditionalWriter(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+				m.EXPECT().Write(mock.Anything, mock.Anything).Return(preconditionErr).Once()
+				m.EXPECT().GetObjectAttrs(mock.Anything, "bucket", "path").Return(&storage.ObjectAttrs{
+					Size:   int64(len(data)),
+					CRC32C: 1,
+				}, nil).Once()
+			},
+			wantErr:      true,
+			wantSeverity: errors.SeverityInput,
+			wantCode:     CodePreconditionFailed,
+		},
+		{
+			name:    "[ERROR] - fails to read existing object attributes",
+			message: SinkMessage{Data: data, Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyCreateOnly},
+			setupMock: func(m *MockGcsClientGateway) {
+				m.EXPECT().GetConditionalWriter(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+				m.EXPECT().Write(mock.Anything, mock.Anything).Return(preconditionErr).Once()
+				m.EXPECT().GetObjectAttrs(mock.Anything, "bucket", "path").Return(nil, errors.New("unavailable")).Once()
+			},
+			wantErr:      true,
+			wantSeverity: errors.SeverityRuntime,
+			wantCode:     CodeFailedToGetObjectAttrs,
+		},
+		{
+			name:         "[ERROR] - match generation without generation",
+			message:      SinkMessage{Data: data, Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyMatchGeneration},
+			setupMock:    func(m *MockGcsClientGateway) {},
+			wantErr:      true,
+			wantSeverity: errors.SeverityInput,
+			wantCode:     CodeInvalidGeneration,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			gateway := NewMockGcsClientGateway(t)
+			test.setupMock(gateway)
+
+			sink, _ := MustNewParallel(gateway, "application/json", 100, []storage.RetryOption{})
+
+			err := sink.Store(context.Background(), test.message)
+			if !test.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+
+			// Store wraps each message error in the errors KV, with the
+			// severity of the message error.
+			assert.ErrorIs(t, err, ErrFailedToStoreMessages)
+			assert.Equal(t, test.wantSeverity, errors.GetSeverity(err))
+			msgErr := err.(errors.Error).KVs[0].Value.([]error)[0]
+			assert.Equal(t, test.wantCode, errors.GetCode(msgErr))
+		})
+	}
+}
+
+func TestStoreWritePolicies_GatewayWithoutConditionalWrites(t *testing.T) {
+	t.Parallel()
+
+	// The embedded interface hides the conditional methods of the mock, like
+	// a gateway implemented before they existed.
+	gateway := struct{ GcsClientGateway }{NewMockGcsClientGateway(t)}
+	sink, _ := MustNewParallel(gateway, "application/json", 100, []storage.RetryOption{})
+
+	err := sink.Store(context.Background(), SinkMessage{Data: []byte("test"), Bucket: "bucket", StoragePath: "path", WritePolicy: WritePolicyCreateOnly})
+	assert.ErrorIs(t, err, ErrFailedToStoreMessages)
+	assert.Equal(t, errors.SeverityFatal, errors.GetSeverity(err))
+	msgErr := err.(errors.Error).KVs[0].Value.([]error)[0]
+	assert.ErrorIs(t, msgErr, ErrConditionalWriteNotSupported)
+}
+
+func TestSeverityOf(t *testing.T) {
+	t.Parallel()
+
+	input := errors.E("input", errors.SeverityInput)
+	runtime := errors.E("runtime", errors.SeverityRuntime)
+	fatal := errors.E("fatal", errors.SeverityFatal)
+
+	assert.Equal(t, errors.SeverityInput, severityOf([]error{input, input}))
+	assert.Equal(t, errors.SeverityRuntime, severityOf([]error{input, runtime}))
+	assert.Equal(t, errors.SeverityRuntime, severityOf([]error{input, errors.New("unset")}))
+	assert.Equal(t, errors.SeverityFatal, severityOf([]error{runtime, fatal, input}))
+}
+
+func TestSetWriterAttrs(t *testing.T) {
+	t.Parallel()
+
+	data := []byte("test")
+
+	// No checksum is sent by default.
+	writer := &storage.Writer{}
+	setWriterAttrs(writer, SinkMessage{
+		Data:            data,
+		Metadata:        map[string]string{"key": "value"},
+		ContentEncoding: "gzip",
+	})
+	assert.Equal(t, map[string]string{"key": "value"}, writer.Metadata)
+	assert.Equal(t, "gzip", writer.ContentEncoding)
+	assert.Empty(t, writer.MD5)
+	assert.False(t, writer.SendCRC32C)
+
+	writer = &storage.Writer{}
+	setWriterAttrs(writer, SinkMessage{Data: data, Checksum: ChecksumCRC32C})
+	assert.True(t, writer.SendCRC32C)
+	assert.Equal(t, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)), writer.CRC32C)
+
+	writer = &storage.Writer{}
+	setWriterAttrs(writer, SinkMessage{Data: data, Checksum: ChecksumMD5})
+	md5Sum := md5.Sum(data) //nolint:gosec
+	assert.Equal(t, md5Sum[:], writer.MD5)
+	assert.False(t, writer.SendCRC32C)
+}
+
+func TestWriteErrorCode(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, CodePreconditionFailed, writeErrorCode(&googleapi.Error{Code: http.StatusPreconditionFailed}, CodeFailedToCloseBucket))
+	assert.Equal(t, CodePreconditionFailed, writeErrorCode(status.Error(codes.FailedPrecondition, "failed"), CodeFailedToCloseBucket))
+	assert.Equal(t, CodeFailedToCloseBucket, writeErrorCode(errors.New("other"), CodeFailedToCloseBucket))
+}
@@ -0,0 +1,23 @@
+package httpsink
+
+import "errors"
+
+var (
+	// ErrUnknownMessageType is returned when the sink message received is
+	// not of the type Message.
+	ErrUnknownMessageType = errors.New("unknown message type: expected httpsink.Message")
+
+	// ErrInvalidURL is returned when the URL template can't be resolved for
+	// a message or the result is not a valid URL.
+	ErrInvalidURL = errors.New("invalid request url")
+
+	// ErrInvalidBody is returned when the Message.Body can't be encoded.
+	ErrInvalidBody = errors.New("invalid request body")
+
+	// ErrRequestFailed is returned when the request could not be sent or
+	// its response could not be read.
+	ErrRequestFailed = errors.New("request failed")
+
+	// ErrUnexpectedStatus is returned when the response status is not 2xx.
+	ErrUnexpectedStatus = errors.New("unexpected response status")
+)
@@ -0,0 +1,60 @@
+package httpsink
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures the http sink.
+type Option func(*httpSink)
+
+// WithMethod sets the request method. The default is POST.
+func WithMethod(method string) Option {
+	return func(s *httpSink) {
+		s.method = method
+	}
+}
+
+// WithHeader sets a header of all requests. Content-Type is
+// application/json unless it is set with this option.
+func WithHeader(key, value string) Option {
+	return func(s *httpSink) {
+		s.headers.Set(key, value)
+	}
+}
+
+// WithSigner signs every request after its headers are set. See HMACSigner.
+func WithSigner(signer Signer) Option {
+	return func(s *httpSink) {
+		s.signer = signer
+	}
+}
+
+// WithBatching sends up to maxMessages messages with the same URL in a single
+// request, whose body is a JSON array of the message bodies. Message bodies
+// must then be JSON. By default each message is sent in its own request.
+func WithBatching(maxMessages int) Option {
+	return func(s *httpSink) {
+		s.maxBatchSize = maxMessages
+	}
+}
+
+// WithRequestTimeout limits how long each request may take, including
+// reading the response. The default is no limit other than the client one.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(s *httpSink) {
+		s.requestTimeout = timeout
+	}
+}
+
+// WithMaxRetryAfter limits how long the sink waits when the server answers
+// with a Retry-After header. The default is 30 seconds.
+func WithMaxRetryAfter(maxRetryAfter time.Duration) Option {
+	return func(s *httpSink) {
+		s.maxRetryAfter = maxRetryAfter
+	}
+}
+
+func defaultHeaders() http.Header {
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
@@ -0,0 +1,37 @@
+package httpsink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signer signs a request. body is the request body, which was already set
+// in the request.
+type Signer func(r *http.Request, body []byte) error
+
+// HMACSigner returns a Signer that sets the header to "sha256=" followed by
+// the hex encoded HMAC-SHA256 of the body with the secret.
+//
+// If timestampHeader is not empty, the current unix time is sent in it and
+// the signed content is the timestamp, a dot and the body, so receivers can
+// reject replayed requests.
+func HMACSigner(header, timestampHeader string, secret []byte) Signer {
+	return func(r *http.Request, body []byte) error {
+		mac := hmac.New(sha256.New, secret)
+		if timestampHeader != "" {
+			timestamp := strconv.FormatInt(now().Unix(), 10)
+			r.Header.Set(timestampHeader, timestamp)
+			mac.Write([]byte(timestamp + "."))
+		}
+		mac.Write(body)
+		r.Header.Set(header, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		return nil
+	}
+}
+
+// now is replaced by tests.
+var now = time.Now
@@ -0,0 +1,314 @@
+package httpsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+)
+
+const (
+	defaultMaxRetryAfter = 30 * time.Second
+	// maxErrorBodySize is how much of an error response is kept in the error.
+	maxErrorBodySize = 1024
+)
+
+// Message is the input for the http sink.
+type Message struct {
+	// Body is the request body. []byte, string and json.RawMessage are sent
+	// as they are and other values are encoded as JSON. With batching, it
+	// must be JSON.
+	Body interface{}
+	// Fields are available to the URL template.
+	Fields map[string]string
+}
+
+type urlTemplateData struct {
+	Fields map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+}
+
+type httpSink struct {
+	client      *http.Client
+	urlTemplate *template.Template
+
+	method         string
+	headers        http.Header
+	signer         Signer
+	maxBatchSize   int
+	requestTimeout time.Duration
+	maxRetryAfter  time.Duration
+}
+
+// MustNew returns a new Sink that sends messages to HTTP endpoints.
+//
+// urlTemplate is a text/template resolved for each message with its .Fields,
+// like "https://partner.example/{{pathEscape .Fields.tenant}}/events". The
+// functions pathEscape and queryEscape are available.
+//
+// Requests are sent in the message order and Store fails on the first
+// request that fails. A 4xx response is an input error, except for 408 and
+// 429, so the messages can go to a DLQ. Other responses that are not 2xx and
+// network errors are runtime errors, which are retried by
+// pipeline.SinkWithRetry. If a 429 or 503 response has a Retry-After header,
+// Store waits for it, limited by WithMaxRetryAfter, before returning.
+//
+// It panics if client is nil or the template is invalid.
+func MustNew(client *http.Client, urlTemplate string, options ...Option) pipeline.Sink {
+	if client == nil {
+		panic("http client is nil")
+	}
+
+	t, err := template.New("url").Funcs(templateFuncs).Option("missingkey=error").Parse(urlTemplate)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &httpSink{
+		client:        client,
+		urlTemplate:   t,
+		method:        http.MethodPost,
+		headers:       defaultHeaders(),
+		maxBatchSize:  1,
+		maxRetryAfter: defaultMaxRetryAfter,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	if s.maxBatchSize < 1 {
+		panic("max batch size must be positive")
+	}
+
+	return s
+}
+
+// request is a request body and the URL it is sent to.
+type request struct {
+	url    string
+	bodies []interface{}
+}
+
+// Store sends the messages to their URLs.
+func (s *httpSink) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
+	const op = errors.Op("httpsink.httpSink.Store")
+
+	requests, err := s.buildRequests(messages)
+	if err != nil {
+		return errors.E(op, err, errors.SeverityInput)
+	}
+
+	for _, r := range requests {
+		if err := s.send(ctx, r); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+// buildRequests resolves the message URLs and, with batching, groups
+// messages with the same URL. Requests keep the order of their first
+// message.
+func (s *httpSink) buildRequests(messages []pipeline.SinkMessage) ([]*request, error) {
+	const op = errors.Op("httpsink.httpSink.buildRequests")
+
+	var requests []*request
+	open := make(map[string]*request)
+
+	for _, m := range messages {
+		message, ok := m.(Message)
+		if !ok {
+			return nil, errors.E(op, ErrUnknownMessageType)
+		}
+
+		u, err := s.resolveURL(message)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		r := open[u]
+		if r == nil || len(r.bodies) >= s.maxBatchSize {
+			r = &request{url: u}
+			requests = append(requests, r)
+			open[u] = r
+		}
+		r.bodies = append(r.bodies, message.Body)
+	}
+
+	return requests, nil
+}
+
+func (s *httpSink) resolveURL(message Message) (string, error) {
+	const op = errors.Op("httpsink.httpSink.resolveURL")
+
+	var b bytes.Buffer
+	if err := s.urlTemplate.Execute(&b, urlTemplateData{Fields: message.Fields}); err != nil {
+		return "", errors.E(op, ErrInvalidURL, errors.KV("cause", err))
+	}
+
+	u, err := url.Parse(b.String())
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", errors.E(op, ErrInvalidURL, errors.KV("url", b.String()))
+	}
+	return u.String(), nil
+}
+
+func (s *httpSink) encodeBody(r *request) ([]byte, error) {
+	const op = errors.Op("httpsink.httpSink.encodeBody")
+
+	if s.maxBatchSize == 1 {
+		body, err := encodeBody(r.bodies[0])
+		if err != nil {
+			return nil, errors.E(op, ErrInvalidBody, errors.SeverityInput, errors.KV("cause", err))
+		}
+		return body, nil
+	}
+
+	array := make([]json.RawMessage, 0, len(r.bodies))
+	for _, body := range r.bodies {
+		b, err := encodeBody(body)
+		if err != nil {
+			return nil, errors.E(op, ErrInvalidBody, errors.SeverityInput, errors.KV("cause", err))
+		}
+		array = append(array, b)
+	}
+
+	body, err := json.Marshal(array)
+	if err != nil {
+		return nil, errors.E(op, ErrInvalidBody, errors.SeverityInput, errors.KV("cause", err))
+	}
+	return body, nil
+}
+
+func encodeBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case []byte:
+		return b, nil
+	case json.RawMessage:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+	return json.Marshal(body)
+}
+
+// send sends a single request and classifies its response.
+func (s *httpSink) send(ctx context.Context, r *request) error {
+	const op = errors.Op("httpsink.httpSink.send")
+
+	body, err := s.encodeBody(r)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	requestCtx := ctx
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		requestCtx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(requestCtx, s.method, r.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.E(op, ErrInvalidURL, errors.SeverityInput, errors.KV("cause", err), errors.KV("url", r.url))
+	}
+	for key, values := range s.headers {
+		req.Header[key] = values
+	}
+	if s.signer != nil {
+		if err := s.signer(req, body); err != nil {
+			return errors.E(op, err, errors.SeverityFatal)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.E(op, ErrRequestFailed, errors.SeverityRuntime, errors.KV("cause", err), errors.KV("url", r.url))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// Reading the body allows the connection to be reused.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	statusErr := errors.E(op, ErrUnexpectedStatus,
+		errors.KV("url", r.url),
+		errors.KV("status", resp.StatusCode),
+		errors.KV("response", string(responseBody)),
+	)
+
+	if isInputStatus(resp.StatusCode) {
+		return errors.E(op, statusErr, errors.SeverityInput)
+	}
+
+	if retryAfter, ok := s.retryAfter(resp); ok {
+		if err := wait(ctx, retryAfter); err != nil {
+			return errors.E(op, err, errors.SeverityRuntime)
+		}
+		return errors.E(op, statusErr, errors.SeverityRuntime, errors.KV("retry_after", retryAfter))
+	}
+	return errors.E(op, statusErr, errors.SeverityRuntime)
+}
+
+// isInputStatus checks if retrying the request can't change the response.
+func isInputStatus(status int) bool {
+	return status >= 400 && status < 500 &&
+		status != http.StatusRequestTimeout &&
+		status != http.StatusTooManyRequests
+}
+
+// retryAfter returns the wait time of a 429 or 503 response, limited by
+// maxRetryAfter.
+func (s *httpSink) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = t.Sub(now())
+	} else {
+		return 0, false
+	}
+
+	if d < 0 {
+		d = 0
+	}
+	if d > s.maxRetryAfter {
+		d = s.maxRetryAfter
+	}
+	return d, true
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
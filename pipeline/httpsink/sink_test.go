@@ -0,0 +1,223 @@
+package httpsink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck/pipeline"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receivedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// recorder is a http handler that records the requests and answers with
+// the configured status and headers.
+type recorder struct {
+	mu       sync.Mutex
+	requests []receivedRequest
+	status   int
+	header   http.Header
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rec.requests = append(rec.requests, receivedRequest{
+		method: r.Method,
+		path:   r.URL.Path,
+		header: r.Header,
+		body:   string(body),
+	})
+
+	for key, values := range rec.header {
+		w.Header()[key] = values
+	}
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte("response body"))
+}
+
+func TestStore_Batching(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	sink := MustNew(server.Client(), server.URL+"/{{pathEscape .Fields.tenant}}/events",
+		WithMethod(http.MethodPut),
+		WithHeader("Authorization", "Bearer token"),
+		WithBatching(2),
+		WithSigner(HMACSigner("X-Signature", "X-Timestamp", []byte("secret"))),
+		WithRequestTimeout(time.Second),
+	)
+
+	err := sink.Store(context.Background(),
+		Message{Body: map[string]int{"n": 1}, Fields: map[string]string{"tenant": "a"}},
+		Message{Body: `{"n":2}`, Fields: map[string]string{"tenant": "b/c"}},
+		Message{Body: []byte(`{"n":3}`), Fields: map[string]string{"tenant": "a"}},
+		Message{Body: 4, Fields: map[string]string{"tenant": "a"}},
+	)
+	require.NoError(t, err)
+
+	require.Len(t, rec.requests, 3)
+
+	assert.Equal(t, http.MethodPut, rec.requests[0].method)
+	assert.Equal(t, "/a/events", rec.requests[0].path)
+	assert.Equal(t, `[{"n":1},{"n":3}]`, rec.requests[0].body)
+	assert.Equal(t, "application/json", rec.requests[0].header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", rec.requests[0].header.Get("Authorization"))
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.[{"n":1},{"n":3}]`))
+	assert.Equal(t, "1700000000", rec.requests[0].header.Get("X-Timestamp"))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), rec.requests[0].header.Get("X-Signature"))
+
+	assert.Equal(t, "/b/c/events", rec.requests[1].path)
+	assert.Equal(t, `[{"n":2}]`, rec.requests[1].body)
+
+	assert.Equal(t, "/a/events", rec.requests[2].path)
+	assert.Equal(t, `[4]`, rec.requests[2].body)
+}
+
+func TestStore_StatusSeverity(t *testing.T) {
+	tests := []struct {
+		name               string
+		status             int
+		header             http.Header
+		expectedSeverity   errors.Severity
+		expectedRetryAfter interface{}
+	}{
+		{
+			name:             "Bad request",
+			status:           http.StatusBadRequest,
+			expectedSeverity: errors.SeverityInput,
+		},
+		{
+			name:             "Request timeout",
+			status:           http.StatusRequestTimeout,
+			expectedSeverity: errors.SeverityRuntime,
+		},
+		{
+			name:             "Internal server error",
+			status:           http.StatusInternalServerError,
+			expectedSeverity: errors.SeverityRuntime,
+		},
+		{
+			name:               "Too many requests",
+			status:             http.StatusTooManyRequests,
+			header:             http.Header{"Retry-After": []string{"120"}},
+			expectedSeverity:   errors.SeverityRuntime,
+			expectedRetryAfter: 10 * time.Millisecond,
+		},
+		{
+			name:               "Service unavailable",
+			status:             http.StatusServiceUnavailable,
+			header:             http.Header{"Retry-After": []string{time.Now().UTC().Format(http.TimeFormat)}},
+			expectedSeverity:   errors.SeverityRuntime,
+			expectedRetryAfter: time.Duration(0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := &recorder{status: test.status, header: test.header}
+			server := httptest.NewServer(rec)
+			defer server.Close()
+
+			sink := MustNew(server.Client(), server.URL, WithMaxRetryAfter(10*time.Millisecond))
+			err := sink.Store(context.Background(), Message{Body: "{}"})
+
+			assert.ErrorIs(t, err, ErrUnexpectedStatus)
+			assert.Equal(t, test.expectedSeverity, errors.GetSeverity(err))
+			assert.Equal(t, test.status, getKV(err, "status"))
+			assert.Equal(t, "response body", getKV(err, "response"))
+			assert.Equal(t, test.expectedRetryAfter, getKV(err, "retry_after"))
+		})
+	}
+}
+
+func TestStore_InvalidMessages(t *testing.T) {
+	sink := MustNew(http.DefaultClient, "https://example.com/{{.Fields.tenant}}", WithBatching(10))
+
+	tests := []struct {
+		name        string
+		message     pipeline.SinkMessage
+		expectedErr error
+	}{
+		{
+			name:        "Unknown type",
+			message:     "message",
+			expectedErr: ErrUnknownMessageType,
+		},
+		{
+			name:        "Missing field",
+			message:     Message{Body: "{}"},
+			expectedErr: ErrInvalidURL,
+		},
+		{
+			name:        "Invalid body",
+			message:     Message{Body: func() {}, Fields: map[string]string{"tenant": "a"}},
+			expectedErr: ErrInvalidBody,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := sink.Store(context.Background(), test.message)
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+		})
+	}
+}
+
+func TestStore_RequestFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	sink := MustNew(server.Client(), server.URL, WithRequestTimeout(10*time.Millisecond))
+	err := sink.Store(context.Background(), Message{Body: "{}"})
+
+	assert.ErrorIs(t, err, ErrRequestFailed)
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+}
+
+// getKV returns the value of the key in the first error of the chain with it.
+func getKV(err error, key string) interface{} {
+	for {
+		e, ok := err.(errors.Error)
+		if !ok {
+			return nil
+		}
+		for _, kv := range e.KVs {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+		err = e.Err
+	}
+}
@@ -0,0 +1,15 @@
+package inputstreams
+
+import "errors"
+
+var (
+	// ErrNoFranzBroker is returned when the brokers are not set.
+	ErrNoFranzBroker = errors.New("no franz broker provided")
+	// ErrNoFranzTopic is returned when the topics are not set.
+	ErrNoFranzTopic = errors.New("no franz topic provided")
+	// ErrEmptyFranzTopic is returned when the provided topic is an empty
+	// string.
+	ErrEmptyFranzTopic = errors.New("empty franz topic")
+	// ErrNoFranzGroupID is returned when the group id is not set.
+	ErrNoFranzGroupID = errors.New("no franz group id provided")
+)
@@ -0,0 +1,83 @@
+package inputstreams
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+)
+
+// FranzOption configures the franz provider.
+type FranzOption func(*franzProvider)
+
+// WithFranzBrokers sets the kafka brokers.
+func WithFranzBrokers(brokers ...string) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.Brokers = brokers
+	}
+}
+
+// WithFranzTopic sets the kafka topic or topics.
+func WithFranzTopic(topics ...string) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.Topics = topics
+	}
+}
+
+// WithFranzGroupID sets the kafka group id.
+func WithFranzGroupID(id string) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.GroupID = id
+	}
+}
+
+// WithFranzTLS enables TLS with the given config.
+func WithFranzTLS(config *tls.Config) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.TLS = config
+	}
+}
+
+// WithFranzSASL sets the SASL mechanism, like the ones returned by
+// kafkafranz.SASLPlain or kafkafranz.SASLScramSHA512.
+func WithFranzSASL(mechanism sasl.Mechanism) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.SASL = mechanism
+	}
+}
+
+// WithFranzStartOffset sets where the group starts consuming partitions
+// without committed offsets.
+func WithFranzStartOffset(offset kgo.Offset) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.StartOffset = &offset
+	}
+}
+
+// WithFranzMaxPollRecords sets how many records are fetched at once.
+func WithFranzMaxPollRecords(n int) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.MaxPollRecords = n
+	}
+}
+
+// WithFranzRebalanceHooks sets the functions called with the partitions
+// assigned to and revoked from each stream. Any of them can be nil.
+func WithFranzRebalanceHooks(
+	onAssigned func(ctx context.Context, assigned map[string][]int32),
+	onRevoked func(ctx context.Context, revoked map[string][]int32),
+) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.OnAssigned = onAssigned
+		fp.config.OnRevoked = onRevoked
+	}
+}
+
+// WithFranzOpts adds extra franz-go options. They override the ones built
+// from the other options.
+func WithFranzOpts(opts ...kgo.Opt) FranzOption {
+	return func(fp *franzProvider) {
+		fp.config.Opts = append(fp.config.Opts, opts...)
+	}
+}
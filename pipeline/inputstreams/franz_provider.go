@@ -0,0 +1,44 @@
+package inputstreams
+
+import (
+	"github.com/arquivei/goduck"
+	"github.com/arquivei/goduck/impl/implstream/kafkafranz"
+)
+
+type franzProvider struct {
+	config kafkafranz.Config
+}
+
+// WithFranzProvider configures the input stream with a pure-Go kafka
+// provider, that doesn't need cgo. Each stream is a member of the consumer
+// group.
+func WithFranzProvider(opts ...FranzOption) Option {
+	return func(o *options) error {
+		provider := &franzProvider{}
+		for _, opt := range opts {
+			opt(provider)
+		}
+		if len(provider.config.Brokers) == 0 {
+			return ErrNoFranzBroker
+		}
+		if len(provider.config.Topics) == 0 {
+			return ErrNoFranzTopic
+		}
+		for _, t := range provider.config.Topics {
+			if t == "" {
+				return ErrEmptyFranzTopic
+			}
+		}
+		if provider.config.GroupID == "" {
+			return ErrNoFranzGroupID
+		}
+
+		o.provider = provider
+
+		return nil
+	}
+}
+
+func (p *franzProvider) MakeStream() (goduck.Stream, error) {
+	return kafkafranz.New(p.config)
+}
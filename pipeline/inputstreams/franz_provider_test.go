@@ -0,0 +1,98 @@
+package inputstreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arquivei/goduck/impl/implstream/kafkafranz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestWithFranzProvider(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		onAssigned := func(context.Context, map[string][]int32) {}
+
+		o := options{}
+		err := WithFranzProvider(
+			WithFranzBrokers("my broker"),
+			WithFranzTopic("my topic", "other topic"),
+			WithFranzGroupID("my group"),
+			WithFranzSASL(kafkafranz.SASLScramSHA512("user", "pass")),
+			WithFranzStartOffset(kgo.NewOffset().AtEnd()),
+			WithFranzMaxPollRecords(10),
+			WithFranzRebalanceHooks(onAssigned, nil),
+			WithFranzOpts(kgo.FetchMaxWait(time.Second)),
+		)(&o)
+
+		require.NoError(t, err)
+		p := o.provider.(*franzProvider)
+		assert.Equal(t, []string{"my broker"}, p.config.Brokers)
+		assert.Equal(t, []string{"my topic", "other topic"}, p.config.Topics)
+		assert.Equal(t, "my group", p.config.GroupID)
+		assert.Equal(t, "SCRAM-SHA-512", p.config.SASL.Name())
+		assert.Equal(t, kgo.NewOffset().AtEnd(), *p.config.StartOffset)
+		assert.Equal(t, 10, p.config.MaxPollRecords)
+		assert.NotNil(t, p.config.OnAssigned)
+		assert.Nil(t, p.config.OnRevoked)
+		assert.Len(t, p.config.Opts, 1)
+	})
+
+	t.Run("Error: No franz broker", func(t *testing.T) {
+		o := options{}
+		err := WithFranzProvider(WithFranzTopic("my topic"), WithFranzGroupID("my group"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoFranzBroker.Error())
+	})
+
+	t.Run("Error: No franz topic", func(t *testing.T) {
+		o := options{}
+		err := WithFranzProvider(WithFranzBrokers("my broker"), WithFranzGroupID("my group"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoFranzTopic.Error())
+	})
+
+	t.Run("Error: Empty franz topic", func(t *testing.T) {
+		o := options{}
+		err := WithFranzProvider(WithFranzBrokers("my broker"), WithFranzTopic(""), WithFranzGroupID("my group"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrEmptyFranzTopic.Error())
+	})
+
+	t.Run("Error: No franz group id", func(t *testing.T) {
+		o := options{}
+		err := WithFranzProvider(WithFranzBrokers("my broker"), WithFranzTopic("my topic"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoFranzGroupID.Error())
+	})
+}
+
+func TestFranzMakeStream(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "my topic"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	o := options{}
+	err = WithFranzProvider(
+		WithFranzBrokers(cluster.ListenAddrs()...),
+		WithFranzTopic("my topic"),
+		WithFranzGroupID("my group"),
+	)(&o)
+	require.NoError(t, err)
+
+	// Each stream joins the group.
+	s1, err := o.provider.MakeStream()
+	require.NoError(t, err)
+	defer s1.Close()
+
+	s2, err := o.provider.MakeStream()
+	require.NoError(t, err)
+	defer s2.Close()
+}
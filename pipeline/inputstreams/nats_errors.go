@@ -0,0 +1,16 @@
+package inputstreams
+
+import "errors"
+
+var (
+	// ErrNoNatsJetStream is returned when the jetstream context is nil.
+	ErrNoNatsJetStream = errors.New("no nats jetstream provided")
+	// ErrNoNatsStream is returned when the jetstream stream is not set.
+	ErrNoNatsStream = errors.New("no nats stream provided")
+	// ErrNoNatsConsumer is returned when the durable consumer is not set.
+	ErrNoNatsConsumer = errors.New("no nats consumer provided")
+	// ErrNatsMultipleStreams is returned when more than one stream is
+	// requested from the nats provider. The streams ack all messages before
+	// the acked one, so a consumer can't be shared.
+	ErrNatsMultipleStreams = errors.New("nats provider supports a single stream")
+)
@@ -0,0 +1,43 @@
+package inputstreams
+
+import "time"
+
+// NatsOption configures the nats provider.
+type NatsOption func(*natsProvider)
+
+// WithNatsStream sets the jetstream stream name.
+func WithNatsStream(stream string) NatsOption {
+	return func(np *natsProvider) {
+		np.config.Stream = stream
+	}
+}
+
+// WithNatsConsumer sets the durable consumer name. It is created if it
+// doesn't exist.
+func WithNatsConsumer(consumer string) NatsOption {
+	return func(np *natsProvider) {
+		np.config.Consumer = consumer
+	}
+}
+
+// WithNatsFilterSubjects restricts the consumer to the given subjects.
+func WithNatsFilterSubjects(subjects ...string) NatsOption {
+	return func(np *natsProvider) {
+		np.config.FilterSubjects = subjects
+	}
+}
+
+// WithNatsBatchSize sets how many messages are pulled at once.
+func WithNatsBatchSize(n int) NatsOption {
+	return func(np *natsProvider) {
+		np.config.BatchSize = n
+	}
+}
+
+// WithNatsAckWait sets how long the server waits for an ack before
+// delivering a message again.
+func WithNatsAckWait(d time.Duration) NatsOption {
+	return func(np *natsProvider) {
+		np.config.AckWait = d
+	}
+}
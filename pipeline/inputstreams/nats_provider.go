@@ -0,0 +1,51 @@
+package inputstreams
+
+import (
+	"github.com/arquivei/goduck"
+	"github.com/arquivei/goduck/impl/implstream/natsjetstream"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type natsProvider struct {
+	js     jetstream.JetStream
+	config natsjetstream.Config
+	made   bool
+}
+
+// WithNatsProvider configures the input stream with a nats jetstream
+// provider. Only one stream can be created, see natsjetstream.New.
+func WithNatsProvider(js jetstream.JetStream, opts ...NatsOption) Option {
+	return func(o *options) error {
+		if js == nil {
+			return ErrNoNatsJetStream
+		}
+
+		provider := &natsProvider{js: js}
+		for _, opt := range opts {
+			opt(provider)
+		}
+		if provider.config.Stream == "" {
+			return ErrNoNatsStream
+		}
+		if provider.config.Consumer == "" {
+			return ErrNoNatsConsumer
+		}
+
+		o.provider = provider
+
+		return nil
+	}
+}
+
+func (p *natsProvider) MakeStream() (goduck.Stream, error) {
+	if p.made {
+		return nil, ErrNatsMultipleStreams
+	}
+
+	s, err := natsjetstream.New(p.js, p.config)
+	if err != nil {
+		return nil, err
+	}
+	p.made = true
+	return s, nil
+}
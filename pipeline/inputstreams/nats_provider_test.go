@@ -0,0 +1,94 @@
+package inputstreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestJetStream(t *testing.T) jetstream.JetStream {
+	s, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	require.True(t, s.ReadyForConnections(5*time.Second))
+
+	nc, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	return js
+}
+
+func TestWithNatsProvider(t *testing.T) {
+	js := newTestJetStream(t)
+
+	t.Run("Success", func(t *testing.T) {
+		o := options{}
+		err := WithNatsProvider(js,
+			WithNatsStream("my stream"),
+			WithNatsConsumer("my consumer"),
+			WithNatsFilterSubjects("my.subject"),
+			WithNatsBatchSize(10),
+			WithNatsAckWait(time.Minute),
+		)(&o)
+
+		require.NoError(t, err)
+		p := o.provider.(*natsProvider)
+		assert.Equal(t, "my stream", p.config.Stream)
+		assert.Equal(t, "my consumer", p.config.Consumer)
+		assert.Equal(t, []string{"my.subject"}, p.config.FilterSubjects)
+		assert.Equal(t, 10, p.config.BatchSize)
+		assert.Equal(t, time.Minute, p.config.AckWait)
+	})
+
+	t.Run("Error: No nats jetstream", func(t *testing.T) {
+		o := options{}
+		err := WithNatsProvider(nil, WithNatsStream("my stream"), WithNatsConsumer("my consumer"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoNatsJetStream.Error())
+	})
+
+	t.Run("Error: No nats stream", func(t *testing.T) {
+		o := options{}
+		err := WithNatsProvider(js, WithNatsConsumer("my consumer"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoNatsStream.Error())
+	})
+
+	t.Run("Error: No nats consumer", func(t *testing.T) {
+		o := options{}
+		err := WithNatsProvider(js, WithNatsStream("my stream"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoNatsConsumer.Error())
+	})
+}
+
+func TestNatsMakeStream(t *testing.T) {
+	js := newTestJetStream(t)
+	_, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events"}})
+	require.NoError(t, err)
+
+	p := &natsProvider{js: js}
+	WithNatsStream("EVENTS")(p)
+	WithNatsConsumer("worker")(p)
+
+	s, err := p.MakeStream()
+	require.NoError(t, err)
+	defer s.Close()
+
+	s2, err := p.MakeStream()
+	assert.Nil(t, s2)
+	assert.Equal(t, ErrNatsMultipleStreams, err)
+}
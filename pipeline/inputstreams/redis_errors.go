@@ -0,0 +1,14 @@
+package inputstreams
+
+import "errors"
+
+var (
+	// ErrNoRedisClient is returned when the redis client is nil.
+	ErrNoRedisClient = errors.New("no redis client provided")
+	// ErrEmptyRedisStream is returned when the provided stream is an empty string.
+	ErrEmptyRedisStream = errors.New("empty redis stream")
+	// ErrNoRedisStream is returned when the streams are not set.
+	ErrNoRedisStream = errors.New("no redis stream provided")
+	// ErrNoRedisGroup is returned when the consumer group is not set.
+	ErrNoRedisGroup = errors.New("no redis consumer group provided")
+)
@@ -0,0 +1,61 @@
+package inputstreams
+
+import "time"
+
+// RedisOption configures the redis provider.
+type RedisOption func(*redisProvider)
+
+// WithRedisStream sets the redis stream or streams.
+func WithRedisStream(streams ...string) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.Streams = streams
+	}
+}
+
+// WithRedisGroup sets the redis consumer group. It is created if it doesn't
+// exist.
+func WithRedisGroup(group string) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.Group = group
+	}
+}
+
+// WithRedisConsumer sets the name of the consumers in the group. The index
+// of each stream is appended to it, like "name-0", so the names are unique
+// and stable across restarts. By default, a random name is used.
+func WithRedisConsumer(name string) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.Consumer = name
+	}
+}
+
+// WithRedisField sets the entry field with the message bytes. By default,
+// all fields of the entry are encoded as a JSON object.
+func WithRedisField(field string) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.Field = field
+	}
+}
+
+// WithRedisStartID sets the ID the group starts after when it is created.
+// Defaults to "0", the beginning of the stream.
+func WithRedisStartID(id string) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.StartID = id
+	}
+}
+
+// WithRedisBatchSize sets how many entries are read at once.
+func WithRedisBatchSize(n int64) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.BatchSize = n
+	}
+}
+
+// WithRedisClaimMinIdle sets how long an entry must be pending before it is
+// claimed from a dead consumer.
+func WithRedisClaimMinIdle(d time.Duration) RedisOption {
+	return func(rp *redisProvider) {
+		rp.config.ClaimMinIdle = d
+	}
+}
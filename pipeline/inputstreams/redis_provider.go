@@ -0,0 +1,56 @@
+package inputstreams
+
+import (
+	"strconv"
+
+	"github.com/arquivei/goduck"
+	"github.com/arquivei/goduck/impl/implstream/redisstream"
+	"github.com/redis/go-redis/v9"
+)
+
+type redisProvider struct {
+	client redis.Cmdable
+	config redisstream.Config
+	// made is how many streams were made, used to name their consumers.
+	made int
+}
+
+// WithRedisProvider configures the input stream with a redis streams
+// provider. Each stream is a consumer of the same consumer group.
+func WithRedisProvider(client redis.Cmdable, opts ...RedisOption) Option {
+	return func(o *options) error {
+		if client == nil {
+			return ErrNoRedisClient
+		}
+
+		provider := &redisProvider{client: client}
+		for _, opt := range opts {
+			opt(provider)
+		}
+		if len(provider.config.Streams) == 0 {
+			return ErrNoRedisStream
+		}
+		for _, s := range provider.config.Streams {
+			if s == "" {
+				return ErrEmptyRedisStream
+			}
+		}
+		if provider.config.Group == "" {
+			return ErrNoRedisGroup
+		}
+
+		o.provider = provider
+
+		return nil
+	}
+}
+
+func (p *redisProvider) MakeStream() (goduck.Stream, error) {
+	config := p.config
+	if config.Consumer != "" {
+		config.Consumer += "-" + strconv.Itoa(p.made)
+	}
+	p.made++
+
+	return redisstream.New(p.client, config)
+}
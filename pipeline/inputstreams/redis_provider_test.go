@@ -0,0 +1,107 @@
+package inputstreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRedisProvider(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer client.Close()
+
+	t.Run("Success", func(t *testing.T) {
+		o := options{}
+		err := WithRedisProvider(client,
+			WithRedisStream("my stream"),
+			WithRedisGroup("my group"),
+			WithRedisConsumer("my consumer"),
+			WithRedisField("data"),
+			WithRedisStartID("$"),
+			WithRedisBatchSize(10),
+			WithRedisClaimMinIdle(time.Minute),
+		)(&o)
+
+		require.NoError(t, err)
+		p := o.provider.(*redisProvider)
+		assert.Equal(t, []string{"my stream"}, p.config.Streams)
+		assert.Equal(t, "my group", p.config.Group)
+		assert.Equal(t, "my consumer", p.config.Consumer)
+		assert.Equal(t, "data", p.config.Field)
+		assert.Equal(t, "$", p.config.StartID)
+		assert.Equal(t, int64(10), p.config.BatchSize)
+		assert.Equal(t, time.Minute, p.config.ClaimMinIdle)
+	})
+
+	t.Run("Error: No redis client", func(t *testing.T) {
+		o := options{}
+		err := WithRedisProvider(nil, WithRedisStream("my stream"), WithRedisGroup("my group"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoRedisClient.Error())
+	})
+
+	t.Run("Error: No redis stream", func(t *testing.T) {
+		o := options{}
+		err := WithRedisProvider(client, WithRedisGroup("my group"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoRedisStream.Error())
+	})
+
+	t.Run("Error: Empty redis stream", func(t *testing.T) {
+		o := options{}
+		err := WithRedisProvider(client, WithRedisStream(""), WithRedisGroup("my group"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrEmptyRedisStream.Error())
+	})
+
+	t.Run("Error: No redis group", func(t *testing.T) {
+		o := options{}
+		err := WithRedisProvider(client, WithRedisStream("my stream"))(&o)
+
+		assert.Nil(t, o.provider)
+		assert.EqualError(t, err, ErrNoRedisGroup.Error())
+	})
+}
+
+func TestRedisMakeStream(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer client.Close()
+
+	p := &redisProvider{client: client}
+	WithRedisStream("events")(p)
+	WithRedisGroup("group")(p)
+	WithRedisConsumer("worker")(p)
+	WithRedisBatchSize(1)(p)
+
+	for _, data := range []string{"a", "b"} {
+		err := client.XAdd(context.Background(), &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{"data": data}}).Err()
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		s, err := p.MakeStream()
+		require.NoError(t, err)
+		defer s.Close()
+
+		// Consumers are registered in the group when they read.
+		_, err = s.Next(context.Background())
+		require.NoError(t, err)
+	}
+
+	consumers, err := client.XInfoConsumers(context.Background(), "events", "group").Result()
+	require.NoError(t, err)
+
+	var names []string
+	for _, c := range consumers {
+		names = append(names, c.Name)
+	}
+	assert.ElementsMatch(t, []string{"worker-0", "worker-1"}, names)
+}
@@ -0,0 +1,23 @@
+package kafkasink
+
+import "errors"
+
+var (
+	// ErrUnknownMessageType is returned when the sink message received is
+	// not of the type SinkMessage.
+	ErrUnknownMessageType = errors.New("unknown message type: expected kafkasink.SinkMessage")
+
+	// ErrEmptyTopic is returned when the SinkMessage.Topic is empty.
+	ErrEmptyTopic = errors.New("topic is missing from the message")
+
+	// ErrMissingBrokers is returned when the sink is created without brokers.
+	ErrMissingBrokers = errors.New("missing kafka brokers")
+
+	// ErrFailedToProduce is returned when a message could not be enqueued
+	// in the producer.
+	ErrFailedToProduce = errors.New("failed to produce message")
+
+	// ErrDeliveryFailed is returned when kafka reports that a message could
+	// not be delivered.
+	ErrDeliveryFailed = errors.New("failed to deliver message")
+)
@@ -0,0 +1,65 @@
+package kafkasink
+
+import (
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Option configures the kafka sink created by New.
+type Option func(*config)
+
+type config struct {
+	configMap kafka.ConfigMap
+}
+
+// WithBrokers sets the kafka brokers.
+func WithBrokers(brokers ...string) Option {
+	return func(c *config) {
+		c.configMap["bootstrap.servers"] = strings.Join(brokers, ",")
+	}
+}
+
+// WithConfigMap configures the inner librdkafka producer.
+// All values in the provided ConfigMap are copied to the sink ConfigMap,
+// replacing existing keys.
+func WithConfigMap(cm kafka.ConfigMap) Option {
+	return func(c *config) {
+		for key, value := range cm {
+			c.configMap[key] = value
+		}
+	}
+}
+
+// WithConfigValue sets or replaces a single librdkafka configuration value.
+func WithConfigValue(name string, value kafka.ConfigValue) Option {
+	return func(c *config) {
+		c.configMap[name] = value
+	}
+}
+
+// WithSaslPlainAuthentication configures kafka sasl plain authentication.
+func WithSaslPlainAuthentication(username, password string) Option {
+	return func(c *config) {
+		c.configMap["security.protocol"] = "sasl_plaintext"
+		c.configMap["sasl.mechanisms"] = "PLAIN"
+		c.configMap["sasl.username"] = username
+		c.configMap["sasl.password"] = password
+	}
+}
+
+// WithSSLAuthentication configures kafka sasl plain authentication over SSL.
+func WithSSLAuthentication(username, password, certPath string) Option {
+	return func(c *config) {
+		c.configMap["security.protocol"] = "sasl_ssl"
+		c.configMap["sasl.mechanisms"] = "PLAIN"
+		c.configMap["sasl.username"] = username
+		c.configMap["sasl.password"] = password
+		c.configMap["ssl.ca.location"] = certPath
+	}
+}
+
+// WithoutIdempotence disables the idempotent producer that New enables by default.
+func WithoutIdempotence() Option {
+	return WithConfigValue("enable.idempotence", false)
+}
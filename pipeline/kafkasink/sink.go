@@ -2,6 +2,7 @@ package kafkasink
 
 import (
 	"context"
+	"time"
 
 	"github.com/arquivei/goduck/pipeline"
 
@@ -9,6 +10,10 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 )
 
+// flushTimeoutMs is how long the close function waits for pending
+// messages to be delivered before closing the producer.
+const flushTimeoutMs = 10000
+
 type kafkaPusher struct {
 	producer *kafka.Producer
 }
@@ -18,6 +23,29 @@ type SinkMessage struct {
 	Topic string
 	Key   []byte
 	Value []byte
+
+	// Headers are optional kafka headers added to the message.
+	Headers []kafka.Header
+	// Partition is the explicit partition the message is sent to. If nil,
+	// the producer partitioner chooses the partition.
+	Partition *int32
+	// Timestamp is the message timestamp. If zero, the producer sets it
+	// to the current time.
+	Timestamp time.Time
+	// OnDelivery is an optional callback called with the delivery report of
+	// this message. It is called before Store returns, even when the
+	// message failed to be delivered, couldn't be produced or ctx is done
+	// before its delivery report arrives. In that case the report Err is
+	// the produce error or ctx.Err().
+	OnDelivery func(DeliveryReport)
+}
+
+// DeliveryReport is the outcome of the delivery of a single SinkMessage.
+type DeliveryReport struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
 }
 
 // MustNew creates a new pipeline sink that saves messages to kafka
@@ -70,39 +98,226 @@ func MustNewWithAuth(brokers, username, password, certPath, securityProtocol str
 	return pusher, closeFn
 }
 
+// New creates a new pipeline sink that saves messages to kafka.
+//
+// The producer is configured with enable.idempotence=true, gzip compression
+// and the murmur2_random partitioner. Any of these can be changed with
+// WithConfigMap or WithConfigValue. The returned function flushes the pending
+// messages and closes the producer.
+func New(opts ...Option) (pipeline.Sink, func(), error) {
+	const op = errors.Op("kafkasink.New")
+
+	c := config{
+		configMap: kafka.ConfigMap{
+			"compression.codec":  "gzip",
+			"partitioner":        "murmur2_random",
+			"enable.idempotence": true,
+		},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if brokers, _ := c.configMap["bootstrap.servers"].(string); brokers == "" {
+		return nil, nil, errors.E(op, ErrMissingBrokers)
+	}
+
+	producer, err := kafka.NewProducer(&c.configMap)
+	if err != nil {
+		return nil, nil, errors.E(op, err)
+	}
+
+	closeFn := func() {
+		producer.Flush(flushTimeoutMs)
+		producer.Close()
+	}
+
+	return &kafkaPusher{producer: producer}, closeFn, nil
+}
+
+// Store sends all messages to kafka and waits for their delivery reports.
 func (p *kafkaPusher) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
 	const op = errors.Op("kafkasink.kafkaPusher.Store")
 
-	sdkMessages := make([]*kafka.Message, len(messages))
+	sinkMessages := make([]SinkMessage, len(messages))
 	for i, m := range messages {
-		message := m.(SinkMessage)
-		sdkMsg := &kafka.Message{
-			Key:   message.Key,
-			Value: message.Value,
-			TopicPartition: kafka.TopicPartition{
-				Topic:     &message.Topic,
-				Partition: kafka.PartitionAny,
-			},
+		message, ok := m.(SinkMessage)
+		if !ok {
+			return errors.E(op, ErrUnknownMessageType, errors.SeverityInput)
+		}
+		if message.Topic == "" {
+			return errors.E(op, ErrEmptyTopic, errors.SeverityInput)
 		}
-		sdkMessages[i] = sdkMsg
+		sinkMessages[i] = message
 	}
 
-	deliveryChan := make(chan kafka.Event, len(sdkMessages))
+	deliveryChan := make(chan kafka.Event, len(sinkMessages))
 
-	for _, msg := range sdkMessages {
-		err := p.producer.Produce(msg, deliveryChan)
+	var produceErr, produceCause error
+	produced := 0
+	for i, message := range sinkMessages {
+		err := p.producer.Produce(newKafkaMessage(message, i), deliveryChan)
 		if err != nil {
-			return errors.E(op, err, errors.SeverityRuntime)
+			produceCause = err
+			produceErr = errors.E(op, ErrFailedToProduce, severityFromKafkaError(err), errors.KV("cause", err), errors.KV("topic", message.Topic))
+			break
 		}
+		produced++
 	}
-	for i := 0; i < len(sdkMessages); i++ {
-		e := <-deliveryChan
-		m := e.(*kafka.Message)
 
-		if m.TopicPartition.Error != nil {
-			return errors.E(op, m.TopicPartition.Error, errors.SeverityRuntime)
-		}
+	// Even if the produce failed, we must wait for the messages already
+	// enqueued so their delivery callbacks are called.
+	deliveryErr := p.waitDeliveries(ctx, sinkMessages, produced, deliveryChan)
+
+	for _, message := range sinkMessages[produced:] {
+		notifyFailure(message, produceCause)
 	}
 
+	if produceErr != nil {
+		return produceErr
+	}
+	if deliveryErr != nil {
+		return errors.E(op, deliveryErr)
+	}
 	return nil
 }
+
+func (p *kafkaPusher) waitDeliveries(
+	ctx context.Context,
+	sinkMessages []SinkMessage,
+	produced int,
+	deliveryChan chan kafka.Event,
+) error {
+	const op = errors.Op("waitDeliveries")
+
+	reported := make([]bool, produced)
+	var firstErr error
+	for range produced {
+		var e kafka.Event
+		select {
+		case e = <-deliveryChan:
+		case <-ctx.Done():
+			// The reports that already arrived are delivered, the others
+			// get the ctx error. Later reports are dropped in the buffered
+			// channel.
+			drainDeliveries(sinkMessages, reported, deliveryChan)
+			for idx, ok := range reported {
+				if !ok {
+					notifyFailure(sinkMessages[idx], ctx.Err())
+				}
+			}
+			return errors.E(op, ctx.Err(), errors.SeverityRuntime)
+		}
+
+		m, ok := e.(*kafka.Message)
+		if !ok {
+			continue
+		}
+
+		report := newDeliveryReport(m)
+		if idx, ok := m.Opaque.(int); ok && idx < produced && !reported[idx] {
+			reported[idx] = true
+			if sinkMessages[idx].OnDelivery != nil {
+				sinkMessages[idx].OnDelivery(report)
+			}
+		}
+
+		if report.Err != nil && firstErr == nil {
+			firstErr = errors.E(
+				op,
+				ErrDeliveryFailed,
+				severityFromKafkaError(report.Err),
+				errors.KV("cause", report.Err),
+				errors.KV("topic", report.Topic),
+				errors.KV("partition", report.Partition),
+			)
+		}
+	}
+	return firstErr
+}
+
+// drainDeliveries calls the callbacks of the delivery reports already in
+// deliveryChan, without waiting for more.
+func drainDeliveries(sinkMessages []SinkMessage, reported []bool, deliveryChan chan kafka.Event) {
+	for {
+		select {
+		case e := <-deliveryChan:
+			m, ok := e.(*kafka.Message)
+			if !ok {
+				continue
+			}
+			idx, ok := m.Opaque.(int)
+			if !ok || idx >= len(reported) || reported[idx] {
+				continue
+			}
+			reported[idx] = true
+			if sinkMessages[idx].OnDelivery != nil {
+				sinkMessages[idx].OnDelivery(newDeliveryReport(m))
+			}
+		default:
+			return
+		}
+	}
+}
+
+// notifyFailure calls the message callback with a report of a message that
+// has no delivery report.
+func notifyFailure(message SinkMessage, err error) {
+	if message.OnDelivery == nil {
+		return
+	}
+	partition := kafka.PartitionAny
+	if message.Partition != nil {
+		partition = *message.Partition
+	}
+	message.OnDelivery(DeliveryReport{
+		Topic:     message.Topic,
+		Partition: partition,
+		Offset:    int64(kafka.OffsetInvalid),
+		Err:       err,
+	})
+}
+
+// newKafkaMessage converts the SinkMessage into a kafka.Message. The index of
+// the message is kept as the opaque value so the delivery report can be
+// matched back to the SinkMessage.
+func newKafkaMessage(message SinkMessage, index int) *kafka.Message {
+	partition := kafka.PartitionAny
+	if message.Partition != nil {
+		partition = *message.Partition
+	}
+
+	topic := message.Topic
+	return &kafka.Message{
+		Key:       message.Key,
+		Value:     message.Value,
+		Headers:   message.Headers,
+		Timestamp: message.Timestamp,
+		Opaque:    index,
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: partition,
+		},
+	}
+}
+
+func newDeliveryReport(m *kafka.Message) DeliveryReport {
+	report := DeliveryReport{
+		Partition: m.TopicPartition.Partition,
+		Offset:    int64(m.TopicPartition.Offset),
+		Err:       m.TopicPartition.Error,
+	}
+	if m.TopicPartition.Topic != nil {
+		report.Topic = *m.TopicPartition.Topic
+	}
+	return report
+}
+
+// severityFromKafkaError returns fatal for errors that require the producer
+// to be recreated, like idempotence violations, and runtime otherwise.
+func severityFromKafkaError(err error) errors.Severity {
+	if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.IsFatal() {
+		return errors.SeverityFatal
+	}
+	return errors.SeverityRuntime
+}
@@ -0,0 +1,146 @@
+package kafkasink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Error - missing brokers", func(t *testing.T) {
+		s, closeFn, err := New()
+		assert.Nil(t, s)
+		assert.Nil(t, closeFn)
+		assert.ErrorIs(t, err, ErrMissingBrokers)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		s, closeFn, err := New(
+			WithBrokers("localhost:9092"),
+			WithConfigValue("linger.ms", 5),
+		)
+		assert.NoError(t, err)
+		assert.NotNil(t, s)
+		assert.NotNil(t, closeFn)
+		// closeFn would wait for the unreachable broker, so the producer
+		// is closed directly.
+		s.(*kafkaPusher).producer.Close()
+	})
+}
+
+func TestOptions(t *testing.T) {
+	c := config{configMap: kafka.ConfigMap{}}
+
+	WithBrokers("b1", "b2")(&c)
+	WithConfigMap(kafka.ConfigMap{"acks": "all"})(&c)
+	WithSaslPlainAuthentication("user", "pass")(&c)
+	WithoutIdempotence()(&c)
+
+	assert.Equal(t, kafka.ConfigMap{
+		"bootstrap.servers":  "b1,b2",
+		"acks":               "all",
+		"security.protocol":  "sasl_plaintext",
+		"sasl.mechanisms":    "PLAIN",
+		"sasl.username":      "user",
+		"sasl.password":      "pass",
+		"enable.idempotence": false,
+	}, c.configMap)
+}
+
+func TestNewKafkaMessage(t *testing.T) {
+	partition := int32(3)
+	now := time.Now()
+
+	m := newKafkaMessage(SinkMessage{
+		Topic:     "topic",
+		Key:       []byte("key"),
+		Value:     []byte("value"),
+		Headers:   []kafka.Header{{Key: "h", Value: []byte("v")}},
+		Partition: &partition,
+		Timestamp: now,
+	}, 7)
+
+	assert.Equal(t, "topic", *m.TopicPartition.Topic)
+	assert.Equal(t, int32(3), m.TopicPartition.Partition)
+	assert.Equal(t, []byte("key"), m.Key)
+	assert.Equal(t, []byte("value"), m.Value)
+	assert.Equal(t, []kafka.Header{{Key: "h", Value: []byte("v")}}, m.Headers)
+	assert.Equal(t, now, m.Timestamp)
+	assert.Equal(t, 7, m.Opaque)
+
+	m = newKafkaMessage(SinkMessage{Topic: "topic"}, 0)
+	assert.Equal(t, kafka.PartitionAny, m.TopicPartition.Partition)
+}
+
+func TestStore(t *testing.T) {
+	s, _, err := New(
+		WithBrokers("localhost:1"),
+		WithoutIdempotence(),
+		WithConfigValue("message.timeout.ms", 100),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.(*kafkaPusher).producer.Close()
+
+	t.Run("Error - invalid message type", func(t *testing.T) {
+		err := s.Store(context.Background(), "bad msg type")
+		assert.ErrorIs(t, err, ErrUnknownMessageType)
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+	})
+
+	t.Run("Error - empty topic", func(t *testing.T) {
+		err := s.Store(context.Background(), SinkMessage{Value: []byte("v")})
+		assert.ErrorIs(t, err, ErrEmptyTopic)
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+	})
+
+	t.Run("Error - delivery failure calls the callback", func(t *testing.T) {
+		var report DeliveryReport
+		called := false
+
+		err := s.Store(context.Background(), SinkMessage{
+			Topic: "topic",
+			Value: []byte("v"),
+			OnDelivery: func(r DeliveryReport) {
+				called = true
+				report = r
+			},
+		})
+		assert.ErrorIs(t, err, ErrDeliveryFailed)
+		assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+		assert.True(t, called)
+		assert.Equal(t, "topic", report.Topic)
+		assert.Error(t, report.Err)
+	})
+}
+
+func TestWaitDeliveries_ContextDone(t *testing.T) {
+	var reports []DeliveryReport
+	onDelivery := func(r DeliveryReport) { reports = append(reports, r) }
+	messages := []SinkMessage{
+		{Topic: "a", OnDelivery: onDelivery},
+		{Topic: "b", OnDelivery: onDelivery},
+	}
+
+	// Only the report of the first message arrived.
+	deliveryChan := make(chan kafka.Event, len(messages))
+	delivered := newKafkaMessage(messages[0], 0)
+	delivered.TopicPartition.Partition = 1
+	delivered.TopicPartition.Offset = 10
+	deliveryChan <- delivered
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := (&kafkaPusher{}).waitDeliveries(ctx, messages, len(messages), deliveryChan)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []DeliveryReport{
+		{Topic: "a", Partition: 1, Offset: 10},
+		{Topic: "b", Partition: kafka.PartitionAny, Offset: int64(kafka.OffsetInvalid), Err: context.Canceled},
+	}, reports)
+}
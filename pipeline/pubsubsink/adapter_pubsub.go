@@ -10,18 +10,50 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// AdapterOption configures the publishers created by the client adapter.
+type AdapterOption func(*clientAdapter)
+
+// WithPublishSettings sets the batching, timeout and flow control settings
+// used by every topic publisher. The default is pubsub.DefaultPublishSettings.
+func WithPublishSettings(settings pubsub.PublishSettings) AdapterOption {
+	return func(c *clientAdapter) {
+		c.publishSettings = &settings
+	}
+}
+
+// WithMessageOrdering enables message ordering on every topic publisher.
+// This is required to publish messages with an OrderingKey.
+func WithMessageOrdering() AdapterOption {
+	return func(c *clientAdapter) {
+		c.enableMessageOrdering = true
+	}
+}
+
 type clientAdapter struct {
 	*pubsub.Client
+
+	publishSettings       *pubsub.PublishSettings
+	enableMessageOrdering bool
 }
 
 // NewPubsubClientAdapter creates a new PubsubClientGateway from a pubsub.Client
-func NewPubsubClientAdapter(client *pubsub.Client) PubsubClientGateway {
-	return clientAdapter{client}
+func NewPubsubClientAdapter(client *pubsub.Client, opts ...AdapterOption) PubsubClientGateway {
+	c := clientAdapter{Client: client}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
 }
 
 func (c clientAdapter) Topic(id string) topicGateway {
+	publisher := c.Client.Publisher(id)
+	if c.publishSettings != nil {
+		publisher.PublishSettings = *c.publishSettings
+	}
+	publisher.EnableMessageOrdering = c.enableMessageOrdering
+
 	return &topicAdapter{
-		publisher:   c.Client.Publisher(id),
+		publisher:   publisher,
 		adminClient: c.Client,
 		topicID:     fmt.Sprintf("projects/%s/topics/%s", c.Client.Project(), id),
 	}
@@ -57,6 +89,10 @@ func (t *topicAdapter) Exists(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
+func (t *topicAdapter) ResumePublish(orderingKey string) {
+	t.publisher.ResumePublish(orderingKey)
+}
+
 func (t *topicAdapter) Stop() {
 	t.publisher.Stop()
 }
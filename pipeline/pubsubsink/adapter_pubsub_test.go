@@ -0,0 +1,64 @@
+package pubsubsink
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub/v2"
+	pubsubpb "cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/v2/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestSinkWithPubsubFake(t *testing.T) {
+	ctx := context.Background()
+
+	srv := pstest.NewServer()
+	defer srv.Close()
+
+	conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client, err := pubsub.NewClient(ctx, "project", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+
+	_, err = client.TopicAdminClient.CreateTopic(ctx, &pubsubpb.Topic{
+		Name: "projects/project/topics/topic1",
+	})
+	require.NoError(t, err)
+
+	settings := pubsub.DefaultPublishSettings
+	settings.CountThreshold = 10
+
+	sink, closeFunc := MustNew(NewPubsubClientAdapter(
+		client,
+		WithPublishSettings(settings),
+		WithMessageOrdering(),
+	))
+
+	err = sink.Store(ctx,
+		SinkMessage{Topic: "topic1", Msg: []byte("message1"), OrderingKey: "key"},
+		SinkMessage{Topic: "topic1", Msg: []byte("message2"), Attributes: map[string]string{"a": "b"}},
+	)
+	assert.NoError(t, err)
+
+	err = sink.Store(ctx, SinkMessage{Topic: "missing", Msg: []byte("message3")})
+	assert.Error(t, err)
+
+	closeFunc()
+
+	messages := srv.Messages()
+	require.Len(t, messages, 2)
+
+	data := map[string]*pstest.Message{}
+	for _, m := range messages {
+		data[string(m.Data)] = m
+	}
+	assert.Equal(t, "key", data["message1"].OrderingKey)
+	assert.Equal(t, map[string]string{"a": "b"}, data["message2"].Attributes)
+}
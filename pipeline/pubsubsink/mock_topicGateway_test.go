@@ -106,6 +106,34 @@ func (_c *mockTopicGateway_Publish_Call) Return(_a0 publishResult) *mockTopicGat
 	return _c
 }
 
+// ResumePublish provides a mock function with given fields: orderingKey
+func (_m *mockTopicGateway) ResumePublish(orderingKey string) {
+	_m.Called(orderingKey)
+}
+
+// mockTopicGateway_ResumePublish_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ResumePublish'
+type mockTopicGateway_ResumePublish_Call struct {
+	*mock.Call
+}
+
+// ResumePublish is a helper method to define mock.On call
+//  - orderingKey string
+func (_e *mockTopicGateway_Expecter) ResumePublish(orderingKey interface{}) *mockTopicGateway_ResumePublish_Call {
+	return &mockTopicGateway_ResumePublish_Call{Call: _e.mock.On("ResumePublish", orderingKey)}
+}
+
+func (_c *mockTopicGateway_ResumePublish_Call) Run(run func(orderingKey string)) *mockTopicGateway_ResumePublish_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *mockTopicGateway_ResumePublish_Call) Return() *mockTopicGateway_ResumePublish_Call {
+	_c.Call.Return()
+	return _c
+}
+
 // Stop provides a mock function with given fields:
 func (_m *mockTopicGateway) Stop() {
 	_m.Called()
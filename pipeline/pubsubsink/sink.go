@@ -2,12 +2,17 @@ package pubsubsink
 
 import (
 	"context"
+	"sync"
 
 	"cloud.google.com/go/pubsub/v2"
 	"github.com/arquivei/foundationkit/errors"
 	"github.com/arquivei/goduck/pipeline"
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrSinkClosed is returned when Store is called after the sink is closed.
+var ErrSinkClosed = errors.New("sink is closed")
+
 // publishResult is the result of a Publish call for the TopicGateway.
 type publishResult interface {
 	Get(ctx context.Context) (string, error)
@@ -17,6 +22,10 @@ type publishResult interface {
 type topicGateway interface {
 	Publish(ctx context.Context, msg *pubsub.Message) publishResult
 	Exists(ctx context.Context) (bool, error)
+	// ResumePublish resumes accepting messages for the ordering key after
+	// a publish failure.
+	ResumePublish(orderingKey string)
+	// Stop flushes the pending messages and stops the topic publisher.
 	Stop()
 }
 
@@ -29,82 +38,161 @@ type PubsubClientGateway interface {
 // Sink is a pubsub sink
 type Sink struct {
 	pubsubClient PubsubClientGateway
+
+	// lookups checks the existence of each topic once, even when it is
+	// requested by concurrent Store calls.
+	lookups singleflight.Group
+
+	// topics caches the topics already checked for existence. They are
+	// kept open until the sink is closed so their publishers can batch
+	// messages across Store calls.
+	topicsMu sync.Mutex
+	topics   map[string]topicGateway
+	closed   bool
 }
 
 // SinkMessage is a message to be sent to a pubsub topic
 type SinkMessage struct {
 	Topic string
 	Msg   []byte
+
+	// Attributes are optional key-value pairs added to the message.
+	Attributes map[string]string
+	// OrderingKey is optional. Messages with the same ordering key are
+	// delivered in the order they were published. The client adapter must
+	// be created with WithMessageOrdering to use it.
+	OrderingKey string
 }
 
-// MustNew creates a new pubsub sink or panics if fails
+// MustNew creates a new pubsub sink or panics if fails.
+// The returned function flushes all pending messages, stops the cached
+// topics and closes the client.
 func MustNew(client PubsubClientGateway) (sink *Sink, closeFunc func()) {
 	op := errors.Op("pubsubsink.MustNew")
 	if client == nil {
 		panic(errors.E(op, "topic gateway is nil"))
 	}
 
-	closeFunc = func() {
-		client.Close()
+	sink = &Sink{
+		pubsubClient: client,
 	}
 
-	return &Sink{
-		pubsubClient: client,
-	}, closeFunc
+	return sink, sink.close
+}
+
+func (s *Sink) close() {
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+
+	s.closed = true
+	for _, topic := range s.topics {
+		topic.Stop()
+	}
+	s.topics = nil
+
+	s.pubsubClient.Close()
 }
 
-func (s *Sink) getTopic(ctx context.Context, topicID string) (topic topicGateway, closeFunc func(), err error) {
+// getTopic returns the cached topic, checking that it exists the first time
+// it is used. The lock is not held during the check, so other topics are not
+// blocked by it.
+func (s *Sink) getTopic(ctx context.Context, topicID string) (topicGateway, error) {
 	op := errors.Op("pubsubsink.sink.getTopic")
-	topic = s.pubsubClient.Topic(topicID)
-	ok, err := topic.Exists(ctx)
+
+	topic, err := s.cachedTopic(topicID)
+	if err != nil || topic != nil {
+		return topic, err
+	}
+
+	v, err, _ := s.lookups.Do(topicID, func() (interface{}, error) {
+		topic := s.pubsubClient.Topic(topicID)
+		ok, err := topic.Exists(ctx)
+		if err != nil {
+			return nil, errors.E(op, err, errors.SeverityRuntime)
+		}
+		if !ok {
+			return nil, errors.E(op, "topic does not exist", errors.KV("topic", topicID))
+		}
+
+		s.topicsMu.Lock()
+		defer s.topicsMu.Unlock()
+
+		// The sink may have been closed during the check.
+		if s.closed {
+			return nil, errors.E(op, ErrSinkClosed, errors.SeverityRuntime)
+		}
+		if s.topics == nil {
+			s.topics = make(map[string]topicGateway)
+		}
+		s.topics[topicID] = topic
+		return topic, nil
+	})
 	if err != nil {
-		return nil, nil, errors.E(op, err)
+		return nil, err
 	}
-	if !ok {
-		return nil, nil, errors.E(op, "topic does not exist", errors.KV("topic", topicID))
+	return v.(topicGateway), nil
+}
+
+// cachedTopic returns the topic if it was already checked, or nil.
+func (s *Sink) cachedTopic(topicID string) (topicGateway, error) {
+	op := errors.Op("pubsubsink.sink.cachedTopic")
+
+	s.topicsMu.Lock()
+	defer s.topicsMu.Unlock()
+
+	if s.closed {
+		return nil, errors.E(op, ErrSinkClosed, errors.SeverityRuntime)
 	}
-	return topic, topic.Stop, nil
+	return s.topics[topicID], nil
 }
 
-// Store stores messages in a pubsub topic. It returns an error if any of the messages return an error.
+// Store stores messages in a pubsub topic. All messages are published
+// concurrently and it returns an error if any of the messages return an error.
 func (s *Sink) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
 	op := errors.Op("pubsubsink.Sink.Store")
 
-	topicStorage := make(map[string]topicGateway)
-	closeTopics := []func(){}
-	defer func() {
-		for _, closeTopic := range closeTopics {
-			closeTopic()
-		}
-	}()
-
-	for _, msg := range messages {
+	sinkMsgs := make([]SinkMessage, len(messages))
+	topics := make([]topicGateway, len(messages))
+	for i, msg := range messages {
 		sinkMsg, ok := msg.(SinkMessage)
 		if !ok {
-			return errors.E(op, "invalid message type: expected pubsubsink.SinkMessage")
+			return errors.E(op, "invalid message type: expected pubsubsink.SinkMessage", errors.SeverityInput)
 		}
 		if sinkMsg.Topic == "" {
-			return errors.E(op, "topic is empty")
-		}
-
-		topic, ok := topicStorage[sinkMsg.Topic]
-		if !ok {
-			var closeFunc func()
-			var err error
-			topic, closeFunc, err = s.getTopic(ctx, sinkMsg.Topic)
-			if err != nil {
-				return errors.E(op, err)
-			}
-			topicStorage[sinkMsg.Topic] = topic
-			closeTopics = append(closeTopics, closeFunc)
+			return errors.E(op, "topic is empty", errors.SeverityInput)
 		}
 
-		_, err := topic.Publish(ctx, &pubsub.Message{
-			Data: sinkMsg.Msg,
-		}).Get(ctx)
+		topic, err := s.getTopic(ctx, sinkMsg.Topic)
 		if err != nil {
 			return errors.E(op, err)
 		}
+		sinkMsgs[i] = sinkMsg
+		topics[i] = topic
+	}
+
+	results := make([]publishResult, len(sinkMsgs))
+	for i, sinkMsg := range sinkMsgs {
+		results[i] = topics[i].Publish(ctx, &pubsub.Message{
+			Data:        sinkMsg.Msg,
+			Attributes:  sinkMsg.Attributes,
+			OrderingKey: sinkMsg.OrderingKey,
+		})
+	}
+
+	var errs []error
+	for i, result := range results {
+		if _, err := result.Get(ctx); err != nil {
+			errs = append(errs, err)
+			// The publisher pauses the ordering key after a failure. It must
+			// be resumed so the message can be published again on retry.
+			if key := sinkMsgs[i].OrderingKey; key != "" {
+				topics[i].ResumePublish(key)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.E(op, "failed to publish messages", errors.SeverityRuntime, errors.KV("errors", errs))
 	}
 	return nil
 }
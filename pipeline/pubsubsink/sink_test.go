@@ -3,6 +3,7 @@ package pubsubsink
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 
 	"cloud.google.com/go/pubsub/v2"
@@ -28,7 +29,6 @@ func TestSink_Store(t *testing.T) {
 				m.EXPECT().Topic("topic1").Return(topic1).Once()
 
 				topic1.EXPECT().Exists(context.Background()).Return(true, nil).Once()
-				topic1.EXPECT().Stop().Once()
 
 				result1 := newMockPublishResult(t)
 				topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
@@ -54,7 +54,6 @@ func TestSink_Store(t *testing.T) {
 				m.EXPECT().Topic("topic1").Return(topic1).Once()
 
 				topic1.EXPECT().Exists(context.Background()).Return(true, nil).Once()
-				topic1.EXPECT().Stop().Once()
 
 				result1 := newMockPublishResult(t)
 				topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
@@ -90,7 +89,6 @@ func TestSink_Store(t *testing.T) {
 				m.EXPECT().Topic("topic1").Return(topic1).Once()
 
 				topic1.EXPECT().Exists(context.Background()).Return(true, nil).Once()
-				topic1.EXPECT().Stop().Once()
 
 				result1 := newMockPublishResult(t)
 				topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
@@ -107,7 +105,6 @@ func TestSink_Store(t *testing.T) {
 				topic2 := newMockTopicGateway(t)
 				m.EXPECT().Topic("topic2").Return(topic2).Once()
 				topic2.EXPECT().Exists(context.Background()).Return(true, nil).Once()
-				topic2.EXPECT().Stop().Once()
 
 				result3 := newMockPublishResult(t)
 				topic2.EXPECT().Publish(context.Background(), &pubsub.Message{
@@ -190,7 +187,6 @@ func TestSink_Store(t *testing.T) {
 				m.EXPECT().Topic("topic1").Return(topic1).Once()
 
 				topic1.EXPECT().Exists(context.Background()).Return(true, nil).Once()
-				topic1.EXPECT().Stop().Once()
 
 				result1 := newMockPublishResult(t)
 				topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
@@ -292,3 +288,116 @@ func TestMustNew(t *testing.T) {
 		})
 	}
 }
+
+func TestSink_TopicCache(t *testing.T) {
+	gateway := NewMockPubsubClientGateway(t)
+	topic1 := newMockTopicGateway(t)
+	gateway.EXPECT().Topic("topic1").Return(topic1).Once()
+	topic1.EXPECT().Exists(context.Background()).Return(true, nil).Once()
+
+	result := newMockPublishResult(t)
+	topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
+		Data:       []byte("message1"),
+		Attributes: map[string]string{"key": "value"},
+	}).Return(result).Twice()
+	result.EXPECT().Get(context.Background()).Return("id", nil).Twice()
+
+	sink, closeFunc := MustNew(gateway)
+
+	msg := SinkMessage{
+		Topic:      "topic1",
+		Msg:        []byte("message1"),
+		Attributes: map[string]string{"key": "value"},
+	}
+	assert.NoError(t, sink.Store(context.Background(), msg))
+	assert.NoError(t, sink.Store(context.Background(), msg))
+
+	// Closing the sink flushes the cached topics before closing the client.
+	topic1.EXPECT().Stop().Once()
+	gateway.EXPECT().Close().Return(nil).Once()
+	closeFunc()
+}
+
+func TestSink_OrderingKeyFailure(t *testing.T) {
+	gateway := NewMockPubsubClientGateway(t)
+	topic1 := newMockTopicGateway(t)
+	gateway.EXPECT().Topic("topic1").Return(topic1).Once()
+	topic1.EXPECT().Exists(context.Background()).Return(true, nil).Once()
+
+	result1 := newMockPublishResult(t)
+	topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
+		Data:        []byte("message1"),
+		OrderingKey: "key1",
+	}).Return(result1).Once()
+	result1.EXPECT().Get(context.Background()).Return("", errors.New("error")).Once()
+
+	result2 := newMockPublishResult(t)
+	topic1.EXPECT().Publish(context.Background(), &pubsub.Message{
+		Data: []byte("message2"),
+	}).Return(result2).Once()
+	result2.EXPECT().Get(context.Background()).Return("id", nil).Once()
+
+	topic1.EXPECT().ResumePublish("key1").Once()
+
+	s := &Sink{pubsubClient: gateway}
+	err := s.Store(context.Background(),
+		SinkMessage{Topic: "topic1", Msg: []byte("message1"), OrderingKey: "key1"},
+		SinkMessage{Topic: "topic1", Msg: []byte("message2")},
+	)
+	assert.Error(t, err)
+}
+
+func TestSink_ConcurrentTopicLookup(t *testing.T) {
+	gateway := NewMockPubsubClientGateway(t)
+	topic1 := newMockTopicGateway(t)
+	topic2 := newMockTopicGateway(t)
+	gateway.EXPECT().Topic("topic1").Return(topic1).Once()
+	gateway.EXPECT().Topic("topic2").Return(topic2).Once()
+
+	// The existence of topic1 is checked once, while topic2 is used.
+	checking := make(chan struct{})
+	release := make(chan struct{})
+	topic1.EXPECT().Exists(context.Background()).Run(func(context.Context) {
+		close(checking)
+		<-release
+	}).Return(true, nil).Once()
+	topic2.EXPECT().Exists(context.Background()).Return(true, nil).Once()
+
+	result := newMockPublishResult(t)
+	result.EXPECT().Get(context.Background()).Return("id", nil)
+	topic1.EXPECT().Publish(context.Background(), &pubsub.Message{Data: []byte("message1")}).Return(result).Twice()
+	topic2.EXPECT().Publish(context.Background(), &pubsub.Message{Data: []byte("message2")}).Return(result).Once()
+
+	sink, closeFunc := MustNew(gateway)
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sink.Store(context.Background(), SinkMessage{Topic: "topic1", Msg: []byte("message1")}))
+		}()
+	}
+
+	<-checking
+	assert.NoError(t, sink.Store(context.Background(), SinkMessage{Topic: "topic2", Msg: []byte("message2")}))
+	close(release)
+	wg.Wait()
+
+	topic1.EXPECT().Stop().Once()
+	topic2.EXPECT().Stop().Once()
+	gateway.EXPECT().Close().Return(nil).Once()
+	closeFunc()
+}
+
+func TestSink_StoreAfterClose(t *testing.T) {
+	gateway := NewMockPubsubClientGateway(t)
+	gateway.EXPECT().Close().Return(nil).Once()
+
+	sink, closeFunc := MustNew(gateway)
+	closeFunc()
+
+	// The closed client is not used to create the topic again.
+	err := sink.Store(context.Background(), SinkMessage{Topic: "topic1", Msg: []byte("message1")})
+	assert.ErrorIs(t, err, ErrSinkClosed)
+}
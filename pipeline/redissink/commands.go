@@ -0,0 +1,224 @@
+package redissink
+
+import (
+	"context"
+	"encoding"
+	"net"
+	"time"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Command is a redis command written by the sink. It is implemented by
+// Set, HSet, Del, ZAdd, XAdd and Publish.
+//
+// Values are sent as they are accepted by go-redis: strings, []byte,
+// numbers, bools, time.Time, time.Duration, net.IP or values implementing
+// encoding.BinaryMarshaler. Nil values are rejected.
+type Command interface {
+	validate() error
+	queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder
+}
+
+// Set sets a key to a value.
+type Set struct {
+	Key   string
+	Value interface{}
+	// TTL is the key expiration. Zero means the key doesn't expire.
+	TTL time.Duration
+}
+
+// HSet sets fields of a hash.
+type HSet struct {
+	Key    string
+	Fields map[string]interface{}
+	// TTL is the key expiration, set with EXPIRE after the fields. Zero
+	// keeps the current expiration of the key.
+	TTL time.Duration
+}
+
+// Del deletes keys.
+type Del struct {
+	Keys []string
+}
+
+// ZMember is a member of a sorted set.
+type ZMember struct {
+	Score  float64
+	Member string
+}
+
+// ZAdd adds members to a sorted set, or updates their scores.
+type ZAdd struct {
+	Key     string
+	Members []ZMember
+	// TTL is the key expiration, set with EXPIRE after the members. Zero
+	// keeps the current expiration of the key.
+	TTL time.Duration
+}
+
+// XAdd appends an entry to a stream.
+type XAdd struct {
+	Stream string
+	// ID is the entry ID. If empty, redis generates it.
+	ID     string
+	Values map[string]interface{}
+	// MaxLen trims the stream to approximately this many entries. Zero
+	// disables trimming.
+	MaxLen int64
+}
+
+// Publish posts a message to a channel.
+type Publish struct {
+	Channel string
+	Message interface{}
+}
+
+func (c Set) validate() error {
+	const op = errors.Op("redissink.Set.validate")
+
+	if c.Key == "" {
+		return errors.E(op, ErrEmptyKey)
+	}
+	if err := checkValue(c.Value); err != nil {
+		return errors.E(op, err, errors.KV("key", c.Key))
+	}
+	return nil
+}
+
+func (c Set) queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	return []redis.Cmder{pipe.Set(ctx, c.Key, c.Value, c.TTL)}
+}
+
+func (c HSet) validate() error {
+	const op = errors.Op("redissink.HSet.validate")
+
+	if c.Key == "" {
+		return errors.E(op, ErrEmptyKey)
+	}
+	if len(c.Fields) == 0 {
+		return errors.E(op, ErrEmptyValues, errors.KV("key", c.Key))
+	}
+	for field, value := range c.Fields {
+		if err := checkValue(value); err != nil {
+			return errors.E(op, err, errors.KV("key", c.Key), errors.KV("field", field))
+		}
+	}
+	return nil
+}
+
+func (c HSet) queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	cmds := []redis.Cmder{pipe.HSet(ctx, c.Key, c.Fields)}
+	if c.TTL > 0 {
+		cmds = append(cmds, pipe.Expire(ctx, c.Key, c.TTL))
+	}
+	return cmds
+}
+
+func (c Del) validate() error {
+	const op = errors.Op("redissink.Del.validate")
+
+	if len(c.Keys) == 0 {
+		return errors.E(op, ErrEmptyValues)
+	}
+	for _, key := range c.Keys {
+		if key == "" {
+			return errors.E(op, ErrEmptyKey)
+		}
+	}
+	return nil
+}
+
+func (c Del) queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	return []redis.Cmder{pipe.Del(ctx, c.Keys...)}
+}
+
+func (c ZAdd) validate() error {
+	const op = errors.Op("redissink.ZAdd.validate")
+
+	if c.Key == "" {
+		return errors.E(op, ErrEmptyKey)
+	}
+	if len(c.Members) == 0 {
+		return errors.E(op, ErrEmptyValues, errors.KV("key", c.Key))
+	}
+	return nil
+}
+
+func (c ZAdd) queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	members := make([]redis.Z, len(c.Members))
+	for i, m := range c.Members {
+		members[i] = redis.Z{Score: m.Score, Member: m.Member}
+	}
+
+	cmds := []redis.Cmder{pipe.ZAdd(ctx, c.Key, members...)}
+	if c.TTL > 0 {
+		cmds = append(cmds, pipe.Expire(ctx, c.Key, c.TTL))
+	}
+	return cmds
+}
+
+func (c XAdd) validate() error {
+	const op = errors.Op("redissink.XAdd.validate")
+
+	if c.Stream == "" {
+		return errors.E(op, ErrEmptyKey)
+	}
+	if len(c.Values) == 0 {
+		return errors.E(op, ErrEmptyValues, errors.KV("stream", c.Stream))
+	}
+	for field, value := range c.Values {
+		if err := checkValue(value); err != nil {
+			return errors.E(op, err, errors.KV("stream", c.Stream), errors.KV("field", field))
+		}
+	}
+	return nil
+}
+
+func (c XAdd) queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	args := &redis.XAddArgs{
+		Stream: c.Stream,
+		ID:     c.ID,
+		Values: c.Values,
+	}
+	if c.MaxLen > 0 {
+		args.MaxLen = c.MaxLen
+		args.Approx = true
+	}
+	return []redis.Cmder{pipe.XAdd(ctx, args)}
+}
+
+func (c Publish) validate() error {
+	const op = errors.Op("redissink.Publish.validate")
+
+	if c.Channel == "" {
+		return errors.E(op, ErrEmptyKey)
+	}
+	if err := checkValue(c.Message); err != nil {
+		return errors.E(op, err, errors.KV("channel", c.Channel))
+	}
+	return nil
+}
+
+func (c Publish) queue(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	return []redis.Cmder{pipe.Publish(ctx, c.Channel, c.Message)}
+}
+
+// checkValue returns an error if go-redis can't write the value. Otherwise
+// the whole pipeline would fail when sent, as if redis was unavailable.
+func checkValue(value interface{}) error {
+	switch value.(type) {
+	case nil:
+		return ErrInvalidValue
+	case string, []byte,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64, bool,
+		time.Time, time.Duration, net.IP,
+		encoding.BinaryMarshaler:
+		return nil
+	default:
+		return ErrInvalidValue
+	}
+}
@@ -0,0 +1,27 @@
+package redissink
+
+import "errors"
+
+var (
+	// ErrUnknownMessageType is returned when the sink message received is
+	// not one of the commands of this package, like Set or HSet.
+	ErrUnknownMessageType = errors.New("unknown message type: expected a redissink command")
+
+	// ErrEmptyKey is returned when the key, stream or channel of a command
+	// is empty.
+	ErrEmptyKey = errors.New("key is missing from the command")
+
+	// ErrEmptyValues is returned when a command has nothing to write, like a
+	// HSet without fields or a Del without keys.
+	ErrEmptyValues = errors.New("values are missing from the command")
+
+	// ErrInvalidValue is returned when a value can't be sent to redis.
+	ErrInvalidValue = errors.New("value can't be sent to redis")
+
+	// ErrCommandFailed is returned for each command that failed.
+	ErrCommandFailed = errors.New("redis command failed")
+
+	// ErrStoreFailed is returned when any command failed. The errors of
+	// each command are in the "errors" key.
+	ErrStoreFailed = errors.New("failed to store messages")
+)
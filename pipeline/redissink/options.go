@@ -0,0 +1,15 @@
+package redissink
+
+// Option configures the redis sink.
+type Option func(*redisSink)
+
+// WithTransaction wraps the commands of each Store in MULTI/EXEC, so no
+// other client sees a partially applied batch. Redis doesn't roll back a
+// transaction, so if a command fails at runtime, like with a WRONGTYPE
+// error, the other commands are still applied. With a cluster client, all
+// keys of a Store must be in the same slot.
+func WithTransaction() Option {
+	return func(s *redisSink) {
+		s.transaction = true
+	}
+}
@@ -0,0 +1,155 @@
+package redissink
+
+import (
+	"context"
+	stderrors "errors"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/redis/go-redis/v9"
+)
+
+// transientErrorPrefixes are redis errors that may succeed if retried.
+var transientErrorPrefixes = []string{
+	"LOADING",
+	"READONLY",
+	"MASTERDOWN",
+	"TRYAGAIN",
+	"CLUSTERDOWN",
+	"BUSY",
+	"OOM",
+	"NOREPLICAS",
+}
+
+type redisSink struct {
+	client      redis.Cmdable
+	transaction bool
+}
+
+// MustNew returns a new Sink that writes commands to redis, like keeping a
+// cache warm. Messages must be one of the commands of this package, like
+// Set, HSet or XAdd.
+//
+// All commands of a Store are sent in a single pipeline, in order. If any
+// command fails, Store returns ErrStoreFailed with the errors of each failed
+// command in the "errors" key. Each of them has the index of its message in
+// the "index" key. Commands that succeeded are not undone, so commands
+// should be idempotent, because a retry sends the whole batch again.
+// XAdd without an ID and Publish are not.
+//
+// The error is an input error if all commands were rejected by redis, like
+// with a WRONGTYPE error, so the batch can go to a DLQ. Otherwise it is a
+// runtime error.
+func MustNew(client redis.Cmdable, options ...Option) pipeline.Sink {
+	if client == nil {
+		panic("redis client is nil")
+	}
+
+	s := &redisSink{client: client}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// Store sends all messages in a single pipeline.
+func (s *redisSink) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
+	const op = errors.Op("redissink.redisSink.Store")
+
+	commands, err := toCommands(messages)
+	if err != nil {
+		return errors.E(op, err, errors.SeverityInput)
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	var pipe redis.Pipeliner
+	if s.transaction {
+		pipe = s.client.TxPipeline()
+	} else {
+		pipe = s.client.Pipeline()
+	}
+
+	var cmds []redis.Cmder
+	// indexes are the message index of each command.
+	var indexes []int
+	for i, command := range commands {
+		for _, cmd := range command.queue(ctx, pipe) {
+			cmds = append(cmds, cmd)
+			indexes = append(indexes, i)
+		}
+	}
+
+	_, execErr := pipe.Exec(ctx)
+	if execErr == nil {
+		return nil
+	}
+
+	var errs []error
+	for i, cmd := range cmds {
+		err := cmd.Err()
+		if err == nil || err == redis.Nil {
+			continue
+		}
+		errs = append(errs, errors.E(op, ErrCommandFailed, severityOf(err),
+			errors.KV("cause", err),
+			errors.KV("index", indexes[i]),
+			errors.KV("command", cmd.Name()),
+		))
+	}
+	if len(errs) == 0 {
+		if execErr == redis.Nil {
+			return nil
+		}
+		// The pipeline failed without setting the error of any command.
+		errs = append(errs, errors.E(op, ErrCommandFailed, severityOf(execErr), errors.KV("cause", execErr)))
+	}
+
+	return errors.E(op, ErrStoreFailed, severityOfAll(errs), errors.KV("errors", errs))
+}
+
+func toCommands(messages []pipeline.SinkMessage) ([]Command, error) {
+	const op = errors.Op("redissink.toCommands")
+
+	commands := make([]Command, len(messages))
+	for i, m := range messages {
+		command, ok := m.(Command)
+		if !ok {
+			return nil, errors.E(op, ErrUnknownMessageType, errors.KV("index", i))
+		}
+		if err := command.validate(); err != nil {
+			return nil, errors.E(op, err, errors.KV("index", i))
+		}
+		commands[i] = command
+	}
+	return commands, nil
+}
+
+// severityOf returns input if redis rejected the command, like with a
+// WRONGTYPE error. Connection errors and transient redis errors are runtime
+// errors.
+func severityOf(err error) errors.Severity {
+	var redisErr redis.Error
+	if !stderrors.As(err, &redisErr) {
+		return errors.SeverityRuntime
+	}
+	for _, prefix := range transientErrorPrefixes {
+		if redis.HasErrorPrefix(err, prefix) {
+			return errors.SeverityRuntime
+		}
+	}
+	return errors.SeverityInput
+}
+
+// severityOfAll returns input if all errors are input errors, so the
+// messages can go to a DLQ. Otherwise the batch should be retried.
+func severityOfAll(errs []error) errors.Severity {
+	for _, err := range errs {
+		if errors.GetSeverity(err) != errors.SeverityInput {
+			return errors.SeverityRuntime
+		}
+	}
+	return errors.SeverityInput
+}
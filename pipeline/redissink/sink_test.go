@@ -0,0 +1,153 @@
+package redissink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+func TestStore(t *testing.T) {
+	for _, options := range [][]Option{nil, {WithTransaction()}} {
+		mr, client := newTestClient(t)
+		mr.Set("stale", "1")
+		ctx := context.Background()
+
+		sub := client.Subscribe(ctx, "updates")
+		defer sub.Close()
+		_, err := sub.Receive(ctx)
+		require.NoError(t, err)
+
+		sink := MustNew(client, options...)
+		err = sink.Store(ctx,
+			Set{Key: "user:1", Value: []byte(`{"name":"a"}`), TTL: time.Minute},
+			HSet{Key: "user:1:stats", Fields: map[string]interface{}{"logins": 3, "plan": "free"}, TTL: time.Hour},
+			Del{Keys: []string{"stale"}},
+			ZAdd{Key: "ranking", Members: []ZMember{{Score: 2, Member: "a"}, {Score: 1, Member: "b"}}},
+			XAdd{Stream: "events", ID: "1-1", Values: map[string]interface{}{"type": "login"}, MaxLen: 100},
+			Publish{Channel: "updates", Message: "user:1"},
+		)
+		require.NoError(t, err)
+
+		value, err := mr.Get("user:1")
+		require.NoError(t, err)
+		assert.Equal(t, `{"name":"a"}`, value)
+		assert.Equal(t, time.Minute, mr.TTL("user:1"))
+
+		assert.Equal(t, "3", mr.HGet("user:1:stats", "logins"))
+		assert.Equal(t, "free", mr.HGet("user:1:stats", "plan"))
+		assert.Equal(t, time.Hour, mr.TTL("user:1:stats"))
+
+		assert.False(t, mr.Exists("stale"))
+
+		members, err := mr.ZMembers("ranking")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a"}, members)
+
+		entries, err := mr.Stream("events")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "1-1", entries[0].ID)
+		assert.Equal(t, []string{"type", "login"}, entries[0].Values)
+
+		msg, err := sub.ReceiveMessage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "user:1", msg.Payload)
+	}
+}
+
+func TestStore_CommandErrors(t *testing.T) {
+	mr, client := newTestClient(t)
+	mr.Set("string", "1")
+
+	sink := MustNew(client)
+	err := sink.Store(context.Background(),
+		Set{Key: "a", Value: "1"},
+		HSet{Key: "string", Fields: map[string]interface{}{"f": "v"}},
+		Set{Key: "b", Value: "2"},
+	)
+
+	assert.ErrorIs(t, err, ErrStoreFailed)
+	assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+
+	errs := getKV(err, "errors").([]error)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrCommandFailed)
+	assert.Equal(t, 1, getKV(errs[0], "index"))
+	assert.Equal(t, "hset", getKV(errs[0], "command"))
+
+	// The other commands of the pipeline are applied.
+	assert.True(t, mr.Exists("a"))
+	assert.True(t, mr.Exists("b"))
+}
+
+func TestStore_ConnectionError(t *testing.T) {
+	mr, client := newTestClient(t)
+	mr.Close()
+
+	sink := MustNew(client, WithTransaction())
+	err := sink.Store(context.Background(), Set{Key: "a", Value: "1"})
+
+	assert.ErrorIs(t, err, ErrStoreFailed)
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+}
+
+func TestStore_InvalidMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     pipeline.SinkMessage
+		expectedErr error
+	}{
+		{name: "Unknown type", message: "SET a 1", expectedErr: ErrUnknownMessageType},
+		{name: "Empty key", message: Set{Value: "1"}, expectedErr: ErrEmptyKey},
+		{name: "Nil value", message: Set{Key: "b"}, expectedErr: ErrInvalidValue},
+		{name: "Invalid value", message: HSet{Key: "b", Fields: map[string]interface{}{"f": struct{}{}}}, expectedErr: ErrInvalidValue},
+		{name: "Empty fields", message: HSet{Key: "b"}, expectedErr: ErrEmptyValues},
+		{name: "Empty keys", message: Del{}, expectedErr: ErrEmptyValues},
+		{name: "Empty members", message: ZAdd{Key: "b"}, expectedErr: ErrEmptyValues},
+		{name: "Empty stream", message: XAdd{Values: map[string]interface{}{"f": "v"}}, expectedErr: ErrEmptyKey},
+		{name: "Empty channel", message: Publish{Message: "m"}, expectedErr: ErrEmptyKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr, client := newTestClient(t)
+
+			sink := MustNew(client)
+			err := sink.Store(context.Background(), Set{Key: "a", Value: "1"}, test.message)
+
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+			assert.False(t, mr.Exists("a"), "no command should be sent")
+		})
+	}
+}
+
+// getKV returns the value of the key in the first error of the chain with it.
+func getKV(err error, key string) interface{} {
+	for {
+		e, ok := err.(errors.Error)
+		if !ok {
+			return nil
+		}
+		for _, kv := range e.KVs {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+		err = e.Err
+	}
+}
@@ -0,0 +1,22 @@
+package routersink
+
+import "errors"
+
+var (
+	// ErrNoRoutes is returned when the sink is created without any route.
+	ErrNoRoutes = errors.New("no routes configured")
+
+	// ErrNilSink is returned when a route is configured with a nil sink.
+	ErrNilSink = errors.New("route sink is nil")
+
+	// ErrNilPredicate is returned when a predicate route is configured with a nil predicate.
+	ErrNilPredicate = errors.New("route predicate is nil")
+
+	// ErrNoRoute is returned when a message doesn't match any route and
+	// there is no default sink.
+	ErrNoRoute = errors.New("no route for message")
+
+	// ErrChildSinkFailed is returned when one or more child sinks failed to
+	// store their messages.
+	ErrChildSinkFailed = errors.New("one or more child sinks failed")
+)
@@ -0,0 +1,81 @@
+package routersink
+
+import (
+	"reflect"
+
+	"github.com/arquivei/goduck/pipeline"
+)
+
+// FailurePolicy defines how the router behaves when some of the child sinks
+// fail while others succeed.
+type FailurePolicy int
+
+const (
+	// FailurePolicyWaitAll waits for all child sinks to finish and returns an
+	// error containing all failures. This is the default policy. Because the
+	// whole batch is retried by the engine, child sinks must be idempotent.
+	FailurePolicyWaitAll FailurePolicy = iota
+	// FailurePolicyFailFast cancels the context passed to the remaining child
+	// sinks as soon as one of them fails.
+	FailurePolicyFailFast
+	// FailurePolicyBestEffort logs the failures of the child sinks and
+	// returns success. Use it only when losing messages is acceptable.
+	FailurePolicyBestEffort
+)
+
+// Option configures the router sink.
+type Option func(*routerSink)
+
+// WithTypeRoute sends all messages with the concrete type T to the given sink.
+// For example:
+//
+//	routersink.WithTypeRoute[kafkasink.SinkMessage](kafkaSink)
+func WithTypeRoute[T pipeline.SinkMessage](sink pipeline.Sink) Option {
+	t := reflect.TypeFor[T]()
+	return WithPredicateRoute(func(m pipeline.SinkMessage) bool {
+		return reflect.TypeOf(m) == t
+	}, sink)
+}
+
+// WithPredicateRoute sends all messages for which match returns true to the given sink.
+func WithPredicateRoute(match func(pipeline.SinkMessage) bool, sink pipeline.Sink) Option {
+	return func(rs *routerSink) {
+		rs.routes = append(rs.routes, route{
+			match: match,
+			sink:  sink,
+		})
+	}
+}
+
+// WithDefaultSink sets the sink that receives messages that don't match any route.
+// The default behavior is to return an error for unrouted messages.
+func WithDefaultSink(sink pipeline.Sink) Option {
+	return func(rs *routerSink) {
+		rs.defaultSink = sink
+	}
+}
+
+// WithIgnoreUnroutedMessages will make the router drop messages that don't
+// match any route instead of returning an error.
+func WithIgnoreUnroutedMessages() Option {
+	return func(rs *routerSink) {
+		rs.shouldIgnoreUnrouted = true
+	}
+}
+
+// WithFanOut makes the router send each message to every matching route.
+// The default behavior is to send the message only to the first matching
+// route, in the order they were configured.
+func WithFanOut() Option {
+	return func(rs *routerSink) {
+		rs.fanOut = true
+	}
+}
+
+// WithFailurePolicy sets how partial failures across child sinks are handled.
+// Defaults to FailurePolicyWaitAll.
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(rs *routerSink) {
+		rs.failurePolicy = p
+	}
+}
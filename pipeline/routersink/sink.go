@@ -0,0 +1,187 @@
+package routersink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
+)
+
+type route struct {
+	match func(pipeline.SinkMessage) bool
+	sink  pipeline.Sink
+}
+
+type routerSink struct {
+	routes      []route
+	defaultSink pipeline.Sink
+
+	fanOut               bool
+	shouldIgnoreUnrouted bool
+	failurePolicy        FailurePolicy
+}
+
+// New returns a sink that dispatches each message to one or more child sinks,
+// either by the message concrete type or by a predicate. Child sinks are
+// called in parallel, each one receiving its messages in the same order they
+// were given to Store.
+func New(options ...Option) (pipeline.Sink, error) {
+	const op = errors.Op("routersink.New")
+
+	rs := &routerSink{}
+	for _, opt := range options {
+		opt(rs)
+	}
+
+	if len(rs.routes) == 0 {
+		return nil, errors.E(op, ErrNoRoutes)
+	}
+	for _, r := range rs.routes {
+		if r.match == nil {
+			return nil, errors.E(op, ErrNilPredicate)
+		}
+		if r.sink == nil {
+			return nil, errors.E(op, ErrNilSink)
+		}
+	}
+
+	return rs, nil
+}
+
+// MustNew calls New but panics in case of error.
+func MustNew(options ...Option) pipeline.Sink {
+	s, err := New(options...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Store groups the messages by route and sends each group to its child sink.
+// How failures are reported depends on the configured FailurePolicy.
+func (r *routerSink) Store(ctx context.Context, input ...pipeline.SinkMessage) error {
+	const op = errors.Op("routersink.routerSink.Store")
+
+	if len(input) == 0 {
+		return nil
+	}
+
+	// The last position holds the messages for the default sink.
+	batches := make([][]pipeline.SinkMessage, len(r.routes)+1)
+	for _, message := range input {
+		if r.route(message, batches) {
+			continue
+		}
+		if r.defaultSink != nil {
+			batches[len(r.routes)] = append(batches[len(r.routes)], message)
+			continue
+		}
+		if r.shouldIgnoreUnrouted {
+			log.Ctx(ctx).Warn().
+				Str("message_type", fmt.Sprintf("%T", message)).
+				Msg("[goduck][pipeline][routerSink] Ignoring unrouted message.")
+			continue
+		}
+		return errors.E(op, ErrNoRoute, errors.SeverityInput, errors.KV("type", fmt.Sprintf("%T", message)))
+	}
+
+	errs := r.dispatch(ctx, batches)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if r.failurePolicy == FailurePolicyBestEffort {
+		for _, err := range errs {
+			log.Ctx(ctx).Warn().Err(err).Msg("[goduck][pipeline][routerSink] Ignoring child sink failure.")
+		}
+		return nil
+	}
+
+	return errors.E(op, ErrChildSinkFailed, mergeSeverities(errs), errors.KV("errors", errs))
+}
+
+// route appends the message to the batches of the matching routes and
+// reports whether any route matched.
+func (r *routerSink) route(message pipeline.SinkMessage, batches [][]pipeline.SinkMessage) bool {
+	routed := false
+	for i, rt := range r.routes {
+		if !rt.match(message) {
+			continue
+		}
+		batches[i] = append(batches[i], message)
+		routed = true
+		if !r.fanOut {
+			break
+		}
+	}
+	return routed
+}
+
+func (r *routerSink) sinkAt(i int) pipeline.Sink {
+	if i == len(r.routes) {
+		return r.defaultSink
+	}
+	return r.routes[i].sink
+}
+
+// dispatch calls all child sinks in parallel and returns their errors.
+func (r *routerSink) dispatch(ctx context.Context, batches [][]pipeline.SinkMessage) []error {
+	g := &errgroup.Group{}
+	storeCtx := ctx
+	if r.failurePolicy == FailurePolicyFailFast {
+		g, storeCtx = errgroup.WithContext(ctx)
+	}
+
+	results := make([]error, len(batches))
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		sink := r.sinkAt(i)
+		g.Go(func() error {
+			var err error
+			panicErr := errors.DontPanic(func() {
+				err = sink.Store(storeCtx, batch...)
+			})
+			if panicErr != nil {
+				err = panicErr
+			}
+			results[i] = err
+			return err
+		})
+	}
+	_ = g.Wait()
+
+	var errs []error
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// mergeSeverities returns the severity that best describes a set of child
+// errors. Fatal errors take precedence so the engine stops, then runtime
+// errors so the batch is retried. Input is returned only if all errors are
+// input errors.
+func mergeSeverities(errs []error) errors.Severity {
+	severity := errors.SeverityInput
+	for _, err := range errs {
+		switch errors.GetSeverity(err) {
+		case errors.SeverityFatal:
+			return errors.SeverityFatal
+		case errors.SeverityInput:
+		case errors.SeverityRuntime:
+			severity = errors.SeverityRuntime
+		default:
+			if severity == errors.SeverityInput {
+				severity = errors.SeverityUnset
+			}
+		}
+	}
+	return severity
+}
@@ -0,0 +1,195 @@
+package routersink
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+type messageA struct{ ID string }
+type messageB struct{ ID string }
+
+type fakeSink struct {
+	mu       sync.Mutex
+	messages []pipeline.SinkMessage
+	err      error
+	block    bool
+}
+
+func (s *fakeSink) Store(ctx context.Context, input ...pipeline.SinkMessage) error {
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, input...)
+	return s.err
+}
+
+func TestNew(t *testing.T) {
+	_, err := New()
+	assert.ErrorIs(t, err, ErrNoRoutes)
+
+	_, err = New(WithTypeRoute[messageA](nil))
+	assert.ErrorIs(t, err, ErrNilSink)
+
+	_, err = New(WithPredicateRoute(nil, &fakeSink{}))
+	assert.ErrorIs(t, err, ErrNilPredicate)
+
+	assert.Panics(t, func() { MustNew() })
+	assert.NotPanics(t, func() { MustNew(WithTypeRoute[messageA](&fakeSink{})) })
+}
+
+func TestStore_Routing(t *testing.T) {
+	t.Run("Success - by type, preserving order", func(t *testing.T) {
+		a, b := &fakeSink{}, &fakeSink{}
+		s := MustNew(
+			WithTypeRoute[messageA](a),
+			WithTypeRoute[messageB](b),
+		)
+
+		err := s.Store(context.Background(),
+			messageA{"1"}, messageB{"2"}, messageA{"3"},
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.SinkMessage{messageA{"1"}, messageA{"3"}}, a.messages)
+		assert.Equal(t, []pipeline.SinkMessage{messageB{"2"}}, b.messages)
+	})
+
+	t.Run("Success - by predicate, first match only", func(t *testing.T) {
+		even, all := &fakeSink{}, &fakeSink{}
+		s := MustNew(
+			WithPredicateRoute(func(m pipeline.SinkMessage) bool {
+				return m.(int)%2 == 0
+			}, even),
+			WithPredicateRoute(func(pipeline.SinkMessage) bool { return true }, all),
+		)
+
+		err := s.Store(context.Background(), 1, 2, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.SinkMessage{2}, even.messages)
+		assert.Equal(t, []pipeline.SinkMessage{1, 3}, all.messages)
+	})
+
+	t.Run("Success - fan out", func(t *testing.T) {
+		even, all := &fakeSink{}, &fakeSink{}
+		s := MustNew(
+			WithFanOut(),
+			WithPredicateRoute(func(m pipeline.SinkMessage) bool {
+				return m.(int)%2 == 0
+			}, even),
+			WithPredicateRoute(func(pipeline.SinkMessage) bool { return true }, all),
+		)
+
+		err := s.Store(context.Background(), 1, 2, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.SinkMessage{2}, even.messages)
+		assert.Equal(t, []pipeline.SinkMessage{1, 2, 3}, all.messages)
+	})
+
+	t.Run("Success - default sink", func(t *testing.T) {
+		a, d := &fakeSink{}, &fakeSink{}
+		s := MustNew(
+			WithTypeRoute[messageA](a),
+			WithDefaultSink(d),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.SinkMessage{messageA{"1"}}, a.messages)
+		assert.Equal(t, []pipeline.SinkMessage{messageB{"2"}}, d.messages)
+	})
+
+	t.Run("Success - ignore unrouted", func(t *testing.T) {
+		a := &fakeSink{}
+		s := MustNew(
+			WithTypeRoute[messageA](a),
+			WithIgnoreUnroutedMessages(),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.SinkMessage{messageA{"1"}}, a.messages)
+	})
+
+	t.Run("Error - unrouted", func(t *testing.T) {
+		a := &fakeSink{}
+		s := MustNew(WithTypeRoute[messageA](a))
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.ErrorIs(t, err, ErrNoRoute)
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+		assert.Empty(t, a.messages)
+	})
+}
+
+func TestStore_FailurePolicy(t *testing.T) {
+	runtimeErr := errors.E("runtime", errors.SeverityRuntime)
+	inputErr := errors.E("input", errors.SeverityInput)
+
+	t.Run("WaitAll - all children are called", func(t *testing.T) {
+		a := &fakeSink{err: runtimeErr}
+		b := &fakeSink{}
+		s := MustNew(
+			WithTypeRoute[messageA](a),
+			WithTypeRoute[messageB](b),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.ErrorIs(t, err, ErrChildSinkFailed)
+		assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+		assert.Len(t, b.messages, 1)
+	})
+
+	t.Run("WaitAll - input only errors", func(t *testing.T) {
+		s := MustNew(
+			WithTypeRoute[messageA](&fakeSink{err: inputErr}),
+			WithTypeRoute[messageB](&fakeSink{err: inputErr}),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+	})
+
+	t.Run("FailFast - siblings are canceled", func(t *testing.T) {
+		s := MustNew(
+			WithFailurePolicy(FailurePolicyFailFast),
+			WithTypeRoute[messageA](&fakeSink{err: runtimeErr}),
+			WithTypeRoute[messageB](&fakeSink{block: true}),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.ErrorIs(t, err, ErrChildSinkFailed)
+	})
+
+	t.Run("BestEffort - errors are ignored", func(t *testing.T) {
+		s := MustNew(
+			WithFailurePolicy(FailurePolicyBestEffort),
+			WithTypeRoute[messageA](&fakeSink{err: runtimeErr}),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Panic - converted to fatal error", func(t *testing.T) {
+		s := MustNew(
+			WithTypeRoute[messageA](panicSink{}),
+			WithTypeRoute[messageB](&fakeSink{err: runtimeErr}),
+		)
+
+		err := s.Store(context.Background(), messageA{"1"}, messageB{"2"})
+		assert.Equal(t, errors.SeverityFatal, errors.GetSeverity(err))
+	})
+}
+
+type panicSink struct{}
+
+func (panicSink) Store(context.Context, ...pipeline.SinkMessage) error {
+	panic("boom")
+}
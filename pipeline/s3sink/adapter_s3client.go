@@ -0,0 +1,129 @@
+package s3sink
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"net/http"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// s3ClientGateway implements S3ClientGateway with the AWS SDK client.
+type s3ClientGateway struct {
+	client *s3.Client
+}
+
+// NewS3Gateway creates a new S3ClientGateway. To use MinIO or other S3
+// compatible storages, configure the client BaseEndpoint and UsePathStyle.
+func NewS3Gateway(client *s3.Client) S3ClientGateway {
+	return &s3ClientGateway{
+		client: client,
+	}
+}
+
+// PutObject uploads the object in a single request.
+func (g s3ClientGateway) PutObject(ctx context.Context, object Object, data []byte) error {
+	_, err := g.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:          aws.String(object.Bucket),
+		Key:             aws.String(object.Key),
+		Body:            bytes.NewReader(data),
+		ContentLength:   aws.Int64(int64(len(data))),
+		ContentType:     aws.String(object.ContentType),
+		ContentEncoding: optionalString(object.ContentEncoding),
+		Metadata:        object.Metadata,
+	})
+	return withSeverity(err)
+}
+
+// CreateMultipartUpload starts a multipart upload and returns its ID.
+func (g s3ClientGateway) CreateMultipartUpload(ctx context.Context, object Object) (string, error) {
+	output, err := g.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:          aws.String(object.Bucket),
+		Key:             aws.String(object.Key),
+		ContentType:     aws.String(object.ContentType),
+		ContentEncoding: optionalString(object.ContentEncoding),
+		Metadata:        object.Metadata,
+	})
+	if err != nil {
+		return "", withSeverity(err)
+	}
+	return aws.ToString(output.UploadId), nil
+}
+
+// UploadPart uploads a part of a multipart upload and returns its ETag.
+func (g s3ClientGateway) UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte) (string, error) {
+	output, err := g.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return "", withSeverity(err)
+	}
+	return aws.ToString(output.ETag), nil
+}
+
+// CompleteMultipartUpload creates the object from the uploaded parts.
+func (g s3ClientGateway) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) error {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	_, err := g.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return withSeverity(err)
+}
+
+// AbortMultipartUpload discards the uploaded parts.
+func (g s3ClientGateway) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	_, err := g.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return withSeverity(err)
+}
+
+// withSeverity classifies the client errors. Client errors, like an
+// invalid key or a missing bucket, are input errors, except for throttling,
+// timeouts and permission errors, which may go away.
+func withSeverity(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var responseErr *smithyhttp.ResponseError
+	if stderrors.As(err, &responseErr) {
+		status := responseErr.HTTPStatusCode()
+		if status >= 400 && status < 500 &&
+			status != http.StatusForbidden &&
+			status != http.StatusRequestTimeout &&
+			status != http.StatusTooManyRequests {
+			return errors.E(err, errors.SeverityInput)
+		}
+	}
+	return errors.E(err, errors.SeverityRuntime)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,61 @@
+package s3sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3Gateway(t *testing.T) {
+	backend := s3mem.New()
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	ctx := context.Background()
+	_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	require.NoError(t, err)
+
+	sink := MustNewParallel(NewS3Gateway(client), "application/json", WithPartSize(minPartSize))
+
+	large := bytes.Repeat([]byte("a"), minPartSize+10)
+	err = sink.Store(ctx,
+		SinkMessage{Bucket: "bucket", Key: "dir/small.json", Data: []byte(`{"a":1}`), Metadata: map[string]string{"origin": "test"}},
+		SinkMessage{Bucket: "bucket", Key: "dir/large.json", Data: large},
+	)
+	require.NoError(t, err)
+
+	small, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/small.json")})
+	require.NoError(t, err)
+	body, err := io.ReadAll(small.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(body))
+	assert.Equal(t, "application/json", aws.ToString(small.ContentType))
+	assert.Equal(t, "test", small.Metadata["origin"])
+
+	largeObject, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/large.json")})
+	require.NoError(t, err)
+	body, err = io.ReadAll(largeObject.Body)
+	require.NoError(t, err)
+	assert.Equal(t, large, body)
+
+	err = sink.Store(ctx, SinkMessage{Bucket: "missing", Key: "key", Data: []byte("{}")})
+	assert.ErrorIs(t, err, ErrFailedToStoreMessages)
+	assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+}
@@ -0,0 +1,25 @@
+package s3sink
+
+import "github.com/arquivei/foundationkit/errors"
+
+var (
+	// CodeWrongTypeSinkMessage is returned when sink message is not a s3sink.SinkMessage
+	CodeWrongTypeSinkMessage = errors.Code("WRONG_TYPE_SINK_MESSAGE")
+	// CodeEmptyDataSinkMessage is returned when sink message data is empty
+	CodeEmptyDataSinkMessage = errors.Code("EMPTY_DATA_MESSAGE")
+	// CodeEmptyLocationSinkMessage is returned when sink message bucket or key is empty
+	CodeEmptyLocationSinkMessage = errors.Code("EMPTY_LOCATION_MESSAGE")
+	// CodeFailedToPutObject is returned when a error occurs while uploading an object in a single request
+	CodeFailedToPutObject = errors.Code("FAILED_TO_PUT_OBJECT")
+	// CodeFailedToUploadPart is returned when a error occurs while starting, uploading or completing a multipart upload
+	CodeFailedToUploadPart = errors.Code("FAILED_TO_UPLOAD_PART")
+	// CodePanic is returned when a panic occurs
+	CodePanic = errors.Code("PANIC_TO_WRITE_AT_BUCKET")
+
+	// ErrFailedToStoreMessages is returned when any message fails to be stored
+	ErrFailedToStoreMessages = errors.New("failed to store messages")
+	// ErrInvalidSinkMessage is returned when sink message is invalid
+	ErrInvalidSinkMessage = errors.New("invalid sink message")
+	// ErrPanic is returned when a panic occurs
+	ErrPanic = errors.New("panic occurred while storing to s3")
+)
@@ -0,0 +1,21 @@
+package s3sink
+
+// Option configures the s3 sink.
+type Option func(*s3ParallelWriter)
+
+// WithPartSize sets the size of the parts of multipart uploads. Objects
+// larger than it are uploaded in parts. The default is 8 MiB and it can't be
+// less than 5 MiB, the minimum part size of S3.
+func WithPartSize(size int) Option {
+	return func(w *s3ParallelWriter) {
+		w.partSize = size
+	}
+}
+
+// WithMaxConcurrentUploads limits how many objects, or parts of the same
+// object, are uploaded at the same time. The default is 16.
+func WithMaxConcurrentUploads(n int) Option {
+	return func(w *s3ParallelWriter) {
+		w.maxConcurrentUploads = n
+	}
+}
@@ -0,0 +1,254 @@
+package s3sink
+
+import (
+	"context"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// minPartSize is the minimum size of all but the last part of a
+	// multipart upload.
+	minPartSize          = 5 << 20
+	defaultPartSize      = 8 << 20
+	defaultMaxConcurrent = 16
+)
+
+// S3ClientGateway represents a gateway to a S3 compatible client.
+type S3ClientGateway interface {
+	// PutObject uploads the object in a single request.
+	PutObject(ctx context.Context, object Object, data []byte) error
+	// CreateMultipartUpload starts a multipart upload and returns its ID.
+	CreateMultipartUpload(ctx context.Context, object Object) (string, error)
+	// UploadPart uploads a part of a multipart upload and returns its ETag.
+	// Part numbers start at 1.
+	UploadPart(ctx context.Context, bucket, key, uploadID string, partNumber int32, data []byte) (string, error)
+	// CompleteMultipartUpload creates the object from the uploaded parts.
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) error
+	// AbortMultipartUpload discards the uploaded parts.
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error
+}
+
+// Object is the location and attributes of an object being written.
+type Object struct {
+	Bucket          string
+	Key             string
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+}
+
+// CompletedPart is an uploaded part of a multipart upload.
+type CompletedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+// SinkMessage is the input for the S3 Sink
+type SinkMessage struct {
+	Data     []byte
+	Key      string
+	Bucket   string
+	Metadata map[string]string
+
+	// ContentEncoding is the object content encoding, like "gzip". Optional.
+	ContentEncoding string
+}
+
+// s3ParallelWriter is a pipeline.Sink that writes messages to S3 in parallel.
+type s3ParallelWriter struct {
+	clientGateway        S3ClientGateway
+	contentType          string
+	partSize             int
+	maxConcurrentUploads int
+}
+
+// MustNewParallel creates a new pipeline sink that writes messages to S3 or
+// any S3 compatible storage, like MinIO. Objects larger than the part size
+// are uploaded with multipart uploads. It panics if clientGateway,
+// contentType or the options are invalid. Order of the messages is not
+// guaranteed.
+func MustNewParallel(clientGateway S3ClientGateway, contentType string, options ...Option) pipeline.Sink {
+	if clientGateway == nil {
+		panic("clientGateway is nil")
+	}
+
+	if contentType == "" {
+		panic("missing content type")
+	}
+
+	w := &s3ParallelWriter{
+		clientGateway:        clientGateway,
+		contentType:          contentType,
+		partSize:             defaultPartSize,
+		maxConcurrentUploads: defaultMaxConcurrent,
+	}
+	for _, opt := range options {
+		opt(w)
+	}
+
+	if w.partSize < minPartSize {
+		panic("part size must be at least 5 MiB")
+	}
+
+	if w.maxConcurrentUploads < 1 {
+		panic("invalid max concurrent uploads")
+	}
+
+	return w
+}
+
+// Store implements the pipeline.Sink interface. It writes a batch of messages in parallel.
+// If any of the messages fail to be written, it returns an error. Order of the messages is not guaranteed.
+func (w *s3ParallelWriter) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
+	const op = errors.Op("s3sink.s3ParallelWriter.Store")
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// uploads limits the requests in flight, shared by objects and parts.
+	uploads := make(chan struct{}, w.maxConcurrentUploads)
+
+	g := &errgroup.Group{}
+	errChan := make(chan error, len(messages))
+
+	for _, message := range messages {
+		g.Go(func() error {
+			defer panicToError(&errChan)
+
+			sinkMsg, ok := message.(SinkMessage)
+			if !ok {
+				errChan <- errors.E(ErrInvalidSinkMessage, CodeWrongTypeSinkMessage, errors.SeverityInput)
+				return nil
+			}
+
+			if sinkMsg.Data == nil {
+				errChan <- errors.E(ErrInvalidSinkMessage, CodeEmptyDataSinkMessage, errors.SeverityInput)
+				return nil
+			}
+
+			if sinkMsg.Bucket == "" || sinkMsg.Key == "" {
+				errChan <- errors.E(ErrInvalidSinkMessage, CodeEmptyLocationSinkMessage, errors.SeverityInput)
+				return nil
+			}
+
+			errChan <- w.write(ctx, sinkMsg, uploads)
+
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+
+	var sliceErrs []error
+	for range messages {
+		if e := <-errChan; e != nil {
+			sliceErrs = append(sliceErrs, e)
+		}
+	}
+
+	close(errChan)
+
+	if len(sliceErrs) > 0 {
+		return errors.E(op, ErrFailedToStoreMessages, severityOf(sliceErrs), errors.KV("errors", sliceErrs))
+	}
+
+	return nil
+}
+
+// write uploads a single message, in parts if it is larger than the part
+// size.
+func (w *s3ParallelWriter) write(ctx context.Context, sinkMsg SinkMessage, uploads chan struct{}) error {
+	object := Object{
+		Bucket:          sinkMsg.Bucket,
+		Key:             sinkMsg.Key,
+		ContentType:     w.contentType,
+		ContentEncoding: sinkMsg.ContentEncoding,
+		Metadata:        sinkMsg.Metadata,
+	}
+
+	if len(sinkMsg.Data) <= w.partSize {
+		uploads <- struct{}{}
+		defer func() { <-uploads }()
+
+		if err := w.clientGateway.PutObject(ctx, object, sinkMsg.Data); err != nil {
+			return errors.E(err, CodeFailedToPutObject, errors.KV("bucket", object.Bucket), errors.KV("key", object.Key))
+		}
+		return nil
+	}
+
+	if err := w.writeMultipart(ctx, object, sinkMsg.Data, uploads); err != nil {
+		return errors.E(err, CodeFailedToUploadPart, errors.KV("bucket", object.Bucket), errors.KV("key", object.Key))
+	}
+	return nil
+}
+
+// writeMultipart uploads the parts in parallel. If any part fails, the
+// upload is aborted so the parts are not kept in the bucket.
+func (w *s3ParallelWriter) writeMultipart(ctx context.Context, object Object, data []byte, uploads chan struct{}) error {
+	uploadID, err := w.clientGateway.CreateMultipartUpload(ctx, object)
+	if err != nil {
+		return err
+	}
+
+	parts := make([]CompletedPart, (len(data)+w.partSize-1)/w.partSize)
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range parts {
+		start := i * w.partSize
+		end := min(start+w.partSize, len(data))
+		partNumber := int32(i + 1)
+
+		g.Go(func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = errors.E(ErrPanic, CodePanic, errors.KV("panic", r))
+				}
+			}()
+
+			select {
+			case uploads <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-uploads }()
+
+			etag, err := w.clientGateway.UploadPart(gctx, object.Bucket, object.Key, uploadID, partNumber, data[start:end])
+			if err != nil {
+				return errors.E(err, errors.KV("part", partNumber))
+			}
+			parts[i] = CompletedPart{PartNumber: partNumber, ETag: etag}
+			return nil
+		})
+	}
+
+	err = g.Wait()
+	if err == nil {
+		err = w.clientGateway.CompleteMultipartUpload(ctx, object.Bucket, object.Key, uploadID, parts)
+	}
+	if err != nil {
+		// The abort must happen even if the context was canceled.
+		_ = w.clientGateway.AbortMultipartUpload(context.WithoutCancel(ctx), object.Bucket, object.Key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// severityOf returns input if all errors are input errors, so the messages
+// can go to a DLQ. Otherwise the batch should be retried.
+func severityOf(errs []error) errors.Severity {
+	for _, err := range errs {
+		if errors.GetSeverity(err) != errors.SeverityInput {
+			return errors.SeverityRuntime
+		}
+	}
+	return errors.SeverityInput
+}
+
+func panicToError(errChan *chan error) {
+	if r := recover(); r != nil {
+		*errChan <- errors.E(ErrPanic, CodePanic, errors.KV("panic", r))
+	}
+}
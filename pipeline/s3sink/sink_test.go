@@ -0,0 +1,217 @@
+package s3sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryGateway is an in-memory S3ClientGateway.
+type memoryGateway struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	attrs    map[string]Object
+	uploads  map[string]map[int32][]byte
+	aborted  []string
+	nextID   int
+	failPart int32
+	panicKey string
+
+	inFlight    int32
+	maxInFlight int32
+}
+
+func newMemoryGateway() *memoryGateway {
+	return &memoryGateway{
+		objects: map[string][]byte{},
+		attrs:   map[string]Object{},
+		uploads: map[string]map[int32][]byte{},
+	}
+}
+
+func (g *memoryGateway) track() func() {
+	n := atomic.AddInt32(&g.inFlight, 1)
+	for {
+		maxInFlight := atomic.LoadInt32(&g.maxInFlight)
+		if n <= maxInFlight || atomic.CompareAndSwapInt32(&g.maxInFlight, maxInFlight, n) {
+			break
+		}
+	}
+	return func() { atomic.AddInt32(&g.inFlight, -1) }
+}
+
+func (g *memoryGateway) PutObject(_ context.Context, object Object, data []byte) error {
+	defer g.track()()
+	if object.Key == g.panicKey {
+		panic("put failed")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.objects[object.Bucket+"/"+object.Key] = data
+	g.attrs[object.Bucket+"/"+object.Key] = object
+	return nil
+}
+
+func (g *memoryGateway) CreateMultipartUpload(_ context.Context, object Object) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nextID++
+	uploadID := fmt.Sprint(g.nextID)
+	g.uploads[uploadID] = map[int32][]byte{}
+	g.attrs[object.Bucket+"/"+object.Key] = object
+	return uploadID, nil
+}
+
+func (g *memoryGateway) UploadPart(_ context.Context, _, _, uploadID string, partNumber int32, data []byte) (string, error) {
+	defer g.track()()
+	if partNumber == g.failPart {
+		return "", errors.E("part failed", errors.SeverityRuntime)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.uploads[uploadID][partNumber] = data
+	return fmt.Sprintf("etag-%d", partNumber), nil
+}
+
+func (g *memoryGateway) CompleteMultipartUpload(_ context.Context, bucket, key, uploadID string, parts []CompletedPart) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var data []byte
+	for i, part := range parts {
+		if part.PartNumber != int32(i+1) || part.ETag != fmt.Sprintf("etag-%d", part.PartNumber) {
+			return errors.E("invalid part", errors.SeverityInput)
+		}
+		data = append(data, g.uploads[uploadID][part.PartNumber]...)
+	}
+	g.objects[bucket+"/"+key] = data
+	delete(g.uploads, uploadID)
+	return nil
+}
+
+func (g *memoryGateway) AbortMultipartUpload(_ context.Context, _, _, uploadID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.uploads, uploadID)
+	g.aborted = append(g.aborted, uploadID)
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	gateway := newMemoryGateway()
+	sink := MustNewParallel(gateway, "application/json", WithPartSize(minPartSize), WithMaxConcurrentUploads(2))
+
+	large := bytes.Repeat([]byte("0123456789"), (2*minPartSize+100)/10)
+	err := sink.Store(context.Background(),
+		SinkMessage{Bucket: "bucket", Key: "small", Data: []byte("{}"), Metadata: map[string]string{"a": "b"}, ContentEncoding: "gzip"},
+		SinkMessage{Bucket: "bucket", Key: "large", Data: large},
+		SinkMessage{Bucket: "bucket", Key: "empty", Data: []byte{}},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("{}"), gateway.objects["bucket/small"])
+	assert.Equal(t, Object{
+		Bucket:          "bucket",
+		Key:             "small",
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		Metadata:        map[string]string{"a": "b"},
+	}, gateway.attrs["bucket/small"])
+	assert.Equal(t, large, gateway.objects["bucket/large"])
+	assert.Equal(t, []byte{}, gateway.objects["bucket/empty"])
+	assert.Empty(t, gateway.uploads)
+	assert.LessOrEqual(t, gateway.maxInFlight, int32(2))
+}
+
+func TestStore_Errors(t *testing.T) {
+	gateway := newMemoryGateway()
+	gateway.failPart = 2
+	gateway.panicKey = "panic"
+	sink := MustNewParallel(gateway, "application/json", WithPartSize(minPartSize))
+
+	err := sink.Store(context.Background(),
+		SinkMessage{Bucket: "bucket", Key: "large", Data: make([]byte, 3*minPartSize)},
+		SinkMessage{Bucket: "bucket", Key: "panic", Data: []byte("{}")},
+		SinkMessage{Bucket: "bucket", Data: []byte("{}")},
+		"wrong type",
+	)
+
+	assert.ErrorIs(t, err, ErrFailedToStoreMessages)
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+
+	var codes []string
+	for _, e := range getKV(err, "errors").([]error) {
+		codes = append(codes, string(errors.GetCode(e)))
+	}
+	sort.Strings(codes)
+	assert.Equal(t, []string{
+		string(CodeEmptyLocationSinkMessage),
+		string(CodeFailedToUploadPart),
+		string(CodePanic),
+		string(CodeWrongTypeSinkMessage),
+	}, codes)
+
+	assert.Equal(t, []string{"1"}, gateway.aborted)
+	assert.Empty(t, gateway.uploads)
+}
+
+func TestStore_InputErrors(t *testing.T) {
+	sink := MustNewParallel(newMemoryGateway(), "application/json")
+
+	err := sink.Store(context.Background(), SinkMessage{Bucket: "bucket", Key: "key"})
+
+	assert.ErrorIs(t, err, ErrFailedToStoreMessages)
+	assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+}
+
+func TestMustNewParallel(t *testing.T) {
+	tests := []struct {
+		name      string
+		gateway   S3ClientGateway
+		options   []Option
+		wantPanic bool
+	}{
+		{name: "valid", gateway: newMemoryGateway()},
+		{name: "nil gateway", wantPanic: true},
+		{name: "small part size", gateway: newMemoryGateway(), options: []Option{WithPartSize(1 << 20)}, wantPanic: true},
+		{name: "no concurrency", gateway: newMemoryGateway(), options: []Option{WithMaxConcurrentUploads(0)}, wantPanic: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newSink := func() pipeline.Sink { return MustNewParallel(test.gateway, "text/plain", test.options...) }
+			if test.wantPanic {
+				assert.Panics(t, func() { newSink() })
+			} else {
+				assert.NotPanics(t, func() { newSink() })
+			}
+		})
+	}
+}
+
+// getKV returns the value of the key in the first error of the chain with it.
+func getKV(err error, key string) interface{} {
+	for {
+		e, ok := err.(errors.Error)
+		if !ok {
+			return nil
+		}
+		for _, kv := range e.KVs {
+			if kv.Key == key {
+				return kv.Value
+			}
+		}
+		err = e.Err
+	}
+}
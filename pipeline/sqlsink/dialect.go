@@ -0,0 +1,170 @@
+package sqlsink
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect builds the upsert statements of a database.
+type Dialect interface {
+	// Upsert returns a statement that inserts rows with the given columns
+	// into table. Rows whose keyColumns conflict with existing rows update
+	// the other columns instead. If keyColumns is empty, it is a plain
+	// insert. Arguments are passed row by row, in the columns order.
+	Upsert(table string, columns, keyColumns []string, rows int) string
+	// MaxParameters is the maximum number of arguments of a statement.
+	MaxParameters() int
+}
+
+var (
+	// Postgres builds INSERT ... ON CONFLICT statements with $n placeholders.
+	// The key columns must have a unique index.
+	Postgres Dialect = onConflictDialect{
+		placeholder:   func(n int) string { return "$" + strconv.Itoa(n) },
+		maxParameters: 65535,
+	}
+
+	// SQLite builds INSERT ... ON CONFLICT statements with ? placeholders.
+	// It requires SQLite 3.24 or newer. The key columns must have a unique
+	// index.
+	SQLite Dialect = onConflictDialect{
+		placeholder:   func(int) string { return "?" },
+		maxParameters: 32766,
+	}
+
+	// MySQL builds INSERT ... ON DUPLICATE KEY UPDATE statements. MySQL
+	// updates on any unique key conflict, so keyColumns only tell which
+	// columns are not updated.
+	MySQL Dialect = mysqlDialect{}
+)
+
+// onConflictDialect is the dialect of databases with the ON CONFLICT
+// clause.
+type onConflictDialect struct {
+	placeholder   func(n int) string
+	maxParameters int
+}
+
+func (d onConflictDialect) Upsert(table string, columns, keyColumns []string, rows int) string {
+	var sb strings.Builder
+	writeInsert(&sb, quoteIdentifier(table, '"'), columns, rows, '"', d.placeholder)
+	if len(keyColumns) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString(" ON CONFLICT (")
+	writeColumns(&sb, keyColumns, '"')
+	sb.WriteString(")")
+
+	updated := nonKeyColumns(columns, keyColumns)
+	if len(updated) == 0 {
+		sb.WriteString(" DO NOTHING")
+		return sb.String()
+	}
+
+	sb.WriteString(" DO UPDATE SET ")
+	for i, column := range updated {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		quoted := quoteIdentifier(column, '"')
+		sb.WriteString(quoted + " = excluded." + quoted)
+	}
+	return sb.String()
+}
+
+func (d onConflictDialect) MaxParameters() int {
+	return d.maxParameters
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Upsert(table string, columns, keyColumns []string, rows int) string {
+	var sb strings.Builder
+	writeInsert(&sb, quoteIdentifier(table, '`'), columns, rows, '`', func(int) string { return "?" })
+	if len(keyColumns) == 0 {
+		return sb.String()
+	}
+
+	updated := nonKeyColumns(columns, keyColumns)
+	if len(updated) == 0 {
+		// Updating a key to itself is a no-op, like DO NOTHING, without
+		// ignoring other errors as INSERT IGNORE does.
+		updated = keyColumns[:1]
+	}
+
+	sb.WriteString(" ON DUPLICATE KEY UPDATE ")
+	for i, column := range updated {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		quoted := quoteIdentifier(column, '`')
+		sb.WriteString(quoted + " = VALUES(" + quoted + ")")
+	}
+	return sb.String()
+}
+
+func (mysqlDialect) MaxParameters() int {
+	return 65535
+}
+
+func writeInsert(sb *strings.Builder, table string, columns []string, rows int, quote byte, placeholder func(int) string) {
+	sb.WriteString("INSERT INTO " + table + " (")
+	writeColumns(sb, columns, quote)
+	sb.WriteString(") VALUES ")
+
+	n := 0
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(")
+		for i := range columns {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			n++
+			sb.WriteString(placeholder(n))
+		}
+		sb.WriteString(")")
+	}
+}
+
+func writeColumns(sb *strings.Builder, columns []string, quote byte) {
+	for i, column := range columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteIdentifier(column, quote))
+	}
+}
+
+// quoteIdentifier quotes each part of a possibly qualified name, like
+// schema.table.
+func quoteIdentifier(name string, quote byte) string {
+	q := string(quote)
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = q + strings.ReplaceAll(part, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+func nonKeyColumns(columns, keyColumns []string) []string {
+	var result []string
+	for _, column := range columns {
+		if !contains(keyColumns, column) {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package sqlsink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect_Upsert(t *testing.T) {
+	tests := []struct {
+		name       string
+		dialect    Dialect
+		columns    []string
+		keyColumns []string
+		expected   string
+	}{
+		{
+			name:       "Postgres",
+			dialect:    Postgres,
+			columns:    []string{"id", "name", "value"},
+			keyColumns: []string{"id"},
+			expected: `INSERT INTO "public"."items" ("id", "name", "value") VALUES ($1, $2, $3), ($4, $5, $6)` +
+				` ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name", "value" = excluded."value"`,
+		},
+		{
+			name:       "Postgres only keys",
+			dialect:    Postgres,
+			columns:    []string{"id"},
+			keyColumns: []string{"id"},
+			expected:   `INSERT INTO "public"."items" ("id") VALUES ($1), ($2) ON CONFLICT ("id") DO NOTHING`,
+		},
+		{
+			name:     "SQLite insert",
+			dialect:  SQLite,
+			columns:  []string{"id", "name"},
+			expected: `INSERT INTO "public"."items" ("id", "name") VALUES (?, ?), (?, ?)`,
+		},
+		{
+			name:       "MySQL",
+			dialect:    MySQL,
+			columns:    []string{"id", "name"},
+			keyColumns: []string{"id"},
+			expected: "INSERT INTO `public`.`items` (`id`, `name`) VALUES (?, ?), (?, ?)" +
+				" ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)",
+		},
+		{
+			name:       "MySQL only keys",
+			dialect:    MySQL,
+			columns:    []string{"id"},
+			keyColumns: []string{"id"},
+			expected:   "INSERT INTO `public`.`items` (`id`) VALUES (?), (?) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.dialect.Upsert("public.items", test.columns, test.keyColumns, 2))
+		})
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, `"we""ird"."table"`, quoteIdentifier(`we"ird.table`, '"'))
+}
@@ -0,0 +1,49 @@
+package sqlsink
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnknownMessageType is returned when the sink message received is
+	// not of the type Message.
+	ErrUnknownMessageType = errors.New("unknown message type: expected sqlsink.Message")
+
+	// ErrEmptyTable is returned when the Message.Table is empty.
+	ErrEmptyTable = errors.New("table is missing from the message")
+
+	// ErrEmptyValues is returned when the Message.Values is empty.
+	ErrEmptyValues = errors.New("values are missing from the message")
+
+	// ErrMissingKeyColumn is returned when a column of Message.KeyColumns
+	// is not in Message.Values.
+	ErrMissingKeyColumn = errors.New("key column is missing from the message values")
+
+	// ErrStoreFailed is returned when the transaction failed.
+	ErrStoreFailed = errors.New("failed to store messages")
+)
+
+// sqliteInputErrors are the primary result codes of SQLite caused by the
+// rows: SQLITE_TOOBIG, SQLITE_CONSTRAINT and SQLITE_MISMATCH.
+var sqliteInputErrors = map[int]bool{18: true, 19: true, 20: true}
+
+// IsConstraintOrDataError tells if err is a constraint violation or an
+// invalid value. It knows the errors of drivers that report the SQLSTATE
+// with a SQLState method, like pgx and lib/pq, where the classes 22 (data
+// exception) and 23 (integrity constraint violation) are input errors, and
+// the errors of modernc.org/sqlite. For other drivers, like MySQL's, use
+// WithInputErrors.
+func IsConstraintOrDataError(err error) bool {
+	var sqlStateErr interface{ SQLState() string }
+	if errors.As(err, &sqlStateErr) {
+		state := sqlStateErr.SQLState()
+		return strings.HasPrefix(state, "22") || strings.HasPrefix(state, "23")
+	}
+
+	var codeErr interface{ Code() int }
+	if errors.As(err, &codeErr) {
+		return sqliteInputErrors[codeErr.Code()&0xff]
+	}
+	return false
+}
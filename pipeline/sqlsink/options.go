@@ -0,0 +1,33 @@
+package sqlsink
+
+import "database/sql"
+
+// Option configures the sql sink.
+type Option func(*sqlSink)
+
+// WithIsolationLevel sets the isolation level of the transaction of each
+// Store. The default is sql.LevelDefault, the database default.
+func WithIsolationLevel(level sql.IsolationLevel) Option {
+	return func(s *sqlSink) {
+		s.isolationLevel = level
+	}
+}
+
+// WithMaxRowsPerStatement limits how many rows are sent in a single
+// statement. The default is 500. Statements are also limited by the
+// maximum number of parameters of the dialect.
+func WithMaxRowsPerStatement(rows int) Option {
+	return func(s *sqlSink) {
+		s.maxRowsPerStatement = rows
+	}
+}
+
+// WithInputErrors sets the function that tells which statement errors are
+// caused by the rows, like constraint violations, so they get
+// errors.SeverityInput and are not retried. The default is
+// IsConstraintOrDataError.
+func WithInputErrors(isInputError func(err error) bool) Option {
+	return func(s *sqlSink) {
+		s.isInputError = isInputError
+	}
+}
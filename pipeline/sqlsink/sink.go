@@ -0,0 +1,291 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/arquivei/goduck/pipeline"
+)
+
+const defaultMaxRowsPerStatement = 500
+
+// Message is the input for the sql sink. It is a row to be upserted.
+type Message struct {
+	// Table is the table name. It may be qualified, like schema.table.
+	Table string
+	// KeyColumns are the columns that identify the row. If a row with the
+	// same key exists, its other columns are updated. If empty, the row is
+	// always inserted.
+	KeyColumns []string
+	// Values are the row values by column name. They must contain the key
+	// columns.
+	Values map[string]interface{}
+}
+
+type sqlSink struct {
+	db      *sql.DB
+	dialect Dialect
+
+	isolationLevel      sql.IsolationLevel
+	maxRowsPerStatement int
+	isInputError        func(err error) bool
+}
+
+// MustNew returns a new Sink that upserts rows into a SQL database, like
+// Postgres or MySQL, using the given dialect.
+//
+// Messages are grouped by table and key columns, and each group is sent in
+// multi-row statements. If the same key appears more than once, the values
+// of the messages are merged and the last message wins, as if they were
+// upserted one by one. All statements of a Store run in a single
+// transaction, so either all messages are stored or none is.
+//
+// Errors of rows the database refuses, like constraint violations or
+// invalid values, have errors.SeverityInput, so they are not retried. See
+// WithInputErrors.
+func MustNew(db *sql.DB, dialect Dialect, options ...Option) pipeline.Sink {
+	if db == nil {
+		panic("sql db is nil")
+	}
+	if dialect == nil {
+		panic("sql dialect is nil")
+	}
+
+	s := &sqlSink{
+		db:                  db,
+		dialect:             dialect,
+		isolationLevel:      sql.LevelDefault,
+		maxRowsPerStatement: defaultMaxRowsPerStatement,
+		isInputError:        IsConstraintOrDataError,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	if s.maxRowsPerStatement < 1 {
+		panic("max rows per statement must be positive")
+	}
+
+	return s
+}
+
+// Store upserts all messages in a single transaction.
+func (s *sqlSink) Store(ctx context.Context, messages ...pipeline.SinkMessage) error {
+	const op = errors.Op("sqlsink.sqlSink.Store")
+
+	groups, err := groupMessages(messages)
+	if err != nil {
+		return errors.E(op, err, errors.SeverityInput)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: s.isolationLevel})
+	if err != nil {
+		return errors.E(op, ErrStoreFailed, errors.SeverityRuntime, errors.KV("cause", err))
+	}
+
+	for _, g := range groups {
+		if err := s.upsert(ctx, tx, g); err != nil {
+			_ = tx.Rollback()
+			return errors.E(op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.E(op, ErrStoreFailed, errors.SeverityRuntime, errors.KV("cause", err))
+	}
+	return nil
+}
+
+// upsert sends the group rows in as few statements as possible.
+func (s *sqlSink) upsert(ctx context.Context, tx *sql.Tx, g *group) error {
+	const op = errors.Op("sqlsink.sqlSink.upsert")
+
+	rowsPerStatement := s.dialect.MaxParameters() / len(g.columns)
+	if rowsPerStatement > s.maxRowsPerStatement {
+		rowsPerStatement = s.maxRowsPerStatement
+	}
+
+	for start := 0; start < len(g.rows); start += rowsPerStatement {
+		end := start + rowsPerStatement
+		if end > len(g.rows) {
+			end = len(g.rows)
+		}
+
+		args := make([]interface{}, 0, (end-start)*len(g.columns))
+		for _, row := range g.rows[start:end] {
+			args = append(args, row...)
+		}
+
+		query := s.dialect.Upsert(g.table, g.columns, g.keyColumns, end-start)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			severity := errors.SeverityRuntime
+			if s.isInputError(err) {
+				severity = errors.SeverityInput
+			}
+			return errors.E(op, ErrStoreFailed, severity,
+				errors.KV("cause", err),
+				errors.KV("table", g.table),
+			)
+		}
+	}
+	return nil
+}
+
+// group is a set of rows with the same table and columns.
+type group struct {
+	table      string
+	columns    []string
+	keyColumns []string
+	rows       [][]interface{}
+}
+
+// tableRows are the rows of a table with the same key columns. The values
+// of the messages with the same key are merged, so a single statement
+// changes each row.
+type tableRows struct {
+	table      string
+	keyColumns []string
+	rows       []map[string]interface{}
+	// rowByKey is the position of each key in rows.
+	rowByKey map[string]int
+}
+
+// groupMessages groups the messages by table and columns, in the order they
+// first appear.
+func groupMessages(messages []pipeline.SinkMessage) ([]*group, error) {
+	const op = errors.Op("sqlsink.groupMessages")
+
+	var tables []*tableRows
+	byName := make(map[string]*tableRows)
+
+	for _, m := range messages {
+		message, ok := m.(Message)
+		if !ok {
+			return nil, errors.E(op, ErrUnknownMessageType)
+		}
+		if err := checkMessage(message); err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		name := message.Table + "\x00" + strings.Join(message.KeyColumns, "\x00")
+		t := byName[name]
+		if t == nil {
+			t = &tableRows{
+				table:      message.Table,
+				keyColumns: message.KeyColumns,
+				rowByKey:   make(map[string]int),
+			}
+			byName[name] = t
+			tables = append(tables, t)
+		}
+
+		t.add(message)
+	}
+
+	var groups []*group
+	for _, t := range tables {
+		groups = append(groups, t.groups()...)
+	}
+	return groups, nil
+}
+
+// add adds the message row. If a row with the same key was already added,
+// the message values are merged into it, replacing the values of the same
+// columns. This is the same as upserting the messages one by one, so the
+// last message wins.
+func (t *tableRows) add(message Message) {
+	if len(t.keyColumns) == 0 {
+		t.rows = append(t.rows, message.Values)
+		return
+	}
+
+	keyValues := make([]interface{}, len(t.keyColumns))
+	for i, column := range t.keyColumns {
+		keyValues[i] = indirect(message.Values[column])
+	}
+	key := fmt.Sprintf("%#v", keyValues)
+
+	i, ok := t.rowByKey[key]
+	if !ok {
+		t.rowByKey[key] = len(t.rows)
+		t.rows = append(t.rows, make(map[string]interface{}, len(message.Values)))
+		i = len(t.rows) - 1
+	}
+	for column, value := range message.Values {
+		t.rows[i][column] = value
+	}
+}
+
+// groups splits the rows by their columns, in the order they first appear.
+func (t *tableRows) groups() []*group {
+	var groups []*group
+	byColumns := make(map[string]*group)
+
+	for _, values := range t.rows {
+		columns := make([]string, 0, len(values))
+		for column := range values {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		name := strings.Join(columns, "\x00")
+		g := byColumns[name]
+		if g == nil {
+			g = &group{
+				table:      t.table,
+				columns:    columns,
+				keyColumns: t.keyColumns,
+			}
+			byColumns[name] = g
+			groups = append(groups, g)
+		}
+
+		row := make([]interface{}, len(columns))
+		for i, column := range columns {
+			row[i] = values[column]
+		}
+		g.rows = append(g.rows, row)
+	}
+	return groups
+}
+
+// indirect dereferences pointers, so keys given by pointers are compared by
+// their values.
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+func checkMessage(m Message) error {
+	const op = errors.Op("sqlsink.checkMessage")
+
+	if m.Table == "" {
+		return errors.E(op, ErrEmptyTable)
+	}
+	if len(m.Values) == 0 {
+		return errors.E(op, ErrEmptyValues)
+	}
+	for _, column := range m.KeyColumns {
+		if _, ok := m.Values[column]; !ok {
+			return errors.E(op, ErrMissingKeyColumn, errors.KV("column", column))
+		}
+	}
+	return nil
+}
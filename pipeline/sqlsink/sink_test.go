@@ -0,0 +1,194 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/arquivei/goduck/pipeline"
+
+	"github.com/arquivei/foundationkit/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	// Each connection to :memory: is a different database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, quantity INTEGER CHECK (quantity >= 0));
+		CREATE TABLE events (kind TEXT, value INTEGER);
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+type item struct {
+	ID       int64
+	Name     string
+	Quantity sql.NullInt64
+}
+
+func readItems(t *testing.T, db *sql.DB) []item {
+	rows, err := db.Query(`SELECT id, name, quantity FROM items ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var items []item
+	for rows.Next() {
+		var i item
+		require.NoError(t, rows.Scan(&i.ID, &i.Name, &i.Quantity))
+		items = append(items, i)
+	}
+	require.NoError(t, rows.Err())
+	return items
+}
+
+func itemMessage(values map[string]interface{}) Message {
+	return Message{Table: "items", KeyColumns: []string{"id"}, Values: values}
+}
+
+func TestStore(t *testing.T) {
+	db := newTestDB(t)
+	sink := MustNew(db, SQLite, WithMaxRowsPerStatement(2), WithIsolationLevel(sql.LevelSerializable))
+	ctx := context.Background()
+
+	require.NoError(t, sink.Store(ctx,
+		itemMessage(map[string]interface{}{"id": 1, "name": "a", "quantity": 1}),
+		itemMessage(map[string]interface{}{"id": 2, "name": "b", "quantity": 2}),
+		itemMessage(map[string]interface{}{"id": 3, "name": "c", "quantity": 3}),
+		Message{Table: "events", Values: map[string]interface{}{"kind": "created", "value": 1}},
+		Message{Table: "events", Values: map[string]interface{}{"kind": "created", "value": 1}},
+	))
+
+	require.NoError(t, sink.Store(ctx,
+		itemMessage(map[string]interface{}{"id": 1, "name": "a2", "quantity": 10}),
+		// Only the name is updated, the quantity is kept.
+		itemMessage(map[string]interface{}{"id": 2, "name": "b2"}),
+		// The last message of the same key wins.
+		itemMessage(map[string]interface{}{"id": 3, "name": "c2", "quantity": 30}),
+		itemMessage(map[string]interface{}{"id": 3, "name": "c3", "quantity": 31}),
+	))
+
+	assert.Equal(t, []item{
+		{ID: 1, Name: "a2", Quantity: sql.NullInt64{Int64: 10, Valid: true}},
+		{ID: 2, Name: "b2", Quantity: sql.NullInt64{Int64: 2, Valid: true}},
+		{ID: 3, Name: "c3", Quantity: sql.NullInt64{Int64: 31, Valid: true}},
+	}, readItems(t, db))
+
+	var events int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&events))
+	assert.Equal(t, 2, events)
+}
+
+func TestStore_SameKey(t *testing.T) {
+	db := newTestDB(t)
+	sink := MustNew(db, SQLite)
+	id1, id2 := int64(1), int64(1)
+
+	require.NoError(t, sink.Store(context.Background(),
+		itemMessage(map[string]interface{}{"id": 1, "name": "a", "quantity": 1}),
+		itemMessage(map[string]interface{}{"id": 1, "name": "b"}),
+		itemMessage(map[string]interface{}{"id": 1, "name": "c", "quantity": 3}),
+		// The message without quantity keeps the previous one.
+		itemMessage(map[string]interface{}{"id": 2, "name": "d", "quantity": 4}),
+		itemMessage(map[string]interface{}{"id": 2, "name": "e"}),
+	))
+	assert.Equal(t, []item{
+		{ID: 1, Name: "c", Quantity: sql.NullInt64{Int64: 3, Valid: true}},
+		{ID: 2, Name: "e", Quantity: sql.NullInt64{Int64: 4, Valid: true}},
+	}, readItems(t, db))
+
+	// Keys are compared by value, not by pointer.
+	groups, err := groupMessages([]pipeline.SinkMessage{
+		itemMessage(map[string]interface{}{"id": &id1, "name": "a"}),
+		itemMessage(map[string]interface{}{"id": &id2, "name": "b"}),
+	})
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, [][]interface{}{{&id2, "b"}}, groups[0].rows)
+}
+
+func TestStore_ConstraintError(t *testing.T) {
+	db := newTestDB(t)
+
+	err := MustNew(db, SQLite).Store(context.Background(),
+		itemMessage(map[string]interface{}{"id": 1, "name": "a", "quantity": -1}),
+	)
+	assert.ErrorIs(t, err, ErrStoreFailed)
+	assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+
+	isInputError := func(error) bool { return false }
+	err = MustNew(db, SQLite, WithInputErrors(isInputError)).Store(context.Background(),
+		itemMessage(map[string]interface{}{"id": 1, "name": "a", "quantity": -1}),
+	)
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+}
+
+func TestStore_Transaction(t *testing.T) {
+	db := newTestDB(t)
+	sink := MustNew(db, SQLite)
+
+	err := sink.Store(context.Background(),
+		itemMessage(map[string]interface{}{"id": 1, "name": "a"}),
+		Message{Table: "missing", Values: map[string]interface{}{"id": 1}},
+	)
+	assert.ErrorIs(t, err, ErrStoreFailed)
+	assert.Equal(t, errors.SeverityRuntime, errors.GetSeverity(err))
+	assert.Empty(t, readItems(t, db))
+}
+
+func TestStore_InvalidMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     pipeline.SinkMessage
+		expectedErr error
+	}{
+		{
+			name:        "Unknown type",
+			message:     "message",
+			expectedErr: ErrUnknownMessageType,
+		},
+		{
+			name:        "Empty table",
+			message:     Message{Values: map[string]interface{}{"id": 1}},
+			expectedErr: ErrEmptyTable,
+		},
+		{
+			name:        "Empty values",
+			message:     Message{Table: "items"},
+			expectedErr: ErrEmptyValues,
+		},
+		{
+			name:        "Missing key column",
+			message:     itemMessage(map[string]interface{}{"name": "a"}),
+			expectedErr: ErrMissingKeyColumn,
+		},
+	}
+
+	sink := MustNew(newTestDB(t), SQLite)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := sink.Store(context.Background(), test.message)
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, errors.SeverityInput, errors.GetSeverity(err))
+		})
+	}
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sql error " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsConstraintOrDataError(t *testing.T) {
+	assert.True(t, IsConstraintOrDataError(sqlStateError("23505")))
+	assert.True(t, IsConstraintOrDataError(errors.E(sqlStateError("22001"))))
+	assert.False(t, IsConstraintOrDataError(sqlStateError("40001")))
+	assert.False(t, IsConstraintOrDataError(sql.ErrConnDone))
+}